@@ -7,27 +7,33 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/admin"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/bigcache"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/configupdater"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/metrics"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/mongodb"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/node"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/notification"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/standalone"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/task"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/updater"
+	"github.com/Autumn-27/ScopeSentry-Scan/modules"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -38,14 +44,31 @@ import (
 )
 
 func main() {
+	// 输出版本，更新时用于检查新版本能否运行
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		fmt.Println(config.Version)
+		return
+	}
 	Banner()
+	// 单机扫描模式，不连接 mongodb 和 redis，运行完毕后退出
+	if len(os.Args) > 1 && os.Args[1] == "scan" {
+		os.Exit(standalone.Main(os.Args[2:]))
+	}
 	// 初始化系统信息
 	config.Initialize()
+	// 检查未确认的更新，新版本没有在超时时间内注册时回滚
+	updater.Resume()
 	var err error
 	// 初始化mongodb连接
-	mongodb.Initialize()
+	err = mongodb.Initialize()
+	if err != nil {
+		log.Fatalf("Failed to init mongodb: %v", err)
+	}
 	// 初始化redis连接
-	redis.Initialize()
+	err = redis.Initialize()
+	if err != nil {
+		log.Fatalf("Failed to init redis: %v", err)
+	}
 	// 初始化日志模块
 	err = logger.NewLogger()
 	if err != nil {
@@ -111,8 +134,22 @@ func main() {
 		log.Fatalf("Failed to init plugins: %v", err)
 		return
 	}
-	// 性能监控
-	go pprof()
+	// 初始化默认扫描流程图
+	err = pipeline.Initialize(filepath.Join(global.ConfigDir, "pipeline.yaml"))
+	if err == nil {
+		err = modules.ValidateGraph(pipeline.Default())
+	}
+	if err != nil {
+		log.Fatalf("Failed to init pipeline: %v", err)
+		return
+	}
+	// 收到停止信号后停止节点
+	go handleSignals()
+	// 节点管理接口，pprof 也在管理接口中，需要 token 认证
+	admin.Serve()
+	// Prometheus 指标接口，配置了监听地址时开启
+	node.RegisterMetrics()
+	metrics.Serve(global.AppConfig.MetricsAddr)
 	//go printMemStats(5 * time.Second)
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -140,25 +177,82 @@ func main() {
 	wg.Wait()
 }
 
-func Banner() {
-	banner := "   _____                         _____            _              \n  / ____|                       / ____|          | |             \n | (___   ___ ___  _ __   ___  | (___   ___ _ __ | |_ _ __ _   _ \n  \\___ \\ / __/ _ \\| '_ \\ / _ \\  \\___ \\ / _ \\ '_ \\| __| '__| | | |\n  ____) | (_| (_) | |_) |  __/  ____) |  __/ | | | |_| |  | |_| |\n |_____/ \\___\\___/| .__/ \\___| |_____/ \\___|_| |_|\\__|_|   \\__, |\n                  | |                                       __/ |\n                  |_|                                      |___/ "
-	fmt.Println(banner)
+// cancelWait 取消任务后等待模块退出并写入检查点的时间
+const cancelWait = 10 * time.Second
+
+// adminShutdownWait 关闭管理接口时等待正在处理的请求的时间
+const adminShutdownWait = 5 * time.Second
+
+// handleSignals 收到 SIGINT、SIGTERM 或节点内部的停止请求（例如更新后重启）后停止节点，停止过程中再次收到信号时立即退出
+func handleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	var reason string
+	select {
+	case sig := <-sigs:
+		reason = sig.String()
+	case reason = <-shutdown.Requested():
+	}
+	go func() {
+		<-sigs
+		logger.SlogWarnLocal("received second signal, exit without cleanup")
+		os.Exit(1)
+	}()
+	gracefulShutdown(reason)
+	os.Exit(0)
 }
 
-func pprof() {
-	if global.AppConfig.Debug {
-		go func() {
-			_ = http.ListenAndServe("0.0.0.0:6060", nil)
-		}()
-		//go DebugMem()
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+// gracefulShutdown 不再获取新任务，等待正在运行的目标完成，超时后取消目标，
+// 结束外部程序，写入队列中剩余的结果和通知，最后关闭本地缓存，中断的任务重启后继续运行
+func gracefulShutdown(reason string) {
+	if !shutdown.Begin() {
+		return
+	}
+	grace := config.ShutdownGrace()
+	logger.SlogInfo(fmt.Sprintf("received %v, node %v stopping, waiting %v for running targets", reason, global.AppConfig.NodeName, grace))
+	node.MarkStopping()
+	if !waitTasks(grace) {
+		logger.SlogInfo(fmt.Sprintf("%v tasks not finished in %v, cancel running targets", pool.TaskQueue.Len(), grace))
+		contextmanager.GlobalContextManagers.CancelAllContexts()
+		if count := utils.Processes.KillAll(); count != 0 {
+			logger.SlogInfoLocal(fmt.Sprintf("killed %v external processes", count))
+		}
+		if !waitTasks(cancelWait) {
+			logger.SlogWarnLocal(fmt.Sprintf("%v tasks not stopped in %v", pool.TaskQueue.Len(), cancelWait))
+		}
+	}
+	if count := utils.Processes.KillAll(); count != 0 {
+		logger.SlogInfoLocal(fmt.Sprintf("killed %v external processes", count))
+	}
+	// 任务结束后关闭管理接口，停止过程中仍可以通过管理接口查看和取消任务
+	ctx, cancel := context.WithTimeout(context.Background(), adminShutdownWait)
+	admin.Shutdown(ctx)
+	cancel()
+	// 写入结果队列和通知队列中剩余的数据
+	results.Close()
+	notification.Flush()
+	err := pebbledb.PebbleStore.Close()
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore close error: %v", err))
+	}
+	logger.SlogInfoLocal("node stopped")
+}
 
-		go func() {
-			sig := <-sigs
-			fmt.Println("收到终止信号:", sig)
-		}()
+// waitTasks 等待所有任务结束，超时返回 false
+func waitTasks(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for pool.TaskQueue.Len() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(500 * time.Millisecond)
 	}
+	return true
+}
+
+func Banner() {
+	banner := "   _____                         _____            _              \n  / ____|                       / ____|          | |             \n | (___   ___ ___  _ __   ___  | (___   ___ _ __ | |_ _ __ _   _ \n  \\___ \\ / __/ _ \\| '_ \\ / _ \\  \\___ \\ / _ \\ '_ \\| __| '__| | | |\n  ____) | (_| (_) | |_) |  __/  ____) |  __/ | | | |_| |  | |_| |\n |_____/ \\___\\___/| .__/ \\___| |_____/ \\___|_| |_|\\__|_|   \\__, |\n                  | |                                       __/ |\n                  |_|                                      |___/ "
+	fmt.Println(banner)
 }
 
 func printMemStats(interval time.Duration) {
@@ -39,9 +39,15 @@ func main() {
 	global.VERSION = "1.5"
 	var err error
 	// 初始化mongodb连接
-	mongodb.Initialize()
+	err = mongodb.Initialize()
+	if err != nil {
+		log.Fatalf("Failed to init mongodb: %v", err)
+	}
 	// 初始化redis连接
-	redis.Initialize()
+	err = redis.Initialize()
+	if err != nil {
+		log.Fatalf("Failed to init redis: %v", err)
+	}
 	// 初始化日志模块
 	err = logger.NewLogger()
 	if err != nil {
@@ -67,6 +67,7 @@ require (
 	github.com/projectdiscovery/retryabledns v1.0.86
 	github.com/projectdiscovery/subfinder/v2 v2.0.0-00010101000000-000000000000
 	github.com/projectdiscovery/tlsx v1.1.8
+	github.com/prometheus/client_golang v1.14.0
 	github.com/redis/go-redis/v9 v9.5.1
 	github.com/sergi/go-diff v1.2.0
 	github.com/shirou/gopsutil v3.21.11+incompatible
@@ -312,7 +313,6 @@ require (
 	github.com/projectdiscovery/useragent v0.0.78 // indirect
 	github.com/projectdiscovery/utils v0.2.21 // indirect
 	github.com/projectdiscovery/yamldoc-go v1.0.4 // indirect
-	github.com/prometheus/client_golang v1.14.0 // indirect
 	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.42.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
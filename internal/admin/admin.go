@@ -0,0 +1,224 @@
+// admin-------------------------------------
+// @file      : admin.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/8 20:31
+// -------------------------------------------
+
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/bigcache"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/configupdater"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/schedule"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAddr 管理接口默认只监听本机
+const defaultAddr = "127.0.0.1:6060"
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	// writeTimeout 需要大于 pprof profile 和 trace 的采集时间（默认 30 秒）
+	writeTimeout = 2 * time.Minute
+	idleTimeout  = 2 * time.Minute
+)
+
+// server 正在运行的管理接口，节点停止时关闭
+var server *http.Server
+
+// Serve 开启节点管理接口，所有接口（包括 pprof）都需要 Authorization: Bearer <token>
+// 中心 redis 无法连接时可以通过管理接口查看和管理节点，没有配置 token 时不开启
+func Serve() {
+	cfg := global.AppConfig.Admin
+	if cfg.Token == "" {
+		return
+	}
+	addr := cfg.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tasks", method(http.MethodGet, tasks))
+	mux.HandleFunc("/api/tasks/cancel", method(http.MethodPost, cancelTask))
+	mux.HandleFunc("/api/targets/cancel", method(http.MethodPost, cancelTarget))
+	mux.HandleFunc("/api/logs", method(http.MethodGet, logs))
+	mux.HandleFunc("/api/plugins/recheck", method(http.MethodPost, pluginAction(configupdater.ReCheck)))
+	mux.HandleFunc("/api/plugins/reinstall", method(http.MethodPost, pluginAction(configupdater.ReInstall)))
+	mux.HandleFunc("/api/storage", method(http.MethodGet, storage))
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server = &http.Server{
+		Addr:              addr,
+		Handler:           authenticate(cfg.Token, mux),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	logger.SlogInfoLocal(fmt.Sprintf("admin api listen on %v", addr))
+	go func(srv *http.Server) {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.SlogErrorLocal(fmt.Sprintf("admin api server error: %v", err))
+		}
+	}(server)
+}
+
+// Shutdown 关闭管理接口，等待正在处理的请求结束直到 ctx 结束
+func Shutdown(ctx context.Context) {
+	if server == nil {
+		return
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("admin api shutdown error: %v", err))
+	}
+}
+
+// authenticate 检查请求的 token
+func authenticate(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func method(m string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != m {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		fn(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// tasks 正在运行的任务和正在扫描的目标
+func tasks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tasks":   pool.TaskQueue.Active(),
+		"targets": pipeline.Progresses.Targets(),
+	})
+}
+
+// cancelTask 停止任务，只修改本地状态，中心 redis 无法连接时也能使用
+// 取消任务上下文并删除本地任务信息和定时配置，保留目标用于重新开始，任务结束后由任务本身弹出
+func cancelTask(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "missing id")
+		return
+	}
+	if !pool.TaskQueue.Running(id) {
+		writeError(w, http.StatusNotFound, "task not running")
+		return
+	}
+	logger.SlogInfoLocal(fmt.Sprintf("admin api stop task %v", id))
+	if err := pebbledb.PebbleStore.Delete([]byte("task:" + id)); err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete task %v error: %v", id, err))
+	}
+	contextmanager.DeleteDeadline(id)
+	schedule.Delete(id, true)
+	contextmanager.GlobalContextManagers.CancelContext(id)
+	writeJSON(w, http.StatusOK, map[string]string{"id": id})
+}
+
+// cancelTarget 取消正在扫描的目标，目标标记为部分完成，任务的其他目标继续运行
+func cancelTarget(w http.ResponseWriter, r *http.Request) {
+	task := r.URL.Query().Get("task")
+	target := r.URL.Query().Get("target")
+	if task == "" || target == "" {
+		writeError(w, http.StatusBadRequest, "missing task or target")
+		return
+	}
+	if !contextmanager.GlobalContextManagers.CancelTargetContext(task, target) {
+		writeError(w, http.StatusNotFound, "target not running")
+		return
+	}
+	logger.SlogInfoLocal(fmt.Sprintf("admin api cancel task %v target %v", task, target))
+	writeJSON(w, http.StatusOK, map[string]string{"task": task, "target": target})
+}
+
+// logs 最近的插件日志，lines 默认为 100
+func logs(w http.ResponseWriter, r *http.Request) {
+	lines := 100
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid lines")
+			return
+		}
+		lines = n
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"lines": logger.PluginLogTail(r.URL.Query().Get("module"), r.URL.Query().Get("plugin"), lines),
+	})
+}
+
+// pluginAction 重新检查或重新安装插件，后台运行，结果通过插件状态和日志查看
+func pluginAction(action func(data string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		module := r.URL.Query().Get("module")
+		id := r.URL.Query().Get("plugin")
+		if module == "" || id == "" || strings.Contains(id, "_") {
+			writeError(w, http.StatusBadRequest, "missing or invalid module or plugin")
+			return
+		}
+		if !plugins.GlobalPluginManager.HasPlugin(module, id) {
+			writeError(w, http.StatusNotFound, "plugin not found")
+			return
+		}
+		go action(id + "_" + module)
+		writeJSON(w, http.StatusAccepted, map[string]string{"module": module, "plugin": id})
+	}
+}
+
+// storage 本地缓存占用的空间
+func storage(w http.ResponseWriter, r *http.Request) {
+	result := make(map[string]interface{})
+	size, err := pebbledb.PebbleStore.DiskUsage()
+	if err != nil {
+		result["pebble"] = map[string]string{"error": err.Error()}
+	} else {
+		result["pebble"] = map[string]uint64{"diskBytes": size}
+	}
+	if bigcache.BigCache != nil {
+		entries, capacity := bigcache.BigCache.Stats()
+		result["bigcache"] = map[string]int{"entries": entries, "capacityBytes": capacity}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -10,6 +10,7 @@ package bigcache
 import (
 	"context"
 	"github.com/allegro/bigcache/v3"
+	"strings"
 	"time"
 )
 
@@ -52,3 +53,27 @@ func (b *BigCacheWrapper) Get(key string) ([]byte, error) {
 func (b *BigCacheWrapper) Delete(key string) error {
 	return b.cache.Delete(key)
 }
+
+// Stats 缓存的数据数量和占用的内存，单位字节
+func (b *BigCacheWrapper) Stats() (int, int) {
+	return b.cache.Len(), b.cache.Capacity()
+}
+
+// DeletePrefix 删除指定前缀的所有数据，返回删除的数量
+func (b *BigCacheWrapper) DeletePrefix(prefix string) int {
+	var keys []string
+	iterator := b.cache.Iterator()
+	for iterator.SetNext() {
+		entry, err := iterator.Value()
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(entry.Key(), prefix) {
+			keys = append(keys, entry.Key())
+		}
+	}
+	for _, key := range keys {
+		_ = b.cache.Delete(key)
+	}
+	return len(keys)
+}
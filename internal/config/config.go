@@ -16,10 +16,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // LoadConfig 读取配置文件并解析
+// 首次运行时从环境变量生成配置文件；之后只有 mongodb 和 redis 的连接环境变量（见 applyEnvOverrides）在设置时覆盖配置文件，其他配置以配置文件为准
 func LoadConfig() error {
 	// 尝试打开配置文件
 	if _, err := os.Stat(global.ConfigPath); err == nil {
@@ -28,6 +33,7 @@ func LoadConfig() error {
 		if err := utils.Tools.ReadYAMLFile(global.ConfigPath, &global.AppConfig); err != nil {
 			return err
 		}
+		applyEnvOverrides(&global.AppConfig)
 	} else {
 		global.FirstRun = true
 		// 配置文件不存在，从环境变量读取
@@ -35,16 +41,44 @@ func LoadConfig() error {
 			NodeName:     getEnv("NodeName", ""),
 			TimeZoneName: getEnv("TimeZoneName", "Asia/Shanghai"),
 			MongoDB: global.MongoDBConfig{
-				IP:       getEnv("MONGODB_IP", ""),
-				Port:     getEnv("MONGODB_PORT", "27017"),
-				User:     getEnv("MONGODB_USER", ""),
-				Password: getEnv("MONGODB_PASSWORD", ""),
-				Database: getEnv("MONGODB_DATABASE", ""),
+				IP:         getEnv("MONGODB_IP", ""),
+				Port:       getEnv("MONGODB_PORT", "27017"),
+				User:       getEnv("MONGODB_USER", ""),
+				Password:   getEnv("MONGODB_PASSWORD", ""),
+				Database:   getEnv("MONGODB_DATABASE", ""),
+				URI:        getEnv("MONGODB_URI", ""),
+				AuthSource: getEnv("MONGODB_AUTH_SOURCE", ""),
+				ReplicaSet: getEnv("MONGODB_REPLICA_SET", ""),
+				TLS:        tlsFromEnv("MONGODB"),
 			},
 			Redis: global.RedisConfig{
-				IP:       getEnv("REDIS_IP", ""),
-				Port:     getEnv("REDIS_PORT", "6379"),
-				Password: getEnv("REDIS_PASSWORD", ""),
+				IP:               getEnv("REDIS_IP", ""),
+				Port:             getEnv("REDIS_PORT", "6379"),
+				Password:         getEnv("REDIS_PASSWORD", ""),
+				Username:         getEnv("REDIS_USERNAME", ""),
+				DB:               getEnvInt("REDIS_DB", 0),
+				SentinelAddrs:    strings.FieldsFunc(getEnv("REDIS_SENTINEL_ADDRS", ""), func(r rune) bool { return r == ',' }),
+				SentinelMaster:   getEnv("REDIS_SENTINEL_MASTER", ""),
+				SentinelUsername: getEnv("REDIS_SENTINEL_USERNAME", ""),
+				SentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+				TLS:              tlsFromEnv("REDIS"),
+			},
+			Result: global.ResultConfig{
+				Sinks:    strings.Split(getEnv("RESULT_SINKS", "mongodb"), ","),
+				JsonlDir: getEnv("RESULT_JSONL_DIR", ""),
+			},
+			Labels:        strings.FieldsFunc(getEnv("NODE_LABELS", ""), func(r rune) bool { return r == ',' }),
+			ShutdownGrace: getEnv("SHUTDOWN_GRACE", "30s"),
+			MetricsAddr:   getEnv("METRICS_ADDR", ""),
+			Admin: global.AdminConfig{
+				Addr:  getEnv("ADMIN_ADDR", "127.0.0.1:6060"),
+				Token: getEnv("ADMIN_TOKEN", ""),
+			},
+			ToolBundle:        getEnv("TOOL_BUNDLE_DIR", ""),
+			ToolAllowUnpinned: getEnvBool("TOOL_ALLOW_UNPINNED"),
+			Update: global.UpdateConfig{
+				PublicKey: getEnv("UPDATE_PUBLIC_KEY", ""),
+				Timeout:   getEnv("UPDATE_TIMEOUT", "5m"),
 			},
 		}
 		nodeName := global.AppConfig.NodeName
@@ -61,7 +95,7 @@ func LoadConfig() error {
 		if err := createConfigFile(global.ConfigPath, global.AppConfig); err != nil {
 			return err
 		}
-		if global.AppConfig.MongoDB.IP == "" {
+		if global.AppConfig.MongoDB.IP == "" && global.AppConfig.MongoDB.URI == "" && !global.Standalone {
 			return fmt.Errorf("missing required MongoDB IP configuration")
 		}
 
@@ -69,6 +103,36 @@ func LoadConfig() error {
 	return nil
 }
 
+// NodeLabels 节点的能力标签，配置的标签加上自动检测的标签，root 用户运行时可以使用原始套接字
+func NodeLabels() []string {
+	seen := make(map[string]bool)
+	var labels []string
+	add := func(label string) {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label != "" && !seen[label] {
+			seen[label] = true
+			labels = append(labels, label)
+		}
+	}
+	for _, label := range global.AppConfig.Labels {
+		add(label)
+	}
+	if os.Geteuid() == 0 {
+		add("raw-socket")
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// ShutdownGrace 收到停止信号后等待目标完成的时间，没有配置或格式错误时为 30 秒
+func ShutdownGrace() time.Duration {
+	grace, err := time.ParseDuration(global.AppConfig.ShutdownGrace)
+	if err != nil || grace < 0 {
+		return 30 * time.Second
+	}
+	return grace
+}
+
 // getEnv 从环境变量中读取配置值，如果环境变量未设置，则返回默认值
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -77,6 +141,76 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// applyEnvOverrides 配置文件已存在时，设置了的连接环境变量覆盖配置文件中的值，修改连接方式后不需要删除配置文件
+func applyEnvOverrides(cfg *global.Config) {
+	overrideString(&cfg.MongoDB.URI, "MONGODB_URI")
+	overrideString(&cfg.MongoDB.AuthSource, "MONGODB_AUTH_SOURCE")
+	overrideString(&cfg.MongoDB.ReplicaSet, "MONGODB_REPLICA_SET")
+	overrideTLS(&cfg.MongoDB.TLS, "MONGODB")
+	overrideString(&cfg.Redis.Username, "REDIS_USERNAME")
+	if _, exists := os.LookupEnv("REDIS_DB"); exists {
+		cfg.Redis.DB = getEnvInt("REDIS_DB", cfg.Redis.DB)
+	}
+	if value, exists := os.LookupEnv("REDIS_SENTINEL_ADDRS"); exists {
+		cfg.Redis.SentinelAddrs = strings.FieldsFunc(value, func(r rune) bool { return r == ',' })
+	}
+	overrideString(&cfg.Redis.SentinelMaster, "REDIS_SENTINEL_MASTER")
+	overrideString(&cfg.Redis.SentinelUsername, "REDIS_SENTINEL_USERNAME")
+	overrideString(&cfg.Redis.SentinelPassword, "REDIS_SENTINEL_PASSWORD")
+	overrideTLS(&cfg.Redis.TLS, "REDIS")
+}
+
+// overrideString 环境变量设置时覆盖配置值
+func overrideString(value *string, key string) {
+	if env, exists := os.LookupEnv(key); exists {
+		*value = env
+	}
+}
+
+// overrideTLS 设置了 <prefix>_TLS* 环境变量时覆盖对应的 TLS 配置
+func overrideTLS(cfg *global.TLSConfig, prefix string) {
+	if _, exists := os.LookupEnv(prefix + "_TLS"); exists {
+		cfg.Enabled = getEnvBool(prefix + "_TLS")
+	}
+	overrideString(&cfg.CAFile, prefix+"_TLS_CA")
+	overrideString(&cfg.CertFile, prefix+"_TLS_CERT")
+	overrideString(&cfg.KeyFile, prefix+"_TLS_KEY")
+	overrideString(&cfg.ServerName, prefix+"_TLS_SERVER_NAME")
+	if _, exists := os.LookupEnv(prefix + "_TLS_INSECURE"); exists {
+		cfg.InsecureSkipVerify = getEnvBool(prefix + "_TLS_INSECURE")
+	}
+}
+
+// getEnvInt 读取整数环境变量，格式错误时使用默认值
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool 读取布尔环境变量，true、1、yes 为 true
+func getEnvBool(key string) bool {
+	switch strings.ToLower(getEnv(key, "")) {
+	case "true", "1", "yes":
+		return true
+	}
+	return false
+}
+
+// tlsFromEnv 读取 <prefix>_TLS、<prefix>_TLS_CA、<prefix>_TLS_CERT、<prefix>_TLS_KEY、<prefix>_TLS_SERVER_NAME、<prefix>_TLS_INSECURE
+func tlsFromEnv(prefix string) global.TLSConfig {
+	return global.TLSConfig{
+		Enabled:            getEnvBool(prefix + "_TLS"),
+		CAFile:             getEnv(prefix+"_TLS_CA", ""),
+		CertFile:           getEnv(prefix+"_TLS_CERT", ""),
+		KeyFile:            getEnv(prefix+"_TLS_KEY", ""),
+		ServerName:         getEnv(prefix+"_TLS_SERVER_NAME", ""),
+		InsecureSkipVerify: getEnvBool(prefix + "_TLS_INSECURE"),
+	}
+}
+
 func createConfigFile(configFile string, config global.Config) error {
 	if err := utils.Tools.WriteYAMLFile(configFile, config); err != nil {
 		return err
@@ -100,6 +234,8 @@ func CreateDir() {
 	for _, scanMopule := range global.ScanModule {
 		dirs = append(dirs, filepath.Join(global.PluginDir, scanMopule))
 	}
+	// 流程图自定义阶段的插件目录
+	dirs = append(dirs, filepath.Join(global.PluginDir, "Custom"))
 
 	for _, dir := range dirs {
 		err := utils.Tools.EnsureDir(dir)
@@ -115,8 +251,11 @@ func InitFilterUrlRe() {
 	global.DisallowedURLFilters = append(global.DisallowedURLFilters, regexp.MustCompile(disallowedRegex))
 }
 
+// Version 节点程序的版本，更新时新版本的 version 命令需要输出清单中的版本
+const Version = "1.5.4"
+
 func Initialize() {
-	global.VERSION = "1.5.4"
+	global.VERSION = Version
 	fmt.Printf("version %v\n", global.VERSION)
 	global.AbsolutePath, _ = filepath.Abs(filepath.Dir(os.Args[0]))
 	global.ConfigDir = filepath.Join(global.AbsolutePath, "config")
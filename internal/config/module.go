@@ -11,57 +11,92 @@ import (
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"log"
+	"time"
 )
 
+const (
+	PluginSequential = "sequential" // 插件依次运行
+	PluginParallel   = "parallel"   // 插件同时运行
+)
+
+// PluginRunConfig 模块中插件的运行方式
+type PluginRunConfig struct {
+	PluginMode   string              `yaml:"pluginMode,omitempty"`   // 插件运行模式 sequential 或 parallel，默认 sequential
+	Dependencies map[string][]string `yaml:"dependencies,omitempty"` // 插件依赖，key 为插件ID，value 为需要先运行完毕的插件ID
+	Timeout      int                 `yaml:"timeout,omitempty"`      // 插件单次运行的超时时间，单位分钟，0 为不限制
+	Timeouts     map[string]int      `yaml:"timeouts,omitempty"`     // 单个插件的超时时间，key 为插件ID，优先于 timeout
+}
+
+// PluginTimeout 获取插件单次运行的超时时间，0 为不限制
+func (c PluginRunConfig) PluginTimeout(pluginId string) time.Duration {
+	if timeout, ok := c.Timeouts[pluginId]; ok {
+		return time.Duration(timeout) * time.Minute
+	}
+	return time.Duration(c.Timeout) * time.Minute
+}
+
 type SubdomainScanConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type SubdomainSecurityConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type AssetMappConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type PortScanPreparationConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 type PortScanConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type PortFingerprintConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type AssetHandleConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type URLScanConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type URLSecurityConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type WebCrawlerConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type DirScanConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type VulnerabilityScanConfig struct {
-	GoroutineCount int `yaml:"goroutineCount"` // 协程数量
+	GoroutineCount  int `yaml:"goroutineCount"` // 协程数量
+	PluginRunConfig `yaml:",inline"`
 }
 
 type ModulesConfigStruct struct {
 	MaxGoroutineCount   int                       `yaml:"maxGoroutineCount"`
+	MaxTaskCount        int                       `yaml:"maxTaskCount"` // 同时运行的任务数量
 	SubdomainScan       SubdomainScanConfig       `yaml:"subdomainScan"`
 	SubdomainSecurity   SubdomainSecurityConfig   `yaml:"subdomainSecurity"`
 	AssetMapping        AssetMappConfig           `yaml:"assetMapping"`
@@ -86,6 +121,46 @@ func ModulesInitialize() error {
 	return nil
 }
 
+// GetPluginRun 获取模块的插件运行方式，没有配置的模块依次运行
+func (cfg *ModulesConfigStruct) GetPluginRun(moduleName string) PluginRunConfig {
+	switch moduleName {
+	case "SubdomainScan":
+		return cfg.SubdomainScan.PluginRunConfig
+	case "SubdomainSecurity":
+		return cfg.SubdomainSecurity.PluginRunConfig
+	case "AssetMapping":
+		return cfg.AssetMapping.PluginRunConfig
+	case "PortScanPreparation":
+		return cfg.PortScanPreparation.PluginRunConfig
+	case "PortScan":
+		return cfg.PortScan.PluginRunConfig
+	case "PortFingerprint":
+		return cfg.PortFingerprint.PluginRunConfig
+	case "AssetHandle":
+		return cfg.AssetHandle.PluginRunConfig
+	case "URLScan":
+		return cfg.URLScan.PluginRunConfig
+	case "URLSecurity":
+		return cfg.URLSecurity.PluginRunConfig
+	case "WebCrawler":
+		return cfg.WebCrawler.PluginRunConfig
+	case "DirScan":
+		return cfg.DirScan.PluginRunConfig
+	case "VulnerabilityScan":
+		return cfg.VulnerabilityScan.PluginRunConfig
+	default:
+		return PluginRunConfig{}
+	}
+}
+
+// GetMaxTaskCount 同时运行的任务数量，没有配置时为 3
+func (cfg *ModulesConfigStruct) GetMaxTaskCount() int {
+	if cfg.MaxTaskCount <= 0 {
+		return 3
+	}
+	return cfg.MaxTaskCount
+}
+
 func (cfg *ModulesConfigStruct) GetGoroutineCount(moduleName string) int {
 	switch moduleName {
 	case "task":
@@ -15,6 +15,7 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/mongodb"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
@@ -167,12 +168,13 @@ type tmpProject struct {
 	ID          primitive.ObjectID `bson:"_id"`
 	RootDomains []string           `bson:"root_domains"`
 	Ignore      string             `bson:"ignore"`
+	Scope       types.ScopeRules   `bson:"scope"`
 }
 
 func UpdateProject() {
 	logger.SlogInfoLocal("project load begin")
 	var tmpProjects []tmpProject
-	if err := mongodb.MongodbClient.FindAll("project", bson.M{}, bson.M{"_id": 1, "root_domains": 1, "ignore": 1}, &tmpProjects); err != nil {
+	if err := mongodb.MongodbClient.FindAll("project", bson.M{}, bson.M{"_id": 1, "root_domains": 1, "ignore": 1, "scope": 1}, &tmpProjects); err != nil {
 		return
 	}
 	global.Projects = []types.Project{}
@@ -189,8 +191,11 @@ func UpdateProject() {
 		}
 		proj.IgnoreList = ignoreList
 		proj.IgnoreRegexList = regexList
+		proj.Scope = tmpProj.Scope
 		global.Projects = append(global.Projects, proj)
 	}
+	// 项目的扫描范围在每个阶段之间检查
+	scope.SetProjects(global.Projects)
 	logger.SlogInfoLocal("project load end")
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"time"
 )
@@ -85,6 +86,8 @@ func RefreshConfig() {
 					Uninstall(jsonData.Content)
 				case "UpdateSystem":
 					SystemUpdate(jsonData.Content)
+				case "resubmit_dead_letter":
+					results.ResubmitDeadLetters(jsonData.Content)
 
 				}
 			}
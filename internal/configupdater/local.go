@@ -0,0 +1,127 @@
+// configupdater-------------------------------------
+// @file      : local.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/21 21:03
+// -------------------------------------------
+
+package configupdater
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localWebFinger 本地指纹规则文件中的一条规则，state 未设置时启用
+type localWebFinger struct {
+	ID      string   `yaml:"id"`
+	Name    string   `yaml:"name"`
+	Express []string `yaml:"express"`
+	State   *bool    `yaml:"state"`
+}
+
+// localSensitive 本地敏感信息规则文件中的一条规则，state 未设置时启用
+type localSensitive struct {
+	ID      string   `yaml:"id"`
+	Name    string   `yaml:"name"`
+	Regular string   `yaml:"regular"`
+	Color   string   `yaml:"color"`
+	Tags    []string `yaml:"tags"`
+	State   *bool    `yaml:"state"`
+}
+
+// ruleFiles 获取规则文件，path 为目录时返回目录下所有的 yaml 文件
+func ruleFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadLocalWebFinger 单机模式从本地文件或目录加载指纹规则
+func LoadLocalWebFinger(path string) error {
+	logger.SlogInfoLocal("local WebFinger load begin")
+	files, err := ruleFiles(path)
+	if err != nil {
+		return err
+	}
+	global.WebFingers = []types.WebFinger{}
+	for _, file := range files {
+		var rules []localWebFinger
+		if err := utils.Tools.ReadYAMLFile(file, &rules); err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		for _, rule := range rules {
+			wf := types.WebFinger{
+				ID:      rule.ID,
+				Name:    rule.Name,
+				Express: rule.Express,
+				State:   rule.State == nil || *rule.State,
+			}
+			if wf.ID == "" {
+				wf.ID = wf.Name
+			}
+			global.WebFingers = append(global.WebFingers, wf)
+		}
+	}
+	logger.SlogInfoLocal(fmt.Sprintf("local WebFinger load end: %v", len(global.WebFingers)))
+	return nil
+}
+
+// LoadLocalSensitive 单机模式从本地文件或目录加载敏感信息规则，只加载启用的规则
+func LoadLocalSensitive(path string) error {
+	logger.SlogInfoLocal("local sens rule load begin")
+	files, err := ruleFiles(path)
+	if err != nil {
+		return err
+	}
+	global.SensitiveRules = []types.SensitiveRule{}
+	for _, file := range files {
+		var rules []localSensitive
+		if err := utils.Tools.ReadYAMLFile(file, &rules); err != nil {
+			return fmt.Errorf("%v: %v", file, err)
+		}
+		for _, rule := range rules {
+			if rule.State != nil && !*rule.State {
+				continue
+			}
+			r := types.SensitiveRule{
+				ID:      rule.ID,
+				Name:    rule.Name,
+				State:   true,
+				Regular: rule.Regular,
+				Color:   rule.Color,
+				Tags:    rule.Tags,
+			}
+			if r.ID == "" {
+				r.ID = r.Name
+			}
+			global.SensitiveRules = append(global.SensitiveRules, r)
+		}
+	}
+	logger.SlogInfoLocal(fmt.Sprintf("local sens rule load end: %v", len(global.SensitiveRules)))
+	return nil
+}
@@ -57,6 +57,8 @@ func InstallPlugin(id string) {
 	}
 	err = plugin.Install()
 	if err != nil {
+		plugins.GlobalPluginManager.MarkDigest(plgInfo, plugin.GetPluginId(), err)
+		plugins.GlobalPluginManager.RecordStatus(plgInfo)
 		plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 		if plgInfoErr != nil {
 			logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 1: %s", plgInfoErr))
@@ -67,6 +69,8 @@ func InstallPlugin(id string) {
 	plgInfo[plugin.GetPluginId()+"_install"] = 1
 	err = plugin.Check()
 	if err != nil {
+		plugins.GlobalPluginManager.MarkDigest(plgInfo, plugin.GetPluginId(), err)
+		plugins.GlobalPluginManager.RecordStatus(plgInfo)
 		plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 		if plgInfoErr != nil {
 			logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 3: %s", plgInfoErr))
@@ -75,6 +79,8 @@ func InstallPlugin(id string) {
 		return
 	}
 	plgInfo[plugin.GetPluginId()+"_check"] = 1
+	plugins.GlobalPluginManager.MarkDigest(plgInfo, plugin.GetPluginId(), nil)
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
 	plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 	if plgInfoErr != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 4: %s", plgInfoErr))
@@ -102,7 +108,8 @@ func DeletePlugin(data string) {
 	plgPath := filepath.Join(global.PluginDir, module, fmt.Sprintf("%v.go", hash))
 	utils.Tools.DeleteFile(plgPath)
 	nodePlgInfokey := fmt.Sprintf("NodePlg:%v", global.AppConfig.NodeName)
-	plgInfoErr := redis.RedisClient.HDel(context.Background(), nodePlgInfokey, hash+"_install", hash+"_check")
+	plugins.GlobalPluginManager.DeleteStatus(hash)
+	plgInfoErr := redis.RedisClient.HDel(context.Background(), nodePlgInfokey, hash+"_install", hash+"_check", hash+"_digest")
 	if plgInfoErr != nil {
 	}
 	logger.SlogInfoLocal(fmt.Sprintf("delete plugin end:%v", hash))
@@ -116,6 +123,7 @@ func ReInstall(data string) {
 		hash + "_install": 0,
 	}
 	nodePlgInfokey := fmt.Sprintf("NodePlg:%v", global.AppConfig.NodeName)
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
 	plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 	if plgInfoErr != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("ReInstall send plginfo error 3: %s", plgInfoErr))
@@ -126,11 +134,14 @@ func ReInstall(data string) {
 		return
 	}
 	err := plg.Install()
+	plugins.GlobalPluginManager.MarkDigest(plgInfo, hash, err)
 	if err != nil {
+		reportDigest(nodePlgInfokey, plgInfo, hash)
 		logger.SlogErrorLocal(fmt.Sprintf("module %v hash %v install error: %v", module, hash, err))
 		return
 	}
 	plgInfo[hash+"_install"] = 1
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
 	plgInfoErr = redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 	if plgInfoErr != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("ReInstall send plginfo error 3: %s", plgInfoErr))
@@ -146,6 +157,7 @@ func ReCheck(data string) {
 		hash + "_check": 0,
 	}
 	nodePlgInfokey := fmt.Sprintf("NodePlg:%v", global.AppConfig.NodeName)
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
 	plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 	if plgInfoErr != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("ReCheck send plginfo error 3: %s", plgInfoErr))
@@ -156,11 +168,14 @@ func ReCheck(data string) {
 		return
 	}
 	err := plg.Check()
+	plugins.GlobalPluginManager.MarkDigest(plgInfo, hash, err)
 	if err != nil {
+		reportDigest(nodePlgInfokey, plgInfo, hash)
 		logger.SlogErrorLocal(fmt.Sprintf("module %v hash %v check error: %v", module, hash, err))
 		return
 	}
 	plgInfo[hash+"_check"] = 1
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
 	plgInfoErr = redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
 	if plgInfoErr != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("ReCheck send plginfo error 3: %s", plgInfoErr))
@@ -169,6 +184,18 @@ func ReCheck(data string) {
 	logger.SlogInfoLocal(fmt.Sprintf("plugin recheck success: %v", data))
 }
 
+// reportDigest 安装或检查失败时写入摘要不一致的信息，状态字段已在开始时置为 0
+func reportDigest(key string, plgInfo map[string]interface{}, hash string) {
+	if _, ok := plgInfo[hash+"_digest"]; !ok {
+		return
+	}
+	plugins.GlobalPluginManager.RecordStatus(plgInfo)
+	plgInfoErr := redis.RedisClient.HMSet(context.Background(), key, plgInfo)
+	if plgInfoErr != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("send plginfo digest error: %s", plgInfoErr))
+	}
+}
+
 func Uninstall(data string) {
 	parts := strings.Split(data, "_")
 	hash := parts[0]
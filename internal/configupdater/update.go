@@ -14,10 +14,11 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/updater"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"gopkg.in/yaml.v3"
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -81,6 +82,7 @@ func UpdateModuleConfig(content string) {
 			logger.SlogErrorLocal(fmt.Sprintf("MaxGoroutineCount SetGoroutineCount error: %v", err))
 		}
 	}
+	config.ModulesConfig.MaxTaskCount = modulesConfig.MaxTaskCount
 	moduleGoroutineCounts := map[string]int{
 		"SubdomainScan":       modulesConfig.SubdomainScan.GoroutineCount,
 		"SubdomainSecurity":   modulesConfig.SubdomainSecurity.GoroutineCount,
@@ -184,6 +186,19 @@ func UpdateModuleConfig(content string) {
 			}
 		}
 	}
+	// 修改模块的插件运行方式，下一条输入开始生效
+	config.ModulesConfig.SubdomainScan.PluginRunConfig = modulesConfig.SubdomainScan.PluginRunConfig
+	config.ModulesConfig.SubdomainSecurity.PluginRunConfig = modulesConfig.SubdomainSecurity.PluginRunConfig
+	config.ModulesConfig.AssetMapping.PluginRunConfig = modulesConfig.AssetMapping.PluginRunConfig
+	config.ModulesConfig.AssetHandle.PluginRunConfig = modulesConfig.AssetHandle.PluginRunConfig
+	config.ModulesConfig.PortScanPreparation.PluginRunConfig = modulesConfig.PortScanPreparation.PluginRunConfig
+	config.ModulesConfig.PortScan.PluginRunConfig = modulesConfig.PortScan.PluginRunConfig
+	config.ModulesConfig.PortFingerprint.PluginRunConfig = modulesConfig.PortFingerprint.PluginRunConfig
+	config.ModulesConfig.URLScan.PluginRunConfig = modulesConfig.URLScan.PluginRunConfig
+	config.ModulesConfig.URLSecurity.PluginRunConfig = modulesConfig.URLSecurity.PluginRunConfig
+	config.ModulesConfig.WebCrawler.PluginRunConfig = modulesConfig.WebCrawler.PluginRunConfig
+	config.ModulesConfig.DirScan.PluginRunConfig = modulesConfig.DirScan.PluginRunConfig
+	config.ModulesConfig.VulnerabilityScan.PluginRunConfig = modulesConfig.VulnerabilityScan.PluginRunConfig
 	err = utils.Tools.WriteYAMLFile(config.ModulesConfigPath, config.ModulesConfig)
 	if err != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("ModulesConfig  writing file error: %v", err))
@@ -236,17 +251,12 @@ func UpdatePoc(content string) {
 	}
 }
 
+// SystemUpdate 校验签名的更新包并替换程序后停止节点，新版本没有在超时时间内注册时自动回滚
 func SystemUpdate(content string) {
-	filePath := filepath.Join("/apps", "UPDATE")
-	err := utils.Tools.WriteContentFile(filePath, content)
+	err := updater.Apply(content)
 	if err != nil {
-		logger.SlogError(fmt.Sprintf("Error write update file: %s", err))
+		logger.SlogError(fmt.Sprintf("system update rejected: %v", err))
 		return
 	}
-	Exit()
-}
-
-func Exit() {
-	logger.SlogInfo(fmt.Sprintf("system exit"))
-	os.Exit(0)
+	shutdown.Request("system update")
 }
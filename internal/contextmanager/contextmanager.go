@@ -20,6 +20,7 @@ type ContextManager struct {
 	contexts   map[string]context.Context    // 存储上下文
 	cancels    map[string]context.CancelFunc // 存储取消函数
 	waitGroups map[string]*sync.WaitGroup    // 存储每个任务的 WaitGroup
+	targets    map[string]targetContext      // 正在运行的目标的上下文，从任务的上下文派生
 }
 
 // Global map to store all ContextManagers by their IDs
@@ -31,6 +32,7 @@ func NewContextManager() {
 		contexts:   make(map[string]context.Context),
 		cancels:    make(map[string]context.CancelFunc),
 		waitGroups: make(map[string]*sync.WaitGroup),
+		targets:    make(map[string]targetContext),
 	}
 }
 
@@ -0,0 +1,151 @@
+// contextmanager-------------------------------------
+// @file      : deadline.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/5 19:33
+// -------------------------------------------
+
+package contextmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sync"
+	"time"
+)
+
+// deadlinePrefix 任务截止时间在本地数据库中的键前缀，节点重启后继续使用原来的截止时间
+const deadlinePrefix = "deadline:"
+
+type targetContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func targetKey(taskID string, target string) string {
+	return taskID + "\x00" + target
+}
+
+// ParseTimeout 解析运行时间，例如 30m、6h，为空时不限制
+func ParseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %v", value)
+	}
+	return d, nil
+}
+
+// TaskDeadline 任务的截止时间，节点第一次运行任务时按 timeout 计算并写入本地，timeout 为 0 时返回零值表示不限制
+func TaskDeadline(taskID string, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	key := []byte(deadlinePrefix + taskID)
+	if pebbledb.PebbleStore != nil {
+		if value, err := pebbledb.PebbleStore.Get(key); err == nil {
+			if deadline, err := time.Parse(time.RFC3339, string(value)); err == nil {
+				return deadline
+			}
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	if pebbledb.PebbleStore != nil {
+		err := pebbledb.PebbleStore.Put(key, []byte(deadline.Format(time.RFC3339)))
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("PebbleStore put task %v deadline error: %v", taskID, err))
+		}
+	}
+	return deadline
+}
+
+// DeleteDeadline 任务结束或停止时删除截止时间，再次运行时重新计算
+func DeleteDeadline(taskID string) {
+	if pebbledb.PebbleStore == nil {
+		return
+	}
+	err := pebbledb.PebbleStore.Delete([]byte(deadlinePrefix + taskID))
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete task %v deadline error: %v", taskID, err))
+	}
+}
+
+// DeadlineExceeded 上下文是否因为超过截止时间结束，任务取消时返回 false
+func DeadlineExceeded(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// AddContextWithDeadline 添加有截止时间的任务上下文，deadline 为零值时和 AddContext 相同
+func (cm *ContextManager) AddContextWithDeadline(taskID string, deadline time.Time) {
+	if deadline.IsZero() {
+		cm.AddContext(taskID)
+		return
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if _, exists := cm.contexts[taskID]; exists {
+		return
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	cm.contexts[taskID] = ctx
+	cm.cancels[taskID] = cancel
+	cm.waitGroups[taskID] = &sync.WaitGroup{}
+}
+
+// AddTargetContext 目标开始扫描时从任务的上下文派生目标的上下文，timeout 为 0 时只随任务取消
+func (cm *ContextManager) AddTargetContext(taskID string, target string, timeout time.Duration) context.Context {
+	parent := cm.GetContext(taskID)
+	var tc targetContext
+	if timeout > 0 {
+		tc.ctx, tc.cancel = context.WithTimeout(parent, timeout)
+	} else {
+		tc.ctx, tc.cancel = context.WithCancel(parent)
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.targets == nil {
+		cm.targets = make(map[string]targetContext)
+	}
+	if old, ok := cm.targets[targetKey(taskID, target)]; ok {
+		old.cancel()
+	}
+	cm.targets[targetKey(taskID, target)] = tc
+	return tc.ctx
+}
+
+// GetTargetContext 获取目标的上下文，目标没有在扫描时返回任务的上下文
+func (cm *ContextManager) GetTargetContext(taskID string, target string) context.Context {
+	cm.mu.Lock()
+	tc, ok := cm.targets[targetKey(taskID, target)]
+	cm.mu.Unlock()
+	if ok {
+		return tc.ctx
+	}
+	return cm.GetContext(taskID)
+}
+
+// CancelTargetContext 取消正在扫描的目标，目标没有在扫描时返回 false
+func (cm *ContextManager) CancelTargetContext(taskID string, target string) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	tc, ok := cm.targets[targetKey(taskID, target)]
+	if ok {
+		tc.cancel()
+	}
+	return ok
+}
+
+// DeleteTargetContext 目标扫描结束后删除目标的上下文
+func (cm *ContextManager) DeleteTargetContext(taskID string, target string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if tc, ok := cm.targets[targetKey(taskID, target)]; ok {
+		tc.cancel()
+		delete(cm.targets, targetKey(taskID, target))
+	}
+}
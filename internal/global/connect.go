@@ -0,0 +1,72 @@
+// global-------------------------------------
+// @file      : connect.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/9 19:42
+// -------------------------------------------
+
+package global
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	connectAttempts = 5               // 启动时连接 mongodb 和 redis 的次数
+	connectDelay    = 2 * time.Second // 第一次重试的等待时间，之后每次翻倍
+)
+
+// ClientConfig 根据配置创建 TLS 客户端配置，没有开启 TLS 时返回 nil
+func (t TLSConfig) ClientConfig() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		ca, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file %v: %v", t.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in ca file %v", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Connect 启动时连接 mongodb 或 redis，失败时按指数退避重试，全部失败后返回最后一次的错误
+// 此时日志模块还没有初始化，重试信息直接输出
+func Connect(name string, connect func() error) error {
+	delay := connectDelay
+	var err error
+	for attempt := 1; attempt <= connectAttempts; attempt++ {
+		err = connect()
+		if err == nil {
+			return nil
+		}
+		if attempt == connectAttempts {
+			break
+		}
+		fmt.Printf("connect to %v failed (%v/%v), retry in %v: %v\n", name, attempt, connectAttempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return fmt.Errorf("connect to %v failed after %v attempts: %v", name, connectAttempts, err)
+}
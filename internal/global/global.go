@@ -33,6 +33,7 @@ var (
 	PocDir                string
 	PluginDir             string
 	DatabaseEnabled       bool
+	Standalone            bool // 单机模式，不连接 mongodb 和 redis
 	CustomParameter       interface{}
 	CustomMapParameter    sync.Map
 	TmpCustomParameter    interface{}
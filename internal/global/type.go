@@ -9,24 +9,72 @@ package global
 
 // Config 结构体
 type Config struct {
-	NodeName     string        `yaml:"NodeName"`
-	State        int           `yaml:"state"`
-	TimeZoneName string        `yaml:"TimeZoneName"`
-	Debug        bool          `yaml:"debug"`
-	MongoDB      MongoDBConfig `yaml:"mongodb"`
-	Redis        RedisConfig   `yaml:"redis"`
+	NodeName          string        `yaml:"NodeName"`
+	State             int           `yaml:"state"`
+	TimeZoneName      string        `yaml:"TimeZoneName"`
+	Debug             bool          `yaml:"debug"`
+	MongoDB           MongoDBConfig `yaml:"mongodb"`
+	Redis             RedisConfig   `yaml:"redis"`
+	Result            ResultConfig  `yaml:"result"`
+	Labels            []string      `yaml:"labels"`        // 节点的能力标签，例如 raw-socket、chromium、egress-cn，任务可以要求节点具有指定标签
+	ShutdownGrace     string        `yaml:"shutdownGrace"` // 收到停止信号后等待正在运行的目标完成的时间，例如 30s，超时后取消目标
+	MetricsAddr       string        `yaml:"metricsAddr"`   // Prometheus 指标接口的监听地址，例如 127.0.0.1:9100，为空时不开启
+	Admin             AdminConfig   `yaml:"admin"`
+	ToolBundle        string        `yaml:"toolBundle"`        // 离线工具包目录，安装外部工具时优先使用，为空时为 ext/bundle
+	ToolAllowUnpinned bool          `yaml:"toolAllowUnpinned"` // 允许安装工具清单中没有固定 sha256 的工具，首次获取的文件摘要记录后不再改变
+	Update            UpdateConfig  `yaml:"update"`
+}
+
+// UpdateConfig 节点自动更新配置，publicKey 为 base64 编码的 ed25519 公钥，为空时使用编译时写入的公钥，都为空时拒绝更新
+// timeout 为新版本需要注册成功的时间，例如 5m，超时后回滚到旧版本
+type UpdateConfig struct {
+	PublicKey string `yaml:"publicKey"`
+	Timeout   string `yaml:"timeout"`
+}
+
+// AdminConfig 节点管理接口配置，token 为空时不开启，监听地址默认为 127.0.0.1:6060
+type AdminConfig struct {
+	Addr  string `yaml:"addr"`
+	Token string `yaml:"token"`
+}
+
+// ResultConfig 结果写入配置，sinks 可同时启用多个：mongodb、jsonl
+type ResultConfig struct {
+	Sinks    []string `yaml:"sinks"`
+	JsonlDir string   `yaml:"jsonlDir"`
 }
 
 type MongoDBConfig struct {
-	IP       string `yaml:"ip"`
-	Port     string `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	Database string `yaml:"database"`
+	IP         string    `yaml:"ip"`
+	Port       string    `yaml:"port"`
+	User       string    `yaml:"user"`
+	Password   string    `yaml:"password"`
+	Database   string    `yaml:"database"`
+	URI        string    `yaml:"uri"`        // 完整的连接字符串，例如 mongodb://user:pass@h1:27017,h2:27017/?replicaSet=rs0，设置后忽略 ip、port、user、password
+	AuthSource string    `yaml:"authSource"` // 认证数据库，例如 admin
+	ReplicaSet string    `yaml:"replicaSet"` // 副本集名称
+	TLS        TLSConfig `yaml:"tls"`
 }
 
 type RedisConfig struct {
-	IP       string `yaml:"ip"`
-	Port     string `yaml:"port"`
-	Password string `yaml:"password"`
+	IP               string    `yaml:"ip"`
+	Port             string    `yaml:"port"`
+	Password         string    `yaml:"password"`
+	Username         string    `yaml:"username"`         // ACL 用户名
+	DB               int       `yaml:"db"`               // 数据库编号，默认为 0
+	SentinelAddrs    []string  `yaml:"sentinelAddrs"`    // 哨兵地址 host:port，设置后通过哨兵获取主节点，忽略 ip 和 port
+	SentinelMaster   string    `yaml:"sentinelMaster"`   // 哨兵监控的主节点名称
+	SentinelUsername string    `yaml:"sentinelUsername"` // 哨兵的 ACL 用户名
+	SentinelPassword string    `yaml:"sentinelPassword"` // 哨兵的密码
+	TLS              TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig 连接 mongodb 或 redis 使用的 TLS 配置，enabled 为 false 时使用明文连接
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"caFile"`             // 自定义 CA 证书，为空时使用系统证书
+	CertFile           string `yaml:"certFile"`           // 客户端证书
+	KeyFile            string `yaml:"keyFile"`            // 客户端证书私钥
+	ServerName         string `yaml:"serverName"`         // 证书中的服务端名称，为空时使用连接地址
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` // 不验证服务端证书，只用于测试
 }
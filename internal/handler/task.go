@@ -9,11 +9,14 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/schedule"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"strings"
@@ -63,6 +66,9 @@ func (h *Handle) ProgressStart(typ string, target string, taskId string, flag in
 	}
 	logger.SlogInfo(fmt.Sprintf("%v module start scanning the target: %v", typ, target))
 	key := "TaskInfo:progress:" + taskId + ":" + target
+	if global.Standalone {
+		return
+	}
 	ty := typ + "_start"
 	ProgressInfo := map[string]interface{}{
 		ty: utils.Tools.GetTimeNow(),
@@ -80,6 +86,9 @@ func (h *Handle) ProgressEnd(typ string, target string, taskId string, flag int,
 	}
 	logger.SlogInfo(fmt.Sprintf("%v module end scanning the target: %v running time: %v", typ, target, time))
 	key := "TaskInfo:progress:" + taskId + ":" + target
+	if global.Standalone {
+		return
+	}
 	ty := typ + "_end"
 	ProgressInfo := map[string]interface{}{
 		ty: utils.Tools.GetTimeNow(),
@@ -92,6 +101,9 @@ func (h *Handle) ProgressEnd(typ string, target string, taskId string, flag int,
 }
 
 func (h *Handle) TaskEnd(target string, taskId string) {
+	if global.Standalone {
+		return
+	}
 	key := "TaskInfo:time:" + taskId
 	err := redis.RedisClient.Set(context.Background(), key, utils.Tools.GetTimeNow())
 	if err != nil {
@@ -107,9 +119,81 @@ func (h *Handle) TaskEnd(target string, taskId string) {
 	}
 }
 
+// TargetPartial 目标超过截止时间，记录被中断的阶段，写入 TaskInfo:partial:<任务ID> 中目标对应的字段
+func (h *Handle) TargetPartial(target string, taskId string, reason string, stages []string) {
+	logger.SlogInfo(fmt.Sprintf("target %v partially complete (%v), stages cut short: %v", target, reason, strings.Join(stages, ",")))
+	if global.Standalone {
+		return
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"time":   utils.Tools.GetTimeNow(),
+		"reason": reason,
+		"stages": stages,
+	})
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("marshal target partial error: %v", err))
+		return
+	}
+	err = redis.RedisClient.HSet(context.Background(), "TaskInfo:partial:"+taskId, target, string(data))
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("TargetPartial redis error: %s", err))
+	}
+}
+
+// TargetOutcome 记录目标的运行结果和已经重试的次数，写入 TaskInfo:retry:<任务ID> 中目标对应的字段
+// nextRun 为下一次重试的时间，为空表示目标不再重试，记录的是最终结果
+func (h *Handle) TargetOutcome(target string, taskId string, outcome pipeline.Outcome, attempts int, nextRun string) {
+	if global.Standalone {
+		return
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"time":     utils.Tools.GetTimeNow(),
+		"status":   outcome.Status,
+		"class":    outcome.Class,
+		"reason":   outcome.Reason,
+		"stages":   outcome.Stages,
+		"failures": outcome.Failures,
+		"attempts": attempts,
+		"nextRun":  nextRun,
+		"final":    nextRun == "",
+	})
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("marshal target outcome error: %v", err))
+		return
+	}
+	err = redis.RedisClient.HSet(context.Background(), "TaskInfo:retry:"+taskId, target, string(data))
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("TargetOutcome redis error: %s", err))
+	}
+}
+
+// TargetAttempts 目标已经重试的次数，目标由其他节点放回 redis 时本地没有重试记录
+func (h *Handle) TargetAttempts(target string, taskId string) int {
+	if global.Standalone {
+		return 0
+	}
+	value, err := redis.RedisClient.HGet(context.Background(), "TaskInfo:retry:"+taskId, target)
+	if err != nil || value == "" {
+		return 0
+	}
+	var record struct {
+		Attempts int  `json:"attempts"`
+		Final    bool `json:"final"`
+	}
+	if json.Unmarshal([]byte(value), &record) != nil || record.Final {
+		// 上一次运行（例如定时运行）的最终结果不计入本次的重试次数
+		return 0
+	}
+	return record.Attempts
+}
+
 func (h *Handle) StopTask(id string) {
 	logger.SlogInfo(fmt.Sprintf("stop task: %v", id))
 	pebbledb.PebbleStore.Delete([]byte("task:" + id))
+	// 重新开始后重新计算任务的截止时间
+	contextmanager.DeleteDeadline(id)
+	// 停止后不再定时运行，保留目标用于任务重新开始
+	schedule.Delete(id, true)
 	_ = h.PopTaskId(id)
 	contextmanager.GlobalContextManagers.CancelContext(id)
 }
@@ -130,6 +214,15 @@ func (h *Handle) DeleteTask(content string) {
 				logger.SlogErrorLocal(fmt.Sprintf("PebbleStore DeleteTask %v error: %v", idTarget, err))
 			}
 		}
+		retries, err := pebbledb.PebbleStore.GetKeysWithPrefix("retry:" + prefix)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("DeleteTask get retries error: %v", err))
+		}
+		for key := range retries {
+			_ = pebbledb.PebbleStore.Delete([]byte(key))
+		}
+		pipeline.ClearTaskCheckpoints(id)
+		schedule.Delete(id, false)
 	}
 }
 
@@ -7,10 +7,14 @@
 
 package interfaces
 
+import "github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+
 type ModuleRunner interface {
 	ModuleRun() error
-	SetInput(chan interface{})
-	GetInput() chan interface{}
+	SetInput(chan types.Message)
+	GetInput() chan types.Message
 	CloseInput()
 	GetName() string
+	Consumes() []types.Kind // 模块接收的消息类型，为空表示接收所有类型
+	Produces() []types.Kind // 模块输出的消息类型，为空表示可能输出所有类型
 }
@@ -7,6 +7,11 @@
 
 package interfaces
 
+import "errors"
+
+// ErrInputType 插件不处理该类型的输入，模块会把所有输入交给插件，这种情况不算作插件运行失败
+var ErrInputType = errors.New("plugin does not accept this input")
+
 type Plugin interface {
 	GetName() string
 	SetName(name string)
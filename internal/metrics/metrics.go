@@ -0,0 +1,181 @@
+// metrics-------------------------------------
+// @file      : metrics.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/7 19:36
+// -------------------------------------------
+
+package metrics
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const namespace = "scopesentry"
+
+// Registry 节点的 Prometheus 指标，只包含本包注册的指标
+var Registry = prometheus.NewRegistry()
+
+var (
+	pluginDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "plugin_duration_seconds",
+		Help:      "Plugin execution latency.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 300, 900, 3600},
+	}, []string{"module", "plugin"})
+	writeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "result_write_duration_seconds",
+		Help:      "Result sink write latency per batch attempt.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sink", "collection"})
+	writeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "result_write_failures_total",
+		Help:      "Failed result sink batch write attempts.",
+	}, []string{"sink", "collection"})
+)
+
+func init() {
+	Registry.MustRegister(
+		pluginDuration,
+		writeDuration,
+		writeFailures,
+		gaugeSet,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// ObservePlugin 记录一次插件执行的时间
+func ObservePlugin(module string, plugin string, duration time.Duration) {
+	pluginDuration.WithLabelValues(module, plugin).Observe(duration.Seconds())
+}
+
+type writeSummary struct {
+	Writes   int64   `json:"writes"`
+	Failures int64   `json:"failures"`
+	Seconds  float64 `json:"-"`
+	Average  float64 `json:"avg"` // 平均写入时间，单位毫秒
+}
+
+var (
+	writeMu     sync.Mutex
+	writeTotals = make(map[string]*writeSummary) // 后端名称 -> 写入统计，用于心跳中的摘要
+)
+
+// ObserveWrite 记录一次结果批量写入的时间，写入失败时计数
+func ObserveWrite(sink string, collection string, duration time.Duration, err error) {
+	writeDuration.WithLabelValues(sink, collection).Observe(duration.Seconds())
+	if err != nil {
+		writeFailures.WithLabelValues(sink, collection).Inc()
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	total, ok := writeTotals[sink]
+	if !ok {
+		total = &writeSummary{}
+		writeTotals[sink] = total
+	}
+	total.Writes++
+	total.Seconds += duration.Seconds()
+	if err != nil {
+		total.Failures++
+	}
+}
+
+type gauge struct {
+	key  string
+	desc *prometheus.Desc
+	read func() map[string]float64
+}
+
+// gauges 采集时才读取当前值的指标，例如协程池和队列的长度
+type gauges struct {
+	mu    sync.Mutex
+	items []gauge
+}
+
+var gaugeSet = &gauges{}
+
+// Gauge 注册采集时读取的指标，read 返回标签值 -> 当前值
+func Gauge(name string, help string, label string, read func() map[string]float64) {
+	gaugeSet.mu.Lock()
+	defer gaugeSet.mu.Unlock()
+	gaugeSet.items = append(gaugeSet.items, gauge{
+		key:  name,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{label}, nil),
+		read: read,
+	})
+}
+
+func (g *gauges) list() []gauge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]gauge(nil), g.items...)
+}
+
+// Describe 指标在运行时注册，不预先声明
+func (g *gauges) Describe(ch chan<- *prometheus.Desc) {}
+
+func (g *gauges) Collect(ch chan<- prometheus.Metric) {
+	for _, item := range g.list() {
+		for label, value := range item.read() {
+			ch <- prometheus.MustNewConstMetric(item.desc, prometheus.GaugeValue, value, label)
+		}
+	}
+}
+
+// Summary 心跳中的指标摘要，只保留不为 0 的值
+func Summary() map[string]interface{} {
+	summary := make(map[string]interface{})
+	for _, item := range gaugeSet.list() {
+		values := make(map[string]float64)
+		for label, value := range item.read() {
+			if value != 0 {
+				values[label] = value
+			}
+		}
+		if len(values) != 0 {
+			summary[item.key] = values
+		}
+	}
+	writeMu.Lock()
+	writes := make(map[string]writeSummary, len(writeTotals))
+	for sink, total := range writeTotals {
+		w := *total
+		if w.Writes > 0 {
+			w.Average = math.Round(w.Seconds/float64(w.Writes)*1000*10) / 10
+		}
+		writes[sink] = w
+	}
+	writeMu.Unlock()
+	if len(writes) != 0 {
+		summary["result_writes"] = writes
+	}
+	return summary
+}
+
+// Serve 开启 HTTP 指标接口 http://<addr>/metrics，地址为空时不开启
+func Serve(addr string) {
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	logger.SlogInfoLocal(fmt.Sprintf("metrics listen on %v", addr))
+	go func() {
+		err := http.ListenAndServe(addr, mux)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("metrics server error: %v", err))
+		}
+	}()
+}
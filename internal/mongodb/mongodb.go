@@ -19,6 +19,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/url"
+	"strings"
+	"time"
 )
 
 type Client struct {
@@ -55,28 +57,70 @@ var MongodbClient *Client
 //	return &Client{client: client, database: db}, nil
 //}
 
-func Initialize() {
-	encodedPassword := url.QueryEscape(global.AppConfig.MongoDB.Password)
-	connectionURI := fmt.Sprintf("mongodb://%s:%s@%s:%s/?maxPoolSize=50", global.AppConfig.MongoDB.User, encodedPassword, global.AppConfig.MongoDB.IP, global.AppConfig.MongoDB.Port)
+// withAuthSource 在连接字符串的参数中加入 authSource，连接字符串中已有的 authSource 被覆盖（后出现的参数生效）
+func withAuthSource(uri string, source string) string {
+	param := "authSource=" + url.QueryEscape(source)
+	if strings.Contains(uri, "?") {
+		return uri + "&" + param
+	}
+	if scheme := strings.Index(uri, "://"); scheme != -1 && !strings.Contains(uri[scheme+3:], "/") {
+		// 没有路径时需要先加上 /
+		return uri + "/?" + param
+	}
+	return uri + "?" + param
+}
+
+// Initialize 连接 mongodb，配置了 uri 时使用完整的连接字符串，连接失败时重试，全部失败后返回错误
+func Initialize() error {
+	cfg := global.AppConfig.MongoDB
+	connectionURI := cfg.URI
+	if connectionURI == "" {
+		encodedPassword := url.QueryEscape(cfg.Password)
+		connectionURI = fmt.Sprintf("mongodb://%s:%s@%s:%s/?maxPoolSize=50", url.QueryEscape(cfg.User), encodedPassword, cfg.IP, cfg.Port)
+	}
+	if cfg.AuthSource != "" {
+		// 单独配置的认证数据库写入连接字符串，凭据来自连接字符串或单独配置时都生效
+		connectionURI = withAuthSource(connectionURI, cfg.AuthSource)
+	}
 	clientOptions := options.Client().ApplyURI(connectionURI)
+	if err := clientOptions.Validate(); err != nil {
+		return fmt.Errorf("mongodb uri invalid: %v", err)
+	}
 	var MaxPoolSizevalue uint64 = 50
 	clientOptions.MaxPoolSize = &MaxPoolSizevalue
 	var MaxConnectingValue uint64 = 10
 	clientOptions.MaxConnecting = &MaxConnectingValue
 	var MinPoolSizeValue uint64 = 5
 	clientOptions.MinPoolSize = &MinPoolSizeValue
+	// 单独配置的副本集覆盖连接字符串中的设置
+	if cfg.ReplicaSet != "" {
+		clientOptions.SetReplicaSet(cfg.ReplicaSet)
+	}
+	tlsConfig, err := cfg.TLS.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("mongodb tls config error: %v", err)
+	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
 	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
-		fmt.Printf("mongodb connect error: %v", err)
+		return fmt.Errorf("mongodb connect error: %v", err)
 	}
 
-	err = client.Ping(context.Background(), nil)
+	err = global.Connect("mongodb", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return client.Ping(ctx, nil)
+	})
 	if err != nil {
-		fmt.Printf("mongodb ping error: %v", err)
+		_ = client.Disconnect(context.Background())
+		return err
 	}
-	db := client.Database(global.AppConfig.MongoDB.Database)
+	db := client.Database(cfg.Database)
 
 	MongodbClient = &Client{client: client, database: db}
+	return nil
 }
 
 // GetCollection 获取指定集合
@@ -146,6 +190,20 @@ func (c *Client) Upsert(collectionName string, selector, update interface{}) (*m
 	return collection.UpdateOne(context.Background(), selector, update, opts)
 }
 
+// FindOneAndUpsert 原子更新或插入单个文档，result 为更新前的文档，文档不存在时返回 mongo.ErrNoDocuments
+func (c *Client) FindOneAndUpsert(collectionName string, selector, update, result interface{}) error {
+	collection := c.GetCollection(collectionName)
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	return collection.FindOneAndUpdate(context.Background(), selector, update, opts).Decode(result)
+}
+
+// CreateIndex 创建索引，索引已存在时不会重复创建
+func (c *Client) CreateIndex(collectionName string, keys bson.D, unique bool) (string, error) {
+	collection := c.GetCollection(collectionName)
+	model := mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(unique)}
+	return collection.Indexes().CreateOne(context.Background(), model)
+}
+
 // BulkWrite 批量写入或更新
 func (c *Client) BulkWrite(collectionName string, operations []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
 	collection := c.GetCollection(collectionName)
@@ -0,0 +1,55 @@
+// node-------------------------------------
+// @file      : metrics.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/7 20:22
+// -------------------------------------------
+
+package node
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/metrics"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/notification"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+)
+
+// RegisterMetrics 注册采集时读取的节点指标，同时用于心跳中的指标摘要
+func RegisterMetrics() {
+	metrics.Gauge("pool_running_workers", "Running workers per pool.", "pool", func() map[string]float64 {
+		values := make(map[string]float64)
+		for name, stat := range pool.PoolManage.Stats() {
+			values[name] = float64(stat.Running)
+		}
+		return values
+	})
+	metrics.Gauge("pool_free_workers", "Free workers per pool.", "pool", func() map[string]float64 {
+		values := make(map[string]float64)
+		for name, stat := range pool.PoolManage.Stats() {
+			values[name] = float64(stat.Free)
+		}
+		return values
+	})
+	metrics.Gauge("module_input_depth", "Messages waiting in module input channels.", "module", func() map[string]float64 {
+		return floats(pipeline.Progresses.InputDepth())
+	})
+	metrics.Gauge("result_queue_backlog", "Results waiting in result queues.", "queue", func() map[string]float64 {
+		return floats(results.Backlog())
+	})
+	metrics.Gauge("notification_queue_backlog", "Notifications waiting in notification queues.", "queue", func() map[string]float64 {
+		return floats(notification.Backlog())
+	})
+	metrics.Gauge("external_processes", "Running external tool processes.", "program", func() map[string]float64 {
+		return floats(utils.Processes.Counts())
+	})
+}
+
+func floats(values map[string]int) map[string]float64 {
+	result := make(map[string]float64, len(values))
+	for key, value := range values {
+		result[key] = float64(value)
+	}
+	return result
+}
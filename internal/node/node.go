@@ -9,17 +9,37 @@ package node
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/metrics"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/schedule"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/updater"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"github.com/shirou/gopsutil/v3/mem"
 	"time"
 )
 
+// StateStopping 节点正在停止，不再获取新任务
+const StateStopping = 4
+
+// MarkStopping 节点开始停止时立即更新节点状态，不等待下一次心跳
+func MarkStopping() {
+	err := redis.RedisClient.HSet(context.Background(), "node:"+global.AppConfig.NodeName, "state", StateStopping)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("set node stopping state error: %v", err))
+	}
+}
+
 func Register() {
 	nodeName := global.AppConfig.NodeName
 	key := "node:" + nodeName
@@ -39,7 +59,7 @@ func Register() {
 				"cpuNum":        0,
 				"TotleMem":      float64(memInfo.Total) / 1024 / 1024,
 				"memNum":        0,
-				"state":         1, //1运行中 2暂停 3未连接
+				"state":         1, //1运行中 2暂停 3未连接 4停止中
 				"version":       global.VERSION,
 				"modulesConfig": modulesConfig,
 			}
@@ -49,11 +69,52 @@ func Register() {
 				return
 			}
 			logger.SlogInfo(fmt.Sprintf("Register Success:%v - version %v", nodeName, global.VERSION))
+			// 注册成功后确认更新
+			updater.Confirm()
 			firstRegister = false
 		} else {
 			key = "node:" + global.AppConfig.NodeName
 			cpuNum, memNum := utils.Tools.GetSystemUsage()
 			run, fin := handler.TaskHandle.GetRunFin()
+			// 插件运行统计，用于查看插件是否异常
+			pluginStats, err := json.Marshal(pipeline.PluginStats.Node())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal plugin stats error: %v", err))
+			}
+			// 结果写入的重试、死信和丢弃数量
+			resultStats, err := json.Marshal(results.WriteStats.Snapshot())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal result stats error: %v", err))
+			}
+			// 节点正在运行的任务
+			activeTasks, err := json.Marshal(pool.TaskQueue.Active())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal active tasks error: %v", err))
+			}
+			// 不在扫描范围内被丢弃的数据数量
+			scopeDrops, err := json.Marshal(scope.Drops.Node())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal scope drops error: %v", err))
+			}
+			// 定时任务的下一次运行时间
+			schedules, err := json.Marshal(schedule.Statuses())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal schedules error: %v", err))
+			}
+			// 节点的能力标签，任务可以要求节点具有指定标签
+			labels, err := json.Marshal(config.NodeLabels())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal node labels error: %v", err))
+			}
+			// 协程池、队列、外部程序和结果写入的指标摘要
+			metricSummary, err := json.Marshal(metrics.Summary())
+			if err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("marshal metrics error: %v", err))
+			}
+			state := global.AppConfig.State
+			if shutdown.Stopping() {
+				state = StateStopping
+			}
 			nodeInfo := map[string]interface{}{
 				"updateTime": utils.Tools.GetTimeNow(),
 				"cpuNum":     cpuNum,
@@ -61,10 +122,17 @@ func Register() {
 				"maxTaskNum": config.ModulesConfig.MaxGoroutineCount,
 				"running":    run,
 				"finished":   fin,
-				"state":      global.AppConfig.State,
+				"state":      state,
 				"version":    global.VERSION,
+				"plugins":    string(pluginStats),
+				"results":    string(resultStats),
+				"tasks":      string(activeTasks),
+				"schedules":  string(schedules),
+				"scope":      string(scopeDrops),
+				"labels":     string(labels),
+				"metrics":    string(metricSummary),
 			}
-			err := redis.RedisClient.HMSet(context.Background(), key, nodeInfo)
+			err = redis.RedisClient.HMSet(context.Background(), key, nodeInfo)
 			if err != nil {
 				logger.SlogErrorLocal(fmt.Sprintf("Error setting initial values: %s", err))
 				continue
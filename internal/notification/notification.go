@@ -56,6 +56,24 @@ func processQueue(module string, mq *NotificationQueue) {
 	}
 }
 
+// Backlog 每个通知队列中等待发送的通知数量
+func Backlog() map[string]int {
+	backlog := make(map[string]int, len(NotificationQueues))
+	for module, mq := range NotificationQueues {
+		backlog[module] = len(mq.Queue)
+	}
+	return backlog
+}
+
+// Flush 节点退出时发送队列中剩余的通知
+func Flush() {
+	for module, mq := range NotificationQueues {
+		for len(mq.Queue) > 0 {
+			processBatch(module, mq)
+		}
+	}
+}
+
 // processBatch 从队列中取出最多 batchSize 条数据进行处理
 func processBatch(module string, mq *NotificationQueue) {
 	var buffer = ""
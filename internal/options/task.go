@@ -7,32 +7,61 @@
 
 package options
 
-import "sync"
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"sync"
+)
 
 type TaskOptions struct {
-	ID                  string                       //任务ID
-	TaskName            string                       // 任务名称
-	Target              string                       //目标
-	Type                string                       //任务类型
-	TargetHandler       []string                     // 目标解析模块
-	SubdomainScan       []string                     // 子域名扫描模块
-	SubdomainSecurity   []string                     // 子域名安全检测模块
-	AssetMapping        []string                     // 资产测绘模块
-	AssetHandle         []string                     // 资产处理模块
-	PortScanPreparation []string                     // 端口扫描预处理模块
-	PortScan            []string                     // 端口扫描模块
-	PortFingerprint     []string                     // 端口指纹识别模块
-	URLScan             []string                     // URL扫描模块
-	URLSecurity         []string                     // URL安全检测模块
-	WebCrawler          []string                     // 爬虫模块
-	DirScan             []string                     //目录扫描模块
-	VulnerabilityScan   []string                     //漏洞扫描模块
-	Parameters          map[string]map[string]string // 各个插件的参数
-	IsRestart           bool                         // 是否为重启后从本地获取缓存中获取的目标
-	Duplicates          string                       // 是否忽略已经存储在mongodb中的子域名
-	InputChan           map[string]chan interface{}  // 每个模块的输入
-	ModuleRunWg         *sync.WaitGroup              // 总的WaitGroup
-	SubdomainFilename   string                       // 子域名扫描字典
-	ProtRangeId         string                       // 端口范围在数据库中的id
-	PortRange           string                       // 端口范围
+	ID                  string                        //任务ID
+	TaskName            string                        // 任务名称
+	Target              string                        //目标
+	Type                string                        //任务类型
+	TargetHandler       []string                      // 目标解析模块
+	SubdomainScan       []string                      // 子域名扫描模块
+	SubdomainSecurity   []string                      // 子域名安全检测模块
+	AssetMapping        []string                      // 资产测绘模块
+	AssetHandle         []string                      // 资产处理模块
+	PortScanPreparation []string                      // 端口扫描预处理模块
+	PortScan            []string                      // 端口扫描模块
+	PortFingerprint     []string                      // 端口指纹识别模块
+	URLScan             []string                      // URL扫描模块
+	URLSecurity         []string                      // URL安全检测模块
+	WebCrawler          []string                      // 爬虫模块
+	DirScan             []string                      //目录扫描模块
+	VulnerabilityScan   []string                      //漏洞扫描模块
+	Parameters          map[string]map[string]string  // 各个插件的参数
+	IsRestart           bool                          // 是否为重启后从本地获取缓存中获取的目标
+	Duplicates          string                        // 是否忽略已经存储在mongodb中的子域名
+	InputChan           map[string]chan types.Message // 每个模块的输入
+	ModuleRunWg         *sync.WaitGroup               // 总的WaitGroup
+	SubdomainFilename   string                        // 子域名扫描字典
+	ProtRangeId         string                        // 端口范围在数据库中的id
+	PortRange           string                        // 端口范围
+	Pipeline            *pipeline.Graph               // 扫描流程图，为空时使用节点默认流程
+	Priority            int                           // 任务优先级，同时运行的任务按优先级比例分配协程，默认为 1
+	Schedule            *Schedule                     // 定时运行配置，为空时只运行一次
+	Scope               *types.ScopeRules             // 任务的扫描范围，和目标所属项目的扫描范围同时生效
+	DryRun              bool                          // 试运行，只生成任务计划，不向目标发送任何请求
+	Requires            []string                      // 任务需要的节点能力标签，节点缺少任意标签时拒绝任务
+	TargetTimeout       string                        // 每个目标的总运行时间，例如 6h，超时后目标标记为部分完成，为空时不限制
+	TaskTimeout         string                        // 任务的总运行时间，从节点开始运行任务时计算，超时后正在运行的目标标记为部分完成，未开始的目标不再运行
+	Retry               *RetryPolicy                  // 目标失败或部分完成后的重试策略，为空时不重试
+}
+
+// RetryPolicy 目标的重试策略，失败类型见 pipeline.FailureClasses
+type RetryPolicy struct {
+	MaxAttempts  int               `json:"maxAttempts"`  // 每个目标最多重试的次数
+	Backoff      map[string]string `json:"backoff"`      // 失败类型 -> 第一次重试前的等待时间，例如 {"network": "1m", "timeout": "10m"}，没有设置的失败类型不重试
+	Multiplier   float64           `json:"multiplier"`   // 每次重试等待时间的倍数，默认为 2
+	Redistribute bool              `json:"redistribute"` // 等待结束后将目标放回任务的 redis 列表由任意节点运行，否则在本节点重试
+}
+
+// Schedule 任务的定时运行配置，节点按 cron 表达式重新运行任务的所有目标
+type Schedule struct {
+	Cron    string `json:"cron"`    // cron 表达式
+	Jitter  string `json:"jitter"`  // 每次运行随机延迟的最大时间，例如 10m
+	Overlap string `json:"overlap"` // 上次运行没有结束时的处理方式：skip 跳过（默认）、queue 上次运行结束后运行、cancel 取消上次运行
+	CatchUp bool   `json:"catchUp"` // 节点停止期间错过的运行是否在启动后补运行一次
 }
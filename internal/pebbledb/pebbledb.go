@@ -8,12 +8,19 @@
 package pebbledb
 
 import (
+	"errors"
 	"fmt"
 	"github.com/cockroachdb/pebble"
+	"sync"
 )
 
+// ErrClosed 数据库已经关闭，节点退出时仍在运行的协程写入会返回该错误
+var ErrClosed = errors.New("pebbledb closed")
+
 type PebbleDB struct {
-	db *pebble.DB
+	db     *pebble.DB
+	mu     sync.RWMutex
+	closed bool
 }
 
 var PebbleStore *PebbleDB
@@ -29,11 +36,41 @@ func NewPebbleDB(options *pebble.Options, dbPath string) (*PebbleDB, error) {
 
 // Put 将键值对存入数据库
 func (p *PebbleDB) Put(key, value []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
 	return p.db.Set(key, value, pebble.Sync)
 }
 
+// PutNoSync 将键值对存入数据库，不等待写入磁盘，之后的 Sync 或同步写入完成后一起持久化
+func (p *PebbleDB) PutNoSync(key, value []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	return p.db.Set(key, value, pebble.NoSync)
+}
+
+// Sync 将之前未同步的写入持久化到磁盘
+func (p *PebbleDB) Sync() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	return p.db.LogData(nil, pebble.Sync)
+}
+
 // Get 从数据库中获取指定键的值
 func (p *PebbleDB) Get(key []byte) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
 	value, closer, err := p.db.Get(key)
 	if err != nil {
 		return nil, err
@@ -44,16 +81,32 @@ func (p *PebbleDB) Get(key []byte) ([]byte, error) {
 
 // Delete 删除数据库中的键
 func (p *PebbleDB) Delete(key []byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
 	return p.db.Delete(key, pebble.Sync)
 }
 
-// Close 关闭数据库连接
+// Close 关闭数据库连接，等待正在进行的读写完成，重复关闭不会出错
 func (p *PebbleDB) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
 	return p.db.Close()
 }
 
 // BatchWrite 批量写入键值对
 func (p *PebbleDB) BatchWrite(pairs map[string]string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
 	batch := p.db.NewBatch()
 	defer batch.Close()
 
@@ -70,15 +123,54 @@ func (p *PebbleDB) BatchWrite(pairs map[string]string) error {
 	return nil
 }
 
+// BatchDelete 批量删除键
+func (p *PebbleDB) BatchDelete(keys [][]byte) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	batch := p.db.NewBatch()
+	defer batch.Close()
+
+	for _, key := range keys {
+		if err := batch.Delete(key, nil); err != nil {
+			return err
+		}
+	}
+
+	return batch.Commit(pebble.NoSync)
+}
+
 // Compact 强制压缩数据库，释放空间
 func (p *PebbleDB) Compact() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
 	start := []byte("")               // 从最开始位置压缩
 	end := []byte("zzzzzzzzzzzzzzzz") // 直到最大键的后面
 	// 调用 Compact 方法进行压缩
 	return p.db.Compact(start, end, true)
 }
 
+// DiskUsage 数据库占用的磁盘空间，单位字节
+func (p *PebbleDB) DiskUsage() (uint64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return 0, ErrClosed
+	}
+	return p.db.Metrics().DiskSpaceUsage(), nil
+}
+
 func (p *PebbleDB) GetKeysWithPrefix(prefix string) (map[string][]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
 	result := make(map[string][]byte)
 
 	// 创建迭代器并设置范围
@@ -99,7 +191,8 @@ func (p *PebbleDB) GetKeysWithPrefix(prefix string) (map[string][]byte, error) {
 	// 遍历所有符合条件的键
 	for iter.First(); iter.Valid(); iter.Next() {
 		key := iter.Key()
-		value := iter.Value()
+		// 迭代器的值在移动后失效，需要复制
+		value := append([]byte(nil), iter.Value()...)
 		result[string(key)] = value
 	}
 
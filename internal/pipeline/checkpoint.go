@@ -0,0 +1,274 @@
+// pipeline-------------------------------------
+// @file      : checkpoint.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/25 20:12
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"sort"
+)
+
+// 阶段检查点：checkpoint:<任务ID>:<目标md5>:<阶段>:done 表示阶段已完成
+// checkpoint:<任务ID>:<目标md5>:<阶段>:out:<序号> 为阶段输出的消息
+const checkpointPrefix = "checkpoint:"
+
+// checkpointMessage 记录的消息，Payload 根据 Kind 解析
+type checkpointMessage struct {
+	Kind    types.Kind      `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+	Target  string          `json:"target"`
+	TaskId  string          `json:"taskId"`
+	Plugin  string          `json:"plugin"`
+}
+
+// Checkpoints 一个目标的阶段检查点，重启后已完成的阶段不再运行，记录的输出重新发送给未完成的下游
+type Checkpoints struct {
+	taskId string
+	target string
+	prefix string
+}
+
+// NewCheckpoints 本地数据库未初始化时返回 nil，不记录检查点
+func NewCheckpoints(taskId string, target string) *Checkpoints {
+	if pebbledb.PebbleStore == nil {
+		return nil
+	}
+	return &Checkpoints{
+		taskId: taskId,
+		target: target,
+		prefix: fmt.Sprintf("%v%v:%v:", checkpointPrefix, taskId, utils.Tools.CalculateMD5(target)),
+	}
+}
+
+func (c *Checkpoints) doneKey(stage string) []byte {
+	return []byte(c.prefix + stage + ":done")
+}
+
+func (c *Checkpoints) outputPrefix(stage string) string {
+	return c.prefix + stage + ":out:"
+}
+
+// Done 阶段是否已经完成
+func (c *Checkpoints) Done(stage string) bool {
+	_, err := pebbledb.PebbleStore.Get(c.doneKey(stage))
+	return err == nil
+}
+
+// Reset 删除未完成阶段上次运行记录的输出，阶段重新运行时重新记录
+func (c *Checkpoints) Reset(stage string) {
+	deletePrefix(c.outputPrefix(stage))
+}
+
+// Clear 目标运行完毕后删除目标的所有检查点
+func (c *Checkpoints) Clear() {
+	deletePrefix(c.prefix)
+}
+
+// ClearTaskCheckpoints 删除任务所有目标的检查点
+func ClearTaskCheckpoints(taskId string) {
+	if pebbledb.PebbleStore == nil {
+		return
+	}
+	deletePrefix(checkpointPrefix + taskId + ":")
+}
+
+func deletePrefix(prefix string) {
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(prefix)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v read error: %v", prefix, err))
+		return
+	}
+	var keys [][]byte
+	for key := range records {
+		keys = append(keys, []byte(key))
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := pebbledb.PebbleStore.BatchDelete(keys); err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v delete error: %v", prefix, err))
+	}
+}
+
+// record 记录阶段输出的消息，不等待写入磁盘，阶段完成时一起持久化
+func (c *Checkpoints) record(stage string, seq uint64, msg types.Message) error {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(checkpointMessage{Kind: msg.Kind, Payload: payload, Target: msg.Target, TaskId: msg.TaskId, Plugin: msg.Plugin})
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%v%020d", c.outputPrefix(stage), seq)
+	return pebbledb.PebbleStore.PutNoSync([]byte(key), data)
+}
+
+// finish 标记阶段完成，同步写入保证之前记录的输出也已经持久化
+func (c *Checkpoints) finish(stage string) error {
+	return pebbledb.PebbleStore.Put(c.doneKey(stage), []byte(utils.Tools.GetTimeNow()))
+}
+
+// complete 阶段处理完所有输入后标记完成，任务取消或目标超过截止时间时阶段没有处理完输入，不标记完成
+func (c *Checkpoints) complete(stage string) {
+	select {
+	case <-contextmanager.GlobalContextManagers.GetTargetContext(c.taskId, c.target).Done():
+	default:
+		if err := c.finish(stage); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v finish error: %v", stage, err))
+		}
+	}
+}
+
+// Recorder 记录阶段的输出，阶段的输出全部处理后标记阶段完成，由阶段的 Relay 调用
+type Recorder struct {
+	Stage  string
+	cp     *Checkpoints
+	seq    uint64
+	failed bool // 输出记录不完整，不标记完成，重启后重新运行该阶段
+}
+
+func NewRecorder(cp *Checkpoints, stage string) *Recorder {
+	return &Recorder{
+		Stage: stage,
+		cp:    cp,
+	}
+}
+
+// Record 记录阶段输出的一条消息，没有设置时不记录
+func (r *Recorder) Record(msg types.Message) {
+	if r == nil || r.failed {
+		return
+	}
+	r.seq++
+	if err := r.cp.record(r.Stage, r.seq, msg); err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v record error: %v", r.Stage, err))
+		r.failed = true
+	}
+}
+
+// Finish 阶段的输出全部处理后标记阶段完成
+func (r *Recorder) Finish() {
+	if r == nil || r.failed {
+		return
+	}
+	r.cp.complete(r.Stage)
+}
+
+// outputs 按记录顺序获取阶段输出的消息
+func (c *Checkpoints) outputs(stage string) ([]types.Message, error) {
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(c.outputPrefix(stage))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var messages []types.Message
+	for _, key := range keys {
+		var record checkpointMessage
+		if err := json.Unmarshal(records[key], &record); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v decode error: %v", key, err))
+			continue
+		}
+		payload, err := types.DecodePayload(record.Kind, record.Payload)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v decode error: %v", key, err))
+			continue
+		}
+		messages = append(messages, types.Message{Kind: record.Kind, Payload: payload, Target: record.Target, TaskId: record.TaskId, Plugin: record.Plugin})
+	}
+	return messages, nil
+}
+
+// Replay 代替已经完成的阶段，丢弃输入，将上次运行记录的输出发送到下游
+type Replay struct {
+	Stage string
+	Next  interfaces.ModuleRunner
+	Input chan types.Message
+	cp    *Checkpoints
+	emit  bool // 下游都已完成时不需要发送
+}
+
+func NewReplay(cp *Checkpoints, stage string, next interfaces.ModuleRunner, emit bool) *Replay {
+	return &Replay{
+		Stage: stage,
+		Next:  next,
+		cp:    cp,
+		emit:  emit,
+	}
+}
+
+func (r *Replay) ModuleRun() error {
+	drained := make(chan struct{})
+	go func() {
+		Drain(r.Input)
+		close(drained)
+	}()
+	if r.Next == nil {
+		<-drained
+		return nil
+	}
+	go func() {
+		err := r.Next.ModuleRun()
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
+		}
+	}()
+	if r.emit {
+		messages, err := r.cp.outputs(r.Stage)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("checkpoint %v read error: %v", r.Stage, err))
+		}
+		ctx := contextmanager.GlobalContextManagers.GetTargetContext(r.cp.taskId, r.cp.target)
+	loop:
+		for _, msg := range messages {
+			select {
+			case <-ctx.Done():
+				break loop
+			case r.Next.GetInput() <- msg:
+			}
+		}
+		logger.SlogInfoLocal(fmt.Sprintf("checkpoint %v replayed: %v", r.Stage, len(messages)))
+	}
+	<-drained
+	r.Next.CloseInput()
+	return nil
+}
+
+func (r *Replay) SetInput(ch chan types.Message) {
+	r.Input = ch
+}
+
+func (r *Replay) GetInput() chan types.Message {
+	return r.Input
+}
+
+func (r *Replay) CloseInput() {
+	close(r.Input)
+}
+
+func (r *Replay) GetName() string {
+	return r.Stage + "-Replay"
+}
+
+func (r *Replay) Consumes() []types.Kind {
+	return nil
+}
+
+func (r *Replay) Produces() []types.Kind {
+	return nil
+}
@@ -0,0 +1,180 @@
+// pipeline-------------------------------------
+// @file      : checkpoint_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/13 20:10
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testModule 模拟阶段的模块，接收输入直到关闭，与模块一样在返回前结束 ModuleRunWg 的计数
+type testModule struct {
+	Input    chan types.Message
+	received []types.Message
+	wg       *sync.WaitGroup
+	linger   time.Duration // 结束计数后到返回之间的时间
+}
+
+func newTestModule(wg *sync.WaitGroup, linger time.Duration) *testModule {
+	wg.Add(1)
+	return &testModule{Input: make(chan types.Message, 100), wg: wg, linger: linger}
+}
+
+func (m *testModule) ModuleRun() error {
+	for data := range m.Input {
+		m.received = append(m.received, data)
+	}
+	m.wg.Done()
+	time.Sleep(m.linger)
+	return nil
+}
+
+func (m *testModule) SetInput(ch chan types.Message) {
+	m.Input = ch
+}
+
+func (m *testModule) GetInput() chan types.Message {
+	return m.Input
+}
+
+func (m *testModule) CloseInput() {
+	close(m.Input)
+}
+
+func (m *testModule) GetName() string {
+	return "Test"
+}
+
+func (m *testModule) Consumes() []types.Kind {
+	return nil
+}
+
+func (m *testModule) Produces() []types.Kind {
+	return nil
+}
+
+func targetMessages(taskId string, targets ...string) []types.Message {
+	var messages []types.Message
+	for _, target := range targets {
+		messages = append(messages, types.Message{Kind: types.KindTarget, Payload: target, Target: "example.com", TaskId: taskId})
+	}
+	return messages
+}
+
+// checkpointKeys 目标剩余的检查点数量
+func checkpointKeys(t *testing.T, cp *Checkpoints) int {
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(cp.prefix)
+	if err != nil {
+		t.Fatalf("GetKeysWithPrefix() error: %v", err)
+	}
+	return len(records)
+}
+
+func TestCheckpointResume(t *testing.T) {
+	taskId := "checkpoint-resume"
+	cp := NewCheckpoints(taskId, "example.com")
+	defer cp.Clear()
+	messages := targetMessages(taskId, "a.example.com", "b.example.com", "c.example.com")
+
+	// 第一次运行：阶段 A 的输出经过 Relay 记录后发送到 B
+	var wg sync.WaitGroup
+	child := newTestModule(&wg, 0)
+	relay := NewRelay("A", []string{"B"}, []interfaces.ModuleRunner{child}, &wg)
+	relay.Recorder = NewRecorder(cp, "A")
+	relay.SetInput(make(chan types.Message, 100))
+	go relay.ModuleRun()
+	for _, msg := range messages {
+		relay.GetInput() <- msg
+	}
+	relay.CloseInput()
+	wg.Wait()
+	if !reflect.DeepEqual(child.received, messages) {
+		t.Fatalf("B received %v, want %v", child.received, messages)
+	}
+	if !cp.Done("A") || cp.Done("B") {
+		t.Fatalf("Done(A) = %v, Done(B) = %v, want true, false", cp.Done("A"), cp.Done("B"))
+	}
+
+	// 重启后 A 已完成，记录的输出按顺序重新发送到未完成的 B
+	var resumeWg sync.WaitGroup
+	resumed := newTestModule(&resumeWg, 0)
+	replay := NewReplay(NewCheckpoints(taskId, "example.com"), "A", resumed, true)
+	replay.SetInput(make(chan types.Message, 100))
+	go replay.ModuleRun()
+	replay.GetInput() <- targetMessages(taskId, "ignored.example.com")[0]
+	replay.CloseInput()
+	resumeWg.Wait()
+	if !reflect.DeepEqual(resumed.received, messages) {
+		t.Fatalf("B resumed with %v, want %v", resumed.received, messages)
+	}
+
+	// 未完成的阶段重新运行时删除上次记录的输出
+	cp.Reset("A")
+	if outputs, _ := cp.outputs("A"); len(outputs) != 0 {
+		t.Fatalf("outputs(A) after Reset = %v, want empty", outputs)
+	}
+	cp.Clear()
+	if n := checkpointKeys(t, cp); n != 0 {
+		t.Fatalf("checkpoint keys after Clear = %v, want 0", n)
+	}
+}
+
+func TestCheckpointCompleteBeforeWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		sink     bool // 没有输出的阶段使用 Sink，否则为没有下游的 Relay
+		canceled bool
+	}{
+		{name: "leaf relay"},
+		{name: "sink", sink: true},
+		{name: "canceled leaf relay", canceled: true},
+		{name: "canceled sink", sink: true, canceled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskId := "checkpoint-wait-" + tt.name
+			ctx := contextmanager.GlobalContextManagers.AddTargetContext(taskId, "example.com", 0)
+			defer contextmanager.GlobalContextManagers.DeleteTargetContext(taskId, "example.com")
+			if tt.canceled {
+				contextmanager.GlobalContextManagers.CancelTargetContext(taskId, "example.com")
+				<-ctx.Done()
+			}
+			cp := NewCheckpoints(taskId, "example.com")
+			var wg sync.WaitGroup
+			var runner interfaces.ModuleRunner
+			if tt.sink {
+				// 模块结束计数后还没有返回，Sink 仍需要在计数结束前标记完成
+				runner = NewSink(newTestModule(&wg, 50*time.Millisecond), "S", cp, &wg)
+			} else {
+				relay := NewRelay("S", nil, nil, &wg)
+				relay.Recorder = NewRecorder(cp, "S")
+				runner = relay
+			}
+			runner.SetInput(make(chan types.Message, 100))
+			go runner.ModuleRun()
+			runner.GetInput() <- targetMessages(taskId, "a.example.com")[0]
+			runner.CloseInput()
+			wg.Wait()
+			if cp.Done("S") == tt.canceled {
+				t.Fatalf("Done(S) after wait = %v, want %v", cp.Done("S"), !tt.canceled)
+			}
+			// 目标运行结束后删除检查点，不能再有延迟写入的完成标记
+			cp.Clear()
+			time.Sleep(100 * time.Millisecond)
+			if n := checkpointKeys(t, cp); n != 0 {
+				t.Fatalf("checkpoint keys after Clear = %v, want 0", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// pipeline-------------------------------------
+// @file      : graph.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/12 20:16
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"os"
+	"sync"
+)
+
+// CustomModule 自定义阶段使用的模块名，插件从 plugin/Custom 目录加载
+const CustomModule = "Custom"
+
+// Stage 扫描流程中的一个阶段
+type Stage struct {
+	Name    string   `json:"name" yaml:"name"`                           // 阶段名称，在图中唯一
+	Module  string   `json:"module" yaml:"module"`                       // 阶段使用的模块
+	Plugins []string `json:"plugins,omitempty" yaml:"plugins,omitempty"` // 阶段使用的插件，为空时使用任务中该模块的插件
+	Next    []string `json:"next,omitempty" yaml:"next,omitempty"`       // 下游阶段，多个时输出会复制到每个下游
+}
+
+// Graph 扫描流程图
+type Graph struct {
+	Entry  string  `json:"entry" yaml:"entry"`   // 入口阶段，接收任务目标
+	Stages []Stage `json:"stages" yaml:"stages"` // 所有阶段
+}
+
+var (
+	defaultGraph *Graph
+	mu           sync.RWMutex
+)
+
+// DefaultGraph 原有的线性模块链
+func DefaultGraph() *Graph {
+	chain := []string{
+		"TargetHandler",
+		"SubdomainScan",
+		"SubdomainSecurity",
+		"PortScanPreparation",
+		"PortScan",
+		"PortFingerprint",
+		"AssetMapping",
+		"AssetHandle",
+		"URLScan",
+		"WebCrawler",
+		"URLSecurity",
+		"DirScan",
+		"VulnerabilityScan",
+	}
+	g := &Graph{Entry: chain[0]}
+	for i, module := range chain {
+		stage := Stage{Name: module, Module: module}
+		if i+1 < len(chain) {
+			stage.Next = []string{chain[i+1]}
+		}
+		g.Stages = append(g.Stages, stage)
+	}
+	return g
+}
+
+// Initialize 加载节点默认流程图，文件不存在时写入内置的默认流程
+func Initialize(path string) error {
+	g := DefaultGraph()
+	if _, err := os.Stat(path); err == nil {
+		var fileGraph Graph
+		if err := utils.Tools.ReadYAMLFile(path, &fileGraph); err != nil {
+			return fmt.Errorf("read pipeline file %v error: %v", path, err)
+		}
+		if err := fileGraph.Validate(); err != nil {
+			return fmt.Errorf("pipeline file %v invalid: %v", path, err)
+		}
+		g = &fileGraph
+	} else {
+		if err := utils.Tools.WriteYAMLFile(path, g); err != nil {
+			logger.SlogWarnLocal(fmt.Sprintf("write default pipeline file %v error: %v", path, err))
+		}
+	}
+	SetDefault(g)
+	return nil
+}
+
+// SetDefault 设置节点默认流程图
+func SetDefault(g *Graph) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultGraph = g
+}
+
+// Default 获取节点默认流程图，任务中未指定流程时使用
+func Default() *Graph {
+	mu.RLock()
+	defer mu.RUnlock()
+	if defaultGraph == nil {
+		return DefaultGraph()
+	}
+	return defaultGraph
+}
+
+// Stage 根据名称获取阶段
+func (g *Graph) Stage(name string) (Stage, bool) {
+	for _, stage := range g.Stages {
+		if stage.Name == name {
+			return stage, true
+		}
+	}
+	return Stage{}, false
+}
+
+// Upstreams 统计每个阶段的上游阶段数量
+func (g *Graph) Upstreams() map[string]int {
+	counts := make(map[string]int)
+	for _, stage := range g.Stages {
+		for _, next := range stage.Next {
+			counts[next]++
+		}
+	}
+	return counts
+}
+
+// Validate 检查流程图结构：名称唯一、引用存在、无环、所有阶段可从入口到达
+func (g *Graph) Validate() error {
+	if g == nil || len(g.Stages) == 0 {
+		return fmt.Errorf("pipeline has no stage")
+	}
+	stages := make(map[string]Stage)
+	for _, stage := range g.Stages {
+		if stage.Name == "" {
+			return fmt.Errorf("pipeline stage name is empty")
+		}
+		if stage.Module == "" {
+			return fmt.Errorf("pipeline stage %v has no module", stage.Name)
+		}
+		if _, ok := stages[stage.Name]; ok {
+			return fmt.Errorf("pipeline stage %v is duplicated", stage.Name)
+		}
+		if stage.Module == CustomModule && len(stage.Plugins) == 0 {
+			return fmt.Errorf("custom stage %v has no plugin", stage.Name)
+		}
+		stages[stage.Name] = stage
+	}
+	if _, ok := stages[g.Entry]; !ok {
+		return fmt.Errorf("pipeline entry %v not found", g.Entry)
+	}
+	for _, stage := range g.Stages {
+		seen := make(map[string]bool)
+		for _, next := range stage.Next {
+			if _, ok := stages[next]; !ok {
+				return fmt.Errorf("pipeline stage %v next %v not found", stage.Name, next)
+			}
+			if seen[next] {
+				return fmt.Errorf("pipeline stage %v next %v is duplicated", stage.Name, next)
+			}
+			seen[next] = true
+		}
+	}
+	// 深度优先遍历，检测环并记录可达阶段
+	// 0 未访问 1 访问中 2 已完成
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("pipeline has a cycle at stage %v", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, next := range stages[name].Next {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		return nil
+	}
+	if err := visit(g.Entry); err != nil {
+		return err
+	}
+	for _, stage := range g.Stages {
+		if state[stage.Name] != 2 {
+			return fmt.Errorf("pipeline stage %v is unreachable from entry %v", stage.Name, g.Entry)
+		}
+	}
+	return nil
+}
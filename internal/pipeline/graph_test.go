@@ -0,0 +1,162 @@
+// pipeline-------------------------------------
+// @file      : graph_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/10 20:31
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraphValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph *Graph
+		err   string // 为空表示校验通过
+	}{
+		{
+			name:  "default",
+			graph: DefaultGraph(),
+		},
+		{
+			name: "fan out and join",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler", Next: []string{"b", "c"}},
+				{Name: "b", Module: "SubdomainScan", Next: []string{"d"}},
+				{Name: "c", Module: "PortScan", Next: []string{"d"}},
+				{Name: "d", Module: "VulnerabilityScan"},
+			}},
+		},
+		{
+			name:  "nil",
+			graph: nil,
+			err:   "has no stage",
+		},
+		{
+			name:  "empty",
+			graph: &Graph{Entry: "a"},
+			err:   "has no stage",
+		},
+		{
+			name: "empty name",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "", Module: "TargetHandler"},
+			}},
+			err: "name is empty",
+		},
+		{
+			name: "no module",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a"},
+			}},
+			err: "stage a has no module",
+		},
+		{
+			name: "duplicated stage",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler"},
+				{Name: "a", Module: "PortScan"},
+			}},
+			err: "stage a is duplicated",
+		},
+		{
+			name: "custom without plugin",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: CustomModule},
+			}},
+			err: "custom stage a has no plugin",
+		},
+		{
+			name: "entry not found",
+			graph: &Graph{Entry: "x", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler"},
+			}},
+			err: "entry x not found",
+		},
+		{
+			name: "next not found",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler", Next: []string{"b"}},
+			}},
+			err: "stage a next b not found",
+		},
+		{
+			name: "duplicated next",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler", Next: []string{"b", "b"}},
+				{Name: "b", Module: "PortScan"},
+			}},
+			err: "stage a next b is duplicated",
+		},
+		{
+			name: "self cycle",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler", Next: []string{"a"}},
+			}},
+			err: "cycle at stage a",
+		},
+		{
+			name: "cycle",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler", Next: []string{"b"}},
+				{Name: "b", Module: "PortScan", Next: []string{"c"}},
+				{Name: "c", Module: "PortFingerprint", Next: []string{"b"}},
+			}},
+			err: "cycle at stage b",
+		},
+		{
+			name: "unreachable",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler"},
+				{Name: "b", Module: "PortScan"},
+			}},
+			err: "stage b is unreachable",
+		},
+		{
+			name: "unreachable cycle",
+			graph: &Graph{Entry: "a", Stages: []Stage{
+				{Name: "a", Module: "TargetHandler"},
+				{Name: "b", Module: "PortScan", Next: []string{"c"}},
+				{Name: "c", Module: "PortFingerprint", Next: []string{"b"}},
+			}},
+			err: "is unreachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.graph.Validate()
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestGraphUpstreams(t *testing.T) {
+	g := &Graph{Entry: "a", Stages: []Stage{
+		{Name: "a", Module: "TargetHandler", Next: []string{"b", "c"}},
+		{Name: "b", Module: "SubdomainScan", Next: []string{"d"}},
+		{Name: "c", Module: "PortScan", Next: []string{"d"}},
+		{Name: "d", Module: "VulnerabilityScan"},
+	}}
+	upstreams := g.Upstreams()
+	want := map[string]int{"b": 1, "c": 1, "d": 2}
+	if len(upstreams) != len(want) {
+		t.Fatalf("Upstreams() = %v, want %v", upstreams, want)
+	}
+	for name, n := range want {
+		if upstreams[name] != n {
+			t.Errorf("Upstreams()[%v] = %v, want %v", name, upstreams[name], n)
+		}
+	}
+}
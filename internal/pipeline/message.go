@@ -0,0 +1,141 @@
+// pipeline-------------------------------------
+// @file      : message.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/15 21:10
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sync"
+)
+
+// Output 模块的输出，负责把模块和插件产生的数据包装为消息
+type Output struct {
+	Module string
+	Stage  string // 模块所在的流程阶段，插件执行计入该阶段的进度
+	Target string
+	TaskId string
+	Ch     chan types.Message
+}
+
+func NewOutput(module string, stage string, target string, taskId string, ch chan types.Message) *Output {
+	return &Output{
+		Module: module,
+		Stage:  stage,
+		Target: target,
+		TaskId: taskId,
+		Ch:     ch,
+	}
+}
+
+// Send 包装数据并发送，数据类型无法识别时记录错误并丢弃
+func (o *Output) Send(payload interface{}, plugin string) bool {
+	msg, err := types.NewMessage(payload, o.Target, o.TaskId, plugin)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("%v module target %v plugin %v output error: %v", o.Module, o.Target, plugin, err))
+		return false
+	}
+	o.Ch <- msg
+	return true
+}
+
+// Finish 模块处理完所有输入后调用，标记所在阶段运行结束
+func (o *Output) Finish() {
+	Progresses.Get(o.TaskId, o.Target).Finish(o.Stage)
+}
+
+// PluginResult 单次插件执行的结果通道，通道中的数据标记为该插件产生
+type PluginResult struct {
+	Ch        chan interface{}
+	mu        sync.Mutex
+	abandoned bool
+	wg        sync.WaitGroup
+	progress  *Progress
+	stage     string
+	target    string
+	endOnce   sync.Once
+}
+
+// Plugin 为单次插件执行创建结果通道，执行计入模块所在阶段的进度
+func (o *Output) Plugin(plugin string) *PluginResult {
+	r := &PluginResult{
+		Ch:       make(chan interface{}, 100),
+		progress: Progresses.Get(o.TaskId, o.Target),
+		stage:    o.Stage,
+		target:   o.Target,
+	}
+	r.progress.update(r.stage, func(s *StageProgress) { s.Running++ })
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		for result := range r.Ch {
+			r.mu.Lock()
+			if !r.abandoned && o.Send(result, plugin) {
+				r.progress.update(r.stage, func(s *StageProgress) { s.Findings++ })
+			}
+			r.mu.Unlock()
+		}
+	}()
+	return r
+}
+
+// end 插件执行结束或不再等待插件
+func (r *PluginResult) end() {
+	r.endOnce.Do(func() {
+		r.progress.update(r.stage, func(s *StageProgress) {
+			s.Running--
+			s.Executed++
+		})
+	})
+}
+
+// fail 插件执行错误
+func (r *PluginResult) fail(class string) {
+	r.progress.fail(r.stage, class)
+}
+
+// Close 插件执行结束后调用，等待结果全部转发完毕
+func (r *PluginResult) Close() {
+	close(r.Ch)
+	r.wg.Wait()
+	r.end()
+}
+
+// Abandon 不再等待插件时调用，插件之后产生的结果直接丢弃
+// 模块可能已经结束，结果不能再发送到模块的结果通道
+func (r *PluginResult) Abandon() {
+	r.mu.Lock()
+	r.abandoned = true
+	r.mu.Unlock()
+	r.end()
+}
+
+// Abandoned 是否已经不再等待插件，不再等待的插件可能仍在运行并修改输入
+func (r *PluginResult) Abandoned() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.abandoned
+}
+
+// Accepts 判断消息类型是否在接收列表中，列表为空表示接收所有类型
+func Accepts(kinds []types.Kind, kind types.Kind) bool {
+	if len(kinds) == 0 {
+		return true
+	}
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Unexpected 模块收到不接收的消息类型，记录错误并丢弃
+func Unexpected(module string, msg types.Message) {
+	logger.SlogError(fmt.Sprintf("%v module target %v received unexpected %v message from plugin %v", module, msg.Target, msg.Kind, msg.Plugin))
+}
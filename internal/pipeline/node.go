@@ -0,0 +1,219 @@
+// pipeline-------------------------------------
+// @file      : node.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/12 21:03
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sync"
+	"sync/atomic"
+)
+
+// Join 有多个上游的阶段，只运行一次，所有上游都关闭后才关闭输入
+type Join struct {
+	Runner    interfaces.ModuleRunner
+	remaining int32
+	once      sync.Once
+}
+
+func NewJoin(runner interfaces.ModuleRunner, upstreams int) *Join {
+	return &Join{
+		Runner:    runner,
+		remaining: int32(upstreams),
+	}
+}
+
+func (j *Join) ModuleRun() error {
+	var err error
+	// 每个上游都会调用一次 ModuleRun，只有第一次真正运行
+	j.once.Do(func() {
+		err = j.Runner.ModuleRun()
+	})
+	return err
+}
+
+func (j *Join) SetInput(ch chan types.Message) {
+	j.Runner.SetInput(ch)
+}
+
+func (j *Join) GetInput() chan types.Message {
+	return j.Runner.GetInput()
+}
+
+func (j *Join) CloseInput() {
+	if atomic.AddInt32(&j.remaining, -1) == 0 {
+		j.Runner.CloseInput()
+	}
+}
+
+func (j *Join) GetName() string {
+	return j.Runner.GetName()
+}
+
+func (j *Join) Consumes() []types.Kind {
+	return j.Runner.Consumes()
+}
+
+func (j *Join) Produces() []types.Kind {
+	return j.Runner.Produces()
+}
+
+// Drain 读取并丢弃通道中的数据直到通道关闭
+// 任务取消后模块不再处理输入，上游仍可能在发送数据，需要继续读取防止上游阻塞
+func Drain(ch chan types.Message) {
+	for range ch {
+	}
+}
+
+// Relay 放在阶段和下游之间，一个 goroutine 完成阶段输出的检查点记录、数量统计、扫描范围检查和分发
+// 数据只发送到接收该类型消息的下游，没有下游时丢弃输出；记录检查点时阶段的输出全部处理后标记阶段完成
+type Relay struct {
+	Stage    string
+	Next     []string                  // 下游阶段名称，与 Children 一一对应
+	Children []interfaces.ModuleRunner // 下游阶段
+	Input    chan types.Message
+	Recorder *Recorder    // 检查点记录，为空时不记录
+	Meter    *Meter       // 进度统计，为空时不统计
+	Filter   *ScopeFilter // 扫描范围检查，为空时不检查
+	wg       *sync.WaitGroup
+}
+
+// NewRelay 创建阶段的输出，wg 为目标的 ModuleRunWg，Relay 处理完所有输出后才结束计数
+// 目标运行结束时删除检查点，需要在阶段标记完成之后
+func NewRelay(stage string, next []string, children []interfaces.ModuleRunner, wg *sync.WaitGroup) *Relay {
+	if wg != nil {
+		wg.Add(1)
+	}
+	return &Relay{
+		Stage:    stage,
+		Next:     next,
+		Children: children,
+		wg:       wg,
+	}
+}
+
+func (r *Relay) ModuleRun() error {
+	if r.wg != nil {
+		defer r.wg.Done()
+	}
+	for _, child := range r.Children {
+		go func(child interfaces.ModuleRunner) {
+			err := child.ModuleRun()
+			if err != nil {
+				logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
+			}
+		}(child)
+	}
+	for data := range r.Input {
+		if len(r.Children) == 0 {
+			continue
+		}
+		r.Recorder.Record(data)
+		r.Meter.Emitted()
+		msg, ok := r.Filter.Filter(data)
+		if !ok {
+			continue
+		}
+		for i, child := range r.Children {
+			if !Accepts(child.Consumes(), msg.Kind) {
+				continue
+			}
+			r.Meter.Received(r.Next[i])
+			child.GetInput() <- msg
+		}
+	}
+	r.Recorder.Finish()
+	for _, child := range r.Children {
+		child.CloseInput()
+	}
+	return nil
+}
+
+func (r *Relay) SetInput(ch chan types.Message) {
+	r.Input = ch
+}
+
+func (r *Relay) GetInput() chan types.Message {
+	return r.Input
+}
+
+func (r *Relay) CloseInput() {
+	close(r.Input)
+}
+
+func (r *Relay) GetName() string {
+	return r.Stage + "-Relay"
+}
+
+func (r *Relay) Consumes() []types.Kind {
+	return nil
+}
+
+func (r *Relay) Produces() []types.Kind {
+	return nil
+}
+
+// Sink 放在没有输出的阶段外层，阶段处理完所有输入后标记阶段完成
+// 没有输出的阶段没有 Relay，需要在模块运行结束后记录检查点
+type Sink struct {
+	Runner interfaces.ModuleRunner
+	Stage  string
+	cp     *Checkpoints
+	wg     *sync.WaitGroup
+}
+
+// NewSink wg 为目标的 ModuleRunWg，模块结束计数后 Sink 仍在计数，标记完成后才结束
+func NewSink(runner interfaces.ModuleRunner, stage string, cp *Checkpoints, wg *sync.WaitGroup) *Sink {
+	if wg != nil {
+		wg.Add(1)
+	}
+	return &Sink{
+		Runner: runner,
+		Stage:  stage,
+		cp:     cp,
+		wg:     wg,
+	}
+}
+
+func (s *Sink) ModuleRun() error {
+	if s.wg != nil {
+		defer s.wg.Done()
+	}
+	// 模块在输入关闭并且所有插件执行结束后返回
+	err := s.Runner.ModuleRun()
+	if err == nil {
+		s.cp.complete(s.Stage)
+	}
+	return err
+}
+
+func (s *Sink) SetInput(ch chan types.Message) {
+	s.Runner.SetInput(ch)
+}
+
+func (s *Sink) GetInput() chan types.Message {
+	return s.Runner.GetInput()
+}
+
+func (s *Sink) CloseInput() {
+	s.Runner.CloseInput()
+}
+
+func (s *Sink) GetName() string {
+	return s.Runner.GetName()
+}
+
+func (s *Sink) Consumes() []types.Kind {
+	return s.Runner.Consumes()
+}
+
+func (s *Sink) Produces() []types.Kind {
+	return s.Runner.Produces()
+}
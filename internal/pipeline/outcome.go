@@ -0,0 +1,107 @@
+// pipeline-------------------------------------
+// @file      : outcome.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/6 20:14
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+)
+
+// 目标的运行结果
+const (
+	OutcomeSuccess = "success" // 所有阶段运行结束并且插件没有出错
+	OutcomePartial = "partial" // 超过截止时间，部分阶段被中断
+	OutcomeFailed  = "failed"  // 有插件执行出错
+)
+
+// 失败类型，重试策略按失败类型设置等待时间
+const (
+	FailureNetwork  = "network"  // 连接失败、DNS 解析失败等网络错误
+	FailureTimeout  = "timeout"  // 插件超过运行时间
+	FailurePanic    = "panic"    // 插件 panic
+	FailureError    = "error"    // 其他错误
+	FailureDeadline = "deadline" // 目标或任务超过截止时间
+)
+
+// FailureClasses 所有的失败类型，多种类型错误数量相同时按此顺序选择
+var FailureClasses = []string{FailureNetwork, FailureTimeout, FailurePanic, FailureError, FailureDeadline}
+
+// networkErrors 网络错误的关键字，插件返回的错误大多只保留了错误信息
+var networkErrors = []string{
+	"connection refused",
+	"connection reset",
+	"connection timed out",
+	"no such host",
+	"i/o timeout",
+	"network is unreachable",
+	"no route to host",
+	"broken pipe",
+	"tls handshake",
+	"unexpected eof",
+	"temporary failure in name resolution",
+}
+
+// Outcome 目标的运行结果，失败和部分完成的目标按任务的重试策略重新运行
+type Outcome struct {
+	Status   string           `json:"status"`
+	Class    string           `json:"class,omitempty"`    // 失败类型
+	Reason   string           `json:"reason,omitempty"`   // 部分完成的原因：target deadline 或 task deadline
+	Stages   []string         `json:"stages,omitempty"`   // 插件出错或被中断的阶段
+	Failures map[string]int64 `json:"failures,omitempty"` // 每种失败类型的插件错误数量
+}
+
+// FailureClass 插件返回的错误的失败类型
+func FailureClass(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return FailureTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return FailureNetwork
+	}
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range networkErrors {
+		if strings.Contains(msg, keyword) {
+			return FailureNetwork
+		}
+	}
+	return FailureError
+}
+
+// Outcome 目标扫描结束后根据插件错误判断运行结果，有插件出错的目标为失败，失败类型取错误数量最多的类型
+func (p *Progress) Outcome() Outcome {
+	outcome := Outcome{Status: OutcomeSuccess}
+	if p == nil {
+		return outcome
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.stages {
+		if s.Errors > 0 {
+			outcome.Stages = append(outcome.Stages, s.Stage)
+		}
+	}
+	if len(p.failures) == 0 {
+		return outcome
+	}
+	outcome.Status = OutcomeFailed
+	outcome.Failures = make(map[string]int64, len(p.failures))
+	for _, class := range FailureClasses {
+		count := p.failures[class]
+		if count == 0 {
+			continue
+		}
+		outcome.Failures[class] = count
+		if count > outcome.Failures[outcome.Class] {
+			outcome.Class = class
+		}
+	}
+	return outcome
+}
@@ -0,0 +1,103 @@
+// pipeline-------------------------------------
+// @file      : plugins.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/18 15:26
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sync"
+	"sync/atomic"
+)
+
+// RunPlugins 按模块的插件运行方式对一条输入运行插件，所有插件结束后返回
+// run 运行单个插件并等待其结束，返回 false 表示不再运行之后的插件，并行运行时还没有开始的插件不再运行
+func RunPlugins(module string, pluginIds []string, cfg config.PluginRunConfig, run func(pluginId string) bool) {
+	order, deps := pluginOrder(module, pluginIds, cfg.Dependencies)
+	if cfg.PluginMode != config.PluginParallel {
+		for _, pluginId := range order {
+			if !run(pluginId) {
+				return
+			}
+		}
+		return
+	}
+	// 并行运行，插件在依赖的插件结束后开始
+	done := make(map[string]chan struct{}, len(order))
+	for _, pluginId := range order {
+		done[pluginId] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	var aborted atomic.Bool
+	for _, pluginId := range order {
+		wg.Add(1)
+		go func(pluginId string) {
+			defer wg.Done()
+			defer close(done[pluginId])
+			for _, dep := range deps[pluginId] {
+				<-done[dep]
+			}
+			// 依赖的插件或其他插件已经中止
+			if aborted.Load() {
+				return
+			}
+			if !run(pluginId) {
+				aborted.Store(true)
+			}
+		}(pluginId)
+	}
+	wg.Wait()
+}
+
+// pluginOrder 根据依赖对插件排序，相互没有依赖的插件保持任务中的顺序
+// 只保留任务中选择的插件之间的依赖，存在循环依赖时忽略所有依赖
+func pluginOrder(module string, pluginIds []string, dependencies map[string][]string) ([]string, map[string][]string) {
+	selected := make(map[string]bool, len(pluginIds))
+	var ids []string
+	for _, pluginId := range pluginIds {
+		if !selected[pluginId] {
+			selected[pluginId] = true
+			ids = append(ids, pluginId)
+		}
+	}
+	deps := make(map[string][]string)
+	for _, pluginId := range ids {
+		for _, dep := range dependencies[pluginId] {
+			if selected[dep] && dep != pluginId {
+				deps[pluginId] = append(deps[pluginId], dep)
+			}
+		}
+	}
+	var order []string
+	sorted := make(map[string]bool, len(ids))
+	for len(order) < len(ids) {
+		progress := false
+		for _, pluginId := range ids {
+			if sorted[pluginId] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[pluginId] {
+				if !sorted[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted[pluginId] = true
+				order = append(order, pluginId)
+				progress = true
+			}
+		}
+		if !progress {
+			logger.SlogError(fmt.Sprintf("%v module plugin dependencies have a cycle, dependencies are ignored", module))
+			return ids, nil
+		}
+	}
+	return order, deps
+}
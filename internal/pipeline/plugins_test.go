@@ -0,0 +1,216 @@
+// pipeline-------------------------------------
+// @file      : plugins_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/10 21:05
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	utils.Tools = &utils.UtilTools{}
+	contextmanager.NewContextManager()
+	dir, err := os.MkdirTemp("", "pipeline-test")
+	if err != nil {
+		panic(err)
+	}
+	pebbledb.PebbleStore, err = pebbledb.NewPebbleDB(&pebble.Options{}, dir)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = pebbledb.PebbleStore.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestPluginOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		plugins      []string
+		dependencies map[string][]string
+		order        []string
+		deps         map[string][]string
+	}{
+		{
+			name:    "no dependency",
+			plugins: []string{"a", "b", "c"},
+			order:   []string{"a", "b", "c"},
+			deps:    map[string][]string{},
+		},
+		{
+			name:    "duplicated plugin",
+			plugins: []string{"a", "b", "a"},
+			order:   []string{"a", "b"},
+			deps:    map[string][]string{},
+		},
+		{
+			name:         "dependency first",
+			plugins:      []string{"a", "b", "c"},
+			dependencies: map[string][]string{"a": {"c"}},
+			order:        []string{"b", "c", "a"},
+			deps:         map[string][]string{"a": {"c"}},
+		},
+		{
+			name:         "chain",
+			plugins:      []string{"a", "b", "c"},
+			dependencies: map[string][]string{"a": {"b"}, "b": {"c"}},
+			order:        []string{"c", "b", "a"},
+			deps:         map[string][]string{"a": {"b"}, "b": {"c"}},
+		},
+		{
+			name:         "unselected and self dependency ignored",
+			plugins:      []string{"a", "b"},
+			dependencies: map[string][]string{"a": {"x", "a"}, "b": {"a"}},
+			order:        []string{"a", "b"},
+			deps:         map[string][]string{"b": {"a"}},
+		},
+		{
+			name:         "cycle ignores all dependencies",
+			plugins:      []string{"a", "b", "c"},
+			dependencies: map[string][]string{"a": {"b"}, "b": {"a"}, "c": {"a"}},
+			order:        []string{"a", "b", "c"},
+			deps:         nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, deps := pluginOrder("Test", tt.plugins, tt.dependencies)
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("order = %v, want %v", order, tt.order)
+			}
+			if !reflect.DeepEqual(deps, tt.deps) {
+				t.Errorf("deps = %v, want %v", deps, tt.deps)
+			}
+		})
+	}
+}
+
+// pluginRecorder 记录插件的运行顺序，abort 中的插件返回 false
+type pluginRecorder struct {
+	mu    sync.Mutex
+	ran   []string
+	abort map[string]bool
+}
+
+func (r *pluginRecorder) run(pluginId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, pluginId)
+	return !r.abort[pluginId]
+}
+
+func (r *pluginRecorder) index(pluginId string) int {
+	for i, id := range r.ran {
+		if id == pluginId {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRunPlugins(t *testing.T) {
+	sequential := config.PluginRunConfig{PluginMode: config.PluginSequential}
+	parallel := config.PluginRunConfig{PluginMode: config.PluginParallel}
+	tests := []struct {
+		name    string
+		plugins []string
+		cfg     config.PluginRunConfig
+		abort   map[string]bool
+		ran     []string // 运行的插件，顺序不确定时只比较集合
+		ordered bool
+		before  [][2]string // 先运行的插件和后运行的插件
+	}{
+		{
+			name:    "sequential",
+			plugins: []string{"a", "b", "c"},
+			cfg:     sequential,
+			ran:     []string{"a", "b", "c"},
+			ordered: true,
+		},
+		{
+			name:    "sequential default mode",
+			plugins: []string{"a", "b"},
+			cfg:     config.PluginRunConfig{Dependencies: map[string][]string{"a": {"b"}}},
+			ran:     []string{"b", "a"},
+			ordered: true,
+		},
+		{
+			name:    "sequential abort",
+			plugins: []string{"a", "b", "c"},
+			cfg:     sequential,
+			abort:   map[string]bool{"b": true},
+			ran:     []string{"a", "b"},
+			ordered: true,
+		},
+		{
+			name:    "parallel",
+			plugins: []string{"a", "b", "c"},
+			cfg:     parallel,
+			ran:     []string{"a", "b", "c"},
+		},
+		{
+			name:    "parallel dependencies",
+			plugins: []string{"a", "b", "c"},
+			cfg: config.PluginRunConfig{PluginMode: config.PluginParallel, Dependencies: map[string][]string{
+				"a": {"b"},
+				"c": {"a"},
+			}},
+			ran:    []string{"a", "b", "c"},
+			before: [][2]string{{"b", "a"}, {"a", "c"}},
+		},
+		{
+			name:    "parallel abort stops dependents",
+			plugins: []string{"a", "b", "c"},
+			cfg: config.PluginRunConfig{PluginMode: config.PluginParallel, Dependencies: map[string][]string{
+				"b": {"a"},
+				"c": {"b"},
+			}},
+			abort: map[string]bool{"a": true},
+			ran:   []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &pluginRecorder{abort: tt.abort}
+			RunPlugins("Test", tt.plugins, tt.cfg, r.run)
+			if tt.ordered {
+				if !reflect.DeepEqual(r.ran, tt.ran) {
+					t.Fatalf("ran = %v, want %v", r.ran, tt.ran)
+				}
+				return
+			}
+			if len(r.ran) != len(tt.ran) {
+				t.Fatalf("ran = %v, want %v", r.ran, tt.ran)
+			}
+			for _, id := range tt.ran {
+				if r.index(id) < 0 {
+					t.Fatalf("ran = %v, want %v", r.ran, tt.ran)
+				}
+			}
+			for _, pair := range tt.before {
+				if r.index(pair[0]) > r.index(pair[1]) {
+					t.Errorf("ran = %v, want %v before %v", r.ran, pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+// pipeline-------------------------------------
+// @file      : progress.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/31 19:52
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// progressInterval 进度写入 redis 的最小间隔
+const progressInterval = 2 * time.Second
+
+// StageProgress 阶段的实时进度
+type StageProgress struct {
+	Stage    string  `json:"stage"`
+	Plugins  int     `json:"plugins"`  // 阶段的插件数量
+	Received int64   `json:"received"` // 接收的数据
+	Emitted  int64   `json:"emitted"`  // 发送到下游的数据
+	Running  int64   `json:"running"`  // 正在执行的插件
+	Executed int64   `json:"executed"` // 执行结束的插件
+	Findings int64   `json:"findings"` // 插件产生的结果
+	Errors   int64   `json:"errors"`   // 插件执行错误
+	Done     int64   `json:"done"`     // 处理完毕的数据，按插件执行次数估算
+	Finished bool    `json:"finished"` // 阶段运行结束
+	ETA      float64 `json:"eta"`      // 预计剩余时间，单位秒，-1 表示没有历史数据无法估算
+	module   string
+	input    chan types.Message // 模块的输入，用于统计等待处理的数据
+}
+
+// Progress 一个目标的各阶段进度，定时写入 TaskInfo:progress:<任务ID>:<目标>
+type Progress struct {
+	taskId   string
+	target   string
+	mu       sync.Mutex
+	stages   []*StageProgress
+	changed  bool
+	failures map[string]int64 // 失败类型 -> 插件错误数量
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+type progressRegistry struct {
+	mu    sync.Mutex
+	items map[string]*Progress
+}
+
+// Progresses 正在扫描的目标的进度
+var Progresses = &progressRegistry{
+	items: make(map[string]*Progress),
+}
+
+func progressKey(taskId string, target string) string {
+	return taskId + ":" + target
+}
+
+// Start 目标开始扫描时创建进度并定时写入 redis
+func (r *progressRegistry) Start(taskId string, target string) *Progress {
+	p := &Progress{
+		taskId:  taskId,
+		target:  target,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	r.mu.Lock()
+	r.items[progressKey(taskId, target)] = p
+	r.mu.Unlock()
+	go p.run()
+	return p
+}
+
+// Get 获取目标的进度，目标没有在扫描时返回 nil，nil 的进度不记录任何数据
+func (r *progressRegistry) Get(taskId string, target string) *Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.items[progressKey(taskId, target)]
+}
+
+// InputDepth 正在扫描的目标中每个模块输入通道等待处理的数据数量
+func (r *progressRegistry) InputDepth() map[string]int {
+	r.mu.Lock()
+	items := make([]*Progress, 0, len(r.items))
+	for _, p := range r.items {
+		items = append(items, p)
+	}
+	r.mu.Unlock()
+	depth := make(map[string]int)
+	for _, p := range items {
+		p.mu.Lock()
+		for _, s := range p.stages {
+			if s.input != nil {
+				depth[s.module] += len(s.input)
+			}
+		}
+		p.mu.Unlock()
+	}
+	return depth
+}
+
+// TargetStatus 正在扫描的目标和正在运行的阶段
+type TargetStatus struct {
+	TaskId string   `json:"taskId"`
+	Target string   `json:"target"`
+	Stages []string `json:"stages"` // 已经接收数据但没有结束的阶段
+	ETA    float64  `json:"eta"`
+}
+
+// Targets 节点正在扫描的目标，按任务和目标排序
+func (r *progressRegistry) Targets() []TargetStatus {
+	r.mu.Lock()
+	items := make([]*Progress, 0, len(r.items))
+	for _, p := range r.items {
+		items = append(items, p)
+	}
+	r.mu.Unlock()
+	targets := make([]TargetStatus, 0, len(items))
+	for _, p := range items {
+		stages, eta := p.Snapshot()
+		status := TargetStatus{TaskId: p.taskId, Target: p.target, Stages: []string{}, ETA: eta}
+		for _, s := range stages {
+			if !s.Finished && s.Received > 0 {
+				status.Stages = append(status.Stages, s.Stage)
+			}
+		}
+		targets = append(targets, status)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].TaskId != targets[j].TaskId {
+			return targets[i].TaskId < targets[j].TaskId
+		}
+		return targets[i].Target < targets[j].Target
+	})
+	return targets
+}
+
+// Stop 目标扫描结束，写入最终进度后删除
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	Progresses.mu.Lock()
+	if Progresses.items[progressKey(p.taskId, p.target)] == p {
+		delete(Progresses.items, progressKey(p.taskId, p.target))
+	}
+	Progresses.mu.Unlock()
+	close(p.stop)
+	<-p.stopped
+}
+
+func (p *Progress) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			p.flush()
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// AddStage 创建扫描流程时添加阶段
+func (p *Progress) AddStage(name string, module string, plugins int, input chan types.Message) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = append(p.stages, &StageProgress{Stage: name, Plugins: plugins, module: module, input: input})
+	p.changed = true
+}
+
+// update 修改阶段的进度
+func (p *Progress) update(stage string, fn func(s *StageProgress)) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.stages {
+		if s.Stage == stage {
+			fn(s)
+			p.changed = true
+			return
+		}
+	}
+}
+
+// fail 记录插件错误及其失败类型
+func (p *Progress) fail(stage string, class string) {
+	if p == nil {
+		return
+	}
+	p.update(stage, func(s *StageProgress) { s.Errors++ })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures == nil {
+		p.failures = make(map[string]int64)
+	}
+	p.failures[class] += 1
+}
+
+// Finish 阶段运行结束
+func (p *Progress) Finish(stage string) {
+	p.update(stage, func(s *StageProgress) {
+		s.Finished = true
+	})
+}
+
+// Unfinished 有插件但没有运行结束的阶段，目标超过截止时间时这些阶段被中断
+func (p *Progress) Unfinished() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var stages []string
+	for _, s := range p.stages {
+		if !s.Finished && s.Plugins > 0 {
+			stages = append(stages, s.Stage)
+		}
+	}
+	return stages
+}
+
+// Snapshot 获取各阶段的进度和目标的预计剩余时间
+func (p *Progress) Snapshot() ([]StageProgress, float64) {
+	if p == nil {
+		return nil, -1
+	}
+	averages := moduleAverages()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stages := make([]StageProgress, 0, len(p.stages))
+	total := 0.0
+	for _, s := range p.stages {
+		stage := *s
+		stage.Done = stage.Received
+		if stage.Plugins > 0 {
+			stage.Done = stage.Executed / int64(stage.Plugins)
+		}
+		stage.ETA = stageETA(&stage, averages[stage.module])
+		if stage.ETA < 0 || total < 0 {
+			total = -1
+		} else {
+			total += stage.ETA
+		}
+		stages = append(stages, stage)
+	}
+	return stages, total
+}
+
+// stageETA 剩余的插件执行次数乘以节点历史上该模块每次插件执行的平均时间，按正在执行的插件数量并行计算
+func stageETA(s *StageProgress, average float64) float64 {
+	remaining := s.Received*int64(s.Plugins) - s.Executed
+	if s.Finished || remaining <= 0 {
+		return 0
+	}
+	if average <= 0 {
+		return -1
+	}
+	parallel := s.Running
+	if parallel < 1 {
+		parallel = 1
+	}
+	return math.Round(float64(remaining)*average/float64(parallel)*10) / 10
+}
+
+// moduleAverages 节点启动以来每个模块单次插件执行的平均时间，单位秒
+func moduleAverages() map[string]float64 {
+	seconds := make(map[string]float64)
+	counts := make(map[string]int64)
+	for _, stat := range PluginStats.Node() {
+		seconds[stat.Module] += stat.Duration
+		counts[stat.Module] += stat.Success + stat.Failure
+	}
+	averages := make(map[string]float64, len(counts))
+	for module, count := range counts {
+		if count > 0 {
+			averages[module] = seconds[module] / float64(count)
+		}
+	}
+	return averages
+}
+
+// flush 进度有变化时写入 redis
+func (p *Progress) flush() {
+	p.mu.Lock()
+	changed := p.changed
+	p.changed = false
+	p.mu.Unlock()
+	if !changed || global.Standalone {
+		return
+	}
+	stages, eta := p.Snapshot()
+	data, err := json.Marshal(stages)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("marshal progress error: %v", err))
+		return
+	}
+	key := "TaskInfo:progress:" + p.taskId + ":" + p.target
+	err = redis.RedisClient.HMSet(context.Background(), key, map[string]interface{}{
+		"stages": string(data),
+		"eta":    eta,
+	})
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("progress redis error: %v", err))
+	}
+}
+
+// Meter 统计阶段发送到下游的数据和下游接收的数据，由阶段的 Relay 调用
+type Meter struct {
+	Stage    string
+	progress *Progress
+}
+
+func NewMeter(progress *Progress, stage string) *Meter {
+	return &Meter{
+		Stage:    stage,
+		progress: progress,
+	}
+}
+
+// Emitted 阶段输出一条数据
+func (m *Meter) Emitted() {
+	if m == nil {
+		return
+	}
+	m.progress.update(m.Stage, func(s *StageProgress) { s.Emitted++ })
+}
+
+// Received 下游阶段 next 接收一条数据
+func (m *Meter) Received(next string) {
+	if m == nil {
+		return
+	}
+	m.progress.update(next, func(s *StageProgress) { s.Received++ })
+}
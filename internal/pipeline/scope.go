@@ -0,0 +1,34 @@
+// pipeline-------------------------------------
+// @file      : scope.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/29 21:04
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+)
+
+// ScopeFilter 检查阶段的输出，不在扫描范围内的数据不再发送到下游，由阶段的 Relay 调用
+type ScopeFilter struct {
+	Stage  string
+	engine *scope.Engine
+}
+
+func NewScopeFilter(engine *scope.Engine, stage string) *ScopeFilter {
+	return &ScopeFilter{
+		Stage:  stage,
+		engine: engine,
+	}
+}
+
+// Filter 批量消息只保留范围内的数据，返回 false 表示丢弃整个消息，没有设置时不过滤
+func (f *ScopeFilter) Filter(msg types.Message) (types.Message, bool) {
+	if f == nil || f.engine == nil {
+		return msg, true
+	}
+	return f.engine.Filter(f.Stage, msg)
+}
@@ -0,0 +1,184 @@
+// pipeline-------------------------------------
+// @file      : supervisor.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/19 16:08
+// -------------------------------------------
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/metrics"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PluginStat 插件的运行统计
+type PluginStat struct {
+	Module        string  `json:"module"`
+	Name          string  `json:"name"`
+	Success       int64   `json:"success"`
+	Failure       int64   `json:"failure"`
+	Duration      float64 `json:"duration"` // 累计运行时间，单位秒
+	LastError     string  `json:"lastError,omitempty"`
+	LastErrorTime string  `json:"lastErrorTime,omitempty"`
+}
+
+type pluginStats struct {
+	mu    sync.Mutex
+	tasks map[string]map[string]*PluginStat // 任务ID -> 插件 -> 统计
+	node  map[string]*PluginStat            // 节点启动以来所有任务的统计
+}
+
+// PluginStats 插件运行统计，按任务和节点分别记录
+var PluginStats = &pluginStats{
+	tasks: make(map[string]map[string]*PluginStat),
+	node:  make(map[string]*PluginStat),
+}
+
+func (s *pluginStats) record(taskId string, plg interfaces.Plugin, duration time.Duration, err error) {
+	key := plg.GetModule() + ":" + plg.GetPluginId()
+	metrics.ObservePlugin(plg.GetModule(), plg.GetName(), duration)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[taskId]; !ok {
+		s.tasks[taskId] = make(map[string]*PluginStat)
+	}
+	for _, stats := range []map[string]*PluginStat{s.tasks[taskId], s.node} {
+		stat, ok := stats[key]
+		if !ok {
+			stat = &PluginStat{Module: plg.GetModule(), Name: plg.GetName()}
+			stats[key] = stat
+		}
+		stat.Duration += duration.Seconds()
+		if err != nil {
+			stat.Failure += 1
+			stat.LastError = err.Error()
+			stat.LastErrorTime = utils.Tools.GetTimeNow()
+		} else {
+			stat.Success += 1
+		}
+	}
+}
+
+func copyStats(stats map[string]*PluginStat) map[string]PluginStat {
+	result := make(map[string]PluginStat, len(stats))
+	for key, stat := range stats {
+		result[key] = *stat
+	}
+	return result
+}
+
+// Task 获取任务中每个插件的运行统计
+func (s *pluginStats) Task(taskId string) map[string]PluginStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyStats(s.tasks[taskId])
+}
+
+// Node 获取节点启动以来每个插件的运行统计
+func (s *pluginStats) Node() map[string]PluginStat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyStats(s.node)
+}
+
+// EndTask 任务结束时输出任务中插件的运行统计并删除
+func (s *pluginStats) EndTask(taskId string) {
+	s.mu.Lock()
+	stats := copyStats(s.tasks[taskId])
+	delete(s.tasks, taskId)
+	s.mu.Unlock()
+	var keys []string
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		stat := stats[key]
+		logger.SlogInfoLocal(fmt.Sprintf("task %v plugin %v %v success: %v failure: %v duration: %.2fs", taskId, stat.Module, stat.Name, stat.Success, stat.Failure, stat.Duration))
+	}
+}
+
+// Execute 监督插件运行，恢复插件中的 panic，超过插件超时时间、任务取消或目标超过截止时间后不再等待插件
+// 插件结束后关闭结果通道，不再等待的插件之后产生的结果被丢弃
+func Execute(plg interfaces.Plugin, input interface{}, result *PluginResult) (interface{}, error) {
+	taskId := plg.GetTaskId()
+	targetCtx := contextmanager.GlobalContextManagers.GetTargetContext(taskId, result.target)
+	if targetCtx.Err() != nil {
+		result.Close()
+		return nil, targetCtx.Err()
+	}
+	ctx := targetCtx
+	timeout := config.ModulesConfig.GetPluginRun(plg.GetModule()).PluginTimeout(plg.GetPluginId())
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	type executeResult struct {
+		output interface{}
+		err    error
+		panic  bool
+	}
+	done := make(chan executeResult, 1)
+	go func() {
+		var output interface{}
+		var err error
+		panicked := false
+		defer func() {
+			if e := recover(); e != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("%v plugin %v panic: %v\n%v", plg.GetModule(), plg.GetName(), e, string(debug.Stack())))
+				err = fmt.Errorf("panic: %v", e)
+				panicked = true
+			}
+			// 结果全部转发后再返回，保证插件结束时结果已经发送到模块
+			result.Close()
+			done <- executeResult{output: output, err: err, panic: panicked}
+		}()
+		output, err = plg.Execute(input)
+	}()
+
+	var output interface{}
+	var err error
+	class := ""
+	select {
+	case r := <-done:
+		output, err = r.output, r.err
+		if r.panic {
+			class = FailurePanic
+		}
+	case <-ctx.Done():
+		result.Abandon()
+		if targetCtx.Err() != nil {
+			// 任务取消或目标超过截止时间，不算作插件运行失败
+			return nil, targetCtx.Err()
+		}
+		err = fmt.Errorf("timeout after %v", timeout)
+		class = FailureTimeout
+	}
+	if errors.Is(err, interfaces.ErrInputType) {
+		return output, err
+	}
+	PluginStats.record(taskId, plg, time.Since(start), err)
+	if err != nil {
+		if class == "" {
+			class = FailureClass(err)
+		}
+		result.fail(class)
+		plg.Log(fmt.Sprintf("task %v execute error: %v", plg.GetTaskName(), strings.TrimSpace(err.Error())), "e")
+	}
+	return output, err
+}
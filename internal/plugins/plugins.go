@@ -13,6 +13,7 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/toolchain"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/assethandle/webfingerprint"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/assetmapping/httpx"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/dirscan/sentrydir"
@@ -31,11 +32,14 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/webcrawler/rad"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/cloudflare/cfssl/log"
+	"strings"
 	"sync"
 )
 
 type PluginManager struct {
 	plugins map[string]map[string]interfaces.Plugin // 存储插件，按模块和名称索引
+	status  map[string]int                          // 插件的安装和检查状态，和 NodePlg:<节点> 中的字段相同
+	digests map[string]string                       // 外部工具摘要不一致的插件，和 NodePlg:<节点> 中的 <插件>_digest 字段相同
 	mu      sync.RWMutex
 }
 
@@ -45,6 +49,8 @@ var GlobalPluginManager *PluginManager
 func NewPluginManager() *PluginManager {
 	return &PluginManager{
 		plugins: make(map[string]map[string]interfaces.Plugin),
+		status:  make(map[string]int),
+		digests: make(map[string]string),
 	}
 }
 
@@ -73,6 +79,73 @@ func (pm *PluginManager) GetPlugin(module, name string) (interfaces.Plugin, bool
 	return nil, false
 }
 
+// HasPlugin 插件是否已注册，不创建新实例
+func (pm *PluginManager) HasPlugin(module, name string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	_, ok := pm.plugins[module][name]
+	return ok
+}
+
+// RecordStatus 记录写入 NodePlg:<节点> 的插件安装和检查状态以及外部工具摘要不一致的信息
+func (pm *PluginManager) RecordStatus(plgInfo map[string]interface{}) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for key, value := range plgInfo {
+		if v, ok := value.(int); ok {
+			pm.status[key] = v
+		}
+		if v, ok := value.(string); ok && strings.HasSuffix(key, "_digest") {
+			if v == "" {
+				delete(pm.digests, strings.TrimSuffix(key, "_digest"))
+			} else {
+				pm.digests[strings.TrimSuffix(key, "_digest")] = v
+			}
+		}
+	}
+}
+
+// MarkDigest 安装或检查返回摘要不一致时在 plgInfo 中记录 <插件>_digest，成功时清除之前记录的不一致
+func (pm *PluginManager) MarkDigest(plgInfo map[string]interface{}, pluginId string, err error) {
+	if toolchain.IsMismatch(err) {
+		plgInfo[pluginId+"_digest"] = err.Error()
+		return
+	}
+	if err != nil {
+		return
+	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if _, ok := pm.digests[pluginId]; ok {
+		plgInfo[pluginId+"_digest"] = ""
+	}
+}
+
+// DeleteStatus 删除插件时清除插件的状态
+func (pm *PluginManager) DeleteStatus(pluginId string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	delete(pm.status, pluginId+"_install")
+	delete(pm.status, pluginId+"_check")
+	delete(pm.digests, pluginId)
+}
+
+// Ready 插件是否安装和检查成功，没有记录状态的插件视为可用
+func (pm *PluginManager) Ready(pluginId string) (bool, string) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	if _, ok := pm.digests[pluginId]; ok {
+		return false, "digest mismatch"
+	}
+	if install, ok := pm.status[pluginId+"_install"]; ok && install == 0 {
+		return false, "install failed"
+	}
+	if check, ok := pm.status[pluginId+"_check"]; ok && check == 0 {
+		return false, "check failed"
+	}
+	return true, ""
+}
+
 // InitializePlugins 初始化插件
 func (pm *PluginManager) InitializePlugins() error {
 	// TargetParser
@@ -156,7 +229,8 @@ func (pm *PluginManager) InitializePlugins() error {
 			}
 			// 调用每个插件的 Install 函数
 			if err := plugin.Install(); err != nil {
-				plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
+				pm.MarkDigest(plgInfo, plugin.GetPluginId(), err)
+				plgInfoErr := pm.setPlgInfo(nodePlgInfokey, plgInfo)
 				if plgInfoErr != nil {
 					logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 1: %s", plgInfoErr))
 				}
@@ -166,7 +240,8 @@ func (pm *PluginManager) InitializePlugins() error {
 			plgInfo[plugin.GetPluginId()+"_install"] = 1
 			// 调用每个插件的 Check 函数
 			if err := plugin.Check(); err != nil {
-				plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
+				pm.MarkDigest(plgInfo, plugin.GetPluginId(), err)
+				plgInfoErr := pm.setPlgInfo(nodePlgInfokey, plgInfo)
 				if plgInfoErr != nil {
 					logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 3: %s", plgInfoErr))
 				}
@@ -174,7 +249,7 @@ func (pm *PluginManager) InitializePlugins() error {
 				continue
 			}
 			plgInfo[plugin.GetPluginId()+"_check"] = 1
-			plgInfoErr := redis.RedisClient.HMSet(context.Background(), nodePlgInfokey, plgInfo)
+			plgInfoErr := pm.setPlgInfo(nodePlgInfokey, plgInfo)
 			if plgInfoErr != nil {
 				logger.SlogErrorLocal(fmt.Sprintf("send plginfo error 4: %s", plgInfoErr))
 			}
@@ -182,3 +257,12 @@ func (pm *PluginManager) InitializePlugins() error {
 	}
 	return nil
 }
+
+// setPlgInfo 记录插件的安装和检查状态并写入redis，单机模式下不写入redis
+func (pm *PluginManager) setPlgInfo(key string, plgInfo map[string]interface{}) error {
+	pm.RecordStatus(plgInfo)
+	if global.Standalone {
+		return nil
+	}
+	return redis.RedisClient.HMSet(context.Background(), key, plgInfo)
+}
@@ -0,0 +1,223 @@
+// pool-------------------------------------
+// @file      : fair.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/26 20:41
+// -------------------------------------------
+
+package pool
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FairQueue 按任务优先级加权公平地分配协程池，同时运行的任务按优先级比例获得协程
+// 每个任务有一个虚拟时间，每运行一个目标增加 1/优先级，每次选择虚拟时间最小的任务运行
+type FairQueue struct {
+	pool    string
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   map[string]*fairTask
+	vclock  float64 // 最近一次运行的目标的虚拟时间，新加入或重新有目标的任务从这里开始
+	running int
+	idling  bool // 最后一个任务结束后正在清理，清理完成前不注册新任务
+}
+
+type fairTask struct {
+	id       string
+	name     string
+	priority int
+	start    time.Time
+	pending  []func()
+	vtime    float64
+	running  int
+	finished int64
+}
+
+// TaskStatus 节点正在运行的任务
+type TaskStatus struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Running  int    `json:"running"`
+	Pending  int    `json:"pending"`
+	Finished int64  `json:"finished"`
+	Start    string `json:"start"`
+}
+
+// TaskQueue 任务目标使用的公平队列，共享 task 协程池
+var TaskQueue = NewFairQueue("task")
+
+func NewFairQueue(pool string) *FairQueue {
+	q := &FairQueue{
+		pool:  pool,
+		tasks: make(map[string]*fairTask),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Register 任务开始运行，priority 小于 1 时按 1 处理，任务已经在运行时返回 false
+// 最后一个任务结束后的清理没有完成时等待清理完成
+func (q *FairQueue) Register(id string, name string, priority int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.idling {
+		q.cond.Wait()
+	}
+	if _, ok := q.tasks[id]; ok {
+		return false
+	}
+	if priority < 1 {
+		priority = 1
+	}
+	q.tasks[id] = &fairTask{id: id, name: name, priority: priority, start: time.Now(), vtime: q.vclock}
+	return true
+}
+
+// Unregister 任务运行结束，idle 不为空时如果没有其他任务在运行则调用，调用期间不会有新任务开始
+// idle 在锁外调用，可以使用队列的其他方法
+func (q *FairQueue) Unregister(id string, idle func()) {
+	q.mu.Lock()
+	delete(q.tasks, id)
+	q.cond.Broadcast()
+	if idle == nil || len(q.tasks) != 0 || q.idling {
+		q.mu.Unlock()
+		return
+	}
+	q.idling = true
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.idling = false
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}()
+	idle()
+}
+
+// Running 任务是否正在运行
+func (q *FairQueue) Running(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, ok := q.tasks[id]
+	return ok
+}
+
+// Len 正在运行的任务数量
+func (q *FairQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks)
+}
+
+// Submit 提交任务的一个目标，等待运行的目标达到协程池大小时阻塞，防止一次从 redis 取出所有目标
+func (q *FairQueue) Submit(id string, job func()) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t, ok := q.tasks[id]
+	if !ok {
+		return fmt.Errorf("task %v is not registered", id)
+	}
+	for len(t.pending) >= q.capacity() {
+		q.cond.Wait()
+		if q.tasks[id] != t {
+			return fmt.Errorf("task %v is not registered", id)
+		}
+	}
+	if len(t.pending) == 0 && t.running == 0 && t.vtime < q.vclock {
+		// 空闲的任务不能积累运行机会
+		t.vtime = q.vclock
+	}
+	t.pending = append(t.pending, job)
+	q.dispatch()
+	return nil
+}
+
+func (q *FairQueue) capacity() int {
+	size, err := PoolManage.GetModulePoolSize(q.pool)
+	if err != nil || size < 1 {
+		return 1
+	}
+	return size
+}
+
+// dispatch 协程池有空闲时运行虚拟时间最小的任务的目标，调用时需要持有锁
+func (q *FairQueue) dispatch() {
+	capacity := q.capacity()
+	for q.running < capacity {
+		var next *fairTask
+		for _, t := range q.tasks {
+			if len(t.pending) == 0 {
+				continue
+			}
+			if next == nil || t.vtime < next.vtime || (t.vtime == next.vtime && t.priority > next.priority) {
+				next = t
+			}
+		}
+		if next == nil {
+			return
+		}
+		job := next.pending[0]
+		next.pending = next.pending[1:]
+		q.vclock = next.vtime
+		next.vtime += 1 / float64(next.priority)
+		next.running++
+		q.running++
+		// 在新的协程中提交，dispatch 可能由刚运行完的目标调用，此时协程池的协程还没有释放
+		go q.run(next, job)
+		q.cond.Broadcast()
+	}
+}
+
+func (q *FairQueue) run(t *fairTask, job func()) {
+	err := PoolManage.SubmitTask(q.pool, func() {
+		defer q.done(t)
+		job()
+	})
+	if err != nil {
+		// 协程池不可用时直接运行，保证调用方的计数正确
+		logger.SlogError(fmt.Sprintf("task pool error: %v", err))
+		defer q.done(t)
+		job()
+	}
+}
+
+func (q *FairQueue) done(t *fairTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t.running--
+	t.finished++
+	q.running--
+	q.dispatch()
+	q.cond.Broadcast()
+}
+
+// Active 获取正在运行的任务，按优先级从高到低排序
+func (q *FairQueue) Active() []TaskStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	status := make([]TaskStatus, 0, len(q.tasks))
+	for _, t := range q.tasks {
+		status = append(status, TaskStatus{
+			ID:       t.id,
+			Name:     t.name,
+			Priority: t.priority,
+			Running:  t.running,
+			Pending:  len(t.pending),
+			Finished: t.finished,
+			Start:    t.start.Format("2006-01-02 15:04:05"),
+		})
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if status[i].Priority != status[j].Priority {
+			return status[i].Priority > status[j].Priority
+		}
+		return status[i].Start < status[j].Start
+	})
+	return status
+}
@@ -0,0 +1,218 @@
+// pool-------------------------------------
+// @file      : fair_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/10 21:40
+// -------------------------------------------
+
+package pool
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/panjf2000/ants/v2"
+	"go.uber.org/zap"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	Initialize()
+	os.Exit(m.Run())
+}
+
+// newTestQueue 创建使用单独协程池的公平队列
+func newTestQueue(t *testing.T, name string, size int) *FairQueue {
+	p, err := ants.NewPool(size)
+	if err != nil {
+		t.Fatalf("create pool error: %v", err)
+	}
+	t.Cleanup(p.Release)
+	PoolManage.mu.Lock()
+	PoolManage.pools[name] = p
+	PoolManage.locks[name] = &sync.Mutex{}
+	PoolManage.mu.Unlock()
+	return NewFairQueue(name)
+}
+
+func TestFairQueueRegister(t *testing.T) {
+	q := newTestQueue(t, "test-register", 2)
+	if !q.Register("a", "task a", 0) {
+		t.Fatal("Register(a) = false, want true")
+	}
+	if q.Register("a", "task a", 3) {
+		t.Fatal("Register(a) again = true, want false")
+	}
+	if !q.Running("a") || q.Len() != 1 {
+		t.Fatalf("Running(a) = %v, Len() = %v, want true, 1", q.Running("a"), q.Len())
+	}
+	if active := q.Active(); len(active) != 1 || active[0].Priority != 1 {
+		t.Fatalf("Active() = %+v, want priority 1", active)
+	}
+	if err := q.Submit("b", func() {}); err == nil {
+		t.Fatal("Submit(b) error = nil, want not registered")
+	}
+	q.Unregister("a", nil)
+	if q.Running("a") || q.Len() != 0 {
+		t.Fatalf("Running(a) = %v, Len() = %v, want false, 0", q.Running("a"), q.Len())
+	}
+}
+
+func TestFairQueuePriority(t *testing.T) {
+	tests := []struct {
+		name       string
+		priorities map[string]int
+		jobs       map[string]int
+		order      []string
+	}{
+		{
+			name:       "equal priority alternates",
+			priorities: map[string]int{"a": 1, "b": 1},
+			jobs:       map[string]int{"a": 3, "b": 3},
+			// 虚拟时间和优先级相同时先运行的任务不确定，只检查交替运行
+			order: nil,
+		},
+		{
+			name:       "weighted by priority",
+			priorities: map[string]int{"a": 2, "b": 1},
+			jobs:       map[string]int{"a": 4, "b": 2},
+			order:      []string{"a", "b", "a", "a", "b", "a"},
+		},
+		{
+			name:       "single task",
+			priorities: map[string]int{"a": 5},
+			jobs:       map[string]int{"a": 3},
+			order:      []string{"a", "a", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueue(t, "test-"+tt.name, 3)
+			var mu sync.Mutex
+			var order []string
+			var wg sync.WaitGroup
+			q.mu.Lock()
+			// 占用两个协程，每次只运行一个目标，运行顺序即为调度顺序
+			q.running = 2
+			total := 0
+			for id, priority := range tt.priorities {
+				q.tasks[id] = &fairTask{id: id, priority: priority, start: time.Now()}
+				for i := 0; i < tt.jobs[id]; i++ {
+					id := id
+					wg.Add(1)
+					total++
+					q.tasks[id].pending = append(q.tasks[id].pending, func() {
+						defer wg.Done()
+						mu.Lock()
+						order = append(order, id)
+						mu.Unlock()
+					})
+				}
+			}
+			q.dispatch()
+			q.mu.Unlock()
+			wg.Wait()
+			if len(order) != total {
+				t.Fatalf("order = %v, want %v jobs", order, total)
+			}
+			if tt.order != nil {
+				if !reflect.DeepEqual(order, tt.order) {
+					t.Fatalf("order = %v, want %v", order, tt.order)
+				}
+				return
+			}
+			// 每两个目标中两个任务各运行一个
+			for i := 1; i < len(order); i += 2 {
+				if order[i] == order[i-1] {
+					t.Fatalf("order = %v, want alternating", order)
+				}
+			}
+		})
+	}
+}
+
+func TestFairQueueSubmit(t *testing.T) {
+	q := newTestQueue(t, "test-submit", 2)
+	q.Register("a", "task a", 1)
+	q.Register("b", "task b", 2)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := make(map[string]int)
+	for i := 0; i < 5; i++ {
+		for _, id := range []string{"a", "b"} {
+			id := id
+			wg.Add(1)
+			if err := q.Submit(id, func() {
+				defer wg.Done()
+				mu.Lock()
+				finished[id]++
+				mu.Unlock()
+			}); err != nil {
+				t.Fatalf("Submit(%v) error: %v", id, err)
+			}
+		}
+	}
+	wg.Wait()
+	if finished["a"] != 5 || finished["b"] != 5 {
+		t.Fatalf("finished = %v, want 5 each", finished)
+	}
+	// 计数在目标返回后更新
+	deadline := time.Now().Add(time.Second)
+	for {
+		var total int64
+		for _, status := range q.Active() {
+			total += status.Finished
+		}
+		if total == 10 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Active() = %+v, want 10 finished", q.Active())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if active := q.Active(); active[0].ID != "b" {
+		t.Fatalf("Active() = %+v, want higher priority first", active)
+	}
+}
+
+func TestFairQueueIdle(t *testing.T) {
+	q := newTestQueue(t, "test-idle", 1)
+	q.Register("a", "task a", 1)
+	q.Register("b", "task b", 1)
+	called := false
+	q.Unregister("a", func() { called = true })
+	if called {
+		t.Fatal("idle called while other task is running")
+	}
+	registered := make(chan struct{})
+	q.Unregister("b", func() {
+		// idle 在锁外调用，可以使用队列的方法
+		if q.Len() != 0 {
+			t.Errorf("Len() = %v in idle, want 0", q.Len())
+		}
+		go func() {
+			q.Register("c", "task c", 1)
+			close(registered)
+		}()
+		select {
+		case <-registered:
+			t.Error("task registered while idle is running")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	select {
+	case <-registered:
+	case <-time.After(time.Second):
+		t.Fatal("task not registered after idle")
+	}
+	if !q.Running("c") {
+		t.Fatal("Running(c) = false, want true")
+	}
+}
@@ -125,7 +125,8 @@ func (pm *Manager) CustomSubmitTask(name string, size int, task func()) error {
 		if err != nil {
 			log.Fatalf("Failed to create pool for %s: %v", name, err)
 		}
-		pm.locks[name] = &sync.Mutex{}
+		lock = &sync.Mutex{}
+		pm.locks[name] = lock
 	}
 	pm.mu.Unlock()
 
@@ -158,6 +159,23 @@ func (pm *Manager) PrintRunningGoroutines(sortedModuleNames []string) {
 	}
 }
 
+// PoolStat 协程池的使用情况
+type PoolStat struct {
+	Running int `json:"running"`
+	Free    int `json:"free"`
+}
+
+// Stats 每个协程池正在运行和空闲的协程数量
+func (pm *Manager) Stats() map[string]PoolStat {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	stats := make(map[string]PoolStat, len(pm.pools))
+	for name, pool := range pm.pools {
+		stats[name] = PoolStat{Running: pool.Running(), Free: pool.Free()}
+	}
+	return stats
+}
+
 func (pm *Manager) GetModuleRunningGoroutines(module string) int {
 	running := pm.pools[module].Running()
 	return running
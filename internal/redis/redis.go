@@ -45,24 +45,56 @@ var RedisClient *Client
 //	return &Client{client: client}, nil
 //}
 
-func Initialize() {
-	client := redis.NewClient(&redis.Options{
-		Addr:           global.AppConfig.Redis.IP + ":" + global.AppConfig.Redis.Port,
-		Password:       global.AppConfig.Redis.Password,
-		DB:             0,
-		ReadTimeout:    -2,
-		MaxActiveConns: 50,
-		MinIdleConns:   5,
-		MaxIdleConns:   10,
-	})
+// Initialize 连接 redis，配置了哨兵时通过哨兵连接主节点，连接失败时重试，全部失败后返回错误
+func Initialize() error {
+	cfg := global.AppConfig.Redis
+	tlsConfig, err := cfg.TLS.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("redis tls config error: %v", err)
+	}
+	var client *redis.Client
+	if len(cfg.SentinelAddrs) != 0 {
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.SentinelMaster,
+			SentinelAddrs:    cfg.SentinelAddrs,
+			SentinelUsername: cfg.SentinelUsername,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        tlsConfig,
+			ReadTimeout:      -2,
+			MaxActiveConns:   50,
+			MinIdleConns:     5,
+			MaxIdleConns:     10,
+		})
+	} else {
+		client = redis.NewClient(&redis.Options{
+			Addr:           cfg.IP + ":" + cfg.Port,
+			Username:       cfg.Username,
+			Password:       cfg.Password,
+			DB:             cfg.DB,
+			TLSConfig:      tlsConfig,
+			ReadTimeout:    -2,
+			MaxActiveConns: 50,
+			MinIdleConns:   5,
+			MaxIdleConns:   10,
+		})
+	}
 
 	// 检查连接是否正常
-	_, err := client.Ping(context.Background()).Result()
+	err = global.Connect("redis", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return client.Ping(ctx).Err()
+	})
 	if err != nil {
-		fmt.Printf("failed to connect to Redis: %v", err)
+		_ = client.Close()
+		return err
 	}
 
 	RedisClient = &Client{client: client}
+	return nil
 }
 
 func (r *Client) Client() *redis.Client {
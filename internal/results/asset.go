@@ -0,0 +1,179 @@
+// results-------------------------------------
+// @file      : asset.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/24 20:36
+// -------------------------------------------
+
+package results
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// assetMergeFields 资产中需要和历史资产合并的字段，其他字段使用本次扫描的结果
+var assetMergeFields = map[string]bool{
+	"time":         true,
+	"lastScanTime": true,
+	"project":      true,
+	"rootDomain":   true,
+	"taskName":     true,
+	"tags":         true,
+}
+
+// assetPipeline 生成资产的更新管道，扫描结果直接覆盖，首次发现时间、项目和根域名只在插入时设置，任务和标签与历史资产合并
+// 使用管道更新兼容历史资产中 tags 等字段为 null 的情况
+func assetPipeline(asset interface{}, scanTime string, project string, rootDomain string, taskName []string, tags []string) (bson.A, error) {
+	data, err := bson.Marshal(asset)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if taskName == nil {
+		taskName = []string{}
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	set := bson.D{}
+	for _, e := range doc {
+		// 资产属于多个任务，任务 id 只用于 JSONL 后端按任务写入文件，不写入资产
+		if assetMergeFields[e.Key] || e.Key == "taskId" {
+			continue
+		}
+		// 使用 $literal 防止以 $ 开头的扫描结果被当作字段路径
+		set = append(set, bson.E{Key: e.Key, Value: bson.M{"$literal": e.Value}})
+	}
+	set = append(set,
+		bson.E{Key: "lastScanTime", Value: bson.M{"$literal": scanTime}},
+		bson.E{Key: "time", Value: bson.M{"$ifNull": bson.A{"$time", bson.M{"$literal": scanTime}}}},
+		bson.E{Key: "project", Value: bson.M{"$ifNull": bson.A{"$project", bson.M{"$literal": project}}}},
+		bson.E{Key: "rootDomain", Value: bson.M{"$ifNull": bson.A{"$rootDomain", bson.M{"$literal": rootDomain}}}},
+		bson.E{Key: "taskName", Value: bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$taskName", bson.A{}}}, bson.M{"$literal": taskName}}}},
+		bson.E{Key: "tags", Value: bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$tags", bson.A{}}}, bson.M{"$literal": tags}}}},
+	)
+	return bson.A{bson.M{"$set": set}}, nil
+}
+
+// upsertAsset 在 mongodb 中以 host+port 为键原子更新或插入资产，返回更新前的资产，资产不存在时返回 nil
+// 多个节点同时更新同一资产时，每次更新得到的都是被自己替换的版本，变更记录不会重复或遗漏
+func (h *handler) upsertAsset(host string, port string, update bson.A, taskId string) bson.Raw {
+	selector := bson.M{"host": host, "port": port}
+	for _, sink := range Sinks.list {
+		mongo, ok := sink.(*mongoSink)
+		if !ok {
+			continue
+		}
+		previous, err := mongo.findAndUpsert("asset", selector, update)
+		if err == nil {
+			return previous
+		}
+		// 原子更新失败时按普通更新重试，仍然失败则写入死信，此时不记录变更
+		logger.SlogError(fmt.Sprintf("asset %v:%v upsert error: %v", host, port, err))
+		operations := []types.BulkUpdateOperation{{Selector: selector, Update: update, TaskId: taskId}}
+		if _, err := writeBatch(sink, &batch{Collection: "asset", Op: "update", Upsert: true, Operations: operations}); err != nil {
+			logger.SlogError(fmt.Sprintf("asset %v:%v write error: %v", host, port, err))
+		}
+	}
+	return nil
+}
+
+// recordAsset 将合并后的资产写入 mongodb 以外的后端
+func (h *handler) recordAsset(asset interface{}) {
+	for _, sink := range Sinks.list {
+		if _, ok := sink.(*mongoSink); ok {
+			continue
+		}
+		if _, err := writeBatch(sink, &batch{Collection: "asset", Op: "insert", Docs: []interface{}{asset}}); err != nil {
+			logger.SlogError(fmt.Sprintf("asset %v write error: %v", sink.Name(), err))
+		}
+	}
+}
+
+// changeLog 历史资产存在变化时写入变更记录
+func (h *handler) changeLog(previous bson.Raw, change types.AssetChangeLog) {
+	if change.Timestamp == "" {
+		return
+	}
+	if id, ok := previous.Lookup("_id").ObjectIDOK(); ok {
+		change.AssetId = id.Hex()
+	}
+	h.AssetChangeLog(&change)
+}
+
+// AssetOtherUpsert 原子更新或插入非 http 资产，根据更新前的资产记录变更，result 会合并历史资产的首次发现时间、项目、任务和标签
+func (h *handler) AssetOtherUpsert(result *types.AssetOther) {
+	rootDomain, err := utils.Tools.GetRootDomain(result.Host)
+	if err != nil {
+		logger.SlogInfoLocal(fmt.Sprintf("%v GetRootDomain error: %v", result.Host, err))
+	}
+	if result.Time == "" {
+		result.Time = utils.Tools.GetTimeNow()
+	}
+	project := h.GetAssetProject(rootDomain)
+	update, err := assetPipeline(result, result.Time, project, rootDomain, result.TaskName, result.Tags)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("AssetOtherUpsert %v:%v error: %v", result.Host, result.Port, err))
+		return
+	}
+	previous := h.upsertAsset(result.Host, result.Port, update, result.TaskId)
+	result.LastScanTime = result.Time
+	if previous == nil {
+		result.Project = project
+		result.RootDomain = rootDomain
+	} else {
+		var old types.AssetOther
+		if err := bson.Unmarshal(previous, &old); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("AssetOtherUpsert %v:%v decode error: %v", result.Host, result.Port, err))
+		}
+		h.changeLog(previous, utils.Results.CompareAssetOther(old, *result))
+		result.Time = old.Time
+		result.Project = old.Project
+		result.RootDomain = old.RootDomain
+		result.TaskName = utils.Tools.RemoveStringDuplicates(append(result.TaskName, old.TaskName...))
+		result.Tags = utils.Tools.RemoveStringDuplicates(append(result.Tags, old.Tags...))
+	}
+	h.recordAsset(result)
+}
+
+// AssetHttpUpsert 原子更新或插入 http 资产，根据更新前的资产记录变更，result 会合并历史资产的首次发现时间、项目、任务和标签
+func (h *handler) AssetHttpUpsert(result *types.AssetHttp) {
+	rootDomain, err := utils.Tools.GetRootDomain(result.Host)
+	if err != nil {
+		logger.SlogInfoLocal(fmt.Sprintf("%v GetRootDomain error: %v", result.Host, err))
+	}
+	if result.Time == "" {
+		result.Time = utils.Tools.GetTimeNow()
+	}
+	project := h.GetAssetProject(rootDomain)
+	update, err := assetPipeline(result, result.Time, project, rootDomain, result.TaskName, result.Tags)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("AssetHttpUpsert %v:%v error: %v", result.Host, result.Port, err))
+		return
+	}
+	previous := h.upsertAsset(result.Host, result.Port, update, result.TaskId)
+	result.LastScanTime = result.Time
+	if previous == nil {
+		result.Project = project
+		result.RootDomain = rootDomain
+	} else {
+		var old types.AssetHttp
+		if err := bson.Unmarshal(previous, &old); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("AssetHttpUpsert %v:%v decode error: %v", result.Host, result.Port, err))
+		}
+		h.changeLog(previous, utils.Results.CompareAssetHttp(old, *result))
+		result.Time = old.Time
+		result.Project = old.Project
+		result.RootDomain = old.RootDomain
+		result.TaskName = utils.Tools.RemoveStringDuplicates(append(result.TaskName, old.TaskName...))
+		result.Tags = utils.Tools.RemoveStringDuplicates(append(result.Tags, old.Tags...))
+	}
+	h.recordAsset(result)
+}
@@ -0,0 +1,137 @@
+// results-------------------------------------
+// @file      : deadletter.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/23 21:02
+// -------------------------------------------
+
+package results
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const deadLetterPrefix = "deadletter:"
+
+// deadLetter 写入失败的一批结果
+type deadLetter struct {
+	Sink       string                      `bson:"sink"`
+	Collection string                      `bson:"collection"`
+	Op         string                      `bson:"op"`
+	Upsert     bool                        `bson:"upsert"`
+	Docs       []bson.Raw                  `bson:"docs"`
+	Operations []types.BulkUpdateOperation `bson:"operations"`
+	Error      string                      `bson:"error"`
+	Time       string                      `bson:"time"`
+}
+
+type deadLetters struct {
+	// 同一时间只进行一次重新写入
+	mu sync.Mutex
+}
+
+// DeadLetters 本地死信存储，保存重试后仍然写入失败的结果
+var DeadLetters = &deadLetters{}
+
+// Add 将写入失败的结果写入死信
+func (d *deadLetters) Add(sinkName string, b *batch, writeErr error) error {
+	if !walEnabled() {
+		return fmt.Errorf("pebbledb is not initialized")
+	}
+	dl := deadLetter{
+		Sink:       sinkName,
+		Collection: b.Collection,
+		Op:         b.Op,
+		Upsert:     b.Upsert,
+		Operations: b.Operations,
+		Time:       utils.Tools.GetTimeNow(),
+	}
+	if writeErr != nil {
+		dl.Error = writeErr.Error()
+	}
+	for _, doc := range b.Docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		dl.Docs = append(dl.Docs, raw)
+	}
+	data, err := bson.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%v%v:%v:%020d", deadLetterPrefix, sinkName, b.Collection, walSeq.Add(1))
+	return pebbledb.PebbleStore.Put([]byte(key), data)
+}
+
+// Resubmit 将死信中的结果重新写入对应的后端，filter 不为空时只写入该集合的结果，返回重新写入成功的结果数量
+func (d *deadLetters) Resubmit(filter string) (int, error) {
+	if !walEnabled() {
+		return 0, fmt.Errorf("pebbledb is not initialized")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(deadLetterPrefix)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	total := 0
+	for _, key := range keys {
+		var dl deadLetter
+		if err := bson.Unmarshal(records[key], &dl); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("dead letter %v decode error: %v", key, err))
+			continue
+		}
+		if filter != "" && dl.Collection != filter {
+			continue
+		}
+		sink := Sinks.get(dl.Sink)
+		if sink == nil {
+			logger.SlogWarnLocal(fmt.Sprintf("dead letter %v sink %v is not enabled", key, dl.Sink))
+			continue
+		}
+		b := &batch{Collection: dl.Collection, Op: dl.Op, Upsert: dl.Upsert, Operations: dl.Operations}
+		for _, doc := range dl.Docs {
+			b.Docs = append(b.Docs, doc)
+		}
+		// 重新写入失败的结果会写入新的死信，之后删除原来的死信
+		deadLettered, err := writeBatch(sink, b)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("dead letter %v resubmit error: %v", key, err))
+			continue
+		}
+		if err := pebbledb.PebbleStore.Delete([]byte(key)); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("dead letter %v delete error: %v", key, err))
+		}
+		total += b.len() - deadLettered
+	}
+	WriteStats.resubmitted.Add(int64(total))
+	return total, nil
+}
+
+// ResubmitDeadLetters 处理重新写入死信的命令，content 为集合名称，为空或 all 时写入所有死信
+func ResubmitDeadLetters(content string) {
+	filter := strings.TrimSpace(content)
+	if filter == "all" {
+		filter = ""
+	}
+	count, err := DeadLetters.Resubmit(filter)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("resubmit dead letters error: %v", err))
+		return
+	}
+	logger.SlogInfo(fmt.Sprintf("resubmit dead letters success: %v", count))
+}
@@ -12,13 +12,13 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/bigcache"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/mongodb"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"net/url"
 	"strings"
@@ -37,7 +37,8 @@ func InitializeDuplicate() {
 func (d *duplicate) SubdomainInTask(taskId string, host string, isRestart bool) bool {
 	key := "duplicates:" + taskId + ":subdomain:" + host
 	flag := d.DuplicateLocalCache(key)
-	if isRestart {
+	if isRestart || global.Standalone {
+		// 单机模式只使用本地缓存去重
 		return flag
 	} else {
 		if flag {
@@ -52,6 +53,9 @@ func (d *duplicate) SubdomainInTask(taskId string, host string, isRestart bool)
 }
 
 func (d *duplicate) SubdomainInMongoDb(result *types.SubdomainResult) bool {
+	if global.Standalone {
+		return true
+	}
 	var resultDoc bson.M
 	err := mongodb.MongodbClient.FindOne("subdomain", bson.M{"host": result.Host}, bson.M{"_id": 1}, &resultDoc)
 	if err != nil {
@@ -70,7 +74,7 @@ func (d *duplicate) SubdomainInMongoDb(result *types.SubdomainResult) bool {
 func (d *duplicate) PortIntask(taskId string, host string, port string, isRestart bool) bool {
 	key := "duplicates:" + taskId + ":port:" + host + ":" + port
 	flag := d.DuplicateLocalCache(key)
-	if isRestart {
+	if isRestart || global.Standalone {
 		return flag
 	}
 	if flag {
@@ -119,26 +123,16 @@ func (d *duplicate) DuplicateRedisCache(key string, value string) bool {
 	}
 }
 
-func (d *duplicate) AssetInMongodb(host string, port string) (bool, string, bson.M) {
-	var result bson.M
-	err := mongodb.MongodbClient.FindOne("asset", bson.M{"host": host, "port": port}, nil, &result)
-	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			// 说明在mongodb中不存在
-			return false, "", nil
-		}
-		// 其他错误也认为在mongodb中不存在
-		logger.SlogErrorLocal(fmt.Sprintf("AssetInMongodb error :%s\n", err))
-		return false, "", nil
-	} else {
-		// 获取并删除 _id 字段，转换为字符串
-		var id string
-		if objId, ok := result["_id"].(primitive.ObjectID); ok {
-			id = objId.Hex()      // 将 ObjectID 转为字符串
-			delete(result, "_id") // 从 result 中删除 _id 字段
+// ResetTask 清除任务的去重记录，定时任务再次运行时重新扫描所有资产
+func (d *duplicate) ResetTask(taskId string) {
+	bigcache.BigCache.DeletePrefix("duplicates:" + taskId + ":")
+	if global.Standalone {
+		return
+	}
+	for _, key := range []string{"duplicates:" + taskId + ":domain", "duplicates:" + taskId + ":port"} {
+		if err := redis.RedisClient.Del(context.Background(), key); err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("ResetTask delete %v error: %v", key, err))
 		}
-		// 在mongodb中找到了这个资产记录
-		return true, id, result
 	}
 }
 
@@ -0,0 +1,75 @@
+// results-------------------------------------
+// @file      : findings.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/21 20:15
+// -------------------------------------------
+
+package results
+
+import (
+	"strings"
+	"sync"
+)
+
+// 漏洞等级，数值越大越严重
+var severityRank = map[string]int{
+	"unknown":  0,
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+type findings struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// Findings 按等级统计节点发现的漏洞
+var Findings = &findings{counts: make(map[string]int)}
+
+// SeverityRank 获取漏洞等级的数值，未知等级返回 -1
+func SeverityRank(level string) int {
+	rank, ok := severityRank[strings.ToLower(strings.TrimSpace(level))]
+	if !ok {
+		return -1
+	}
+	return rank
+}
+
+func (f *findings) Record(level string) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if _, ok := severityRank[level]; !ok {
+		level = "unknown"
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[level] += 1
+}
+
+// Counts 获取每个等级的漏洞数量
+func (f *findings) Counts() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[string]int, len(f.counts))
+	for level, count := range f.counts {
+		counts[level] = count
+	}
+	return counts
+}
+
+// AtLeast 获取等级不低于 level 的漏洞数量
+func (f *findings) AtLeast(level string) int {
+	threshold := SeverityRank(level)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	total := 0
+	for l, count := range f.counts {
+		if severityRank[l] >= threshold {
+			total += count
+		}
+	}
+	return total
+}
@@ -0,0 +1,54 @@
+// results-------------------------------------
+// @file      : findings_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/13 21:40
+// -------------------------------------------
+
+package results
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"testing"
+)
+
+func TestVulnerabilityFindings(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []string
+		failOn string
+		want   int
+	}{
+		{name: "no findings", failOn: "info"},
+		{name: "below threshold", levels: []string{"info", "low", "medium"}, failOn: "high"},
+		{name: "at threshold", levels: []string{"low", "High"}, failOn: "high", want: 1},
+		{name: "above threshold", levels: []string{"critical", "high", "info"}, failOn: "medium", want: 2},
+		{name: "unknown level", levels: []string{"weird"}, failOn: "info"},
+		{name: "unknown level counted by unknown", levels: []string{"weird", "info"}, failOn: "unknown", want: 2},
+	}
+	useSink(t, &testSink{})
+	queue := &ResultQueue{Queue: make(chan interface{}, 10)}
+	ResultQueues["VulnerabilityScan"] = queue
+	defer delete(ResultQueues, "VulnerabilityScan")
+	InitializeHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := Findings
+			Findings = &findings{counts: make(map[string]int)}
+			defer func() { Findings = previous }()
+			for _, level := range tt.levels {
+				Handler.Vulnerability(&types.VulnResult{Url: "https://example.com", VulName: "test", Level: level})
+			}
+			// 结果处理返回时漏洞已经计数并进入结果队列，单机模式据此确定退出码
+			if len(queue.Queue) != len(tt.levels) {
+				t.Fatalf("queued %v results, want %v", len(queue.Queue), len(tt.levels))
+			}
+			for len(queue.Queue) > 0 {
+				<-queue.Queue
+			}
+			if got := Findings.AtLeast(tt.failOn); got != tt.want {
+				t.Fatalf("AtLeast(%q) = %v, want %v", tt.failOn, got, tt.want)
+			}
+		})
+	}
+}
@@ -10,16 +10,16 @@ package results
 import (
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
-	"github.com/Autumn-27/ScopeSentry-Scan/internal/mongodb"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/notification"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"strings"
 )
 
+// handler 处理模块的结果，方法返回时结果已经写入预写日志并进入结果队列
+// 模块需要直接调用，不能放到 goroutine 中，目标的模块结束后删除目标或者关闭结果队列时不会遗漏结果
 type handler struct {
 }
 
@@ -68,7 +68,7 @@ func (h *handler) Subdomain(result *types.SubdomainResult) {
 		NotificationMsg := fmt.Sprintf("%v - %v\n", result.Host, result.IP)
 		notification.NotificationQueues["SubdomainScan"].Queue <- NotificationMsg
 	}
-	ResultQueues["SubdomainScan"].Queue <- interfaceSlice
+	Enqueue("SubdomainScan", interfaceSlice)
 }
 
 func (h *handler) SubdomainTakeover(result *types.SubTakeResult) {
@@ -84,67 +84,13 @@ func (h *handler) SubdomainTakeover(result *types.SubTakeResult) {
 		NotificationMsg := fmt.Sprintf("Subdomain Takeover:\n%v - %v\n", result.Input, result.Cname)
 		notification.NotificationQueues["SubdomainSecurity"].Queue <- NotificationMsg
 	}
-	ResultQueues["SubdomainSecurity"].Queue <- interfaceSlice
+	Enqueue("SubdomainSecurity", interfaceSlice)
 }
 
 func (h *handler) AssetChangeLog(result *types.AssetChangeLog) {
 	var interfaceSlice interface{}
 	interfaceSlice = &result
-	ResultQueues["AssetChangeLog"].Queue <- interfaceSlice
-}
-
-func (h *handler) AssetUpdate(id string, updateData interface{}) {
-	// 资产比较少，并且需要实时获取历史记录，所以不采用多条插入的方式
-	objectID, err := primitive.ObjectIDFromHex(id) // 将字符串 ID 转换为 ObjectID
-	if err != nil {
-		logger.SlogError(fmt.Sprintf("AssetUpdate %v ObjectIDFromHex error:%v", id, err))
-		return
-	}
-	selector := bson.M{"_id": objectID} // 创建选择器，匹配指定的 ObjectID
-	_, err = mongodb.MongodbClient.Update("asset", selector, bson.M{"$set": updateData})
-	if err != nil {
-		logger.SlogError(fmt.Sprintf("AssetUpdate %v error:%v", id, err))
-	} // 使用 $set 更新字段
-}
-
-func (h *handler) AssetOtherInsert(result *types.AssetOther) {
-	// 资产比较少，并且需要实时获取历史记录，所以不采用多条插入的方式
-	var interfaceSlice interface{}
-	rootDomain, err := utils.Tools.GetRootDomain(result.Host)
-	if err != nil {
-		logger.SlogInfoLocal(fmt.Sprintf("%v GetRootDomain error: %v", result.Host, err))
-	}
-	result.RootDomain = rootDomain
-	if result.Time == "" {
-		result.Time = utils.Tools.GetTimeNow()
-	}
-	result.Project = h.GetAssetProject(rootDomain)
-	interfaceSlice = &result
-	_, err = mongodb.MongodbClient.InsertOne("asset", interfaceSlice)
-	if err != nil {
-		logger.SlogError(fmt.Sprintf("AssetOtherInsert error:%v", err))
-		return
-	}
-}
-
-func (h *handler) AssetHttpInsert(result *types.AssetHttp) {
-	// 资产比较少，并且需要实时获取历史记录，所以不采用多条插入的方式
-	var interfaceSlice interface{}
-	rootDomain, err := utils.Tools.GetRootDomain(result.Host)
-	if err != nil {
-		logger.SlogInfoLocal(fmt.Sprintf("%v GetRootDomain error: %v", result.Host, err))
-	}
-	result.RootDomain = rootDomain
-	if result.Time == "" {
-		result.Time = utils.Tools.GetTimeNow()
-	}
-	result.Project = h.GetAssetProject(rootDomain)
-	interfaceSlice = &result
-	_, err = mongodb.MongodbClient.InsertOne("asset", interfaceSlice)
-	if err != nil {
-		logger.SlogError(fmt.Sprintf("AssetOtherInsert error:%v", err))
-		return
-	}
+	Enqueue("AssetChangeLog", interfaceSlice)
 }
 
 func (h *handler) URL(result *types.UrlResult) {
@@ -170,12 +116,13 @@ func (h *handler) URL(result *types.UrlResult) {
 		Time:       result.Time,
 		Project:    result.Project,
 		TaskName:   result.TaskName,
+		TaskId:     result.TaskId,
 		ResultId:   result.ResultId,
 		RootDomain: result.RootDomain,
 		Body:       "", // 设置Body为空
 	}
 	interfaceSlice = &resultCopy
-	ResultQueues["URLScan"].Queue <- interfaceSlice
+	Enqueue("URLScan", interfaceSlice)
 }
 
 func (h *handler) Crawler(result *types.CrawlerResult) {
@@ -190,7 +137,7 @@ func (h *handler) Crawler(result *types.CrawlerResult) {
 	}
 	result.Project = h.GetAssetProject(rootDomain)
 	interfaceSlice = &result
-	ResultQueues["WebCrawler"].Queue <- interfaceSlice
+	Enqueue("WebCrawler", interfaceSlice)
 }
 
 func (h *handler) Sensitive(result *types.SensitiveResult) {
@@ -209,11 +156,11 @@ func (h *handler) Sensitive(result *types.SensitiveResult) {
 		NotificationMsg := fmt.Sprintf("Sensitive Scan:\n%v - %v\n", result.Url, result.SID)
 		notification.NotificationQueues["URLSecurity"].Queue <- NotificationMsg
 	}
-	ResultQueues["SensitiveResult"].Queue <- interfaceSlice
+	Enqueue("SensitiveResult", interfaceSlice)
 
 }
 
-func (h *handler) SensitiveBody(body *string, md5 string) {
+func (h *handler) SensitiveBody(body *string, md5 string, taskId string) {
 	selector := bson.M{"md5": md5}
 
 	update := bson.M{
@@ -225,11 +172,12 @@ func (h *handler) SensitiveBody(body *string, md5 string) {
 	op := types.BulkUpdateOperation{
 		Selector: selector,
 		Update:   update,
+		TaskId:   taskId,
 	}
-	ResultQueues["SensitiveBody"].Queue <- op
+	Enqueue("SensitiveBody", op)
 }
 
-func (h *handler) SensitiveUrl(url string, urlId string, bodyId string) {
+func (h *handler) SensitiveUrl(url string, urlId string, bodyId string, taskId string) {
 	key := "SenU:" + urlId
 	collectionName := "SensitiveUrl"
 	selector := bson.M{"urlId": urlId}
@@ -243,7 +191,7 @@ func (h *handler) SensitiveUrl(url string, urlId string, bodyId string) {
 			},
 		}
 		// 调用 Upsert 方法，执行插入或更新操作
-		_, err := mongodb.MongodbClient.Upsert(collectionName, selector, update)
+		err := Sinks.Update(collectionName, []types.BulkUpdateOperation{{Selector: selector, Update: update, TaskId: taskId}}, true)
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("SensitiveUrl insert mongodb error:%v", err))
 		}
@@ -268,7 +216,7 @@ func (h *handler) Dir(result *types.DirResult) {
 		}
 		notification.NotificationQueues["DirScan"].Queue <- NotificationMsg
 	}
-	ResultQueues["DirScan"].Queue <- interfaceSlice
+	Enqueue("DirScan", interfaceSlice)
 }
 
 func (h *handler) Vulnerability(result *types.VulnResult) {
@@ -283,26 +231,27 @@ func (h *handler) Vulnerability(result *types.VulnResult) {
 	}
 	result.Project = h.GetAssetProject(rootDomain)
 	interfaceSlice = &result
+	Findings.Record(result.Level)
 	if global.NotificationConfig.VulNotification {
 		NotificationMsg := ""
 		if global.NotificationConfig.VulLevel != "" {
 			if strings.Contains(strings.ToLower(global.NotificationConfig.VulLevel), strings.ToLower(result.Level)+",") {
 				if result.Url != "" {
-					NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Url)
+					NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Url, result.Level, result.VulName)
 				} else {
-					NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Matched)
+					NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Matched, result.Level, result.VulName)
 				}
 			}
 		} else {
 			if result.Url != "" {
-				NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Url)
+				NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Url, result.Level, result.VulName)
 			} else {
-				NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Matched)
+				NotificationMsg += fmt.Sprintf("%v-[%v]-[%v]\n", result.Matched, result.Level, result.VulName)
 			}
 		}
 		notification.NotificationQueues["VulnerabilityScan"].Queue <- NotificationMsg
 	}
-	ResultQueues["VulnerabilityScan"].Queue <- interfaceSlice
+	Enqueue("VulnerabilityScan", interfaceSlice)
 }
 
 func (h *handler) PageMonitoringInsert(result *types.PageMonit) {
@@ -317,11 +266,11 @@ func (h *handler) PageMonitoringInsert(result *types.PageMonit) {
 	}
 	result.Project = h.GetAssetProject(rootDomain)
 	interfaceSlice = &result
-	ResultQueues["PageMonitoring"].Queue <- interfaceSlice
+	Enqueue("PageMonitoring", interfaceSlice)
 }
 
 func (h *handler) PageMonitoringInsertBody(result *types.PageMonitBody) {
 	var interfaceSlice interface{}
 	interfaceSlice = &result
-	ResultQueues["PageMonitoringBody"].Queue <- interfaceSlice
+	Enqueue("PageMonitoringBody", interfaceSlice)
 }
@@ -8,12 +8,17 @@
 package results
 
 import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"sync"
 	"time"
 )
 
 const (
 	batchSize     = 60
 	flushInterval = 30 * time.Second
+	// 重新写入写入失败保留在预写日志中的结果的间隔
+	walRetryInterval = 5 * time.Minute
 )
 
 type ResultQueue struct {
@@ -23,6 +28,13 @@ type ResultQueue struct {
 
 var ResultQueues = make(map[string]*ResultQueue)
 
+var queueWg sync.WaitGroup
+
+var (
+	closeMu sync.RWMutex
+	closed  bool // 队列已关闭，之后的结果不再进入队列
+)
+
 func InitializeResultQueue() {
 	// 模块列表
 	modules := []string{
@@ -60,88 +72,144 @@ func InitializeResultQueue() {
 			}
 		}
 
-		go processQueue(module, ResultQueues[module])
 	}
 
 	// 初始化去重模块
 	InitializeDuplicate()
 	// 初始化结果处理模块
 	InitializeHandler()
+	// 初始化结果写入后端
+	InitializeSinks()
 	// 初始化结果插入模块
 	InitializeResults()
+
+	for _, module := range modules {
+		// 写入上次运行没有写入的结果后再开始处理队列
+		wq := replayWAL(module)
+		queueWg.Add(1)
+		go processQueue(module, ResultQueues[module], wq)
+	}
 }
 
-func processQueue(module string, mq *ResultQueue) {
+// processQueue 处理模块的结果队列，等待重试的写入到期后重试，重试期间继续处理队列
+func processQueue(module string, mq *ResultQueue, wq *writeQueue) {
 	ticker := time.NewTicker(flushInterval)
 	if module == "URLScan" {
 		ticker = time.NewTicker(60 * time.Second)
 	}
 	defer ticker.Stop()
+	retryTicker := time.NewTicker(retryMinDelay)
+	defer retryTicker.Stop()
+	// 定期重新写入写入失败保留在预写日志中的结果
+	walTicker := time.NewTicker(walRetryInterval)
+	defer walTicker.Stop()
+	defer queueWg.Done()
 
 	var buffer []interface{}
+	// 缓冲区中结果对应的预写日志键
+	var keys [][]byte
 
 	for {
 		select {
 		case batch := <-mq.Queue:
-			if batch != nil {
-				buffer = append(buffer, batch)
+			if qi, ok := batch.(queueItem); ok {
+				buffer = append(buffer, qi.item)
+				keys = append(keys, qi.key)
 				if len(buffer) >= batchSize-2 {
-					flushBuffer(module, &buffer)
+					wq.flush(&buffer, &keys)
 				}
 			}
 
 		case <-ticker.C:
 			if len(buffer) > 0 {
-				flushBuffer(module, &buffer)
+				wq.flush(&buffer, &keys)
+			}
+		case now := <-retryTicker.C:
+			if len(wq.retries) > 0 {
+				wq.retry(now, false)
 			}
+		case <-walTicker.C:
+			wq.replayKept()
 		case <-mq.CloseCh:
-			// 处理关闭信号
+			// 处理关闭信号，队列已关闭，取出队列中剩余的结果
+			for batch := range mq.Queue {
+				if qi, ok := batch.(queueItem); ok {
+					buffer = append(buffer, qi.item)
+					keys = append(keys, qi.key)
+				}
+			}
 			if len(buffer) > 0 {
-				flushBuffer(module, &buffer)
+				wq.flush(&buffer, &keys)
 			}
+			wq.close()
 			return
 		}
 	}
 }
 
-func flushBuffer(module string, buffer *[]interface{}) {
-	if len(*buffer) == 0 {
-		return
+// Backlog 每个结果队列中等待写入的结果数量
+func Backlog() map[string]int {
+	backlog := make(map[string]int, len(ResultQueues))
+	for module, mq := range ResultQueues {
+		backlog[module] = len(mq.Queue)
 	}
-	var name string
+	return backlog
+}
+
+// moduleBatch 将缓冲区中的结果转换为写入对应集合的一批结果
+func moduleBatch(module string, buffer []interface{}) (*batch, error) {
 	if module == "SensitiveBody" {
-		Results.Update(buffer)
-	} else {
-		switch module {
-		case "SubdomainScan":
-			name = "subdomain"
-		case "SubdomainSecurity":
-			name = "SubdoaminTakerResult"
-		case "AssetChangeLog":
-			name = "AssetChangeLog"
-		case "URLScan":
-			name = "UrlScan"
-		case "SensitiveResult":
-			name = "SensitiveResult"
-		case "WebCrawler":
-			name = "crawler"
-		case "VulnerabilityScan":
-			name = "vulnerability"
-		case "DirScan":
-			name = "DirScanResult"
-		case "PageMonitoring":
-			name = "PageMonitoring"
-		case "PageMonitoringBody":
-			name = "PageMonitoringBody"
+		// 没有匹配文档时插入新的文档
+		b := &batch{Collection: "SensitiveBody", Op: "update", Upsert: true}
+		for _, item := range buffer {
+			op, ok := item.(types.BulkUpdateOperation)
+			if !ok {
+				return nil, fmt.Errorf("update SensitiveBody error: item is not of type types.BulkUpdateOperation")
+			}
+			b.Operations = append(b.Operations, op)
 		}
-		Results.Insert(name, buffer)
+		return b, nil
 	}
-	*buffer = nil
+	var name string
+	switch module {
+	case "SubdomainScan":
+		name = "subdomain"
+	case "SubdomainSecurity":
+		name = "SubdoaminTakerResult"
+	case "AssetChangeLog":
+		name = "AssetChangeLog"
+	case "URLScan":
+		name = "UrlScan"
+	case "SensitiveResult":
+		name = "SensitiveResult"
+	case "WebCrawler":
+		name = "crawler"
+	case "VulnerabilityScan":
+		name = "vulnerability"
+	case "DirScan":
+		name = "DirScanResult"
+	case "PageMonitoring":
+		name = "PageMonitoring"
+	case "PageMonitoringBody":
+		name = "PageMonitoringBody"
+	}
+	return &batch{Collection: name, Op: "insert", Docs: buffer}, nil
 }
 
+// Close 关闭结果队列，写入队列中剩余的结果，重复调用不会出错
 func Close() {
+	closeMu.Lock()
+	if closed {
+		closeMu.Unlock()
+		return
+	}
+	closed = true
+	closeMu.Unlock()
 	for _, mq := range ResultQueues {
 		close(mq.Queue)   // 关闭队列
 		close(mq.CloseCh) // 发送关闭信号
 	}
+	// 等待缓冲区中的结果写入后关闭写入后端
+	queueWg.Wait()
+	Sinks.Close()
 }
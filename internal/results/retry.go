@@ -0,0 +1,208 @@
+// results-------------------------------------
+// @file      : retry.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/23 20:18
+// -------------------------------------------
+
+package results
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/metrics"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	retryAttempts = 6
+	retryMinDelay = time.Second
+	retryMaxDelay = 30 * time.Second
+)
+
+// BatchError 批量写入部分失败，Retryable 为可以重试的结果下标，Failed 为重试也无法写入的结果下标
+// 后端返回其他错误时表示整批结果都没有写入，整批结果都会重试
+type BatchError struct {
+	Retryable []int
+	Failed    []int
+	Err       error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%v retryable, %v failed: %v", len(e.Retryable), len(e.Failed), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batch 一批写入同一集合的结果
+type batch struct {
+	Collection string
+	Op         string // insert 或 update
+	Upsert     bool
+	Docs       []interface{}
+	Operations []types.BulkUpdateOperation
+}
+
+func (b *batch) len() int {
+	if b.Op == "update" {
+		return len(b.Operations)
+	}
+	return len(b.Docs)
+}
+
+func (b *batch) subset(indexes []int) *batch {
+	sub := &batch{Collection: b.Collection, Op: b.Op, Upsert: b.Upsert}
+	for _, i := range indexes {
+		if b.Op == "update" {
+			sub.Operations = append(sub.Operations, b.Operations[i])
+		} else {
+			sub.Docs = append(sub.Docs, b.Docs[i])
+		}
+	}
+	return sub
+}
+
+func (b *batch) merge(other *batch) {
+	b.Docs = append(b.Docs, other.Docs...)
+	b.Operations = append(b.Operations, other.Operations...)
+}
+
+func (b *batch) apply(sink ResultSink) error {
+	if b.Op == "update" {
+		return sink.Update(b.Collection, b.Operations, b.Upsert)
+	}
+	return sink.Insert(b.Collection, b.Docs)
+}
+
+type writeStats struct {
+	retried      atomic.Int64
+	deadLettered atomic.Int64
+	dropped      atomic.Int64
+	resubmitted  atomic.Int64
+}
+
+// WriteStats 结果写入统计，retried 为重试的结果数量，deadLettered 为写入死信的结果数量，
+// dropped 为写入死信也失败而丢弃的结果数量，resubmitted 为从死信重新写入成功的结果数量
+var WriteStats = &writeStats{}
+
+func (w *writeStats) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"retried":      w.retried.Load(),
+		"deadLettered": w.deadLettered.Load(),
+		"dropped":      w.dropped.Load(),
+		"resubmitted":  w.resubmitted.Load(),
+	}
+}
+
+// pendingWrite 一批结果写入一个后端的过程，失败时按指数退避重试可以重试的部分，无法写入的部分写入死信
+type pendingWrite struct {
+	sink    ResultSink
+	batch   *batch // 还没有写入的结果
+	failed  *batch // 无法写入的结果，写入结束后写入死信
+	attempt int
+	delay   time.Duration
+	next    time.Time // 下一次尝试的时间
+	lastErr error
+}
+
+func newPendingWrite(sink ResultSink, b *batch) *pendingWrite {
+	return &pendingWrite{
+		sink:   sink,
+		batch:  b,
+		failed: &batch{Collection: b.Collection, Op: b.Op, Upsert: b.Upsert},
+		delay:  retryMinDelay,
+	}
+}
+
+// due 是否到了下一次尝试的时间
+func (w *pendingWrite) due(now time.Time) bool {
+	return !now.Before(w.next)
+}
+
+// try 尝试写入一次，还需要重试时返回 false 并设置下一次尝试的时间
+// 结束时返回写入死信的结果数量，返回错误表示有结果既没有写入后端也没有写入死信
+func (w *pendingWrite) try() (bool, int, error) {
+	w.attempt++
+	start := time.Now()
+	err := w.batch.apply(w.sink)
+	metrics.ObserveWrite(w.sink.Name(), w.batch.Collection, time.Since(start), err)
+	if err != nil {
+		w.lastErr = err
+		retryable, fail := splitBatchError(err, w.batch.len())
+		w.failed.merge(w.batch.subset(fail))
+		if len(retryable) != 0 && w.attempt < retryAttempts {
+			logger.SlogWarnLocal(fmt.Sprintf("result sink %v write %v error, retry %v results in %v: %v", w.sink.Name(), w.batch.Collection, len(retryable), w.delay, err))
+			WriteStats.retried.Add(int64(len(retryable)))
+			w.batch = w.batch.subset(retryable)
+			w.next = start.Add(w.delay)
+			w.delay *= 2
+			if w.delay > retryMaxDelay {
+				w.delay = retryMaxDelay
+			}
+			return false, 0, nil
+		}
+		w.failed.merge(w.batch.subset(retryable))
+	}
+	deadLettered, err := w.deadLetter()
+	return true, deadLettered, err
+}
+
+// deadLetter 将无法写入的结果写入死信
+func (w *pendingWrite) deadLetter() (int, error) {
+	if w.failed.len() == 0 {
+		return 0, nil
+	}
+	if err := DeadLetters.Add(w.sink.Name(), w.failed, w.lastErr); err != nil {
+		WriteStats.dropped.Add(int64(w.failed.len()))
+		return 0, fmt.Errorf("dead letter %v results error: %v, write error: %w", w.failed.len(), err, w.lastErr)
+	}
+	WriteStats.deadLettered.Add(int64(w.failed.len()))
+	logger.SlogErrorLocal(fmt.Sprintf("result sink %v write %v failed, %v results moved to dead letter: %v", w.sink.Name(), w.failed.Collection, w.failed.len(), w.lastErr))
+	return w.failed.len(), nil
+}
+
+// writeBatch 将一批结果写入后端并等待重试结束，结果队列以外的调用方使用，结果队列中的重试不阻塞队列（见 queuedWrite）
+// 返回写入死信的结果数量，返回错误表示有结果既没有写入后端也没有写入死信
+func writeBatch(sink ResultSink, b *batch) (int, error) {
+	w := newPendingWrite(sink, b)
+	for {
+		if finished, deadLettered, err := w.try(); finished {
+			return deadLettered, err
+		}
+		time.Sleep(time.Until(w.next))
+	}
+}
+
+// splitBatchError 根据写入错误获取可以重试和无法写入的结果下标
+// 不是 BatchError 的错误按照 ResultSink 的约定表示整批结果都没有写入；
+// BatchError 中超出范围和重复的下标被忽略，同时列为可重试和失败的结果按失败处理，避免重复写入
+func splitBatchError(err error, n int) ([]int, []int) {
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	seen := make([]bool, n)
+	var retryable, failed []int
+	for _, i := range batchErr.Failed {
+		if i >= 0 && i < n && !seen[i] {
+			seen[i] = true
+			failed = append(failed, i)
+		}
+	}
+	for _, i := range batchErr.Retryable {
+		if i >= 0 && i < n && !seen[i] {
+			seen[i] = true
+			retryable = append(retryable, i)
+		}
+	}
+	return retryable, failed
+}
@@ -0,0 +1,38 @@
+// results-------------------------------------
+// @file      : retry_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/14 20:35
+// -------------------------------------------
+
+package results
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSplitBatchError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable []int
+		failed    []int
+	}{
+		{name: "other error retries whole batch", err: errors.New("connection reset"), retryable: []int{0, 1, 2}},
+		{name: "batch error", err: &BatchError{Retryable: []int{0}, Failed: []int{2}}, retryable: []int{0}, failed: []int{2}},
+		{name: "wrapped batch error", err: fmt.Errorf("insert: %w", &BatchError{Failed: []int{1}}), failed: []int{1}},
+		{name: "out of range and duplicates ignored", err: &BatchError{Retryable: []int{1, 1, 3, -1}, Failed: []int{2, 2}}, retryable: []int{1}, failed: []int{2}},
+		{name: "failed wins over retryable", err: &BatchError{Retryable: []int{0, 1}, Failed: []int{1}}, retryable: []int{0}, failed: []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retryable, failed := splitBatchError(tt.err, 3)
+			if !reflect.DeepEqual(retryable, tt.retryable) || !reflect.DeepEqual(failed, tt.failed) {
+				t.Fatalf("splitBatchError() = %v, %v, want %v, %v", retryable, failed, tt.retryable, tt.failed)
+			}
+		})
+	}
+}
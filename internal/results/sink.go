@@ -0,0 +1,437 @@
+// results-------------------------------------
+// @file      : sink.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/20 14:32
+// -------------------------------------------
+
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/mongodb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SinkMongoDB = "mongodb"
+	SinkJsonl   = "jsonl"
+)
+
+// ResultSink 结果写入后端
+// Insert 和 Update 部分写入时必须返回 *BatchError 列出没有写入的结果下标，没有列出的结果视为已经写入；
+// 返回其他错误表示整批结果都没有写入，整批结果会重新写入，后端不能在部分写入后返回其他错误
+type ResultSink interface {
+	Name() string
+	// Insert 批量插入结果
+	Insert(collection string, docs []interface{}) error
+	// Update 批量更新结果，upsert 为 true 时没有匹配的文档则插入
+	Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error
+	Close() error
+}
+
+// Sinks 当前启用的结果写入后端，结果会写入所有后端
+var Sinks = &sinks{}
+
+type sinks struct {
+	list []ResultSink
+}
+
+// InitializeSinks 根据配置初始化结果写入后端，未配置时只写入 mongodb
+func InitializeSinks() {
+	names := global.AppConfig.Result.Sinks
+	if len(names) == 0 {
+		names = []string{SinkMongoDB}
+	}
+	var list []ResultSink
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case SinkMongoDB:
+			if global.Standalone {
+				logger.SlogErrorLocal("result sink mongodb is not available in standalone mode")
+				continue
+			}
+			sink := &mongoSink{}
+			sink.ensureIndexes()
+			list = append(list, sink)
+		case SinkJsonl:
+			dir := global.AppConfig.Result.JsonlDir
+			if dir == "" {
+				dir = filepath.Join(global.AbsolutePath, "data", "results")
+			}
+			sink, err := NewJsonlSink(dir)
+			if err != nil {
+				logger.SlogError(fmt.Sprintf("result sink %v init error: %v", name, err))
+				continue
+			}
+			list = append(list, sink)
+		default:
+			logger.SlogError(fmt.Sprintf("unknown result sink: %v", name))
+		}
+	}
+	Sinks.list = list
+}
+
+// Register 添加结果写入后端
+func (s *sinks) Register(sink ResultSink) {
+	s.list = append(s.list, sink)
+}
+
+func (s *sinks) get(name string) ResultSink {
+	for _, sink := range s.list {
+		if sink.Name() == name {
+			return sink
+		}
+	}
+	return nil
+}
+
+// Insert 将结果写入所有后端，写入失败的结果重试后写入死信
+func (s *sinks) Insert(collection string, docs []interface{}) error {
+	return s.write(&batch{Collection: collection, Op: "insert", Docs: docs})
+}
+
+// Update 在所有后端更新结果，写入失败的结果重试后写入死信
+func (s *sinks) Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error {
+	return s.write(&batch{Collection: collection, Op: "update", Upsert: upsert, Operations: operations})
+}
+
+func (s *sinks) write(b *batch) error {
+	var errs []error
+	for _, sink := range s.list {
+		if _, err := writeBatch(sink, b); err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *sinks) Close() {
+	for _, sink := range s.list {
+		if err := sink.Close(); err != nil {
+			logger.SlogError(fmt.Sprintf("result sink %v close error: %v", sink.Name(), err))
+		}
+	}
+}
+
+// mongoSink 将结果写入 ScopeSentry 的 mongodb
+type mongoSink struct {
+}
+
+func (m *mongoSink) Name() string {
+	return SinkMongoDB
+}
+
+// ensureIndexes 创建资产的 host+port 唯一索引，保证多个节点同时发现同一资产时只会插入一次
+func (m *mongoSink) ensureIndexes() {
+	_, err := mongodb.MongodbClient.CreateIndex("asset", bson.D{{Key: "host", Value: 1}, {Key: "port", Value: 1}}, true)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("create asset unique index error, duplicate assets need to be removed: %v", err))
+	}
+}
+
+// findAndUpsert 原子更新或插入单个文档，返回更新前的文档，文档不存在时返回 nil
+func (m *mongoSink) findAndUpsert(collection string, selector, update interface{}) (bson.Raw, error) {
+	var previous bson.Raw
+	err := mongodb.MongodbClient.FindOneAndUpsert(collection, selector, update, &previous)
+	if mongo.IsDuplicateKeyError(err) {
+		// 并发插入同一文档时只有一个会成功，其他的重新执行即为更新
+		err = mongodb.MongodbClient.FindOneAndUpsert(collection, selector, update, &previous)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
+
+// Insert 无序批量插入，单个文档失败不影响其他文档，返回的 BatchError 中只包含失败的文档
+func (m *mongoSink) Insert(collection string, docs []interface{}) error {
+	_, err := mongodb.MongodbClient.InsertMany(collection, docs)
+	return mongoBatchError(err, len(docs))
+}
+
+func (m *mongoSink) Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error {
+	var models []mongo.WriteModel
+	for _, op := range operations {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(op.Selector).
+			SetUpdate(op.Update).
+			SetUpsert(upsert))
+	}
+	_, err := mongodb.MongodbClient.BulkWrite(collection, models)
+	return mongoBatchError(err, len(operations))
+}
+
+func (m *mongoSink) Close() error {
+	return nil
+}
+
+// mongoRetryableCodes 主节点切换、关闭、网络等暂时性错误的错误码，重试可能成功
+var mongoRetryableCodes = []int{6, 7, 50, 64, 89, 91, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// mongoTransient 错误是否为暂时性错误
+func mongoTransient(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) || errors.Is(err, mongo.ErrClientDisconnected) {
+		return true
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		if serverErr.HasErrorLabel("RetryableWriteError") {
+			return true
+		}
+		for _, code := range mongoRetryableCodes {
+			if serverErr.HasErrorCode(code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mongoBatchError 将 mongodb 批量写入错误转换为 BatchError，主键重复的文档在之前已经写入，不算作失败
+func mongoBatchError(err error, n int) error {
+	if err == nil {
+		return nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || (len(bulkErr.WriteErrors) == 0 && bulkErr.WriteConcernError == nil) {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		if mongoTransient(err) {
+			return &BatchError{Retryable: all, Err: err}
+		}
+		return &BatchError{Failed: all, Err: err}
+	}
+	batchErr := &BatchError{Err: err}
+	handled := make(map[int]bool)
+	for _, wErr := range bulkErr.WriteErrors {
+		handled[wErr.Index] = true
+		switch {
+		case wErr.Code == 11000:
+		case containsInt(mongoRetryableCodes, wErr.Code):
+			batchErr.Retryable = append(batchErr.Retryable, wErr.Index)
+		default:
+			batchErr.Failed = append(batchErr.Failed, wErr.Index)
+		}
+	}
+	if bulkErr.WriteConcernError != nil {
+		// 写入关注错误时无法确认其他文档是否写入，重新写入
+		for i := 0; i < n; i++ {
+			if !handled[i] {
+				batchErr.Retryable = append(batchErr.Retryable, i)
+			}
+		}
+	}
+	if len(batchErr.Retryable) == 0 && len(batchErr.Failed) == 0 {
+		return nil
+	}
+	sort.Ints(batchErr.Retryable)
+	return batchErr
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonlSink 将结果按任务写入本地 JSON lines 文件，每个任务一个以任务 id 命名的文件
+type jsonlSink struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// jsonlRecord 文件中的一行，data 为 mongodb 中的文档格式
+type jsonlRecord struct {
+	Collection string          `json:"collection"`
+	Time       string          `json:"time"`
+	Op         string          `json:"op"`
+	Upsert     bool            `json:"upsert,omitempty"`
+	Selector   json.RawMessage `json:"selector,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+var fileNameRe = regexp.MustCompile(`[^\p{L}\p{N}._-]+`)
+
+// NewJsonlSink 创建写入 dir 目录的 JSON lines 后端
+func NewJsonlSink(dir string) (ResultSink, error) {
+	if err := utils.Tools.EnsureDir(dir); err != nil {
+		return nil, err
+	}
+	return &jsonlSink{dir: dir}, nil
+}
+
+func (j *jsonlSink) Name() string {
+	return SinkJsonl
+}
+
+func (j *jsonlSink) Insert(collection string, docs []interface{}) error {
+	lines := make(map[string]*jsonlLines)
+	batchErr := &BatchError{}
+	var errs []error
+	now := utils.Tools.GetTimeNow()
+	for i, doc := range docs {
+		data, err := marshalExtJSON(doc)
+		if err != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			errs = append(errs, err)
+			continue
+		}
+		line, err := json.Marshal(jsonlRecord{Collection: collection, Time: now, Op: "insert", Data: data})
+		if err != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			errs = append(errs, err)
+			continue
+		}
+		addLine(lines, docTaskId(doc), i, line)
+	}
+	return j.write(lines, batchErr, errs)
+}
+
+func (j *jsonlSink) Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error {
+	lines := make(map[string]*jsonlLines)
+	batchErr := &BatchError{}
+	var errs []error
+	now := utils.Tools.GetTimeNow()
+	for i, op := range operations {
+		selector, err := marshalExtJSON(op.Selector)
+		if err != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			errs = append(errs, err)
+			continue
+		}
+		data, err := marshalExtJSON(op.Update)
+		if err != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			errs = append(errs, err)
+			continue
+		}
+		line, err := json.Marshal(jsonlRecord{Collection: collection, Time: now, Op: "update", Upsert: upsert, Selector: selector, Data: data})
+		if err != nil {
+			batchErr.Failed = append(batchErr.Failed, i)
+			errs = append(errs, err)
+			continue
+		}
+		addLine(lines, op.TaskId, i, line)
+	}
+	return j.write(lines, batchErr, errs)
+}
+
+// jsonlLines 写入同一个文件的行以及它们在批量中的位置
+type jsonlLines struct {
+	index []int
+	lines [][]byte
+}
+
+func addLine(lines map[string]*jsonlLines, file string, index int, line []byte) {
+	if lines[file] == nil {
+		lines[file] = &jsonlLines{}
+	}
+	lines[file].index = append(lines[file].index, index)
+	lines[file].lines = append(lines[file].lines, line)
+}
+
+// write 按文件追加写入，无法转换的结果不再重试，只有写入文件失败的结果重新写入
+func (j *jsonlSink) write(lines map[string]*jsonlLines, batchErr *BatchError, errs []error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for file, fileLines := range lines {
+		if err := j.append(file, fileLines.lines); err != nil {
+			batchErr.Retryable = append(batchErr.Retryable, fileLines.index...)
+			errs = append(errs, err)
+		}
+	}
+	if len(batchErr.Retryable) == 0 && len(batchErr.Failed) == 0 {
+		return nil
+	}
+	sort.Ints(batchErr.Retryable)
+	batchErr.Err = errors.Join(errs...)
+	return batchErr
+}
+
+// append 追加写入任务的文件，没有任务 id 的结果写入 default.jsonl
+func (j *jsonlSink) append(taskId string, lines [][]byte) error {
+	name := fileNameRe.ReplaceAllString(taskId, "_")
+	if name == "" || strings.Trim(name, ".") == "" {
+		name = "default"
+	}
+	file, err := os.OpenFile(filepath.Join(j.dir, name+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for _, line := range lines {
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	_, err = file.Write(buf)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (j *jsonlSink) Close() error {
+	return nil
+}
+
+// marshalExtJSON 按 bson 标签将文档转换为 JSON，与写入 mongodb 的字段保持一致
+func marshalExtJSON(doc interface{}) (json.RawMessage, error) {
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil document")
+		}
+		v = v.Elem()
+	}
+	data, err := bson.MarshalExtJSON(v.Interface(), false, false)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// docTaskId 获取结果中的任务 id
+func docTaskId(doc interface{}) string {
+	if raw, ok := doc.(bson.Raw); ok {
+		taskId, _ := raw.Lookup("taskId").StringValueOK()
+		return taskId
+	}
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	field := v.FieldByName("TaskId")
+	if field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
@@ -0,0 +1,211 @@
+// results-------------------------------------
+// @file      : sink_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/12 21:10
+// -------------------------------------------
+
+package results
+
+import (
+	"context"
+	"errors"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"github.com/cockroachdb/pebble"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	utils.Tools = &utils.UtilTools{}
+	dir, err := os.MkdirTemp("", "results-test")
+	if err != nil {
+		panic(err)
+	}
+	pebbledb.PebbleStore, err = pebbledb.NewPebbleDB(&pebble.Options{}, dir)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = pebbledb.PebbleStore.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func bulkWriteError(index int, code int) mongo.BulkWriteError {
+	return mongo.BulkWriteError{WriteError: mongo.WriteError{Index: index, Code: code, Message: "write error"}}
+}
+
+func TestMongoBatchError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		n         int
+		nilErr    bool
+		retryable []int
+		failed    []int
+	}{
+		{name: "nil", err: nil, n: 3, nilErr: true},
+		{name: "unknown error fails all", err: errors.New("bad document"), n: 3, failed: []int{0, 1, 2}},
+		{name: "timeout retries all", err: context.DeadlineExceeded, n: 2, retryable: []int{0, 1}},
+		{name: "disconnected retries all", err: mongo.ErrClientDisconnected, n: 2, retryable: []int{0, 1}},
+		{
+			name:      "retryable label retries all",
+			err:       mongo.CommandError{Code: 1, Labels: []string{"RetryableWriteError"}},
+			n:         2,
+			retryable: []int{0, 1},
+		},
+		{name: "retryable code retries all", err: mongo.CommandError{Code: 11600}, n: 1, retryable: []int{0}},
+		{name: "command error fails all", err: mongo.CommandError{Code: 2}, n: 1, failed: []int{0}},
+		{
+			name:   "duplicate key is written",
+			err:    mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{bulkWriteError(0, 11000), bulkWriteError(2, 11000)}},
+			n:      3,
+			nilErr: true,
+		},
+		{
+			name: "write errors split",
+			err: mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+				bulkWriteError(3, 91),
+				bulkWriteError(0, 11000),
+				bulkWriteError(1, 121),
+				bulkWriteError(2, 6),
+			}},
+			n:         5,
+			retryable: []int{2, 3},
+			failed:    []int{1},
+		},
+		{
+			name: "write concern error retries unhandled",
+			err: mongo.BulkWriteException{
+				WriteErrors:       []mongo.BulkWriteError{bulkWriteError(1, 11000), bulkWriteError(2, 121)},
+				WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"},
+			},
+			n:         4,
+			retryable: []int{0, 3},
+			failed:    []int{2},
+		},
+		{
+			name:      "empty bulk exception is treated as a whole batch error",
+			err:       mongo.BulkWriteException{Labels: []string{"RetryableWriteError"}},
+			n:         2,
+			retryable: []int{0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mongoBatchError(tt.err, tt.n)
+			if tt.nilErr {
+				if err != nil {
+					t.Fatalf("mongoBatchError() = %v, want nil", err)
+				}
+				return
+			}
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				t.Fatalf("mongoBatchError() = %v, want BatchError", err)
+			}
+			if !reflect.DeepEqual(batchErr.Retryable, tt.retryable) || !reflect.DeepEqual(batchErr.Failed, tt.failed) {
+				t.Fatalf("mongoBatchError() retryable %v failed %v, want %v, %v", batchErr.Retryable, batchErr.Failed, tt.retryable, tt.failed)
+			}
+			if !reflect.DeepEqual(batchErr.Err, tt.err) {
+				t.Fatalf("mongoBatchError() error = %v, want %v", batchErr.Err, tt.err)
+			}
+		})
+	}
+}
+
+func TestJsonlSinkWrite(t *testing.T) {
+	var nilDoc *types.DirResult
+	tests := []struct {
+		name      string
+		docs      []interface{}
+		update    bool // 以更新操作写入，更新操作按携带的任务 id 写入文件
+		retryable []int
+		failed    []int
+		lines     map[string]int // 每个文件写入的行数
+	}{
+		{
+			name:  "written",
+			docs:  []interface{}{&types.DirResult{TaskId: "a"}, &types.DirResult{TaskId: "b"}, &types.DirResult{TaskId: "a"}},
+			lines: map[string]int{"a": 2, "b": 1},
+		},
+		{
+			name:   "updates written by task",
+			docs:   []interface{}{&types.DirResult{TaskId: "a"}, &types.DirResult{TaskId: "b"}, &types.DirResult{}},
+			update: true,
+			lines:  map[string]int{"a": 1, "b": 1, "default": 1},
+		},
+		{
+			name:   "marshal error fails",
+			docs:   []interface{}{&types.DirResult{TaskId: "a"}, nilDoc, &types.DirResult{TaskId: "a"}},
+			failed: []int{1},
+			lines:  map[string]int{"a": 2},
+		},
+		{
+			name:      "file error retries its lines",
+			docs:      []interface{}{&types.DirResult{TaskId: "blocked"}, &types.DirResult{TaskId: "a"}, &types.DirResult{TaskId: "blocked"}, nilDoc},
+			retryable: []int{0, 2},
+			failed:    []int{3},
+			lines:     map[string]int{"a": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// 与结果文件同名的目录使该文件无法写入
+			if err := os.Mkdir(filepath.Join(dir, "blocked.jsonl"), os.ModePerm); err != nil {
+				t.Fatalf("create dir error: %v", err)
+			}
+			sink, err := NewJsonlSink(dir)
+			if err != nil {
+				t.Fatalf("NewJsonlSink() error: %v", err)
+			}
+			if tt.update {
+				var operations []types.BulkUpdateOperation
+				for _, doc := range tt.docs {
+					result := doc.(*types.DirResult)
+					operations = append(operations, types.BulkUpdateOperation{Selector: bson.M{"url": result.Url}, Update: bson.M{"$set": result}, TaskId: result.TaskId})
+				}
+				err = sink.Update("DirScanResult", operations, true)
+			} else {
+				err = sink.Insert("DirScanResult", tt.docs)
+			}
+			if tt.retryable == nil && tt.failed == nil {
+				if err != nil {
+					t.Fatalf("Insert() = %v, want nil", err)
+				}
+			} else {
+				var batchErr *BatchError
+				if !errors.As(err, &batchErr) {
+					t.Fatalf("Insert() = %v, want BatchError", err)
+				}
+				if !reflect.DeepEqual(batchErr.Retryable, tt.retryable) || !reflect.DeepEqual(batchErr.Failed, tt.failed) {
+					t.Fatalf("Insert() retryable %v failed %v, want %v, %v", batchErr.Retryable, batchErr.Failed, tt.retryable, tt.failed)
+				}
+			}
+			for name, n := range tt.lines {
+				data, err := os.ReadFile(filepath.Join(dir, name+".jsonl"))
+				if err != nil {
+					t.Fatalf("read %v.jsonl error: %v", name, err)
+				}
+				if lines := strings.Count(string(data), "\n"); lines != n {
+					t.Fatalf("%v.jsonl lines = %v, want %v", name, lines, n)
+				}
+			}
+		})
+	}
+}
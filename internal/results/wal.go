@@ -0,0 +1,313 @@
+// results-------------------------------------
+// @file      : wal.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/22 19:47
+// -------------------------------------------
+
+package results
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// 结果预写日志：结果进入队列前写入 pebble，写入后端成功后删除，写入失败的结果在运行期间定期重新写入，启动时重新写入上次运行没有删除的结果
+const walPrefix = "result:"
+
+var walSeq atomic.Uint64
+
+func init() {
+	// 以启动时间作为起始序号，保证重启后的序号大于之前的序号
+	walSeq.Store(uint64(time.Now().UnixNano()))
+}
+
+// queueItem 结果队列中的结果以及对应的预写日志键，键为空表示没有写入预写日志
+type queueItem struct {
+	key  []byte
+	item interface{}
+}
+
+func walEnabled() bool {
+	return pebbledb.PebbleStore != nil
+}
+
+func walKey(module string) []byte {
+	return []byte(fmt.Sprintf("%v%v:%020d", walPrefix, module, walSeq.Add(1)))
+}
+
+// walEncode 将结果转换为 bson，结果文档预先生成 _id，重新写入 mongodb 时已经写入的结果会因主键重复被忽略
+func walEncode(module string, item interface{}) (interface{}, []byte, error) {
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return item, nil, err
+	}
+	if module == "SensitiveBody" {
+		return item, data, nil
+	}
+	if _, err := bson.Raw(data).LookupErr("_id"); err == nil {
+		return bson.Raw(data), data, nil
+	}
+	elements, err := bsoncore.Document(data).Elements()
+	if err != nil {
+		return item, nil, err
+	}
+	parts := [][]byte{bsoncore.AppendObjectIDElement(nil, "_id", primitive.NewObjectID())}
+	for _, element := range elements {
+		parts = append(parts, element)
+	}
+	doc := bsoncore.BuildDocumentFromElements(nil, parts...)
+	return bson.Raw(doc), doc, nil
+}
+
+func walDecode(module string, data []byte) (interface{}, error) {
+	if module == "SensitiveBody" {
+		var op types.BulkUpdateOperation
+		err := bson.Unmarshal(data, &op)
+		return op, err
+	}
+	if err := bson.Raw(data).Validate(); err != nil {
+		return nil, err
+	}
+	return bson.Raw(data), nil
+}
+
+// Enqueue 将结果写入预写日志后放入模块的结果队列
+func Enqueue(module string, item interface{}) {
+	mq, ok := ResultQueues[module]
+	if !ok {
+		logger.SlogErrorLocal(fmt.Sprintf("result queue %v not found", module))
+		return
+	}
+	closeMu.RLock()
+	defer closeMu.RUnlock()
+	if closed {
+		logger.SlogWarnLocal(fmt.Sprintf("result queue %v closed, result dropped", module))
+		return
+	}
+	var key []byte
+	if walEnabled() {
+		var data []byte
+		var err error
+		item, data, err = walEncode(module, item)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("result wal %v encode error: %v", module, err))
+		} else {
+			key = walKey(module)
+			if err = pebbledb.PebbleStore.PutNoSync(key, data); err != nil {
+				logger.SlogErrorLocal(fmt.Sprintf("result wal %v write error: %v", module, err))
+				key = nil
+			}
+		}
+	}
+	mq.Queue <- queueItem{key: key, item: item}
+}
+
+// Sync 将预写日志持久化到磁盘，之前进入队列的结果在重启后不会丢失
+func Sync() error {
+	if !walEnabled() {
+		return nil
+	}
+	return pebbledb.PebbleStore.Sync()
+}
+
+// queuedWrite 结果队列中的一批结果写入所有后端的过程，等待重试时不阻塞结果队列
+type queuedWrite struct {
+	writes []*pendingWrite // 还没有结束的写入
+	keys   [][]byte
+	failed bool // 有结果既没有写入后端也没有写入死信
+}
+
+// retry 尝试到期的写入，force 为 true 时不等待到期，所有写入都结束时返回 true
+func (q *queuedWrite) retry(module string, now time.Time, force bool) bool {
+	var waiting []*pendingWrite
+	for _, w := range q.writes {
+		if !force && !w.due(now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		finished, _, err := w.try()
+		if !finished {
+			waiting = append(waiting, w)
+			continue
+		}
+		if err != nil {
+			logger.SlogWarnLocal(fmt.Sprintf("result %v write %v error: %v", module, w.sink.Name(), err))
+			q.failed = true
+		}
+	}
+	q.writes = waiting
+	return len(waiting) == 0
+}
+
+// writeQueue 模块结果队列中等待写入后端的结果，只在结果队列的协程中使用
+// 所有后端都写入或写入死信后删除对应的预写日志，写入失败的结果保留在预写日志中，运行期间定期重新写入
+type writeQueue struct {
+	module  string
+	retries []*queuedWrite // 等待重试的写入
+	kept    [][]byte       // 写入失败保留在预写日志中的结果
+}
+
+func newWriteQueue(module string) *writeQueue {
+	return &writeQueue{module: module}
+}
+
+// flush 写入缓冲区中的结果，有后端需要重试时加入等待重试的写入，到期后由 retry 重试
+func (w *writeQueue) flush(buffer *[]interface{}, keys *[][]byte) {
+	if len(*buffer) == 0 {
+		return
+	}
+	q := &queuedWrite{keys: *keys}
+	b, err := moduleBatch(w.module, *buffer)
+	*buffer = nil
+	*keys = nil
+	if err != nil {
+		logger.SlogWarnLocal(fmt.Sprintf("result %v flush error: %v", w.module, err))
+		q.failed = true
+	} else {
+		for _, sink := range Sinks.list {
+			q.writes = append(q.writes, newPendingWrite(sink, b))
+		}
+	}
+	if q.retry(w.module, time.Now(), false) {
+		w.finish(q)
+	} else {
+		w.retries = append(w.retries, q)
+	}
+}
+
+// retry 尝试到期的写入，force 为 true 时不等待到期
+func (w *writeQueue) retry(now time.Time, force bool) {
+	var waiting []*queuedWrite
+	for _, q := range w.retries {
+		if q.retry(w.module, now, force) {
+			w.finish(q)
+		} else {
+			waiting = append(waiting, q)
+		}
+	}
+	w.retries = waiting
+}
+
+// finish 写入结束后删除预写日志，有结果没有写入时保留，之后由 replayKept 重新写入
+func (w *writeQueue) finish(q *queuedWrite) {
+	if !q.failed {
+		deleteWAL(w.module, q.keys)
+		return
+	}
+	var kept int
+	for _, key := range q.keys {
+		if key != nil {
+			w.kept = append(w.kept, key)
+			kept++
+		}
+	}
+	if kept > 0 {
+		logger.SlogWarnLocal(fmt.Sprintf("result %v flush failed, %v results are kept in wal", w.module, kept))
+	}
+}
+
+// replayKept 重新写入运行期间写入失败保留在预写日志中的结果
+func (w *writeQueue) replayKept() {
+	if len(w.kept) == 0 || !walEnabled() {
+		return
+	}
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(walPrefix + w.module + ":")
+	if err != nil {
+		// 读取失败时保留，下次重新写入
+		logger.SlogErrorLocal(fmt.Sprintf("result wal %v read error: %v", w.module, err))
+		return
+	}
+	// 只重新写入保留的结果，其他结果还在队列中或正在写入
+	var walKeys []string
+	for _, key := range w.kept {
+		if _, ok := records[string(key)]; ok {
+			walKeys = append(walKeys, string(key))
+		}
+	}
+	w.kept = nil
+	w.replay(walKeys, records)
+	logger.SlogInfoLocal(fmt.Sprintf("result wal %v retried: %v", w.module, len(walKeys)))
+}
+
+// close 结果队列关闭时最后尝试一次等待重试的写入，仍然没有结束的结果保留在预写日志中，下次启动时重新写入
+func (w *writeQueue) close() {
+	w.retry(time.Now(), true)
+	var kept int
+	for _, q := range w.retries {
+		kept += len(q.keys)
+	}
+	if kept > 0 {
+		logger.SlogWarnLocal(fmt.Sprintf("result %v flush failed, %v results are kept in wal", w.module, kept))
+	}
+	w.retries = nil
+}
+
+// replay 按顺序重新写入预写日志中的结果，无法解析的结果直接删除
+func (w *writeQueue) replay(walKeys []string, records map[string][]byte) {
+	var buffer []interface{}
+	var keys [][]byte
+	var invalid [][]byte
+	for _, key := range walKeys {
+		item, err := walDecode(w.module, records[key])
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("result wal %v decode error: %v", key, err))
+			invalid = append(invalid, []byte(key))
+			continue
+		}
+		buffer = append(buffer, item)
+		keys = append(keys, []byte(key))
+		if len(buffer) >= batchSize {
+			w.flush(&buffer, &keys)
+		}
+	}
+	w.flush(&buffer, &keys)
+	deleteWAL(w.module, invalid)
+}
+
+func deleteWAL(module string, keys [][]byte) {
+	if !walEnabled() || len(keys) == 0 {
+		return
+	}
+	var walKeys [][]byte
+	for _, key := range keys {
+		if key != nil {
+			walKeys = append(walKeys, key)
+		}
+	}
+	if err := pebbledb.PebbleStore.BatchDelete(walKeys); err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("result wal %v delete error: %v", module, err))
+	}
+}
+
+// replayWAL 将上次运行中没有写入后端的结果重新写入，返回模块的写入队列，需要重试的写入由结果队列继续重试
+func replayWAL(module string) *writeQueue {
+	w := newWriteQueue(module)
+	if !walEnabled() {
+		return w
+	}
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(walPrefix + module + ":")
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("result wal %v read error: %v", module, err))
+		return w
+	}
+	if len(records) == 0 {
+		return w
+	}
+	var walKeys []string
+	for key := range records {
+		walKeys = append(walKeys, key)
+	}
+	sort.Strings(walKeys)
+	w.replay(walKeys, records)
+	logger.SlogInfoLocal(fmt.Sprintf("result wal %v replayed: %v", module, len(walKeys)))
+	return w
+}
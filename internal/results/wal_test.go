@@ -0,0 +1,202 @@
+// results-------------------------------------
+// @file      : wal_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/13 21:02
+// -------------------------------------------
+
+package results
+
+import (
+	"errors"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSink 记录写入的结果，errs 为每次写入依次返回的错误
+type testSink struct {
+	mu       sync.Mutex
+	errs     []error
+	inserted []string
+}
+
+func (s *testSink) Name() string {
+	return "test"
+}
+
+func (s *testSink) Insert(collection string, docs []interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		s.inserted = append(s.inserted, doc.(bson.Raw).Lookup("url").StringValue())
+	}
+	return nil
+}
+
+func (s *testSink) Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error {
+	return nil
+}
+
+func (s *testSink) Close() error {
+	return nil
+}
+
+// useSink 测试期间只写入 sink，结束后删除测试留下的预写日志和死信
+func useSink(t *testing.T, sink ResultSink) {
+	list := Sinks.list
+	Sinks.list = []ResultSink{sink}
+	t.Cleanup(func() {
+		Sinks.list = list
+		for _, prefix := range []string{walPrefix, deadLetterPrefix} {
+			records, _ := pebbledb.PebbleStore.GetKeysWithPrefix(prefix)
+			var keys [][]byte
+			for key := range records {
+				keys = append(keys, []byte(key))
+			}
+			if len(keys) > 0 {
+				_ = pebbledb.PebbleStore.BatchDelete(keys)
+			}
+		}
+	})
+}
+
+// putWAL 与 Enqueue 一样将结果写入预写日志，返回队列中的结果和键
+func putWAL(t *testing.T, module string, url string) (interface{}, []byte) {
+	item, data, err := walEncode(module, &types.DirResult{Url: url})
+	if err != nil {
+		t.Fatalf("walEncode() error: %v", err)
+	}
+	key := walKey(module)
+	if err := pebbledb.PebbleStore.PutNoSync(key, data); err != nil {
+		t.Fatalf("PutNoSync() error: %v", err)
+	}
+	return item, key
+}
+
+func walCount(t *testing.T, module string) int {
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(walPrefix + module + ":")
+	if err != nil {
+		t.Fatalf("GetKeysWithPrefix() error: %v", err)
+	}
+	return len(records)
+}
+
+func TestEnqueueWritesWAL(t *testing.T) {
+	useSink(t, &testSink{})
+	queue := &ResultQueue{Queue: make(chan interface{}, 1)}
+	ResultQueues["DirScan"] = queue
+	defer delete(ResultQueues, "DirScan")
+
+	// 结果处理同步写入预写日志和结果队列，返回后结果已经在队列中
+	InitializeHandler()
+	Handler.Dir(&types.DirResult{Url: "https://example.com/admin"})
+	var qi queueItem
+	select {
+	case item := <-queue.Queue:
+		qi = item.(queueItem)
+	default:
+		t.Fatal("result is not enqueued when Dir returns")
+	}
+	if qi.key == nil {
+		t.Fatal("queue item has no wal key")
+	}
+	data, err := pebbledb.PebbleStore.GetKeysWithPrefix(string(qi.key))
+	if err != nil || len(data) != 1 {
+		t.Fatalf("wal record = %v, %v, want written before enqueue", data, err)
+	}
+	// 重新写入时依靠预先生成的 _id 忽略已经写入的结果
+	doc := qi.item.(bson.Raw)
+	if _, err := doc.LookupErr("_id"); err != nil {
+		t.Fatalf("queued result has no _id: %v", doc)
+	}
+	if !reflect.DeepEqual([]byte(doc), data[string(qi.key)]) {
+		t.Fatal("queued result differs from wal record")
+	}
+}
+
+func TestWriteQueueFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		errs        []error
+		waiting     bool     // flush 后是否等待重试
+		inserted    []string // 最终写入的结果
+		deadLetters int
+	}{
+		{name: "written deletes wal", inserted: []string{"a", "b"}},
+		{name: "retry keeps wal until written", errs: []error{errors.New("connection reset")}, waiting: true, inserted: []string{"a", "b"}},
+		{name: "partial retry", errs: []error{&BatchError{Retryable: []int{1}, Failed: []int{0}, Err: errors.New("write error")}}, waiting: true, inserted: []string{"b"}, deadLetters: 1},
+		{name: "failed results dead lettered", errs: []error{&BatchError{Failed: []int{0, 1}, Err: errors.New("bad document")}}, deadLetters: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &testSink{errs: tt.errs}
+			useSink(t, sink)
+			var buffer []interface{}
+			var keys [][]byte
+			for _, url := range []string{"a", "b"} {
+				item, key := putWAL(t, "DirScan", url)
+				buffer = append(buffer, item)
+				keys = append(keys, key)
+			}
+			w := newWriteQueue("DirScan")
+			w.flush(&buffer, &keys)
+			if (len(w.retries) != 0) != tt.waiting {
+				t.Fatalf("waiting retries = %v, want waiting %v", len(w.retries), tt.waiting)
+			}
+			if tt.waiting {
+				// 写入结束前预写日志保留，重启后可以重新写入
+				if n := walCount(t, "DirScan"); n != 2 {
+					t.Fatalf("wal records while retrying = %v, want 2", n)
+				}
+				w.retry(time.Now().Add(time.Minute), false)
+			}
+			if len(w.retries) != 0 || len(w.kept) != 0 {
+				t.Fatalf("retries = %v, kept = %v, want finished", len(w.retries), len(w.kept))
+			}
+			if n := walCount(t, "DirScan"); n != 0 {
+				t.Fatalf("wal records after write = %v, want 0", n)
+			}
+			if !reflect.DeepEqual(sink.inserted, tt.inserted) {
+				t.Fatalf("inserted %v, want %v", sink.inserted, tt.inserted)
+			}
+			records, _ := pebbledb.PebbleStore.GetKeysWithPrefix(deadLetterPrefix + "test:")
+			if len(records) != tt.deadLetters {
+				t.Fatalf("dead letters = %v, want %v", len(records), tt.deadLetters)
+			}
+		})
+	}
+}
+
+func TestReplayWAL(t *testing.T) {
+	sink := &testSink{}
+	useSink(t, sink)
+	for _, url := range []string{"a", "b", "c"} {
+		putWAL(t, "DirScan", url)
+	}
+	// 无法解析的记录直接删除
+	if err := pebbledb.PebbleStore.Put(walKey("DirScan"), []byte("invalid")); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	w := replayWAL("DirScan")
+	if len(w.retries) != 0 {
+		t.Fatalf("waiting retries = %v, want 0", len(w.retries))
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(sink.inserted, want) {
+		t.Fatalf("replayed %v, want %v", sink.inserted, want)
+	}
+	if n := walCount(t, "DirScan"); n != 0 {
+		t.Fatalf("wal records after replay = %v, want 0", n)
+	}
+}
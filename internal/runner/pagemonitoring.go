@@ -18,7 +18,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"strings"
 	"sync"
-	"time"
 )
 
 func PageMonitoringRunner(targets []string) {
@@ -30,7 +29,6 @@ func PageMonitoringRunner(targets []string) {
 	defer pool.Release() // 确保池被释放
 	var wg sync.WaitGroup
 	for _, target := range targets {
-		wg.Add(1)
 		var pageMonitResult types.PageMonit
 		err := json.Unmarshal([]byte(target), &pageMonitResult)
 		if err != nil {
@@ -38,14 +36,15 @@ func PageMonitoringRunner(targets []string) {
 			continue
 		}
 		pageMonitResultCopy := pageMonitResult
+		wg.Add(1)
 		err = pool.Submit(func() {
 			Handler(pageMonitResultCopy, &wg)
 		})
 		if err != nil {
 			logger.SlogWarnLocal(fmt.Sprintf("任务提交失败: %v", err))
+			wg.Done()
 		}
 	}
-	time.Sleep(3 * time.Second)
 	wg.Wait()
 }
 
@@ -12,6 +12,8 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"runtime"
@@ -19,7 +21,9 @@ import (
 	"time"
 )
 
-func Run(op options.TaskOptions) error {
+// Run 扫描一个目标，返回目标的运行结果，任务取消时返回错误
+// 目标的最终结果由调用方在不再重试时通过 Finish 记录
+func Run(op options.TaskOptions) (pipeline.Outcome, error) {
 	// 清空临时文件
 	defer CleanTmp()
 	var wg sync.WaitGroup
@@ -30,8 +34,14 @@ func Run(op options.TaskOptions) error {
 	handler.TaskHandle.ProgressStart("scan", op.Target, op.ID, 1)
 	op.ModuleRunWg = &wg
 	op.TargetHandler = append(op.TargetHandler, "7bbaec6487f51a9aafeff4720c7643f0")
+	// 目标的上下文，超过目标或任务的截止时间后所有模块停止处理
+	targetTimeout, _ := contextmanager.ParseTimeout(op.TargetTimeout)
+	targetCtx := contextmanager.GlobalContextManagers.AddTargetContext(op.ID, op.Target, targetTimeout)
+	defer contextmanager.GlobalContextManagers.DeleteTargetContext(op.ID, op.Target)
+	// 各阶段的实时进度
+	progress := pipeline.Progresses.Start(op.ID, op.Target)
 	process := modules.CreateScanProcess(&op)
-	ch := make(chan interface{})
+	ch := make(chan types.Message)
 	process.SetInput(ch)
 	go func() {
 		err := process.ModuleRun()
@@ -40,26 +50,73 @@ func Run(op options.TaskOptions) error {
 			return
 		}
 	}()
-	ch <- op.Target
+	ch <- types.Message{Kind: types.KindTarget, Payload: op.Target, Target: op.Target, TaskId: op.ID}
 	close(ch)
-	time.Sleep(10 * time.Second)
+	// 每个模块及其 Relay、Sink 在创建时已经计数，输入关闭后逐级结束，结束后阶段的检查点都已经写入
 	wg.Wait()
+	unfinished := progress.Unfinished()
+	outcome := progress.Outcome()
+	progress.Stop()
 	end = time.Now()
 	duration := end.Sub(start)
+	if contextmanager.DeadlineExceeded(targetCtx) {
+		// 超过截止时间的目标部分完成，被中断的阶段在 Finish 时记录
+		reason := "target deadline"
+		if contextmanager.DeadlineExceeded(contextmanager.GlobalContextManagers.GetContext(op.ID)) {
+			reason = "task deadline"
+		}
+		if cp := pipeline.NewCheckpoints(op.ID, op.Target); cp != nil {
+			cp.Clear()
+		}
+		handler.TaskHandle.ProgressEnd("scan", op.Target, op.ID, 1, duration)
+		handler.TaskHandle.EndTask()
+		return pipeline.Outcome{
+			Status:   pipeline.OutcomePartial,
+			Class:    pipeline.FailureDeadline,
+			Reason:   reason,
+			Stages:   unfinished,
+			Failures: outcome.Failures,
+		}, nil
+	}
+	taskCtx := contextmanager.GlobalContextManagers.GetContext(op.ID)
+	if targetCtx.Err() != nil && taskCtx.Err() == nil {
+		// 单独取消的目标不再运行也不重试，标记为部分完成
+		if cp := pipeline.NewCheckpoints(op.ID, op.Target); cp != nil {
+			cp.Clear()
+		}
+		handler.TaskHandle.ProgressEnd("scan", op.Target, op.ID, 1, duration)
+		handler.TaskHandle.EndTask()
+		return pipeline.Outcome{
+			Status: pipeline.OutcomePartial,
+			Reason: "target cancelled",
+			Stages: unfinished,
+		}, nil
+	}
 	select {
-	case <-contextmanager.GlobalContextManagers.GetContext(op.ID).Done():
+	case <-taskCtx.Done():
 		// 增加完成计数
 		handler.TaskHandle.EndTask()
-		return fmt.Errorf("task Cancel")
+		return outcome, fmt.Errorf("task Cancel")
 	default:
+		// 目标运行完毕，删除阶段检查点，失败的目标重试时重新运行所有阶段
+		if cp := pipeline.NewCheckpoints(op.ID, op.Target); cp != nil {
+			cp.Clear()
+		}
 		// 记录模块完成日志
 		handler.TaskHandle.ProgressEnd("scan", op.Target, op.ID, 1, duration)
-		// 记录完成时间以及完成目标
-		handler.TaskHandle.TaskEnd(op.Target, op.ID)
 		// 增加完成计数
 		handler.TaskHandle.EndTask()
-		return nil
+		return outcome, nil
+	}
+}
+
+// Finish 目标不再重试时记录最终结果，部分完成的目标记录被中断的阶段
+func Finish(op options.TaskOptions, outcome pipeline.Outcome) {
+	if outcome.Status == pipeline.OutcomePartial {
+		handler.TaskHandle.TargetPartial(op.Target, op.ID, outcome.Reason, outcome.Stages)
 	}
+	// 记录完成时间以及完成目标
+	handler.TaskHandle.TaskEnd(op.Target, op.ID)
 }
 
 func CleanTmp() {
@@ -0,0 +1,153 @@
+// schedule-------------------------------------
+// @file      : cron_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/11 21:03
+// -------------------------------------------
+
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@every 30s",
+		"@every x",
+		"@never",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := ParseCron(expr); err == nil {
+				t.Fatalf("ParseCron(%q) error = nil, want error", expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2025-01-15 是周三
+	base := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time // 零值表示没有下一次运行时间
+	}{
+		{"*/15 * * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2025, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2025, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"5,10 8-9 * * *", time.Date(2025, 1, 16, 8, 5, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2025, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 */10 * *", time.Date(2025, 1, 21, 12, 0, 0, 0, time.UTC)},
+		// 日和周都有限制时满足其中一个即可
+		{"0 0 13 * 5", time.Date(2025, 1, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@hourly", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 90m", time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			c, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error: %v", tt.expr, err)
+			}
+			if next := c.Next(base); !next.Equal(tt.next) {
+				t.Fatalf("Next() = %v, want %v", next, tt.next)
+			}
+		})
+	}
+}
+
+func TestCronNextSkipsSeconds(t *testing.T) {
+	c, err := ParseCron("* * * * *")
+	if err != nil {
+		t.Fatalf("ParseCron() error: %v", err)
+	}
+	next := c.Next(time.Date(2025, 1, 15, 10, 30, 59, 999, time.UTC))
+	if want := time.Date(2025, 1, 15, 10, 31, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("Next() = %v, want %v", next, want)
+	}
+}
+
+func TestParseOverlap(t *testing.T) {
+	tests := []struct {
+		overlap string
+		want    string
+		err     bool
+	}{
+		{"", OverlapSkip, false},
+		{OverlapSkip, OverlapSkip, false},
+		{OverlapQueue, OverlapQueue, false},
+		{OverlapCancel, OverlapCancel, false},
+		{"wait", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			got, err := ParseOverlap(tt.overlap)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Fatalf("ParseOverlap(%q) = %q, %v, want %q, error %v", tt.overlap, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseJitter(t *testing.T) {
+	tests := []struct {
+		jitter string
+		want   time.Duration
+		err    bool
+	}{
+		{"", 0, false},
+		{"10m", 10 * time.Minute, false},
+		{"-1m", 0, true},
+		{"ten", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.jitter, func(t *testing.T) {
+			got, err := ParseJitter(tt.jitter)
+			if (err != nil) != tt.err || got != tt.want {
+				t.Fatalf("ParseJitter(%q) = %v, %v, want %v, error %v", tt.jitter, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestNextRunJitter(t *testing.T) {
+	c, err := ParseCron("0 * * * *")
+	if err != nil {
+		t.Fatalf("ParseCron() error: %v", err)
+	}
+	base := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	next := c.Next(base)
+	if got := NextRun(c, 0, base); !got.Equal(next) {
+		t.Fatalf("NextRun() without jitter = %v, want %v", got, next)
+	}
+	for i := 0; i < 100; i++ {
+		got := NextRun(c, 5*time.Minute, base)
+		if got.Before(next) || !got.Before(next.Add(5*time.Minute)) {
+			t.Fatalf("NextRun() = %v, want in [%v, %v)", got, next, next.Add(5*time.Minute))
+		}
+	}
+}
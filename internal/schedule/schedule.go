@@ -0,0 +1,127 @@
+// schedule-------------------------------------
+// @file      : schedule.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/27 21:16
+// -------------------------------------------
+
+package schedule
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 本地保存的定时任务：schedule:<任务ID> 为定时配置，scheduletarget:<任务ID>:<目标md5> 为任务的所有目标
+const (
+	RecordPrefix       = "schedule:"
+	targetRecordPrefix = "scheduletarget:"
+)
+
+// 上次运行没有结束时的处理方式
+const (
+	OverlapSkip   = "skip"   // 跳过本次运行
+	OverlapQueue  = "queue"  // 上次运行结束后立即运行
+	OverlapCancel = "cancel" // 取消上次运行后运行
+)
+
+// Status 定时任务的状态，在节点心跳中上报
+type Status struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Cron    string `json:"cron"`
+	NextRun string `json:"nextRun"`
+	LastRun string `json:"lastRun"`
+	Running bool   `json:"running"`
+}
+
+var (
+	statusMu sync.Mutex
+	statuses []Status
+)
+
+// SetStatuses 更新节点所有定时任务的状态
+func SetStatuses(list []Status) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statuses = list
+}
+
+// Statuses 节点所有定时任务的状态
+func Statuses() []Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	list := make([]Status, len(statuses))
+	copy(list, statuses)
+	return list
+}
+
+// RecordKey 定时配置的键
+func RecordKey(id string) []byte {
+	return []byte(RecordPrefix + id)
+}
+
+// TargetPrefix 定时任务目标的键前缀
+func TargetPrefix(id string) string {
+	return fmt.Sprintf("%v%v:", targetRecordPrefix, id)
+}
+
+// Delete 删除定时配置，停止任务后不再定时运行，keepTargets 为 false 时同时删除记录的目标
+func Delete(id string, keepTargets bool) {
+	err := pebbledb.PebbleStore.Delete(RecordKey(id))
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete schedule %v error: %v", id, err))
+	}
+	if keepTargets {
+		return
+	}
+	targets, err := pebbledb.PebbleStore.GetKeysWithPrefix(TargetPrefix(id))
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore get schedule targets error: %v", err))
+		return
+	}
+	keys := make([][]byte, 0, len(targets))
+	for key := range targets {
+		keys = append(keys, []byte(key))
+	}
+	err = pebbledb.PebbleStore.BatchDelete(keys)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete schedule targets error: %v", err))
+	}
+}
+
+// ParseOverlap 检查处理方式，为空时默认跳过
+func ParseOverlap(overlap string) (string, error) {
+	switch overlap {
+	case "":
+		return OverlapSkip, nil
+	case OverlapSkip, OverlapQueue, OverlapCancel:
+		return overlap, nil
+	}
+	return "", fmt.Errorf("invalid overlap %v", overlap)
+}
+
+// ParseJitter 解析随机延迟时间，为空时不延迟
+func ParseJitter(jitter string) (time.Duration, error) {
+	if jitter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(jitter)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid jitter %v", jitter)
+	}
+	return d, nil
+}
+
+// NextRun after 之后的下一次运行时间，加上不超过 jitter 的随机延迟，分散多个节点同时运行
+func NextRun(c *Cron, jitter time.Duration, after time.Time) time.Time {
+	next := c.Next(after)
+	if next.IsZero() || jitter <= 0 {
+		return next
+	}
+	return next.Add(time.Duration(rand.Int63n(int64(jitter))))
+}
@@ -0,0 +1,357 @@
+// scope-------------------------------------
+// @file      : engine.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/29 20:22
+// -------------------------------------------
+
+package scope
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type projectScope struct {
+	id    string
+	scope *Scope
+}
+
+var (
+	projectMu sync.RWMutex
+	projects  = make(map[string][]projectScope) // 根域名 -> 项目的扫描范围
+)
+
+// SetProjects 更新项目的扫描范围，规则错误的项目只使用原有的黑名单
+func SetProjects(list []types.Project) {
+	result := make(map[string][]projectScope)
+	for _, p := range list {
+		s, err := compileProject(p)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("project %v scope invalid, only ignore list is used: %v", p.ID, err))
+			s, _ = compileProject(types.Project{IgnoreList: p.IgnoreList, IgnoreRegexList: p.IgnoreRegexList})
+		}
+		for _, rootDomain := range p.Target {
+			rootDomain = strings.ToLower(rootDomain)
+			result[rootDomain] = append(result[rootDomain], projectScope{id: p.ID, scope: s})
+		}
+	}
+	projectMu.Lock()
+	projects = result
+	projectMu.Unlock()
+}
+
+// projectScopes 任务目标和数据所属项目的扫描范围
+func projectScopes(hosts ...string) []projectScope {
+	projectMu.RLock()
+	defer projectMu.RUnlock()
+	if len(projects) == 0 {
+		return nil
+	}
+	var result []projectScope
+	seen := make(map[string]bool)
+	for _, host := range hosts {
+		if host == "" {
+			continue
+		}
+		rootDomain, err := utils.Tools.GetRootDomain(host)
+		if err != nil {
+			continue
+		}
+		for _, p := range projects[strings.ToLower(rootDomain)] {
+			if !seen[p.id] {
+				seen[p.id] = true
+				result = append(result, p)
+			}
+		}
+	}
+	return result
+}
+
+// Engine 一个任务的扫描范围检查，数据需要同时满足任务和所属项目的扫描范围
+type Engine struct {
+	taskId string
+	task   *Scope
+}
+
+// NewEngine 任务没有设置扫描范围时只检查项目的扫描范围
+func NewEngine(taskId string, rules *types.ScopeRules) (*Engine, error) {
+	e := &Engine{taskId: taskId}
+	if rules != nil {
+		s, err := Compile(*rules)
+		if err != nil {
+			return nil, err
+		}
+		e.task = s
+	}
+	return e, nil
+}
+
+func (e *Engine) check(target string, subject Subject) (bool, string) {
+	if e.task != nil {
+		if ok, reason := e.task.Check(subject); !ok {
+			return false, "task " + reason
+		}
+	}
+	for _, p := range projectScopes(target, subject.Host) {
+		if ok, reason := p.scope.Check(subject); !ok {
+			return false, fmt.Sprintf("project %v %v", p.id, reason)
+		}
+	}
+	return true, ""
+}
+
+// CheckTarget 检查任务目标是否在扫描范围内，不计数也不记录日志，用于任务试运行
+func (e *Engine) CheckTarget(target string) (bool, string) {
+	subject, ok := targetSubject(target)
+	if !ok {
+		return true, ""
+	}
+	return e.check(target, subject)
+}
+
+// allow 检查数据，不在范围内时记录审计日志并计数
+func (e *Engine) allow(stage string, msg types.Message, subject Subject) bool {
+	ok, reason := e.check(msg.Target, subject)
+	if !ok {
+		Drops.record(e.taskId, stage)
+		logger.SlogInfoLocal(fmt.Sprintf("scope drop task %v stage %v target %v %v %v: %v", e.taskId, stage, msg.Target, msg.Kind, subject, reason))
+	}
+	return ok
+}
+
+// Filter 检查阶段输出的消息，批量消息只保留范围内的数据，返回 false 表示丢弃整个消息
+func (e *Engine) Filter(stage string, msg types.Message) (types.Message, bool) {
+	switch p := msg.Payload.(type) {
+	case string:
+		subject, ok := targetSubject(p)
+		if !ok {
+			// IP 段等需要目标解析展开的目标，展开后再检查
+			return msg, true
+		}
+		return msg, e.allow(stage, msg, subject)
+	case types.SubdomainResult:
+		return msg, e.allow(stage, msg, Subject{Host: p.Host, IP: p.IP})
+	case types.SubTakeResult:
+		return msg, e.allow(stage, msg, Subject{Host: hostOnly(p.Input)})
+	case types.DomainResolve:
+		return msg, e.allow(stage, msg, Subject{Host: p.Domain, IP: p.IP})
+	case types.DomainSkip:
+		return msg, e.allow(stage, msg, Subject{Host: p.Domain, IP: p.IP})
+	case types.PortAlive:
+		return msg, e.allow(stage, msg, Subject{Host: p.Host, IP: ipList(p.IP), Port: p.Port})
+	case types.MappingBatch:
+		var assets types.MappingBatch
+		for _, asset := range p {
+			if e.allow(stage, msg, assetOtherSubject(asset)) {
+				assets = append(assets, asset)
+			}
+		}
+		msg.Payload = assets
+		return msg, len(assets) != 0
+	case types.AssetOther:
+		return msg, e.allow(stage, msg, assetOtherSubject(p))
+	case types.AssetHttp:
+		return msg, e.allow(stage, msg, assetHttpSubject(p))
+	case []types.AssetOther:
+		var assets []types.AssetOther
+		for _, asset := range p {
+			if e.allow(stage, msg, assetOtherSubject(asset)) {
+				assets = append(assets, asset)
+			}
+		}
+		msg.Payload = assets
+		return msg, len(assets) != 0
+	case []types.AssetHttp:
+		var assets []types.AssetHttp
+		for _, asset := range p {
+			if e.allow(stage, msg, assetHttpSubject(asset)) {
+				assets = append(assets, asset)
+			}
+		}
+		msg.Payload = assets
+		return msg, len(assets) != 0
+	case types.UrlResult:
+		// 输出不是 URL 时（例如敏感信息）按输入检查
+		subject, ok := urlSubject(p.Output)
+		if !ok {
+			subject, ok = urlSubject(p.Input)
+		}
+		if !ok {
+			return msg, true
+		}
+		return msg, e.allow(stage, msg, subject)
+	case []string:
+		var urls []string
+		for _, rawUrl := range p {
+			if subject, ok := urlSubject(rawUrl); !ok || e.allow(stage, msg, subject) {
+				urls = append(urls, rawUrl)
+			}
+		}
+		msg.Payload = urls
+		return msg, len(urls) != 0
+	case types.CrawlerResult:
+		return msg, e.allowUrl(stage, msg, p.Url)
+	case []types.CrawlerResult:
+		var crawlers []types.CrawlerResult
+		for _, crawler := range p {
+			if e.allowUrl(stage, msg, crawler.Url) {
+				crawlers = append(crawlers, crawler)
+			}
+		}
+		msg.Payload = crawlers
+		return msg, len(crawlers) != 0
+	case types.DirResult:
+		return msg, e.allowUrl(stage, msg, p.Url)
+	case types.VulnResult:
+		return msg, e.allowUrl(stage, msg, p.Url)
+	}
+	return msg, true
+}
+
+func (e *Engine) allowUrl(stage string, msg types.Message, rawUrl string) bool {
+	subject, ok := urlSubject(rawUrl)
+	if !ok {
+		return true
+	}
+	return e.allow(stage, msg, subject)
+}
+
+// targetSubject 任务目标，可能是 URL、host:port、域名或 IP
+func targetSubject(target string) (Subject, bool) {
+	target = strings.TrimSpace(target)
+	if strings.Contains(target, "://") {
+		subject, ok := urlSubject(target)
+		// 任务目标不检查路径，路径规则只用于发现的 URL
+		subject.Path = ""
+		return subject, ok
+	}
+	if strings.Contains(target, "/") {
+		return Subject{}, false
+	}
+	if parts := strings.SplitN(target, "-", 2); len(parts) == 2 && net.ParseIP(strings.TrimSpace(parts[0])) != nil {
+		return Subject{}, false
+	}
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		return Subject{Host: host, Port: port}, true
+	}
+	return Subject{Host: target}, target != ""
+}
+
+// urlSubject 完整的 URL，没有端口时使用协议的默认端口
+func urlSubject(rawUrl string) (Subject, bool) {
+	if !strings.Contains(rawUrl, "://") {
+		return Subject{}, false
+	}
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil || u.Hostname() == "" {
+		return Subject{}, false
+	}
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	return Subject{Host: u.Hostname(), Port: port, Path: path}, true
+}
+
+func assetOtherSubject(asset types.AssetOther) Subject {
+	return Subject{Host: hostOnly(asset.Host), IP: ipList(asset.IP), Port: asset.Port}
+}
+
+func assetHttpSubject(asset types.AssetHttp) Subject {
+	return Subject{Host: hostOnly(asset.Host), IP: ipList(asset.IP), Port: asset.Port}
+}
+
+// hostOnly 去掉协议和端口
+func hostOnly(host string) string {
+	if subject, ok := urlSubject(host); ok {
+		return subject.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func ipList(ip string) []string {
+	if ip == "" {
+		return nil
+	}
+	return []string{ip}
+}
+
+type dropStats struct {
+	mu    sync.Mutex
+	tasks map[string]map[string]int64 // 任务ID -> 阶段 -> 丢弃数量
+	node  map[string]int64            // 节点启动以来每个阶段的丢弃数量
+}
+
+// Drops 不在扫描范围内被丢弃的数据数量，按任务和节点分别记录
+var Drops = &dropStats{
+	tasks: make(map[string]map[string]int64),
+	node:  make(map[string]int64),
+}
+
+func (s *dropStats) record(taskId string, stage string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[taskId]; !ok {
+		s.tasks[taskId] = make(map[string]int64)
+	}
+	s.tasks[taskId][stage] += 1
+	s.node[stage] += 1
+}
+
+func copyDrops(drops map[string]int64) map[string]int64 {
+	result := make(map[string]int64, len(drops))
+	for stage, count := range drops {
+		result[stage] = count
+	}
+	return result
+}
+
+// Task 获取任务每个阶段丢弃的数量
+func (s *dropStats) Task(taskId string) map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyDrops(s.tasks[taskId])
+}
+
+// Node 获取节点启动以来每个阶段丢弃的数量
+func (s *dropStats) Node() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return copyDrops(s.node)
+}
+
+// EndTask 任务结束时输出任务每个阶段丢弃的数量并删除
+func (s *dropStats) EndTask(taskId string) {
+	s.mu.Lock()
+	drops := copyDrops(s.tasks[taskId])
+	delete(s.tasks, taskId)
+	s.mu.Unlock()
+	var stages []string
+	for stage := range drops {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		logger.SlogInfo(fmt.Sprintf("task %v stage %v dropped %v out of scope items", taskId, stage, drops[stage]))
+	}
+}
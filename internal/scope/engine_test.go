@@ -0,0 +1,199 @@
+// scope-------------------------------------
+// @file      : engine_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/11 20:12
+// -------------------------------------------
+
+package scope
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	utils.Tools = &utils.UtilTools{}
+	os.Exit(m.Run())
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules types.ScopeRules
+		err   bool
+	}{
+		{name: "empty", rules: types.ScopeRules{}},
+		{name: "valid", rules: types.ScopeRules{
+			Include:      []string{"example.com", "*.test.com", "10.0.0.0/8", "192.168.1.1", "https://a.org/"},
+			ExcludePorts: []string{"22", "8000-9000"},
+			IncludePaths: []string{"^/api/"},
+		}},
+		{name: "bad cidr", rules: types.ScopeRules{Include: []string{"10.0.0.0/33"}}, err: true},
+		{name: "bad port", rules: types.ScopeRules{IncludePorts: []string{"http"}}, err: true},
+		{name: "port out of range", rules: types.ScopeRules{ExcludePorts: []string{"1-70000"}}, err: true},
+		{name: "reversed port range", rules: types.ScopeRules{IncludePorts: []string{"90-80"}}, err: true},
+		{name: "bad path regex", rules: types.ScopeRules{ExcludePaths: []string{"(["}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.rules)
+			if (err != nil) != tt.err {
+				t.Fatalf("Compile() error = %v, want error %v", err, tt.err)
+			}
+			if err := Validate(&tt.rules); (err != nil) != tt.err {
+				t.Fatalf("Validate() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+	if err := Validate(nil); err != nil {
+		t.Fatalf("Validate(nil) error = %v, want nil", err)
+	}
+}
+
+func TestEngineFilter(t *testing.T) {
+	rules := &types.ScopeRules{
+		Include:      []string{"example.com", "*.dev.test.com", "10.0.0.0/24"},
+		Exclude:      []string{"admin.example.com", "10.0.0.5"},
+		ExcludePorts: []string{"22", "3306-3310"},
+		ExcludePaths: []string{"^/logout"},
+	}
+	tests := []struct {
+		name    string
+		payload interface{}
+		ok      bool
+		want    interface{} // 批量消息过滤后的数据，为空时不检查
+	}{
+		{name: "target domain", payload: "www.example.com", ok: true},
+		{name: "target subdomain excluded", payload: "admin.example.com", ok: false},
+		{name: "target not included", payload: "other.com", ok: false},
+		{name: "target wildcard", payload: "a.dev.test.com", ok: true},
+		{name: "target wildcard parent", payload: "dev.test.com", ok: false},
+		{name: "target url ignores path", payload: "https://www.example.com/logout", ok: true},
+		{name: "target port excluded", payload: "www.example.com:22", ok: false},
+		{name: "target ip range expands later", payload: "10.0.1.1-10.0.1.9", ok: true},
+		{name: "target cidr expands later", payload: "172.16.0.0/16", ok: true},
+		{name: "subdomain by ip", payload: types.SubdomainResult{Host: "", IP: []string{"10.0.0.8"}}, ok: true},
+		{name: "subdomain excluded ip", payload: types.SubdomainResult{Host: "", IP: []string{"10.0.0.5"}}, ok: false},
+		{name: "subdomain host", payload: types.SubdomainResult{Host: "api.example.com", IP: []string{"1.1.1.1"}}, ok: true},
+		{name: "resolve", payload: types.DomainResolve{Domain: "other.com", IP: []string{"10.0.0.9"}}, ok: true},
+		{name: "port alive", payload: types.PortAlive{Host: "www.example.com", IP: "1.1.1.1", Port: "80"}, ok: true},
+		{name: "port alive excluded port", payload: types.PortAlive{Host: "www.example.com", IP: "1.1.1.1", Port: "3307"}, ok: false},
+		{
+			name: "mapping batch keeps in scope assets",
+			payload: types.MappingBatch{
+				{Host: "www.example.com", Port: "443"},
+				{Host: "other.com", Port: "443"},
+				{Host: "www.example.com:8080", Port: "8080"},
+			},
+			ok: true,
+			want: types.MappingBatch{
+				{Host: "www.example.com", Port: "443"},
+				{Host: "www.example.com:8080", Port: "8080"},
+			},
+		},
+		{
+			name:    "mapping batch all dropped",
+			payload: types.MappingBatch{{Host: "other.com", Port: "443"}},
+			ok:      false,
+		},
+		{name: "asset http", payload: types.AssetHttp{Host: "https://www.example.com", Port: "22"}, ok: false},
+		{name: "url result", payload: types.UrlResult{Input: "https://www.example.com", Output: "https://www.example.com/logout?x=1"}, ok: false},
+		{name: "url result non url output uses input", payload: types.UrlResult{Input: "https://www.example.com/", Output: "secret"}, ok: true},
+		{name: "url result without url", payload: types.UrlResult{Input: "x", Output: "y"}, ok: true},
+		{
+			name:    "url list",
+			payload: []string{"https://www.example.com/a", "https://other.com/", "not a url", "http://www.example.com/logout"},
+			ok:      true,
+			want:    []string{"https://www.example.com/a", "not a url"},
+		},
+		{name: "crawler", payload: types.CrawlerResult{Url: "http://admin.example.com/"}, ok: false},
+		{name: "dir", payload: types.DirResult{Url: "https://www.example.com:443/admin"}, ok: true},
+		{name: "vuln default port", payload: types.VulnResult{Url: "https://www.example.com:22/"}, ok: false},
+		{name: "unknown payload", payload: 1, ok: true},
+	}
+	e, err := NewEngine("scope-test", rules)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ok := e.Filter("Test", types.Message{Payload: tt.payload, Target: "example.com", TaskId: "scope-test"})
+			if ok != tt.ok {
+				t.Fatalf("Filter() ok = %v, want %v", ok, tt.ok)
+			}
+			if tt.want != nil && !reflect.DeepEqual(msg.Payload, tt.want) {
+				t.Fatalf("Filter() payload = %v, want %v", msg.Payload, tt.want)
+			}
+		})
+	}
+	if drops := Drops.Task("scope-test"); drops["Test"] == 0 {
+		t.Fatalf("Drops.Task() = %v, want drops of stage Test", drops)
+	}
+	Drops.EndTask("scope-test")
+	if drops := Drops.Task("scope-test"); len(drops) != 0 {
+		t.Fatalf("Drops.Task() after EndTask = %v, want empty", drops)
+	}
+}
+
+func TestEngineProjectScope(t *testing.T) {
+	SetProjects([]types.Project{
+		{
+			ID:              "p1",
+			Target:          []string{"Example.com"},
+			IgnoreList:      []string{"skip.example.com"},
+			IgnoreRegexList: []*regexp.Regexp{regexp.MustCompile(`^test-`)},
+			Scope:           types.ScopeRules{ExcludePorts: []string{"22"}},
+		},
+		{
+			// 规则错误时只使用黑名单
+			ID:         "p2",
+			Target:     []string{"other.com"},
+			IgnoreList: []string{"skip.other.com"},
+			Scope:      types.ScopeRules{Include: []string{"10.0.0.0/99"}},
+		},
+	})
+	defer SetProjects(nil)
+	tests := []struct {
+		name    string
+		target  string
+		payload interface{}
+		ok      bool
+	}{
+		{name: "in project", target: "example.com", payload: "www.example.com", ok: true},
+		{name: "project ignore list", target: "example.com", payload: "skip.example.com", ok: false},
+		{name: "project ignore regex", target: "example.com", payload: "test-a.example.com", ok: false},
+		{name: "project port", target: "example.com", payload: types.PortAlive{Host: "www.example.com", Port: "22"}, ok: false},
+		{name: "data of another project", target: "other.com", payload: "skip.example.com", ok: false},
+		{name: "invalid project scope keeps ignore list", target: "other.com", payload: "skip.other.com", ok: false},
+		{name: "invalid project scope not restricted", target: "other.com", payload: "www.other.com", ok: true},
+		{name: "no project", target: "none.com", payload: "www.none.com", ok: true},
+	}
+	// 任务没有扫描范围时只检查项目的扫描范围
+	e, err := NewEngine("scope-project-test", nil)
+	if err != nil {
+		t.Fatalf("NewEngine() error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := e.Filter("Test", types.Message{Payload: tt.payload, Target: tt.target})
+			if ok != tt.ok {
+				t.Fatalf("Filter() ok = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+	if ok, reason := e.CheckTarget("skip.example.com"); ok || reason == "" {
+		t.Fatalf("CheckTarget() = %v, %q, want false with reason", ok, reason)
+	}
+	Drops.EndTask("scope-project-test")
+}
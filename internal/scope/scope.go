@@ -0,0 +1,277 @@
+// scope-------------------------------------
+// @file      : scope.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/29 19:35
+// -------------------------------------------
+
+package scope
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scope 编译后的扫描范围规则
+type Scope struct {
+	include      hostRules
+	exclude      hostRules
+	includePorts []portRange
+	excludePorts []portRange
+	includePaths []*regexp.Regexp
+	excludePaths []*regexp.Regexp
+}
+
+// hostRules 主机规则，满足任意一条即匹配
+type hostRules struct {
+	hosts    map[string]bool  // 完全相同的主机
+	domains  []string         // 域名及其子域名
+	patterns []*regexp.Regexp // 通配符和正则
+	nets     []*net.IPNet     // IP 和 CIDR
+}
+
+type portRange struct {
+	start int
+	end   int
+}
+
+// Subject 需要检查的数据，为空的字段不检查
+type Subject struct {
+	Host string
+	IP   []string
+	Port string
+	Path string
+}
+
+func (s Subject) String() string {
+	item := s.Host
+	if item == "" && len(s.IP) != 0 {
+		item = s.IP[0]
+	}
+	if s.Port != "" {
+		item = net.JoinHostPort(item, s.Port)
+	}
+	return item + s.Path
+}
+
+// Compile 编译扫描范围规则，规则格式错误时返回错误，错误的包含规则可能扩大扫描范围，不能忽略
+func Compile(rules types.ScopeRules) (*Scope, error) {
+	var s Scope
+	var err error
+	if s.include, err = compileHosts(rules.Include); err != nil {
+		return nil, err
+	}
+	if s.exclude, err = compileHosts(rules.Exclude); err != nil {
+		return nil, err
+	}
+	if s.includePorts, err = compilePorts(rules.IncludePorts); err != nil {
+		return nil, err
+	}
+	if s.excludePorts, err = compilePorts(rules.ExcludePorts); err != nil {
+		return nil, err
+	}
+	if s.includePaths, err = compilePaths(rules.IncludePaths); err != nil {
+		return nil, err
+	}
+	if s.excludePaths, err = compilePaths(rules.ExcludePaths); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate 检查扫描范围规则的格式
+func Validate(rules *types.ScopeRules) error {
+	if rules == nil {
+		return nil
+	}
+	_, err := Compile(*rules)
+	return err
+}
+
+// compileProject 项目的扫描范围，项目原有的黑名单和黑名单正则作为排除规则
+func compileProject(p types.Project) (*Scope, error) {
+	s, err := Compile(p.Scope)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range p.IgnoreList {
+		if s.exclude.hosts == nil {
+			s.exclude.hosts = make(map[string]bool)
+		}
+		s.exclude.hosts[strings.ToLower(host)] = true
+	}
+	s.exclude.patterns = append(s.exclude.patterns, p.IgnoreRegexList...)
+	return s, nil
+}
+
+func compileHosts(items []string) (hostRules, error) {
+	var rules hostRules
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		item = strings.TrimPrefix(strings.TrimPrefix(item, "http://"), "https://")
+		item = strings.TrimSuffix(item, "/")
+		if item == "" {
+			continue
+		}
+		if strings.Contains(item, "/") {
+			_, ipNet, err := net.ParseCIDR(item)
+			if err != nil {
+				return rules, fmt.Errorf("invalid cidr %v", item)
+			}
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		if strings.Contains(item, "*") {
+			// *.example.com 只匹配子域名，* 匹配任意字符
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(item), `\*`, `.*`)
+			re, err := regexp.Compile("^" + pattern + "$")
+			if err != nil {
+				return rules, fmt.Errorf("invalid wildcard %v", item)
+			}
+			rules.patterns = append(rules.patterns, re)
+			continue
+		}
+		rules.domains = append(rules.domains, item)
+	}
+	return rules, nil
+}
+
+func compilePorts(items []string) ([]portRange, error) {
+	var ranges []portRange
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		start, end := item, item
+		if i := strings.Index(item, "-"); i >= 0 {
+			start, end = item[:i], item[i+1:]
+		}
+		s, err1 := strconv.Atoi(strings.TrimSpace(start))
+		e, err2 := strconv.Atoi(strings.TrimSpace(end))
+		if err1 != nil || err2 != nil || s < 0 || e > 65535 || s > e {
+			return nil, fmt.Errorf("invalid port %v", item)
+		}
+		ranges = append(ranges, portRange{start: s, end: e})
+	}
+	return ranges, nil
+}
+
+func compilePaths(items []string) ([]*regexp.Regexp, error) {
+	var paths []*regexp.Regexp
+	for _, item := range items {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		re, err := regexp.Compile(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path regex %v: %v", item, err)
+		}
+		paths = append(paths, re)
+	}
+	return paths, nil
+}
+
+func (r hostRules) empty() bool {
+	return len(r.hosts) == 0 && len(r.domains) == 0 && len(r.patterns) == 0 && len(r.nets) == 0
+}
+
+// match 主机或主机解析的任意 IP 满足规则
+func (r hostRules) match(host string, ips []string) bool {
+	if host != "" {
+		if r.hosts[host] {
+			return true
+		}
+		for _, domain := range r.domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+		for _, pattern := range r.patterns {
+			if pattern.MatchString(host) {
+				return true
+			}
+		}
+		if ip := net.ParseIP(host); ip != nil && r.matchIP(ip) {
+			return true
+		}
+	}
+	for _, value := range ips {
+		if r.hosts[value] {
+			return true
+		}
+		if ip := net.ParseIP(value); ip != nil && r.matchIP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r hostRules) matchIP(ip net.IP) bool {
+	for _, ipNet := range r.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPort(ranges []portRange, port int) bool {
+	for _, r := range ranges {
+		if port >= r.start && port <= r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPath(paths []*regexp.Regexp, path string) bool {
+	for _, re := range paths {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check 检查数据是否在扫描范围内，不在范围内时返回原因
+func (s *Scope) Check(subject Subject) (bool, string) {
+	host := strings.ToLower(subject.Host)
+	if host != "" || len(subject.IP) != 0 {
+		if s.exclude.match(host, subject.IP) {
+			return false, "host excluded"
+		}
+		if !s.include.empty() && !s.include.match(host, subject.IP) {
+			return false, "host not included"
+		}
+	}
+	if port, err := strconv.Atoi(subject.Port); err == nil {
+		if matchPort(s.excludePorts, port) {
+			return false, "port excluded"
+		}
+		if len(s.includePorts) != 0 && !matchPort(s.includePorts, port) {
+			return false, "port not included"
+		}
+	}
+	if subject.Path != "" {
+		if matchPath(s.excludePaths, subject.Path) {
+			return false, "path excluded"
+		}
+		if len(s.includePaths) != 0 && !matchPath(s.includePaths, subject.Path) {
+			return false, "path not included"
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,40 @@
+// shutdown-------------------------------------
+// @file      : shutdown.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/4 19:48
+// -------------------------------------------
+
+package shutdown
+
+import (
+	"sync/atomic"
+)
+
+var stopping atomic.Bool
+
+// requests 节点内部发起的停止请求，例如更新程序后重启
+var requests = make(chan string, 1)
+
+// Begin 节点开始停止，不再获取新任务，已经开始停止时返回 false
+func Begin() bool {
+	return stopping.CompareAndSwap(false, true)
+}
+
+// Request 请求节点停止并退出，和收到停止信号一样等待正在运行的目标，写入队列中的数据后退出
+func Request(reason string) {
+	select {
+	case requests <- reason:
+	default:
+	}
+}
+
+// Requested 节点内部发起的停止请求，值为停止的原因
+func Requested() <-chan string {
+	return requests
+}
+
+// Stopping 节点是否正在停止，停止时被取消的任务保留本地缓存，重启后继续运行
+func Stopping() bool {
+	return stopping.Load()
+}
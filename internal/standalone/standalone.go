@@ -0,0 +1,339 @@
+// standalone-------------------------------------
+// @file      : standalone.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/21 21:40
+// -------------------------------------------
+
+package standalone
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/bigcache"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/configupdater"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/notification"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/runner"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/modules"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// 退出码
+const (
+	ExitOK       = 0
+	ExitFindings = 1 // 发现了不低于阈值等级的漏洞
+	ExitError    = 2
+)
+
+// Options 单机扫描参数
+type Options struct {
+	TaskFile      string   // 任务定义 yaml 文件
+	Targets       []string // 命令行中的目标
+	TargetFile    string   // 目标文件，每行一个目标
+	Output        string   // 结果输出目录
+	ModulesConfig string   // 模块配置文件
+	WebFinger     string   // 指纹规则文件或目录
+	Sensitive     string   // 敏感信息规则文件或目录
+	PocDir        string   // poc 目录
+	FailOn        string   // 漏洞等级阈值，不为空时发现不低于该等级的漏洞则返回非零退出码
+}
+
+// ParseArgs 解析 scan 子命令参数
+func ParseArgs(args []string) (*Options, error) {
+	opt := &Options{}
+	var targets string
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	fs.StringVar(&opt.TaskFile, "task", "", "task definition yaml file (plugin ids and parameters as in TaskOptions)")
+	fs.StringVar(&targets, "t", "", "targets, separated by commas")
+	fs.StringVar(&opt.TargetFile, "f", "", "file containing targets, one per line")
+	fs.StringVar(&opt.Output, "o", "results", "directory to write results to")
+	fs.StringVar(&opt.ModulesConfig, "modules", "", "modules config file (default config/modules.yaml)")
+	fs.StringVar(&opt.WebFinger, "finger", "", "fingerprint rules yaml file or directory")
+	fs.StringVar(&opt.Sensitive, "sensitive", "", "sensitive rules yaml file or directory")
+	fs.StringVar(&opt.PocDir, "poc", "", "poc directory (default poc)")
+	fs.StringVar(&opt.FailOn, "fail-on", "", "exit with code 1 when vulnerabilities at or above this severity are found (info, low, medium, high, critical)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	for _, t := range strings.Split(targets, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			opt.Targets = append(opt.Targets, t)
+		}
+	}
+	opt.Targets = append(opt.Targets, fs.Args()...)
+	if opt.TaskFile == "" {
+		return nil, fmt.Errorf("missing -task")
+	}
+	if opt.FailOn != "" && results.SeverityRank(opt.FailOn) < 0 {
+		return nil, fmt.Errorf("unknown severity: %v", opt.FailOn)
+	}
+	return opt, nil
+}
+
+// LoadTask 读取任务定义，字段名与服务端下发的任务相同
+func LoadTask(path string) (options.TaskOptions, error) {
+	var op options.TaskOptions
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return op, err
+	}
+	// 先解析为 map 再转换为 json，字段名与 TaskOptions 一致且不区分大小写
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return op, err
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return op, err
+	}
+	if err := json.Unmarshal(data, &op); err != nil {
+		return op, err
+	}
+	if op.ID == "" {
+		op.ID = "standalone-" + utils.Tools.GenerateRandomString(8)
+	}
+	if op.TaskName == "" {
+		op.TaskName = op.ID
+	}
+	return op, nil
+}
+
+// loadTargets 合并任务、命令行和文件中的目标并去重
+func loadTargets(op options.TaskOptions, opt *Options) ([]string, error) {
+	var targets []string
+	targets = append(targets, strings.Split(op.Target, "\n")...)
+	targets = append(targets, opt.Targets...)
+	if opt.TargetFile != "" {
+		file, err := os.Open(opt.TargetFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			targets = append(targets, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" || strings.HasPrefix(t, "#") || seen[t] {
+			continue
+		}
+		seen[t] = true
+		result = append(result, t)
+	}
+	return result, nil
+}
+
+// Main 运行单机扫描并返回退出码
+func Main(args []string) int {
+	opt, err := ParseArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scan: %v\n", err)
+		return ExitError
+	}
+	global.Standalone = true
+	code, err := Run(opt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "scan: %v\n", err)
+		return ExitError
+	}
+	return code
+}
+
+// Run 初始化本地运行环境，对所有目标运行任务，结束后根据发现的漏洞返回退出码
+func Run(opt *Options) (int, error) {
+	// 初始化系统信息
+	config.Initialize()
+	if opt.ModulesConfig != "" {
+		config.ModulesConfigPath = opt.ModulesConfig
+	}
+	if opt.PocDir != "" {
+		global.PocDir = opt.PocDir
+	}
+	output, err := filepath.Abs(opt.Output)
+	if err != nil {
+		return ExitError, err
+	}
+	// 结果只写入本地文件
+	global.AppConfig.Result = global.ResultConfig{Sinks: []string{results.SinkJsonl}, JsonlDir: output}
+	// 初始化日志模块
+	err = logger.NewLogger()
+	if err != nil {
+		return ExitError, fmt.Errorf("init logger: %v", err)
+	}
+	// 初始化任务计数器
+	handler.InitHandle()
+	// 加载本地规则
+	if opt.WebFinger != "" {
+		if err := configupdater.LoadLocalWebFinger(opt.WebFinger); err != nil {
+			return ExitError, fmt.Errorf("load fingerprints: %v", err)
+		}
+	}
+	if opt.Sensitive != "" {
+		if err := configupdater.LoadLocalSensitive(opt.Sensitive); err != nil {
+			return ExitError, fmt.Errorf("load sensitive rules: %v", err)
+		}
+	}
+	// 初始化模块配置
+	err = config.ModulesInitialize()
+	if err != nil {
+		return ExitError, fmt.Errorf("init ModulesConfig: %v", err)
+	}
+	op, err := LoadTask(opt.TaskFile)
+	if err != nil {
+		return ExitError, fmt.Errorf("load task: %v", err)
+	}
+	if op.Type == "page_monitoring" {
+		return ExitError, fmt.Errorf("task type page_monitoring is not supported in standalone mode")
+	}
+	targets, err := loadTargets(op, opt)
+	if err != nil {
+		return ExitError, fmt.Errorf("load targets: %v", err)
+	}
+	if len(targets) == 0 {
+		return ExitError, fmt.Errorf("no targets")
+	}
+	// 初始化上下文管理器
+	contextmanager.NewContextManager()
+	// 初始化tools
+	utils.InitializeTools()
+	utils.InitializeDnsTools()
+	utils.InitializeRequests()
+	utils.InitializeResults()
+	// 初始化通知模块
+	notification.InitializeNotification()
+	// 初始化协程池
+	pool.Initialize()
+	pool.PoolManage.InitializeModulesPools(config.ModulesConfig)
+	// 初始化内存缓存，单机模式只使用本地缓存去重
+	err = bigcache.Initialize()
+	if err != nil {
+		return ExitError, fmt.Errorf("init bigcache: %v", err)
+	}
+	// 使用单独的本地持久化缓存，避免与节点模式的缓存冲突
+	pebbledbSetting := pebbledb.Settings{
+		DBPath:       filepath.Join(global.AbsolutePath, "data", "standalone"),
+		CacheSize:    64 << 20,
+		MaxOpenFiles: 500,
+	}
+	pebbledbOption := pebbledb.GetPebbleOptions(&pebbledbSetting)
+	if !global.AppConfig.Debug {
+		pebbledbOption.Logger = nil
+	}
+	pedb, err := pebbledb.NewPebbleDB(pebbledbOption, pebbledbSetting.DBPath)
+	if err != nil {
+		return ExitError, fmt.Errorf("init pebbledb: %v", err)
+	}
+	pebbledb.PebbleStore = pedb
+	defer func(PebbleStore *pebbledb.PebbleDB) {
+		_ = PebbleStore.Close()
+	}(pebbledb.PebbleStore)
+	// 初始化结果处理队列
+	results.InitializeResultQueue()
+	// 初始化全局插件管理器
+	plugins.GlobalPluginManager = plugins.NewPluginManager()
+	err = plugins.GlobalPluginManager.InitializePlugins()
+	if err != nil {
+		results.Close()
+		return ExitError, fmt.Errorf("init plugins: %v", err)
+	}
+	// 初始化默认扫描流程图
+	err = pipeline.Initialize(filepath.Join(global.ConfigDir, "pipeline.yaml"))
+	if err == nil {
+		err = modules.ValidateGraph(pipeline.Default())
+	}
+	if err == nil && op.Pipeline != nil {
+		err = modules.ValidateGraph(op.Pipeline)
+	}
+	if err != nil {
+		results.Close()
+		return ExitError, fmt.Errorf("init pipeline: %v", err)
+	}
+
+	runTask(op, targets)
+
+	// 模块同步调用结果处理，runTask 返回时所有漏洞都已经计数并进入结果队列
+	// 关闭结果队列，等待结果写入文件后再根据漏洞数量确定退出码
+	results.Close()
+	counts := results.Findings.Counts()
+	logger.SlogInfoLocal(fmt.Sprintf("task %v end, results: %v, vulnerabilities: %v", op.ID, output, counts))
+	if opt.FailOn != "" && results.Findings.AtLeast(opt.FailOn) > 0 {
+		return ExitFindings, nil
+	}
+	return ExitOK, nil
+}
+
+// runTask 对所有目标运行任务，收到中断信号时取消任务
+func runTask(op options.TaskOptions, targets []string) {
+	contextmanager.GlobalContextManagers.AddContext(op.ID)
+	defer contextmanager.GlobalContextManagers.DeleteContext(op.ID)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer close(sigs)
+	defer signal.Stop(sigs)
+	go func() {
+		if _, ok := <-sigs; ok {
+			logger.SlogInfoLocal(fmt.Sprintf("task %v canceled", op.ID))
+			contextmanager.GlobalContextManagers.CancelContext(op.ID)
+		}
+	}()
+	logger.SlogInfoLocal(fmt.Sprintf("task %v begin, targets: %v", op.ID, len(targets)))
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		optionCopy := op
+		optionCopy.Target = target
+		taskFunc := func(op options.TaskOptions) func() {
+			return func() {
+				defer wg.Done()
+				select {
+				case <-contextmanager.GlobalContextManagers.GetContext(op.ID).Done():
+					// 任务取消直接返回
+					return
+				default:
+					// 单机模式不重试目标
+					outcome, err := runner.Run(op)
+					if err == nil {
+						runner.Finish(op, outcome)
+					}
+				}
+			}
+		}(optionCopy)
+		wg.Add(1)
+		err := pool.PoolManage.SubmitTask("task", taskFunc)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("task pool error: %v", err))
+			wg.Done()
+		}
+	}
+	wg.Wait()
+	pipeline.PluginStats.EndTask(op.ID)
+	scope.Drops.EndTask(op.ID)
+	handler.CloseNucleiEngine()
+}
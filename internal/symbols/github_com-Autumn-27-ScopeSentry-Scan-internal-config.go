@@ -4,6 +4,8 @@ package symbols
 
 import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"go/constant"
+	"go/token"
 	"reflect"
 )
 
@@ -17,12 +19,18 @@ func init() {
 		"ModulesConfig":     reflect.ValueOf(&config.ModulesConfig).Elem(),
 		"ModulesConfigPath": reflect.ValueOf(&config.ModulesConfigPath).Elem(),
 		"ModulesInitialize": reflect.ValueOf(config.ModulesInitialize),
+		"NodeLabels":        reflect.ValueOf(config.NodeLabels),
+		"PluginParallel":    reflect.ValueOf(constant.MakeFromLiteral("\"parallel\"", token.STRING, 0)),
+		"PluginSequential":  reflect.ValueOf(constant.MakeFromLiteral("\"sequential\"", token.STRING, 0)),
+		"ShutdownGrace":     reflect.ValueOf(config.ShutdownGrace),
+		"Version":           reflect.ValueOf(constant.MakeFromLiteral("\"1.5.4\"", token.STRING, 0)),
 
 		// type definitions
 		"AssetHandleConfig":         reflect.ValueOf((*config.AssetHandleConfig)(nil)),
 		"AssetMappConfig":           reflect.ValueOf((*config.AssetMappConfig)(nil)),
 		"DirScanConfig":             reflect.ValueOf((*config.DirScanConfig)(nil)),
 		"ModulesConfigStruct":       reflect.ValueOf((*config.ModulesConfigStruct)(nil)),
+		"PluginRunConfig":           reflect.ValueOf((*config.PluginRunConfig)(nil)),
 		"PortFingerprintConfig":     reflect.ValueOf((*config.PortFingerprintConfig)(nil)),
 		"PortScanConfig":            reflect.ValueOf((*config.PortScanConfig)(nil)),
 		"PortScanPreparationConfig": reflect.ValueOf((*config.PortScanPreparationConfig)(nil)),
@@ -10,8 +10,12 @@ import (
 func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager/contextmanager"] = map[string]reflect.Value{
 		// function, constant and variable definitions
+		"DeadlineExceeded":      reflect.ValueOf(contextmanager.DeadlineExceeded),
+		"DeleteDeadline":        reflect.ValueOf(contextmanager.DeleteDeadline),
 		"GlobalContextManagers": reflect.ValueOf(&contextmanager.GlobalContextManagers).Elem(),
 		"NewContextManager":     reflect.ValueOf(contextmanager.NewContextManager),
+		"ParseTimeout":          reflect.ValueOf(contextmanager.ParseTimeout),
+		"TaskDeadline":          reflect.ValueOf(contextmanager.TaskDeadline),
 
 		// type definitions
 		"ContextManager": reflect.ValueOf((*contextmanager.ContextManager)(nil)),
@@ -14,6 +14,7 @@ func init() {
 		"AppConfig":             reflect.ValueOf(&global.AppConfig).Elem(),
 		"ConfigDir":             reflect.ValueOf(&global.ConfigDir).Elem(),
 		"ConfigPath":            reflect.ValueOf(&global.ConfigPath).Elem(),
+		"Connect":               reflect.ValueOf(global.Connect),
 		"CustomMapParameter":    reflect.ValueOf(&global.CustomMapParameter).Elem(),
 		"CustomParameter":       reflect.ValueOf(&global.CustomParameter).Elem(),
 		"DatabaseEnabled":       reflect.ValueOf(&global.DatabaseEnabled).Elem(),
@@ -28,6 +29,7 @@ func init() {
 		"Projects":              reflect.ValueOf(&global.Projects).Elem(),
 		"ScanModule":            reflect.ValueOf(&global.ScanModule).Elem(),
 		"SensitiveRules":        reflect.ValueOf(&global.SensitiveRules).Elem(),
+		"Standalone":            reflect.ValueOf(&global.Standalone).Elem(),
 		"SubdomainTakerFingers": reflect.ValueOf(&global.SubdomainTakerFingers).Elem(),
 		"TakeoverFinger":        reflect.ValueOf(&global.TakeoverFinger).Elem(),
 		"TmpCustomMapParameter": reflect.ValueOf(&global.TmpCustomMapParameter).Elem(),
@@ -36,8 +38,12 @@ func init() {
 		"WebFingers":            reflect.ValueOf(&global.WebFingers).Elem(),
 
 		// type definitions
+		"AdminConfig":   reflect.ValueOf((*global.AdminConfig)(nil)),
 		"Config":        reflect.ValueOf((*global.Config)(nil)),
 		"MongoDBConfig": reflect.ValueOf((*global.MongoDBConfig)(nil)),
 		"RedisConfig":   reflect.ValueOf((*global.RedisConfig)(nil)),
+		"ResultConfig":  reflect.ValueOf((*global.ResultConfig)(nil)),
+		"TLSConfig":     reflect.ValueOf((*global.TLSConfig)(nil)),
+		"UpdateConfig":  reflect.ValueOf((*global.UpdateConfig)(nil)),
 	}
 }
@@ -4,11 +4,15 @@ package symbols
 
 import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"reflect"
 )
 
 func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces/interfaces"] = map[string]reflect.Value{
+		// function, constant and variable definitions
+		"ErrInputType": reflect.ValueOf(&interfaces.ErrInputType).Elem(),
+
 		// type definitions
 		"ModuleRunner": reflect.ValueOf((*interfaces.ModuleRunner)(nil)),
 		"Plugin":       reflect.ValueOf((*interfaces.Plugin)(nil)),
@@ -23,16 +27,21 @@ func init() {
 type _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner struct {
 	IValue      interface{}
 	WCloseInput func()
-	WGetInput   func() chan interface{}
+	WConsumes   func() []types.Kind
+	WGetInput   func() chan types.Message
 	WGetName    func() string
 	WModuleRun  func() error
-	WSetInput   func(a0 chan interface{})
+	WProduces   func() []types.Kind
+	WSetInput   func(a0 chan types.Message)
 }
 
 func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) CloseInput() {
 	W.WCloseInput()
 }
-func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) GetInput() chan interface{} {
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) Consumes() []types.Kind {
+	return W.WConsumes()
+}
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) GetInput() chan types.Message {
 	return W.WGetInput()
 }
 func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) GetName() string {
@@ -41,7 +50,10 @@ func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner)
 func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) ModuleRun() error {
 	return W.WModuleRun()
 }
-func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) SetInput(a0 chan interface{}) {
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) Produces() []types.Kind {
+	return W.WProduces()
+}
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_interfaces_ModuleRunner) SetInput(a0 chan types.Message) {
 	W.WSetInput(a0)
 }
 
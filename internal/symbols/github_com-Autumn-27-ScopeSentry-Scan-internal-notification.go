@@ -10,6 +10,8 @@ import (
 func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/notification/notification"] = map[string]reflect.Value{
 		// function, constant and variable definitions
+		"Backlog":                reflect.ValueOf(notification.Backlog),
+		"Flush":                  reflect.ValueOf(notification.Flush),
 		"InitializeNotification": reflect.ValueOf(notification.InitializeNotification),
 		"NotificationQueues":     reflect.ValueOf(&notification.NotificationQueues).Elem(),
 
@@ -11,6 +11,8 @@ func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/options/options"] = map[string]reflect.Value{
 		// type definitions
 		"PluginOption": reflect.ValueOf((*options.PluginOption)(nil)),
+		"RetryPolicy":  reflect.ValueOf((*options.RetryPolicy)(nil)),
+		"Schedule":     reflect.ValueOf((*options.Schedule)(nil)),
 		"TaskOptions":  reflect.ValueOf((*options.TaskOptions)(nil)),
 	}
 }
@@ -11,10 +11,15 @@ func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/pool/pool"] = map[string]reflect.Value{
 		// function, constant and variable definitions
 		"Initialize":      reflect.ValueOf(pool.Initialize),
+		"NewFairQueue":    reflect.ValueOf(pool.NewFairQueue),
 		"PoolManage":      reflect.ValueOf(&pool.PoolManage).Elem(),
 		"StartMonitoring": reflect.ValueOf(pool.StartMonitoring),
+		"TaskQueue":       reflect.ValueOf(&pool.TaskQueue).Elem(),
 
 		// type definitions
-		"Manager": reflect.ValueOf((*pool.Manager)(nil)),
+		"FairQueue":  reflect.ValueOf((*pool.FairQueue)(nil)),
+		"Manager":    reflect.ValueOf((*pool.Manager)(nil)),
+		"PoolStat":   reflect.ValueOf((*pool.PoolStat)(nil)),
+		"TaskStatus": reflect.ValueOf((*pool.TaskStatus)(nil)),
 	}
 }
@@ -4,23 +4,66 @@ package symbols
 
 import (
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"go/constant"
+	"go/token"
 	"reflect"
 )
 
 func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/results/results"] = map[string]reflect.Value{
 		// function, constant and variable definitions
+		"Backlog":               reflect.ValueOf(results.Backlog),
 		"Close":                 reflect.ValueOf(results.Close),
+		"DeadLetters":           reflect.ValueOf(&results.DeadLetters).Elem(),
 		"Duplicate":             reflect.ValueOf(&results.Duplicate).Elem(),
+		"Enqueue":               reflect.ValueOf(results.Enqueue),
+		"Findings":              reflect.ValueOf(&results.Findings).Elem(),
 		"Handler":               reflect.ValueOf(&results.Handler).Elem(),
 		"InitializeDuplicate":   reflect.ValueOf(results.InitializeDuplicate),
 		"InitializeHandler":     reflect.ValueOf(results.InitializeHandler),
 		"InitializeResultQueue": reflect.ValueOf(results.InitializeResultQueue),
 		"InitializeResults":     reflect.ValueOf(results.InitializeResults),
+		"InitializeSinks":       reflect.ValueOf(results.InitializeSinks),
+		"NewJsonlSink":          reflect.ValueOf(results.NewJsonlSink),
+		"ResubmitDeadLetters":   reflect.ValueOf(results.ResubmitDeadLetters),
 		"ResultQueues":          reflect.ValueOf(&results.ResultQueues).Elem(),
 		"Results":               reflect.ValueOf(&results.Results).Elem(),
+		"SeverityRank":          reflect.ValueOf(results.SeverityRank),
+		"SinkJsonl":             reflect.ValueOf(constant.MakeFromLiteral("\"jsonl\"", token.STRING, 0)),
+		"SinkMongoDB":           reflect.ValueOf(constant.MakeFromLiteral("\"mongodb\"", token.STRING, 0)),
+		"Sinks":                 reflect.ValueOf(&results.Sinks).Elem(),
+		"Sync":                  reflect.ValueOf(results.Sync),
+		"WriteStats":            reflect.ValueOf(&results.WriteStats).Elem(),
 
 		// type definitions
+		"BatchError":  reflect.ValueOf((*results.BatchError)(nil)),
 		"ResultQueue": reflect.ValueOf((*results.ResultQueue)(nil)),
+		"ResultSink":  reflect.ValueOf((*results.ResultSink)(nil)),
+
+		// interface wrapper definitions
+		"_ResultSink": reflect.ValueOf((*_github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink)(nil)),
 	}
 }
+
+// _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink is an interface wrapper for ResultSink type
+type _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink struct {
+	IValue  interface{}
+	WClose  func() error
+	WInsert func(collection string, docs []interface{}) error
+	WName   func() string
+	WUpdate func(collection string, operations []types.BulkUpdateOperation, upsert bool) error
+}
+
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink) Close() error {
+	return W.WClose()
+}
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink) Insert(collection string, docs []interface{}) error {
+	return W.WInsert(collection, docs)
+}
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink) Name() string {
+	return W.WName()
+}
+func (W _github_com_Autumn_27_ScopeSentry_Scan_internal_results_ResultSink) Update(collection string, operations []types.BulkUpdateOperation, upsert bool) error {
+	return W.WUpdate(collection, operations, upsert)
+}
@@ -9,6 +9,27 @@ import (
 
 func init() {
 	Symbols["github.com/Autumn-27/ScopeSentry-Scan/internal/types/types"] = map[string]reflect.Value{
+		// function, constant and variable definitions
+		"DecodePayload":         reflect.ValueOf(types.DecodePayload),
+		"KindAssetHttp":         reflect.ValueOf(types.KindAssetHttp),
+		"KindAssetHttpBatch":    reflect.ValueOf(types.KindAssetHttpBatch),
+		"KindAssetOther":        reflect.ValueOf(types.KindAssetOther),
+		"KindAssetOtherBatch":   reflect.ValueOf(types.KindAssetOtherBatch),
+		"KindCrawler":           reflect.ValueOf(types.KindCrawler),
+		"KindCrawlerBatch":      reflect.ValueOf(types.KindCrawlerBatch),
+		"KindDir":               reflect.ValueOf(types.KindDir),
+		"KindDomainResolve":     reflect.ValueOf(types.KindDomainResolve),
+		"KindDomainSkip":        reflect.ValueOf(types.KindDomainSkip),
+		"KindMappingBatch":      reflect.ValueOf(types.KindMappingBatch),
+		"KindPortAlive":         reflect.ValueOf(types.KindPortAlive),
+		"KindSubdomain":         reflect.ValueOf(types.KindSubdomain),
+		"KindSubdomainTakeover": reflect.ValueOf(types.KindSubdomainTakeover),
+		"KindTarget":            reflect.ValueOf(types.KindTarget),
+		"KindUrl":               reflect.ValueOf(types.KindUrl),
+		"KindUrlList":           reflect.ValueOf(types.KindUrlList),
+		"KindVuln":              reflect.ValueOf(types.KindVuln),
+		"NewMessage":            reflect.ValueOf(types.NewMessage),
+
 		// type definitions
 		"AssetChangeLog":       reflect.ValueOf((*types.AssetChangeLog)(nil)),
 		"AssetHttp":            reflect.ValueOf((*types.AssetHttp)(nil)),
@@ -23,6 +44,9 @@ func init() {
 		"HttpResponse":         reflect.ValueOf((*types.HttpResponse)(nil)),
 		"HttpSample":           reflect.ValueOf((*types.HttpSample)(nil)),
 		"KatanaResult":         reflect.ValueOf((*types.KatanaResult)(nil)),
+		"Kind":                 reflect.ValueOf((*types.Kind)(nil)),
+		"MappingBatch":         reflect.ValueOf((*types.MappingBatch)(nil)),
+		"Message":              reflect.ValueOf((*types.Message)(nil)),
 		"NotificationApi":      reflect.ValueOf((*types.NotificationApi)(nil)),
 		"NotificationConfig":   reflect.ValueOf((*types.NotificationConfig)(nil)),
 		"PageMonit":            reflect.ValueOf((*types.PageMonit)(nil)),
@@ -31,6 +55,7 @@ func init() {
 		"PortAlive":            reflect.ValueOf((*types.PortAlive)(nil)),
 		"PortDict":             reflect.ValueOf((*types.PortDict)(nil)),
 		"Project":              reflect.ValueOf((*types.Project)(nil)),
+		"ScopeRules":           reflect.ValueOf((*types.ScopeRules)(nil)),
 		"SecretResults":        reflect.ValueOf((*types.SecretResults)(nil)),
 		"SensitiveResult":      reflect.ValueOf((*types.SensitiveResult)(nil)),
 		"SensitiveRule":        reflect.ValueOf((*types.SensitiveRule)(nil)),
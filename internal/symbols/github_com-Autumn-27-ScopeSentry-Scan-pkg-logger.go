@@ -12,6 +12,7 @@ func init() {
 		// function, constant and variable definitions
 		"GetTimeNow":           reflect.ValueOf(logger.GetTimeNow),
 		"NewLogger":            reflect.ValueOf(logger.NewLogger),
+		"PluginLogTail":        reflect.ValueOf(logger.PluginLogTail),
 		"PluginsLog":           reflect.ValueOf(logger.PluginsLog),
 		"SendLogToRedis":       reflect.ValueOf(logger.SendLogToRedis),
 		"SendPluginLogToRedis": reflect.ValueOf(logger.SendPluginLogToRedis),
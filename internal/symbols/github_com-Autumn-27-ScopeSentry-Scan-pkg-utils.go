@@ -17,6 +17,7 @@ func init() {
 		"InitializeRequests": reflect.ValueOf(utils.InitializeRequests),
 		"InitializeResults":  reflect.ValueOf(utils.InitializeResults),
 		"InitializeTools":    reflect.ValueOf(utils.InitializeTools),
+		"Processes":          reflect.ValueOf(&utils.Processes).Elem(),
 		"Requests":           reflect.ValueOf(&utils.Requests).Elem(),
 		"Results":            reflect.ValueOf(&utils.Results).Elem(),
 		"SizeThreshold":      reflect.ValueOf(&utils.SizeThreshold).Elem(),
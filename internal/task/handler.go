@@ -9,19 +9,25 @@ package task
 
 import (
 	"fmt"
-	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
-	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
-	"github.com/Autumn-27/ScopeSentry-Scan/internal/runner"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"strings"
 	"sync"
-	"time"
 )
 
+// DeletePebbleTarget 删除运行完毕的目标，目标的结果持久化到预写日志后才删除，否则重启后重新运行该目标
+// 模块同步调用结果处理，目标运行完毕时结果都已经写入预写日志
 func DeletePebbleTarget(PebbleStore *pebbledb.PebbleDB, targetKey []byte) {
-	err := PebbleStore.Delete(targetKey)
+	err := results.Sync()
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("result wal sync error, keep target %v: %v", string(targetKey), err))
+		return
+	}
+	err = PebbleStore.Delete(targetKey)
 	if err != nil {
 		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete error: %v", err))
 	}
@@ -40,40 +46,18 @@ func RunPebbleTarget(runnerOption options.TaskOptions) {
 		return
 	}
 	for idTarget, _ := range targets {
-		wg.Add(1)
 		// 创建 runnerOption 的副本
 		optionCopy := runnerOption
 		target := strings.SplitN(idTarget, ":", 2)
 		optionCopy.Target = target[1]
-		// 使用局部变量创建闭包
-		taskFunc := func(op options.TaskOptions) func() {
-			return func() {
-				defer wg.Done()
-				select {
-				case <-contextmanager.GlobalContextManagers.GetContext(op.ID).Done():
-					// 任务取消直接返回
-					return
-				default:
-					err := runner.Run(op)
-					if err != nil {
-						// 说明该任务取消了，直接返回不进行删除目标
-						return
-					} else {
-						// 目标运行完毕删除目标
-						DeletePebbleTarget(pebbledb.PebbleStore, []byte(op.ID+":"+op.Target))
-					}
-				}
-			}
-		}(optionCopy)
-
-		// 提交任务
-		err := pool.PoolManage.SubmitTask("task", taskFunc)
-		if err != nil {
-			logger.SlogError(fmt.Sprintf("task pool error: %v", err))
-			// 如果提交任务失败，手动减少计数
-			wg.Done()
-		}
+		submitTarget(optionCopy, &wg)
 	}
-	time.Sleep(3 * time.Second)
 	wg.Wait()
+	// 重试的目标放回 redis 后继续获取
+	for requeued(runnerOption) {
+		popTargets(runnerOption, &wg)
+		wg.Wait()
+	}
+	pipeline.PluginStats.EndTask(runnerOption.ID)
+	scope.Drops.EndTask(runnerOption.ID)
 }
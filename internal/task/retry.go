@@ -0,0 +1,218 @@
+// task-------------------------------------
+// @file      : retry.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/6 21:03
+// -------------------------------------------
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/runner"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxRetryDelay 重试等待时间的上限
+const maxRetryDelay = 24 * time.Hour
+
+// retryRecord 等待重试的目标，保存在 pebble 的 retry:<任务ID>:<目标>，节点重启后继续等待
+type retryRecord struct {
+	Attempts int    `json:"attempts"` // 已经重试的次数，包含等待中的这一次
+	Class    string `json:"class"`
+	NextRun  string `json:"nextRun"`
+}
+
+func retryKey(op options.TaskOptions) []byte {
+	return []byte(fmt.Sprintf("retry:%v:%v", op.ID, op.Target))
+}
+
+func loadRetry(op options.TaskOptions) (retryRecord, bool) {
+	var record retryRecord
+	data, err := pebbledb.PebbleStore.Get(retryKey(op))
+	if err != nil || len(data) == 0 {
+		return record, false
+	}
+	return record, json.Unmarshal(data, &record) == nil
+}
+
+func deleteRetry(op options.TaskOptions) {
+	_ = pebbledb.PebbleStore.Delete(retryKey(op))
+}
+
+// validateRetry 检查重试策略的失败类型和等待时间
+func validateRetry(policy *options.RetryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAttempts < 0 || policy.Multiplier < 0 {
+		return fmt.Errorf("retry maxAttempts and multiplier must not be negative")
+	}
+	for class, value := range policy.Backoff {
+		known := false
+		for _, c := range pipeline.FailureClasses {
+			if c == class {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown retry failure class %v", class)
+		}
+		if _, err := contextmanager.ParseTimeout(value); err != nil {
+			return fmt.Errorf("retry backoff %v: %v", class, err)
+		}
+	}
+	return nil
+}
+
+// retryDelay 目标下一次重试前的等待时间，重试次数用完或失败类型没有设置等待时间时不重试
+func retryDelay(policy *options.RetryPolicy, class string, attempts int) (time.Duration, bool) {
+	if policy == nil || attempts >= policy.MaxAttempts {
+		return 0, false
+	}
+	value, ok := policy.Backoff[class]
+	if !ok {
+		return 0, false
+	}
+	delay, err := contextmanager.ParseTimeout(value)
+	if err != nil {
+		return 0, false
+	}
+	multiplier := policy.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	backoff := float64(delay) * math.Pow(multiplier, float64(attempts))
+	if backoff > float64(maxRetryDelay) {
+		return maxRetryDelay, true
+	}
+	return time.Duration(backoff), true
+}
+
+// retryAttempts 目标已经重试的次数，本地没有记录时使用 redis 中其他节点记录的次数
+func retryAttempts(op options.TaskOptions) int {
+	if record, ok := loadRetry(op); ok {
+		return record.Attempts
+	}
+	return handler.TaskHandle.TargetAttempts(op.Target, op.ID)
+}
+
+// submitTarget 提交目标到任务队列，等待重试的目标到达重试时间后再提交
+func submitTarget(op options.TaskOptions, wg *sync.WaitGroup) {
+	if record, ok := loadRetry(op); ok {
+		if next, err := time.Parse(time.RFC3339, record.NextRun); err == nil && time.Until(next) > 0 {
+			waitRetry(op, time.Until(next), wg)
+			return
+		}
+	}
+	// 提交任务，在提交前计数，保证 wg.Wait 时所有目标都已计数
+	wg.Add(1)
+	err := pool.TaskQueue.Submit(op.ID, func() {
+		runTarget(op, wg)
+	})
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("task pool error: %v", err))
+		wg.Done()
+	}
+}
+
+// runTarget 运行一个目标，任务取消时保留本地目标，重启或任务重新开始后重新运行
+func runTarget(op options.TaskOptions, wg *sync.WaitGroup) {
+	defer wg.Done()
+	select {
+	case <-contextmanager.GlobalContextManagers.GetContext(op.ID).Done():
+		// 任务取消直接返回，任务超过截止时间时标记为部分完成
+		skipTarget(op)
+		return
+	default:
+	}
+	outcome, err := runner.Run(op)
+	if err != nil {
+		// 说明该任务取消了，直接返回不进行删除目标
+		return
+	}
+	attempts := retryAttempts(op)
+	if outcome.Status != pipeline.OutcomeSuccess {
+		if delay, ok := retryDelay(op.Retry, outcome.Class, attempts); ok {
+			scheduleRetry(op, outcome, attempts+1, delay, wg)
+			return
+		}
+	}
+	finishTarget(op, outcome, attempts)
+}
+
+// finishTarget 目标不再重试，记录最终结果后删除目标
+func finishTarget(op options.TaskOptions, outcome pipeline.Outcome, attempts int) {
+	runner.Finish(op, outcome)
+	handler.TaskHandle.TargetOutcome(op.Target, op.ID, outcome, attempts, "")
+	deleteRetry(op)
+	// 目标运行完毕删除目标
+	DeletePebbleTarget(pebbledb.PebbleStore, []byte(op.ID+":"+op.Target))
+}
+
+// scheduleRetry 保存重试记录，等待结束后重新运行目标，本地目标保留到重试结束
+func scheduleRetry(op options.TaskOptions, outcome pipeline.Outcome, attempt int, delay time.Duration, wg *sync.WaitGroup) {
+	next := time.Now().Add(delay).Format(time.RFC3339)
+	data, err := json.Marshal(retryRecord{Attempts: attempt, Class: outcome.Class, NextRun: next})
+	if err == nil {
+		err = pebbledb.PebbleStore.Put(retryKey(op), data)
+	}
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("save retry %v %v error: %v", op.ID, op.Target, err))
+	}
+	logger.SlogInfo(fmt.Sprintf("target %v %v (%v), retry %v/%v in %v", op.Target, outcome.Status, outcome.Class, attempt, op.Retry.MaxAttempts, delay))
+	handler.TaskHandle.TargetOutcome(op.Target, op.ID, outcome, attempt, next)
+	waitRetry(op, delay, wg)
+}
+
+// waitRetry 等待结束后在本节点重新提交目标，或放回 redis 由任意节点运行
+// 任务取消时停止等待，目标和重试记录保留在本地，任务超过截止时间时目标不再重试
+func waitRetry(op options.TaskOptions, delay time.Duration, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx := contextmanager.GlobalContextManagers.GetContext(op.ID)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			if contextmanager.DeadlineExceeded(ctx) {
+				record, _ := loadRetry(op)
+				outcome := pipeline.Outcome{Status: pipeline.OutcomePartial, Class: pipeline.FailureDeadline, Reason: "task deadline before retry"}
+				finishTarget(op, outcome, record.Attempts)
+			}
+			return
+		case <-timer.C:
+		}
+		if op.Retry != nil && op.Retry.Redistribute {
+			requeueTarget(op)
+			return
+		}
+		submitTarget(op, wg)
+	}()
+}
+
+// requeueTarget 将目标放回任务的 redis 列表，删除本地目标和重试记录，重试次数记录在 TaskInfo:retry:<任务ID> 中
+func requeueTarget(op options.TaskOptions) {
+	_, err := redis.RedisClient.AddToList(context.Background(), "TaskInfo:"+op.ID, op.Target)
+	if err != nil {
+		// 放回失败时保留本地目标，重启后在本节点重试
+		logger.SlogError(fmt.Sprintf("requeue target %v %v error: %v", op.ID, op.Target, err))
+		return
+	}
+	deleteRetry(op)
+	DeletePebbleTarget(pebbledb.PebbleStore, []byte(op.ID+":"+op.Target))
+}
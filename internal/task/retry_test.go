@@ -0,0 +1,79 @@
+// task-------------------------------------
+// @file      : retry_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/12 20:18
+// -------------------------------------------
+
+package task
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := &options.RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: map[string]string{
+			pipeline.FailureNetwork: "1m",
+			pipeline.FailureTimeout: "10h",
+			pipeline.FailureError:   "bad",
+		},
+	}
+	tripled := &options.RetryPolicy{
+		MaxAttempts: 2,
+		Backoff:     map[string]string{pipeline.FailureNetwork: "1m"},
+		Multiplier:  3,
+	}
+	tests := []struct {
+		name     string
+		policy   *options.RetryPolicy
+		class    string
+		attempts int
+		delay    time.Duration
+		ok       bool
+	}{
+		{name: "no policy", policy: nil, class: pipeline.FailureNetwork},
+		{name: "first retry", policy: policy, class: pipeline.FailureNetwork, attempts: 0, delay: time.Minute, ok: true},
+		{name: "default multiplier", policy: policy, class: pipeline.FailureNetwork, attempts: 2, delay: 4 * time.Minute, ok: true},
+		{name: "attempts used up", policy: policy, class: pipeline.FailureNetwork, attempts: 3},
+		{name: "class without backoff", policy: policy, class: pipeline.FailurePanic},
+		{name: "invalid backoff", policy: policy, class: pipeline.FailureError},
+		{name: "capped", policy: policy, class: pipeline.FailureTimeout, attempts: 2, delay: maxRetryDelay, ok: true},
+		{name: "multiplier", policy: tripled, class: pipeline.FailureNetwork, attempts: 1, delay: 3 * time.Minute, ok: true},
+		{name: "multiplier attempts used up", policy: tripled, class: pipeline.FailureNetwork, attempts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := retryDelay(tt.policy, tt.class, tt.attempts)
+			if delay != tt.delay || ok != tt.ok {
+				t.Fatalf("retryDelay() = %v, %v, want %v, %v", delay, ok, tt.delay, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *options.RetryPolicy
+		err    bool
+	}{
+		{name: "nil"},
+		{name: "valid", policy: &options.RetryPolicy{MaxAttempts: 2, Backoff: map[string]string{pipeline.FailureNetwork: "30s"}}},
+		{name: "negative attempts", policy: &options.RetryPolicy{MaxAttempts: -1}, err: true},
+		{name: "negative multiplier", policy: &options.RetryPolicy{Multiplier: -2}, err: true},
+		{name: "unknown class", policy: &options.RetryPolicy{Backoff: map[string]string{"dns": "1m"}}, err: true},
+		{name: "invalid backoff", policy: &options.RetryPolicy{Backoff: map[string]string{pipeline.FailureTimeout: "soon"}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateRetry(tt.policy); (err != nil) != tt.err {
+				t.Fatalf("validateRetry() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// task-------------------------------------
+// @file      : schedule.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/27 21:48
+// -------------------------------------------
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/schedule"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 定时任务每次运行时将记录的所有目标重新写入 <任务ID>:<目标>，按本地缓存任务的方式运行
+const scheduleTick = 10 * time.Second
+
+// scheduleRecord 本地保存的定时任务
+type scheduleRecord struct {
+	Task    string    `json:"task"` // 任务的原始配置
+	NextRun time.Time `json:"nextRun"`
+	LastRun time.Time `json:"lastRun"`
+	Queued  bool      `json:"queued"` // 上次运行结束后立即运行
+}
+
+// scheduleTask 解析定时任务的配置
+type scheduleTask struct {
+	option  options.TaskOptions
+	cron    *schedule.Cron
+	jitter  time.Duration
+	overlap string
+}
+
+func parseScheduleTask(taskInfo string) (*scheduleTask, error) {
+	var st scheduleTask
+	err := json.Unmarshal([]byte(taskInfo), &st.option)
+	if err != nil {
+		return nil, err
+	}
+	if st.option.Schedule == nil {
+		return nil, fmt.Errorf("task %v has no schedule", st.option.ID)
+	}
+	if st.option.Type == "page_monitoring" {
+		return nil, fmt.Errorf("page monitoring task %v can not be scheduled", st.option.ID)
+	}
+	st.cron, err = schedule.ParseCron(st.option.Schedule.Cron)
+	if err != nil {
+		return nil, err
+	}
+	st.jitter, err = schedule.ParseJitter(st.option.Schedule.Jitter)
+	if err != nil {
+		return nil, err
+	}
+	st.overlap, err = schedule.ParseOverlap(st.option.Schedule.Overlap)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// AddSchedule 保存任务的定时配置，重新下发的任务从当前时间开始计算下一次运行时间
+func AddSchedule(taskInfo string, runnerOption options.TaskOptions) {
+	if runnerOption.Schedule == nil {
+		return
+	}
+	st, err := parseScheduleTask(taskInfo)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("task %v schedule invalid: %v", runnerOption.ID, err))
+		return
+	}
+	record, _ := getSchedule(runnerOption.ID)
+	if record == nil {
+		record = &scheduleRecord{}
+	}
+	record.Task = taskInfo
+	record.NextRun = schedule.NextRun(st.cron, st.jitter, time.Now())
+	putSchedule(runnerOption.ID, record)
+	logger.SlogInfo(fmt.Sprintf("task %v schedule %v next run: %v", runnerOption.ID, runnerOption.Schedule.Cron, record.NextRun.Format(time.DateTime)))
+}
+
+// AddScheduleTarget 记录定时任务的目标，每次运行时重新扫描
+func AddScheduleTarget(runnerOption options.TaskOptions, target string) {
+	if runnerOption.Schedule == nil {
+		return
+	}
+	key := schedule.TargetPrefix(runnerOption.ID) + utils.Tools.CalculateMD5(target)
+	err := pebbledb.PebbleStore.PutNoSync([]byte(key), []byte(target))
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore put schedule target error: %v", err))
+	}
+}
+
+func getSchedule(id string) (*scheduleRecord, error) {
+	value, err := pebbledb.PebbleStore.Get(schedule.RecordKey(id))
+	if err != nil {
+		return nil, err
+	}
+	var record scheduleRecord
+	err = json.Unmarshal(value, &record)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func putSchedule(id string, record *scheduleRecord) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("marshal schedule %v error: %v", id, err))
+		return
+	}
+	err = pebbledb.PebbleStore.Put(schedule.RecordKey(id), value)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore put schedule %v error: %v", id, err))
+	}
+}
+
+// RunSchedules 按 cron 表达式重新运行定时任务，每次从本地读取定时配置，停止或删除任务后不再运行
+func RunSchedules() {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	// 等待本地缓存的任务恢复运行，启动时正在运行的任务按上次运行未结束处理
+	<-ticker.C
+	startup := true
+	for {
+		checkSchedules(startup)
+		startup = false
+		<-ticker.C
+	}
+}
+
+func checkSchedules(startup bool) {
+	// 节点正在停止，不再开始定时任务
+	if shutdown.Stopping() {
+		return
+	}
+	records, err := pebbledb.PebbleStore.GetKeysWithPrefix(schedule.RecordPrefix)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore get schedules error: %v", err))
+		return
+	}
+	now := time.Now()
+	var list []schedule.Status
+	for key, value := range records {
+		id := strings.TrimPrefix(key, schedule.RecordPrefix)
+		var record scheduleRecord
+		err = json.Unmarshal(value, &record)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("schedule %v parse error: %v", id, err))
+			schedule.Delete(id, false)
+			continue
+		}
+		st, err := parseScheduleTask(record.Task)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("schedule %v invalid: %v", id, err))
+			schedule.Delete(id, false)
+			continue
+		}
+		running := pool.TaskQueue.Running(id)
+		if record.Queued && !running {
+			record.Queued = false
+			if startScheduledRun(st) {
+				record.LastRun = now
+			}
+		} else if !record.NextRun.IsZero() && !record.NextRun.After(now) {
+			missed := record.NextRun
+			record.NextRun = schedule.NextRun(st.cron, st.jitter, now)
+			switch {
+			case startup && !st.option.Schedule.CatchUp:
+				// 节点停止期间错过的运行不补运行
+				logger.SlogInfoLocal(fmt.Sprintf("schedule %v skip missed run: %v", id, missed.Format(time.DateTime)))
+			case !running:
+				if startScheduledRun(st) {
+					record.LastRun = now
+				}
+			case st.overlap == schedule.OverlapQueue:
+				record.Queued = true
+			case st.overlap == schedule.OverlapCancel:
+				logger.SlogInfo(fmt.Sprintf("schedule %v cancel previous run", id))
+				contextmanager.GlobalContextManagers.CancelContext(id)
+				record.Queued = true
+			default:
+				logger.SlogInfo(fmt.Sprintf("schedule %v previous run is not finished, skip", id))
+			}
+		}
+		putSchedule(id, &record)
+		status := schedule.Status{
+			ID:      id,
+			Name:    st.option.TaskName,
+			Cron:    st.option.Schedule.Cron,
+			Running: pool.TaskQueue.Running(id),
+		}
+		if !record.NextRun.IsZero() {
+			status.NextRun = record.NextRun.Format(time.DateTime)
+		}
+		if !record.LastRun.IsZero() {
+			status.LastRun = record.LastRun.Format(time.DateTime)
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].NextRun < list[j].NextRun
+	})
+	schedule.SetStatuses(list)
+}
+
+// startScheduledRun 开始定时任务的一次运行，任务已经在运行时返回 false
+func startScheduledRun(st *scheduleTask) bool {
+	op := st.option
+	op.IsRestart = false
+	if !pool.TaskQueue.Register(op.ID, op.TaskName, op.Priority) {
+		return false
+	}
+	logger.SlogInfo(fmt.Sprintf("schedule task begin: %v", op.ID))
+	go func() {
+		defer pool.TaskQueue.Unregister(op.ID, taskIdle)
+		// 上次运行可能被取消，使用新的上下文
+		contextmanager.GlobalContextManagers.DeleteContext(op.ID)
+		// 每次运行重新计算任务的截止时间
+		contextmanager.DeleteDeadline(op.ID)
+		contextmanager.GlobalContextManagers.AddContextWithDeadline(op.ID, taskDeadline(op))
+		// 清除上次运行的检查点和去重记录，所有目标重新扫描
+		pipeline.ClearTaskCheckpoints(op.ID)
+		results.Duplicate.ResetTask(op.ID)
+		record, err := getSchedule(op.ID)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("schedule %v get error: %v", op.ID, err))
+			return
+		}
+		targets, err := pebbledb.PebbleStore.GetKeysWithPrefix(schedule.TargetPrefix(op.ID))
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("PebbleStore get schedule targets error: %v", err))
+			return
+		}
+		pairs := make(map[string]string, len(targets))
+		for _, target := range targets {
+			pairs[fmt.Sprintf("%v:%v", op.ID, string(target))] = ""
+		}
+		// 写入任务配置和目标，节点重启后按本地缓存任务继续运行
+		taskKey := fmt.Sprintf("task:%v", op.ID)
+		pairs[taskKey] = record.Task
+		err = pebbledb.PebbleStore.BatchWrite(pairs)
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("PebbleStore write schedule targets error: %v", err))
+			return
+		}
+		RunPebbleTarget(op)
+		contextmanager.GlobalContextManagers.DeleteContext(op.ID)
+		if shutdown.Stopping() {
+			logger.SlogInfo(fmt.Sprintf("schedule task interrupted by node shutdown: %v", op.ID))
+			return
+		}
+		err = pebbledb.PebbleStore.Delete([]byte(taskKey))
+		if err != nil {
+			logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete %v error: %v", taskKey, err))
+		}
+		contextmanager.DeleteDeadline(op.ID)
+		logger.SlogInfo(fmt.Sprintf("schedule task end: %v", op.ID))
+	}()
+	return true
+}
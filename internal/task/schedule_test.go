@@ -0,0 +1,178 @@
+// task-------------------------------------
+// @file      : schedule_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/11 21:40
+// -------------------------------------------
+
+package task
+
+import (
+	"encoding/json"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/schedule"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/cockroachdb/pebble"
+	"go.uber.org/zap"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	contextmanager.NewContextManager()
+	dir, err := os.MkdirTemp("", "task-test")
+	if err != nil {
+		panic(err)
+	}
+	pebbledb.PebbleStore, err = pebbledb.NewPebbleDB(&pebble.Options{}, dir)
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = pebbledb.PebbleStore.Close()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// putTestSchedule 保存定时任务的配置和记录，测试结束后删除
+func putTestSchedule(t *testing.T, id string, sc options.Schedule, record scheduleRecord) {
+	data, err := json.Marshal(options.TaskOptions{ID: id, TaskName: id, Schedule: &sc})
+	if err != nil {
+		t.Fatalf("marshal task error: %v", err)
+	}
+	record.Task = string(data)
+	putSchedule(id, &record)
+	t.Cleanup(func() { schedule.Delete(id, false) })
+}
+
+func TestCheckSchedulesOverlap(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	tests := []struct {
+		name     string
+		schedule options.Schedule
+		record   scheduleRecord
+		startup  bool
+		queued   bool // 检查后是否等待上次运行结束
+		canceled bool // 上次运行是否被取消
+		advanced bool // 下一次运行时间是否重新计算
+	}{
+		{
+			name:     "skip",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapSkip},
+			record:   scheduleRecord{NextRun: past},
+			advanced: true,
+		},
+		{
+			name:     "default skip",
+			schedule: options.Schedule{Cron: "@hourly"},
+			record:   scheduleRecord{NextRun: past},
+			advanced: true,
+		},
+		{
+			name:     "queue",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapQueue},
+			record:   scheduleRecord{NextRun: past},
+			queued:   true,
+			advanced: true,
+		},
+		{
+			name:     "cancel",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapCancel},
+			record:   scheduleRecord{NextRun: past},
+			queued:   true,
+			canceled: true,
+			advanced: true,
+		},
+		{
+			name:     "not due",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapCancel},
+			record:   scheduleRecord{NextRun: future},
+		},
+		{
+			name:     "queued waits for running",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapQueue},
+			record:   scheduleRecord{NextRun: future, Queued: true},
+			queued:   true,
+		},
+		{
+			name:     "startup without catch up",
+			schedule: options.Schedule{Cron: "@hourly", Overlap: schedule.OverlapQueue},
+			record:   scheduleRecord{NextRun: past},
+			startup:  true,
+			advanced: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "schedule-test-" + tt.name
+			putTestSchedule(t, id, tt.schedule, tt.record)
+			// 上次运行没有结束
+			if !pool.TaskQueue.Register(id, id, 1) {
+				t.Fatalf("Register(%v) = false", id)
+			}
+			defer pool.TaskQueue.Unregister(id, nil)
+			contextmanager.GlobalContextManagers.AddContext(id)
+			defer contextmanager.GlobalContextManagers.DeleteContext(id)
+
+			checkSchedules(tt.startup)
+
+			record, err := getSchedule(id)
+			if err != nil {
+				t.Fatalf("getSchedule() error: %v", err)
+			}
+			if record.Queued != tt.queued {
+				t.Errorf("Queued = %v, want %v", record.Queued, tt.queued)
+			}
+			if !record.LastRun.IsZero() {
+				t.Errorf("LastRun = %v, want not run", record.LastRun)
+			}
+			advanced := !record.NextRun.Equal(tt.record.NextRun)
+			if advanced != tt.advanced {
+				t.Errorf("NextRun = %v, want advanced %v", record.NextRun, tt.advanced)
+			}
+			if advanced && !record.NextRun.After(time.Now()) {
+				t.Errorf("NextRun = %v, want after now", record.NextRun)
+			}
+			select {
+			case <-contextmanager.GlobalContextManagers.GetContext(id).Done():
+				if !tt.canceled {
+					t.Error("previous run canceled, want running")
+				}
+			default:
+				if tt.canceled {
+					t.Error("previous run running, want canceled")
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSchedulesInvalid(t *testing.T) {
+	id := "schedule-test-invalid"
+	putSchedule(id, &scheduleRecord{Task: `{"ID":"schedule-test-invalid","Schedule":{"cron":"* *"}}`, NextRun: time.Now()})
+	target := schedule.TargetPrefix(id) + "a"
+	if err := pebbledb.PebbleStore.Put([]byte(target), []byte("a")); err != nil {
+		t.Fatalf("put target error: %v", err)
+	}
+	checkSchedules(false)
+	if _, err := getSchedule(id); err == nil {
+		t.Fatal("invalid schedule is kept, want deleted")
+	}
+	if _, err := pebbledb.PebbleStore.Get([]byte(target)); err == nil {
+		t.Fatal("invalid schedule target is kept, want deleted")
+	}
+	for _, status := range schedule.Statuses() {
+		if status.ID == id {
+			t.Fatalf("Statuses() contains invalid schedule %v", id)
+		}
+	}
+}
@@ -13,30 +13,38 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/bigcache"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pebbledb"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/redis"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/runner"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/modules"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	goRedis "github.com/redis/go-redis/v9"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
 
 func GetTask() {
+	// 定时任务
+	go RunSchedules()
 	// 运行本地缓存的任务
 	RunPebbledbTask()
 	// 从redis获取任务
 	RunRedisTask()
 }
 
-// RunPebbledbTask 运行本地缓存任务
+// RunPebbledbTask 运行本地缓存任务，所有任务同时运行
 func RunPebbledbTask() {
 	prefix := "task:"
 	keys, err := pebbledb.PebbleStore.GetKeysWithPrefix(prefix)
@@ -45,13 +53,13 @@ func RunPebbledbTask() {
 		os.Exit(0)
 	}
 	if len(keys) > 0 {
-		// 打印所有以 "task:" 开头的键值对
+		var wg sync.WaitGroup
 		for key, value := range keys {
 			logger.SlogInfoLocal(fmt.Sprintf("get PebbleStore task: %v", string(value)))
 			var runnerOption options.TaskOptions
 			err = utils.Tools.JSONToStruct(value, &runnerOption)
-			// 任务增加全局上下文
-			contextmanager.GlobalContextManagers.AddContext(runnerOption.ID)
+			// 任务增加全局上下文，继续使用重启前的截止时间
+			contextmanager.GlobalContextManagers.AddContextWithDeadline(runnerOption.ID, taskDeadline(runnerOption))
 			// 设置为本地获取的任务
 			runnerOption.IsRestart = true
 			if err != nil {
@@ -62,25 +70,63 @@ func RunPebbledbTask() {
 				}
 				continue
 			}
-			// 运行任务目标
-			RunPebbleTarget(runnerOption)
-			// 任务运行完毕删除任务
-			err = pebbledb.PebbleStore.Delete([]byte(key))
+			if runnerOption.Pipeline != nil {
+				err = modules.ValidateGraph(runnerOption.Pipeline)
+				if err != nil {
+					logger.SlogErrorLocal(fmt.Sprintf("task %v pipeline invalid: %v", runnerOption.ID, err))
+					err = pebbledb.PebbleStore.Delete([]byte(key))
+					if err != nil {
+						logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete error: %v", runnerOption.ID))
+					}
+					continue
+				}
+			}
+			err = scope.Validate(runnerOption.Scope)
 			if err != nil {
-				logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete %v error: %v", key, err))
+				logger.SlogErrorLocal(fmt.Sprintf("task %v scope invalid: %v", runnerOption.ID, err))
+				err = pebbledb.PebbleStore.Delete([]byte(key))
+				if err != nil {
+					logger.SlogErrorLocal(fmt.Sprintf("PebbleStore delete error: %v", runnerOption.ID))
+				}
+				continue
+			}
+			if !pool.TaskQueue.Register(runnerOption.ID, runnerOption.TaskName, runnerOption.Priority) {
+				continue
 			}
-			logger.SlogInfoLocal(fmt.Sprintf("PebbleStore task run end: %v", runnerOption.ID))
+			wg.Add(1)
+			go func(key string, runnerOption options.TaskOptions) {
+				defer wg.Done()
+				// 运行任务目标
+				RunPebbleTarget(runnerOption)
+				if shutdown.Stopping() {
+					pool.TaskQueue.Unregister(runnerOption.ID, nil)
+					return
+				}
+				// 任务运行完毕删除任务
+				err := pebbledb.PebbleStore.Delete([]byte(key))
+				if err != nil {
+					logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete %v error: %v", key, err))
+				}
+				contextmanager.DeleteDeadline(runnerOption.ID)
+				logger.SlogInfoLocal(fmt.Sprintf("PebbleStore task run end: %v", runnerOption.ID))
+				pool.TaskQueue.Unregister(runnerOption.ID, nil)
+			}(key, runnerOption)
 		}
+		wg.Wait()
 		// 关闭nuclei引擎
 		handler.CloseNucleiEngine()
 	}
 }
 
-// RunRedisTask 从redis中获取任务
+// RunRedisTask 从redis中获取任务，同时运行的任务数量不超过 maxTaskCount，优先运行优先级高的任务
 func RunRedisTask() {
 	ticker := time.Tick(3 * time.Second)
 	for {
 		<-ticker
+		// 节点正在停止，不再获取新任务
+		if shutdown.Stopping() {
+			continue
+		}
 		TaskNodeName := "NodeTask:" + global.AppConfig.NodeName
 		exists, err := redis.RedisClient.Exists(context.Background(), TaskNodeName)
 
@@ -88,141 +134,299 @@ func RunRedisTask() {
 			logger.SlogError(fmt.Sprintf("GetTask Error: %v", err))
 			continue
 		}
-		if exists {
-			var wg sync.WaitGroup
-
-			taskInfo, err := redis.RedisClient.GetFirstFromList(context.Background(), TaskNodeName)
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("GetTask info error: %v", err))
-				continue
-			}
-			logger.SlogInfo(fmt.Sprintf("Get a new task: %v", taskInfo))
+		if !exists || pool.TaskQueue.Len() >= config.ModulesConfig.GetMaxTaskCount() {
+			continue
+		}
+		taskInfos, err := redis.RedisClient.LRange(context.Background(), TaskNodeName, 0, -1)
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("GetTask info error: %v", err))
+			continue
+		}
+		var waiting []redisTask
+		for _, taskInfo := range taskInfos {
 			var runnerOption options.TaskOptions
 			err = json.Unmarshal([]byte(taskInfo), &runnerOption)
 			if err != nil {
 				logger.SlogError(fmt.Sprintf("Task parse error: %s", err))
 				continue
 			}
-			// 将任务配置写入本地
-			runnerOption.IsRestart = false
-			taskKey := fmt.Sprintf("task:%v", runnerOption.ID)
-			err = pebbledb.PebbleStore.Put([]byte(taskKey), []byte(taskInfo))
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("PebbleStore.Put Task error: %s", err))
+			waiting = append(waiting, redisTask{info: taskInfo, option: runnerOption})
+		}
+		// 优先级相同时按下发顺序运行
+		sort.SliceStable(waiting, func(i, j int) bool {
+			return waiting[i].option.Priority > waiting[j].option.Priority
+		})
+		for _, t := range waiting {
+			if pool.TaskQueue.Len() >= config.ModulesConfig.GetMaxTaskCount() {
+				break
+			}
+			if !pool.TaskQueue.Register(t.option.ID, t.option.TaskName, t.option.Priority) {
+				// 任务已经在运行
 				continue
 			}
-			logger.SlogInfo(fmt.Sprintf("Task begin: %v", runnerOption.ID))
-			if runnerOption.Type == "page_monitoring" {
-				// 运行页面监控程序
-				go func() {
-					for {
-						targets, err := redis.RedisClient.BatchGetAndDelete(context.Background(), "TaskInfo:"+runnerOption.ID, 50)
-						if len(targets) == 0 {
-							break
-						}
-						if err != nil {
-							// 如果 err 不为空，并且不是 redis.Nil 错误，则打印错误信息
-							if !errors.Is(err, goRedis.Nil) {
-								logger.SlogError(fmt.Sprintf("GetRedisTask BatchGetAndDelete error: %v", err))
-								// 如果获取任务出错了 直接退出 防止删除本地任务 重启之后重新获取本地任务开始执行
-								os.Exit(0)
-							}
-							break
-						}
-						runner.PageMonitoringRunner(targets)
-					}
-				}()
-			} else {
-				// 任务增加全局上下文
-				contextmanager.GlobalContextManagers.AddContext(runnerOption.ID)
-				if runnerOption.Type == "start" {
-					runnerOption.IsRestart = false
-					// 如果任务是暂停后开始的，则先运行本地缓存的目标
-					go func() {
-						logger.SlogInfoLocal(fmt.Sprintf("[stop to start]task start run pebbledb: %v", runnerOption.ID))
-						RunPebbleTarget(runnerOption)
-						logger.SlogInfoLocal(fmt.Sprintf("[stop to start]task end run pebbledb: %v", runnerOption.ID))
-					}()
+			logger.SlogInfo(fmt.Sprintf("Get a new task: %v", t.info))
+			go RunTask(t.info, t.option)
+		}
+	}
+}
+
+// redisTask 节点任务列表中的任务
+type redisTask struct {
+	info   string
+	option options.TaskOptions
+}
+
+// RunTask 运行从 redis 获取的任务，调用前需要在 pool.TaskQueue 中注册任务
+func RunTask(taskInfo string, runnerOption options.TaskOptions) {
+	// 任务结束后如果没有其他任务在运行，关闭nuclei引擎、重新初始化缓存、清除全局变量
+	defer pool.TaskQueue.Unregister(runnerOption.ID, taskIdle)
+	var wg sync.WaitGroup
+	// 检查任务的扫描流程图，流程图错误的任务无法运行，直接弹出
+	if runnerOption.Pipeline != nil {
+		err := modules.ValidateGraph(runnerOption.Pipeline)
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("Task %v pipeline invalid: %v", runnerOption.ID, err))
+			_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+			return
+		}
+	}
+	// 扫描范围规则错误时可能扩大扫描范围，任务不运行
+	err := scope.Validate(runnerOption.Scope)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("Task %v scope invalid: %v", runnerOption.ID, err))
+		_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+		return
+	}
+	err = validateTimeouts(runnerOption)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("Task %v timeout invalid: %v", runnerOption.ID, err))
+		_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+		return
+	}
+	err = validateRetry(runnerOption.Retry)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("Task %v retry invalid: %v", runnerOption.ID, err))
+		_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+		return
+	}
+	if runnerOption.DryRun {
+		dryRunTask(runnerOption)
+		return
+	}
+	// 节点无法运行任务使用的插件或缺少任务要求的能力标签时拒绝任务
+	if rejection := modules.CheckCapability(runnerOption); rejection != nil {
+		rejectTask(rejection)
+		return
+	}
+	// 将任务配置写入本地
+	runnerOption.IsRestart = false
+	taskKey := fmt.Sprintf("task:%v", runnerOption.ID)
+	err = pebbledb.PebbleStore.Put([]byte(taskKey), []byte(taskInfo))
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("PebbleStore.Put Task error: %s", err))
+		return
+	}
+	// 保存定时配置，任务结束后按 cron 表达式重新运行
+	AddSchedule(taskInfo, runnerOption)
+	logger.SlogInfo(fmt.Sprintf("Task begin: %v", runnerOption.ID))
+	if runnerOption.Type == "page_monitoring" {
+		// 运行页面监控程序，运行结束后才弹出任务
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				targets, err := redis.RedisClient.BatchGetAndDelete(context.Background(), "TaskInfo:"+runnerOption.ID, 50)
+				if len(targets) == 0 {
+					break
 				}
-			loop:
-				for {
-					select {
-					case <-contextmanager.GlobalContextManagers.GetContext(runnerOption.ID).Done():
-						break loop
-					default:
-						target, err := redis.RedisClient.PopFromListR(context.Background(), "TaskInfo:"+runnerOption.ID)
-						if err != nil {
-							// 如果 err 不为空，并且不是 redis.Nil 错误，则打印错误信息
-							if !errors.Is(err, goRedis.Nil) {
-								logger.SlogError(fmt.Sprintf("GetRedisTask redis error: %v", err))
-								// 如果获取任务出错了 直接退出 防止删除本地任务 重启之后重新获取本地任务开始执行
-								os.Exit(0)
-							}
-							break loop
-						}
-						optionCopy := runnerOption
-						optionCopy.Target = target
-						taskFunc := func(op options.TaskOptions) func() {
-							return func() {
-								wg.Add(1)
-								defer wg.Done()
-								select {
-								case <-contextmanager.GlobalContextManagers.GetContext(op.ID).Done():
-									// 任务取消直接返回
-									return
-								default:
-									err := runner.Run(op)
-									if err != nil {
-										// 说明该任务取消了，直接返回不进行删除目标
-										return
-									} else {
-										// 目标运行完毕删除目标
-										DeletePebbleTarget(pebbledb.PebbleStore, []byte(op.ID+":"+op.Target))
-									}
-								}
-							}
-						}(optionCopy)
-						// 将任务目标写入本地
-						err = pebbledb.PebbleStore.Put([]byte(fmt.Sprintf("%v:%v", runnerOption.ID, target)), []byte(""))
-						if err != nil {
-							logger.SlogError(fmt.Sprintf("PebbleStore.Put target error: %v", err))
-						}
-						// 提交任务
-						err = pool.PoolManage.SubmitTask("task", taskFunc)
-						if err != nil {
-							logger.SlogError(fmt.Sprintf("task pool error: %v", err))
-							wg.Done()
-						}
-						logger.SlogInfoLocal(fmt.Sprintf("task target pool running goroutines: %v", pool.PoolManage.GetModuleRunningGoroutines("task")))
+				if err != nil {
+					// 如果 err 不为空，并且不是 redis.Nil 错误，则打印错误信息
+					if !errors.Is(err, goRedis.Nil) {
+						logger.SlogError(fmt.Sprintf("GetRedisTask BatchGetAndDelete error: %v", err))
+						// 如果获取任务出错了 直接退出 防止删除本地任务 重启之后重新获取本地任务开始执行
+						os.Exit(0)
 					}
+					break
 				}
-				time.Sleep(3 * time.Second)
-				wg.Wait()
-				// 删除任务上下文
-				contextmanager.GlobalContextManagers.DeleteContext(runnerOption.ID)
+				runner.PageMonitoringRunner(targets)
 			}
-			logger.SlogInfo(fmt.Sprintf("Task end: %v", runnerOption.ID))
-			handler.CloseNucleiEngine()
-			// 目标运行完毕 删除任务信息
-			// 删除本地缓存任务信息
-			err = pebbledb.PebbleStore.Delete([]byte(taskKey))
-			if err != nil {
-				logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete %v error: %v", taskKey, err))
+		}()
+		wg.Wait()
+	} else {
+		// 任务增加全局上下文，设置了任务运行时间时上下文在截止时间结束
+		contextmanager.GlobalContextManagers.AddContextWithDeadline(runnerOption.ID, taskDeadline(runnerOption))
+		if runnerOption.Type == "start" {
+			runnerOption.IsRestart = false
+			// 如果任务是暂停后开始的，则先运行本地缓存的目标
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				logger.SlogInfoLocal(fmt.Sprintf("[stop to start]task start run pebbledb: %v", runnerOption.ID))
+				RunPebbleTarget(runnerOption)
+				logger.SlogInfoLocal(fmt.Sprintf("[stop to start]task end run pebbledb: %v", runnerOption.ID))
+			}()
+		}
+		// 重试的目标放回 redis 后继续获取
+		for {
+			popTargets(runnerOption, &wg)
+			wg.Wait()
+			if !requeued(runnerOption) {
+				break
 			}
-			// 任务结束重新初始化缓存
-			err = bigcache.Initialize()
-			if err != nil {
-				logger.SlogErrorLocal(fmt.Sprintf("bigcache Initialize error: %v", err))
+		}
+		if contextmanager.DeadlineExceeded(contextmanager.GlobalContextManagers.GetContext(runnerOption.ID)) {
+			remaining, _ := redis.RedisClient.LLen(context.Background(), "TaskInfo:"+runnerOption.ID)
+			logger.SlogInfo(fmt.Sprintf("Task %v deadline reached, %v targets not started", runnerOption.ID, remaining))
+		}
+		// 删除任务上下文
+		contextmanager.GlobalContextManagers.DeleteContext(runnerOption.ID)
+	}
+	if shutdown.Stopping() {
+		// 节点停止时中断的任务保留本地缓存和任务信息，重启后继续运行
+		logger.SlogInfo(fmt.Sprintf("Task interrupted by node shutdown: %v", runnerOption.ID))
+		return
+	}
+	logger.SlogInfo(fmt.Sprintf("Task end: %v", runnerOption.ID))
+	contextmanager.DeleteDeadline(runnerOption.ID)
+	pipeline.PluginStats.EndTask(runnerOption.ID)
+	scope.Drops.EndTask(runnerOption.ID)
+	// 目标运行完毕 删除任务信息
+	// 删除本地缓存任务信息
+	err = pebbledb.PebbleStore.Delete([]byte(taskKey))
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("PebbleStore Delete %v error: %v", taskKey, err))
+	}
+	// 弹出任务信息
+	_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+}
+
+// popTargets 从 redis 获取任务的目标，写入本地后提交到任务队列，直到没有目标、任务取消或节点停止
+func popTargets(runnerOption options.TaskOptions, wg *sync.WaitGroup) {
+	for {
+		select {
+		case <-contextmanager.GlobalContextManagers.GetContext(runnerOption.ID).Done():
+			return
+		default:
+		}
+		// 节点正在停止，剩余的目标留在 redis 中，重启后继续获取
+		if shutdown.Stopping() {
+			return
+		}
+		target, err := redis.RedisClient.PopFromListR(context.Background(), "TaskInfo:"+runnerOption.ID)
+		if err != nil {
+			// 如果 err 不为空，并且不是 redis.Nil 错误，则打印错误信息
+			if !errors.Is(err, goRedis.Nil) {
+				logger.SlogError(fmt.Sprintf("GetRedisTask redis error: %v", err))
+				// 如果获取任务出错了 直接退出 防止删除本地任务 重启之后重新获取本地任务开始执行
+				os.Exit(0)
 			}
-			// 弹出任务信息
-			_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
-			// 清除全局变量
-			CleanGlobal()
+			return
+		}
+		optionCopy := runnerOption
+		optionCopy.Target = target
+		// 将任务目标写入本地
+		err = pebbledb.PebbleStore.Put([]byte(fmt.Sprintf("%v:%v", runnerOption.ID, target)), []byte(""))
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("PebbleStore.Put target error: %v", err))
 		}
+		AddScheduleTarget(runnerOption, target)
+		submitTarget(optionCopy, wg)
+		logger.SlogInfoLocal(fmt.Sprintf("task target pool running goroutines: %v", pool.PoolManage.GetModuleRunningGoroutines("task")))
+	}
+}
+
+// requeued 目标重试时放回了任务的 redis 列表，任务没有结束时继续获取
+func requeued(op options.TaskOptions) bool {
+	if op.Retry == nil || !op.Retry.Redistribute || shutdown.Stopping() {
+		return false
+	}
+	if contextmanager.GlobalContextManagers.GetContext(op.ID).Err() != nil {
+		return false
+	}
+	remaining, err := redis.RedisClient.LLen(context.Background(), "TaskInfo:"+op.ID)
+	return err == nil && remaining > 0
+}
+
+// validateTimeouts 检查目标和任务的运行时间格式
+func validateTimeouts(op options.TaskOptions) error {
+	if _, err := contextmanager.ParseTimeout(op.TargetTimeout); err != nil {
+		return err
 	}
+	_, err := contextmanager.ParseTimeout(op.TaskTimeout)
+	return err
+}
+
+// taskDeadline 任务的截止时间，没有设置任务运行时间时返回零值
+func taskDeadline(op options.TaskOptions) time.Time {
+	timeout, _ := contextmanager.ParseTimeout(op.TaskTimeout)
+	return contextmanager.TaskDeadline(op.ID, timeout)
+}
+
+// skipTarget 任务超过截止时间后没有开始的目标不再运行，删除本地目标并标记为部分完成，任务取消时保留目标
+func skipTarget(op options.TaskOptions) {
+	if !contextmanager.DeadlineExceeded(contextmanager.GlobalContextManagers.GetContext(op.ID)) {
+		return
+	}
+	deleteRetry(op)
+	DeletePebbleTarget(pebbledb.PebbleStore, []byte(op.ID+":"+op.Target))
+	handler.TaskHandle.TargetPartial(op.Target, op.ID, "task deadline before start", nil)
+}
+
+// taskIdle 没有任务在运行时关闭nuclei引擎、重新初始化缓存、清除全局变量
+func taskIdle() {
+	handler.CloseNucleiEngine()
+	err := bigcache.Initialize()
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("bigcache Initialize error: %v", err))
+	}
+	CleanGlobal()
 }
 
 func CleanGlobal() {
 	global.TmpCustomMapParameter = sync.Map{}
 	global.TmpCustomParameter = nil
 }
+
+// rejectTask 拒绝任务，拒绝原因写入 TaskInfo:reject:<任务ID>，任务的目标留在 redis 中由其他节点运行
+func rejectTask(rejection *modules.Rejection) {
+	logger.SlogError(fmt.Sprintf("Task %v rejected: %v", rejection.TaskId, rejection.Error()))
+	data, err := json.Marshal(rejection)
+	if err != nil {
+		logger.SlogErrorLocal(fmt.Sprintf("marshal task rejection error: %v", err))
+	} else {
+		err = redis.RedisClient.HSet(context.Background(), "TaskInfo:reject:"+rejection.TaskId, rejection.Node, string(data))
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("Task %v save rejection error: %v", rejection.TaskId, err))
+		}
+	}
+	_ = handler.TaskHandle.PopTaskId(rejection.TaskId)
+}
+
+// dryRunTask 试运行任务，读取任务的全部目标生成计划写入 TaskInfo:plan:<任务ID>，不扫描目标，目标保留在 redis 中
+func dryRunTask(runnerOption options.TaskOptions) {
+	var targets []string
+	for start := int64(0); ; start += 100 {
+		batch, err := redis.RedisClient.LRange(context.Background(), "TaskInfo:"+runnerOption.ID, start, start+99)
+		if err != nil && !errors.Is(err, goRedis.Nil) {
+			logger.SlogError(fmt.Sprintf("Task %v dry run get targets error: %v", runnerOption.ID, err))
+			return
+		}
+		if len(batch) == 0 {
+			break
+		}
+		targets = append(targets, batch...)
+	}
+	plan := modules.PlanTask(runnerOption, targets)
+	data, err := json.Marshal(plan)
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("Task %v dry run marshal plan error: %v", runnerOption.ID, err))
+		return
+	}
+	err = redis.RedisClient.Set(context.Background(), "TaskInfo:plan:"+runnerOption.ID, string(data))
+	if err != nil {
+		logger.SlogError(fmt.Sprintf("Task %v dry run save plan error: %v", runnerOption.ID, err))
+		return
+	}
+	logger.SlogInfo(fmt.Sprintf("Task %v dry run: %v hosts, %v excluded, %v port probes, %v problems", runnerOption.ID, plan.Targets.Hosts, len(plan.Targets.Excluded), plan.Estimate.PortProbes, len(plan.Problems)))
+	_ = handler.TaskHandle.PopTaskId(runnerOption.ID)
+}
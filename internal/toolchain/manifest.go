@@ -0,0 +1,148 @@
+// toolchain-------------------------------------
+// @file      : manifest.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/9 10:12
+// -------------------------------------------
+
+package toolchain
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Platform 工具在某个 os/arch 下的文件，sha256 为空时默认拒绝安装，配置了 toolAllowUnpinned 时首次获取的文件摘要会记录在可执行文件旁的 .sha256 文件中
+type Platform struct {
+	File   string   `yaml:"file"`
+	SHA256 string   `yaml:"sha256"`
+	URLs   []string `yaml:"urls"`
+}
+
+// Tool 工具清单中的一个工具，platforms 的 key 为 os/arch，例如 linux/amd64
+type Tool struct {
+	Version   string              `yaml:"version"`
+	Platforms map[string]Platform `yaml:"platforms"`
+}
+
+// ManifestFile 工具清单的覆盖文件，按工具覆盖默认清单，同一工具中按 os/arch 覆盖，未填写的 file、sha256 和 urls 使用默认清单
+const ManifestFile = "tools.yaml"
+
+// DefaultManifest 默认的工具清单，版本为工具所在的仓库分支
+// 只有仓库中存在的文件固定了摘要，其他条目需要在 tools.yaml 中填写 sha256，docker 镜像构建时会写入镜像中工具的摘要
+var DefaultManifest = map[string]Tool{
+	"rustscan": {
+		Version: "1.5-restructure",
+		Platforms: map[string]Platform{
+			"linux/amd64":   repoPlatform("1.5-restructure", "linux", "rustscan", ""),
+			"windows/amd64": repoPlatform("1.5-restructure", "win", "rustscan.exe", ""),
+			"darwin/arm64":  repoPlatform("1.5-restructure", "darwin", "rustscan", "8419a1497f945cccc0243f9037fdb89a5a1c4f7d72f494012094d2be9b753e22"),
+		},
+	},
+	"katana": {
+		Version: "1.5-restructure",
+		Platforms: map[string]Platform{
+			"linux/amd64":   repoPlatform("1.5-restructure", "linux", "katana", ""),
+			"windows/amd64": repoPlatform("1.5-restructure", "win", "katana.exe", ""),
+			"darwin/arm64":  repoPlatform("1.5-restructure", "darwin", "katana", ""),
+		},
+	},
+	"rad": {
+		Version: "main",
+		Platforms: map[string]Platform{
+			"linux/amd64":   repoPlatform("main", "linux", "rad", ""),
+			"windows/amd64": repoPlatform("main", "win", "rad.exe", ""),
+			"darwin/arm64":  repoPlatform("main", "darwin", "rad", ""),
+		},
+	},
+	"ksubdomain": {
+		Version: "main",
+		Platforms: map[string]Platform{
+			"linux/amd64":   repoPlatform("main", "linux", "ksubdomain", ""),
+			"windows/amd64": repoPlatform("main", "win", "ksubdomain.exe", ""),
+			"darwin/arm64":  repoPlatform("main", "darwin", "ksubdomain", ""),
+		},
+	},
+}
+
+// repoPlatform 仓库 tools 目录中的工具，github 下载失败时使用 gitee
+func repoPlatform(ref string, dir string, file string, digest string) Platform {
+	return Platform{
+		File:   file,
+		SHA256: digest,
+		URLs: []string{
+			fmt.Sprintf("https://raw.githubusercontent.com/Autumn-27/ScopeSentry-Scan/%v/tools/%v/%v", ref, dir, file),
+			fmt.Sprintf("https://gitee.com/constL/ScopeSentry-Scan/raw/%v/tools/%v/%v", ref, dir, file),
+		},
+	}
+}
+
+// PlatformKey 当前节点的 os/arch
+func PlatformKey() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// Manifest 默认清单合并配置目录下的 tools.yaml，每次调用都重新读取，修改后重新安装即可生效
+func Manifest() (map[string]Tool, error) {
+	manifest := make(map[string]Tool, len(DefaultManifest))
+	for name, tool := range DefaultManifest {
+		platforms := make(map[string]Platform, len(tool.Platforms))
+		for key, platform := range tool.Platforms {
+			platforms[key] = platform
+		}
+		manifest[name] = Tool{Version: tool.Version, Platforms: platforms}
+	}
+	path := filepath.Join(global.ConfigDir, ManifestFile)
+	if _, err := os.Stat(path); err != nil {
+		return manifest, nil
+	}
+	var override map[string]Tool
+	if err := utils.Tools.ReadYAMLFile(path, &override); err != nil {
+		return nil, fmt.Errorf("read tool manifest %v: %w", path, err)
+	}
+	for name, tool := range override {
+		current, ok := manifest[name]
+		if !ok {
+			current = Tool{Platforms: make(map[string]Platform)}
+		}
+		if tool.Version != "" {
+			current.Version = tool.Version
+		}
+		for key, platform := range tool.Platforms {
+			base := current.Platforms[key]
+			if platform.File == "" {
+				platform.File = base.File
+			}
+			if len(platform.URLs) == 0 {
+				platform.URLs = base.URLs
+			}
+			if platform.SHA256 == "" {
+				platform.SHA256 = base.SHA256
+			}
+			current.Platforms[key] = platform
+		}
+		manifest[name] = current
+	}
+	return manifest, nil
+}
+
+// Lookup 获取工具在当前节点 os/arch 下的清单条目
+func Lookup(name string) (Tool, Platform, error) {
+	manifest, err := Manifest()
+	if err != nil {
+		return Tool{}, Platform{}, err
+	}
+	tool, ok := manifest[name]
+	if !ok {
+		return Tool{}, Platform{}, fmt.Errorf("tool %v not found in manifest", name)
+	}
+	platform, ok := tool.Platforms[PlatformKey()]
+	if !ok {
+		return Tool{}, Platform{}, fmt.Errorf("tool %v has no manifest entry for %v", name, PlatformKey())
+	}
+	return tool, platform, nil
+}
@@ -0,0 +1,218 @@
+// toolchain-------------------------------------
+// @file      : toolchain.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/9 10:40
+// -------------------------------------------
+
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DigestError 工具文件的 sha256 与清单或首次记录的摘要不一致
+type DigestError struct {
+	Tool     string
+	Path     string
+	Expected string
+	Actual   string
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("tool %v digest mismatch: %v expected sha256 %v, got %v", e.Tool, e.Path, e.Expected, e.Actual)
+}
+
+// IsMismatch 错误是否为摘要不一致
+func IsMismatch(err error) bool {
+	var digestErr *DigestError
+	return errors.As(err, &digestErr)
+}
+
+// BundleDir 离线工具包目录，未配置时为 ext/bundle，目录结构为 <bundle>/<os>_<arch>/<file>
+func BundleDir() string {
+	if global.AppConfig.ToolBundle != "" {
+		return global.AppConfig.ToolBundle
+	}
+	return filepath.Join(global.ExtDir, "bundle")
+}
+
+// Ensure 确保工具的可执行文件存在且摘要正确，优先从离线工具包中复制，其次按清单中的地址依次下载
+// 已存在的文件摘要不一致时不重新获取，返回 DigestError 阻止插件运行，所有来源的摘要都不一致时也返回 DigestError
+func Ensure(name string, dest string) error {
+	tool, platform, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return Verify(name, dest)
+	}
+	expected, err := expectedDigest(name, platform, dest)
+	if err != nil {
+		return err
+	}
+	tmp := dest + ".download"
+	defer os.Remove(tmp)
+	var lastErr error
+	for _, source := range sources(platform) {
+		if err := fetch(source, tmp); err != nil {
+			lastErr = err
+			continue
+		}
+		actual, err := fileDigest(tmp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if expected != "" && !strings.EqualFold(actual, expected) {
+			lastErr = &DigestError{Tool: name, Path: source, Expected: expected, Actual: actual}
+			logger.SlogWarnLocal(lastErr.Error())
+			continue
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			return err
+		}
+		if runtime.GOOS != "windows" {
+			if err := os.Chmod(dest, 0755); err != nil {
+				return err
+			}
+		}
+		if expected == "" {
+			// 允许未固定摘要时记录首次获取的文件摘要
+			if err := writeRecord(dest, actual); err != nil {
+				return err
+			}
+		}
+		logger.SlogInfoLocal(fmt.Sprintf("tool %v %v installed from %v", name, tool.Version, source))
+		return nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("tool %v has no source for %v", name, PlatformKey())
+	}
+	return lastErr
+}
+
+// Verify 检查磁盘上的工具文件是否与清单中的摘要一致，清单未固定摘要时与首次记录的摘要比较
+func Verify(name string, path string) error {
+	_, platform, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	expected, err := expectedDigest(name, platform, path)
+	if err != nil {
+		return err
+	}
+	actual, err := fileDigest(path)
+	if err != nil {
+		return err
+	}
+	if expected == "" {
+		// 允许未固定摘要且还没有记录时，记录当前文件的摘要
+		return writeRecord(path, actual)
+	}
+	if !strings.EqualFold(actual, expected) {
+		return &DigestError{Tool: name, Path: path, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// expectedDigest 文件应有的摘要，优先使用清单中的摘要，其次使用已有的记录
+// 两者都没有时只有配置了 toolAllowUnpinned 才允许安装，返回空表示信任首次获取的文件
+func expectedDigest(name string, platform Platform, path string) (string, error) {
+	if platform.SHA256 != "" {
+		return platform.SHA256, nil
+	}
+	recorded, err := readRecord(path)
+	if err != nil || recorded != "" {
+		return recorded, err
+	}
+	if !global.AppConfig.ToolAllowUnpinned {
+		return "", fmt.Errorf("tool %v has no sha256 for %v in the manifest, pin it in %v or set toolAllowUnpinned", name, PlatformKey(), ManifestFile)
+	}
+	logger.SlogWarnLocal(fmt.Sprintf("tool %v %v is not pinned in the manifest, trusting the first file", name, PlatformKey()))
+	return "", nil
+}
+
+// sources 工具的获取来源，离线工具包中存在时排在最前面
+func sources(platform Platform) []string {
+	var list []string
+	bundled := filepath.Join(BundleDir(), runtime.GOOS+"_"+runtime.GOARCH, platform.File)
+	if _, err := os.Stat(bundled); err == nil {
+		list = append(list, bundled)
+	}
+	return append(list, platform.URLs...)
+}
+
+// fetch 下载或复制工具到临时文件
+func fetch(source string, tmp string) error {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		_, err := utils.Tools.HttpGetDownloadFile(source, tmp)
+		return err
+	}
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readRecord 读取可执行文件旁记录的摘要，不存在时返回空
+func readRecord(path string) (string, error) {
+	data, err := os.ReadFile(path + ".sha256")
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeRecord 记录文件摘要，已有记录时不覆盖
+func writeRecord(path string, digest string) error {
+	file, err := os.OpenFile(path+".sha256", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(digest + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
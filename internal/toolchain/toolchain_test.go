@@ -0,0 +1,228 @@
+// toolchain-------------------------------------
+// @file      : toolchain_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/12 22:30
+// -------------------------------------------
+
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	utils.Tools = &utils.UtilTools{}
+	os.Exit(m.Run())
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		t.Fatalf("create dir error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write file error: %v", err)
+	}
+}
+
+// setupManifest 在临时配置目录写入工具清单，来源为本地文件，返回来源所在目录
+// pinned 固定了 good 的摘要，来源依次为 bad 和 good；mismatch 固定了其他摘要；unpinned 没有固定摘要
+func setupManifest(t *testing.T) string {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "good"), "good")
+	writeFile(t, filepath.Join(src, "bad"), "bad")
+	manifest := fmt.Sprintf(`pinned:
+  version: v1
+  platforms:
+    %[1]v:
+      file: tool
+      sha256: %[2]v
+      urls: [%[3]v, %[4]v]
+mismatch:
+  version: v1
+  platforms:
+    %[1]v:
+      file: tool
+      sha256: %[5]v
+      urls: [%[4]v]
+unpinned:
+  version: v1
+  platforms:
+    %[1]v:
+      file: tool
+      urls: [%[4]v]
+`, PlatformKey(), digest("good"), filepath.Join(src, "bad"), filepath.Join(src, "good"), digest("other"))
+	writeFile(t, filepath.Join(dir, "config", ManifestFile), manifest)
+	configDir, bundle, allow := global.ConfigDir, global.AppConfig.ToolBundle, global.AppConfig.ToolAllowUnpinned
+	global.ConfigDir = filepath.Join(dir, "config")
+	global.AppConfig.ToolBundle = filepath.Join(dir, "bundle")
+	t.Cleanup(func() {
+		global.ConfigDir, global.AppConfig.ToolBundle, global.AppConfig.ToolAllowUnpinned = configDir, bundle, allow
+	})
+	return dir
+}
+
+func TestManifestOverride(t *testing.T) {
+	setupManifest(t)
+	writeFile(t, filepath.Join(global.ConfigDir, ManifestFile), fmt.Sprintf(`rustscan:
+  platforms:
+    %v:
+      sha256: abc
+`, PlatformKey()))
+	manifest, err := Manifest()
+	if err != nil {
+		t.Fatalf("Manifest() error: %v", err)
+	}
+	tool := manifest["rustscan"]
+	platform := tool.Platforms[PlatformKey()]
+	if platform.SHA256 != "abc" {
+		t.Fatalf("rustscan sha256 = %q, want abc", platform.SHA256)
+	}
+	if tool.Version != DefaultManifest["rustscan"].Version {
+		t.Fatalf("rustscan version = %q, want default %q", tool.Version, DefaultManifest["rustscan"].Version)
+	}
+	// 默认清单不受覆盖文件影响
+	if base, ok := DefaultManifest["rustscan"].Platforms[PlatformKey()]; ok {
+		if platform.File != base.File || len(platform.URLs) != len(base.URLs) {
+			t.Fatalf("rustscan platform = %+v, want file and urls of %+v", platform, base)
+		}
+		if base.SHA256 == "abc" {
+			t.Fatal("DefaultManifest is modified by override")
+		}
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		allow    bool
+		bundle   string // 离线工具包中的文件内容，为空表示没有
+		existing string // 已存在的文件内容，为空表示没有
+		mismatch bool   // 是否返回 DigestError
+		err      bool
+		record   bool // 是否记录首次获取的摘要
+	}{
+		{name: "pinned skips bad source", tool: "pinned"},
+		{name: "pinned from bundle", tool: "pinned", bundle: "good"},
+		{name: "pinned bad bundle falls back", tool: "pinned", bundle: "bad"},
+		{name: "all sources mismatch", tool: "mismatch", mismatch: true, err: true},
+		{name: "existing file mismatch", tool: "pinned", existing: "bad", mismatch: true, err: true},
+		{name: "existing file verified", tool: "pinned", existing: "good"},
+		{name: "unpinned refused", tool: "unpinned", err: true},
+		{name: "unpinned allowed", tool: "unpinned", allow: true, record: true},
+		{name: "unknown tool", tool: "none", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupManifest(t)
+			global.AppConfig.ToolAllowUnpinned = tt.allow
+			if tt.bundle != "" {
+				writeFile(t, filepath.Join(BundleDir(), runtime.GOOS+"_"+runtime.GOARCH, "tool"), tt.bundle)
+			}
+			dest := filepath.Join(dir, "bin", "tool")
+			if err := os.MkdirAll(filepath.Dir(dest), os.ModePerm); err != nil {
+				t.Fatalf("create dir error: %v", err)
+			}
+			if tt.existing != "" {
+				writeFile(t, dest, tt.existing)
+			}
+			err := Ensure(tt.tool, dest)
+			if (err != nil) != tt.err || IsMismatch(err) != tt.mismatch {
+				t.Fatalf("Ensure() error = %v, want error %v mismatch %v", err, tt.err, tt.mismatch)
+			}
+			data, readErr := os.ReadFile(dest)
+			switch {
+			case tt.existing != "":
+				// 已存在的文件不重新获取
+				if string(data) != tt.existing {
+					t.Fatalf("tool content = %q, want unchanged %q", data, tt.existing)
+				}
+			case tt.err:
+				if readErr == nil {
+					t.Fatalf("tool installed with content %q, want not installed", data)
+				}
+			default:
+				if string(data) != "good" {
+					t.Fatalf("tool content = %q, %v, want good", data, readErr)
+				}
+			}
+			if _, err := os.Stat(dest + ".download"); err == nil {
+				t.Fatal("temporary download file is kept")
+			}
+			recorded, _ := readRecord(dest)
+			if tt.record && recorded != digest("good") {
+				t.Fatalf("recorded digest = %q, want %q", recorded, digest("good"))
+			}
+			if !tt.record && recorded != "" {
+				t.Fatalf("recorded digest = %q, want none", recorded)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name     string
+		tool     string
+		allow    bool
+		content  string
+		record   string // 已有的摘要记录，为空表示没有
+		mismatch bool
+		err      bool
+		recorded string // 检查后的摘要记录
+	}{
+		{name: "pinned", tool: "pinned", content: "good"},
+		{name: "pinned mismatch", tool: "pinned", content: "bad", mismatch: true, err: true},
+		// 清单固定的摘要优先于记录
+		{name: "pinned ignores record", tool: "pinned", content: "good", record: digest("bad"), recorded: digest("bad")},
+		{name: "recorded", tool: "unpinned", content: "good", record: digest("good"), recorded: digest("good")},
+		{name: "recorded mismatch", tool: "unpinned", content: "bad", record: digest("good"), mismatch: true, err: true, recorded: digest("good")},
+		{name: "unpinned refused", tool: "unpinned", content: "good", err: true},
+		{name: "unpinned allowed records", tool: "unpinned", allow: true, content: "good", recorded: digest("good")},
+		{name: "missing file", tool: "pinned", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupManifest(t)
+			global.AppConfig.ToolAllowUnpinned = tt.allow
+			path := filepath.Join(dir, "bin", "tool")
+			if tt.content != "" {
+				writeFile(t, path, tt.content)
+			}
+			if tt.record != "" {
+				writeFile(t, path+".sha256", tt.record+"\n")
+			}
+			err := Verify(tt.tool, path)
+			if (err != nil) != tt.err || IsMismatch(err) != tt.mismatch {
+				t.Fatalf("Verify() error = %v, want error %v mismatch %v", err, tt.err, tt.mismatch)
+			}
+			if tt.mismatch && !strings.Contains(err.Error(), "digest mismatch") {
+				t.Fatalf("Verify() error = %v, want digest mismatch", err)
+			}
+			if recorded, _ := readRecord(path); recorded != tt.recorded {
+				t.Fatalf("recorded digest = %q, want %q", recorded, tt.recorded)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// types-------------------------------------
+// @file      : message.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/15 20:32
+// -------------------------------------------
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Kind 模块之间传递的消息类型
+type Kind string
+
+const (
+	KindTarget            Kind = "target"            // string 目标
+	KindSubdomain         Kind = "subdomain"         // SubdomainResult
+	KindSubdomainTakeover Kind = "subdomainTakeover" // SubTakeResult
+	KindDomainResolve     Kind = "domainResolve"     // DomainResolve
+	KindDomainSkip        Kind = "domainSkip"        // DomainSkip
+	KindPortAlive         Kind = "portAlive"         // PortAlive
+	KindMappingBatch      Kind = "mappingBatch"      // MappingBatch
+	KindAssetOther        Kind = "assetOther"        // AssetOther
+	KindAssetHttp         Kind = "assetHttp"         // AssetHttp
+	KindAssetOtherBatch   Kind = "assetOtherBatch"   // []AssetOther 已处理的资产
+	KindAssetHttpBatch    Kind = "assetHttpBatch"    // []AssetHttp 已处理的资产
+	KindUrl               Kind = "url"               // UrlResult
+	KindUrlList           Kind = "urlList"           // []string 爬虫目标
+	KindCrawler           Kind = "crawler"           // CrawlerResult
+	KindCrawlerBatch      Kind = "crawlerBatch"      // []CrawlerResult
+	KindDir               Kind = "dir"               // DirResult
+	KindVuln              Kind = "vuln"              // VulnResult
+)
+
+// MappingBatch 等待资产测绘的资产
+type MappingBatch []AssetOther
+
+// Message 模块之间传递的消息
+type Message struct {
+	Kind    Kind        // 消息类型，决定 Payload 的具体类型
+	Payload interface{} // 数据，始终为值类型
+	Target  string      // 任务原始目标
+	TaskId  string      // 任务ID
+	Plugin  string      // 产生该数据的插件，模块自身转换的数据为空
+}
+
+// NewMessage 根据数据类型确定消息类型，指针统一转换为值
+func NewMessage(payload interface{}, target string, taskId string, plugin string) (Message, error) {
+	msg := Message{
+		Target: target,
+		TaskId: taskId,
+		Plugin: plugin,
+	}
+	switch p := payload.(type) {
+	case string:
+		msg.Kind, msg.Payload = KindTarget, p
+	case SubdomainResult:
+		msg.Kind, msg.Payload = KindSubdomain, p
+	case *SubdomainResult:
+		msg.Kind, msg.Payload = KindSubdomain, *p
+	case SubTakeResult:
+		msg.Kind, msg.Payload = KindSubdomainTakeover, p
+	case *SubTakeResult:
+		msg.Kind, msg.Payload = KindSubdomainTakeover, *p
+	case DomainResolve:
+		msg.Kind, msg.Payload = KindDomainResolve, p
+	case *DomainResolve:
+		msg.Kind, msg.Payload = KindDomainResolve, *p
+	case DomainSkip:
+		msg.Kind, msg.Payload = KindDomainSkip, p
+	case *DomainSkip:
+		msg.Kind, msg.Payload = KindDomainSkip, *p
+	case PortAlive:
+		msg.Kind, msg.Payload = KindPortAlive, p
+	case *PortAlive:
+		msg.Kind, msg.Payload = KindPortAlive, *p
+	case []interface{}:
+		// 目标解析插件输出的待测绘资产
+		var assets MappingBatch
+		for _, item := range p {
+			switch asset := item.(type) {
+			case AssetOther:
+				assets = append(assets, asset)
+			case *AssetOther:
+				assets = append(assets, *asset)
+			default:
+				return msg, fmt.Errorf("unsupported mapping asset type %T", item)
+			}
+		}
+		msg.Kind, msg.Payload = KindMappingBatch, assets
+	case MappingBatch:
+		msg.Kind, msg.Payload = KindMappingBatch, p
+	case AssetOther:
+		msg.Kind, msg.Payload = KindAssetOther, p
+	case *AssetOther:
+		msg.Kind, msg.Payload = KindAssetOther, *p
+	case AssetHttp:
+		msg.Kind, msg.Payload = KindAssetHttp, p
+	case *AssetHttp:
+		msg.Kind, msg.Payload = KindAssetHttp, *p
+	case []AssetOther:
+		msg.Kind, msg.Payload = KindAssetOtherBatch, p
+	case []AssetHttp:
+		msg.Kind, msg.Payload = KindAssetHttpBatch, p
+	case UrlResult:
+		msg.Kind, msg.Payload = KindUrl, p
+	case *UrlResult:
+		msg.Kind, msg.Payload = KindUrl, *p
+	case []string:
+		msg.Kind, msg.Payload = KindUrlList, p
+	case CrawlerResult:
+		msg.Kind, msg.Payload = KindCrawler, p
+	case *CrawlerResult:
+		msg.Kind, msg.Payload = KindCrawler, *p
+	case []CrawlerResult:
+		msg.Kind, msg.Payload = KindCrawlerBatch, p
+	case DirResult:
+		msg.Kind, msg.Payload = KindDir, p
+	case *DirResult:
+		msg.Kind, msg.Payload = KindDir, *p
+	case VulnResult:
+		msg.Kind, msg.Payload = KindVuln, p
+	case *VulnResult:
+		msg.Kind, msg.Payload = KindVuln, *p
+	default:
+		return msg, fmt.Errorf("unsupported message payload type %T", payload)
+	}
+	return msg, nil
+}
+
+// payloadTypes 每种消息类型对应的数据类型
+var payloadTypes = map[Kind]reflect.Type{
+	KindTarget:            reflect.TypeOf(""),
+	KindSubdomain:         reflect.TypeOf(SubdomainResult{}),
+	KindSubdomainTakeover: reflect.TypeOf(SubTakeResult{}),
+	KindDomainResolve:     reflect.TypeOf(DomainResolve{}),
+	KindDomainSkip:        reflect.TypeOf(DomainSkip{}),
+	KindPortAlive:         reflect.TypeOf(PortAlive{}),
+	KindMappingBatch:      reflect.TypeOf(MappingBatch{}),
+	KindAssetOther:        reflect.TypeOf(AssetOther{}),
+	KindAssetHttp:         reflect.TypeOf(AssetHttp{}),
+	KindAssetOtherBatch:   reflect.TypeOf([]AssetOther{}),
+	KindAssetHttpBatch:    reflect.TypeOf([]AssetHttp{}),
+	KindUrl:               reflect.TypeOf(UrlResult{}),
+	KindUrlList:           reflect.TypeOf([]string{}),
+	KindCrawler:           reflect.TypeOf(CrawlerResult{}),
+	KindCrawlerBatch:      reflect.TypeOf([]CrawlerResult{}),
+	KindDir:               reflect.TypeOf(DirResult{}),
+	KindVuln:              reflect.TypeOf(VulnResult{}),
+}
+
+// DecodePayload 根据消息类型将 json 数据解析为对应类型的值
+func DecodePayload(kind Kind, data []byte) (interface{}, error) {
+	t, ok := payloadTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported message kind %v", kind)
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(data, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+// Is 判断消息是否为给定类型之一
+func (m Message) Is(kinds ...Kind) bool {
+	for _, k := range kinds {
+		if m.Kind == k {
+			return true
+		}
+	}
+	return false
+}
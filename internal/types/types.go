@@ -25,6 +25,7 @@ type SubdomainResult struct {
 	Tags       []string `bson:"tags"`
 	Project    string
 	TaskName   string `bson:"taskName"`
+	TaskId     string `bson:"taskId"`
 	RootDomain string `bson:"rootDomain"`
 }
 
@@ -56,6 +57,7 @@ type AssetHttp struct {
 	IconContent   string                 `bson:"iconcontent"`
 	Domain        string                 `bson:"domain"`
 	TaskName      []string               `bson:"taskName"`
+	TaskId        string                 `bson:"taskId"`
 	WebServer     string                 `bson:"webServer"`
 	Service       string                 `bson:"service"`
 	RootDomain    string                 `bson:"rootDomain"`
@@ -72,6 +74,17 @@ type Project struct {
 	Target          []string         `bson:"target"`
 	IgnoreList      []string         `bson:"ignoreList"`
 	IgnoreRegexList []*regexp.Regexp `yaml:"ignoreRegexList"`
+	Scope           ScopeRules       `bson:"scope"`
+}
+
+// ScopeRules 扫描范围，排除规则优先，包含规则为空时不限制
+type ScopeRules struct {
+	Include      []string `json:"include" bson:"include"`            // 域名（包含子域名）、*.example.com 通配符、IP、CIDR
+	Exclude      []string `json:"exclude" bson:"exclude"`            // 同 Include
+	IncludePorts []string `json:"includePorts" bson:"include_ports"` // 端口或端口范围，例如 443、8000-9000
+	ExcludePorts []string `json:"excludePorts" bson:"exclude_ports"` // 同 IncludePorts
+	IncludePaths []string `json:"includePaths" bson:"include_paths"` // URL 路径正则
+	ExcludePaths []string `json:"excludePaths" bson:"exclude_paths"` // 同 IncludePaths
 }
 
 type AssetOther struct {
@@ -89,6 +102,7 @@ type AssetOther struct {
 	Type         string          `bson:"type"`
 	Tags         []string        `bson:"tags"`
 	TaskName     []string        `bson:"taskName"`
+	TaskId       string          `bson:"taskId"`
 	RootDomain   string          `bson:"rootDomain"`
 	UrlPath      string          `bson:"urlPath"`
 }
@@ -116,6 +130,7 @@ type UrlResult struct {
 	Body       string `bson:"body"`
 	Project    string
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	ResultId   string   `bson:"resultId"`
 	RootDomain string   `bson:"rootDomain"`
 	Tags       []string `bson:"tags"`
@@ -134,6 +149,7 @@ type CrawlerResult struct {
 	Body       string
 	Project    string
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	ResultId   string   `bson:"resultId"`
 	RootDomain string   `bson:"rootDomain"`
 	Time       string   `json:"time"`
@@ -158,6 +174,7 @@ type SubTakeResult struct {
 	Response   string
 	Project    string
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	RootDomain string   `bson:"rootDomain"`
 	Tags       []string `bson:"tags"`
 }
@@ -169,6 +186,7 @@ type DirResult struct {
 	Project    string
 	Length     int
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	RootDomain string   `bson:"rootDomain"`
 	Tags       []string `bson:"tags"`
 }
@@ -192,6 +210,7 @@ type SensitiveResult struct {
 	Time       string
 	Md5        string
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	RootDomain string   `bson:"rootDomain"`
 	Tags       []string `bson:"tags"`
 	Status     int      `bson:"status"` // 1表示未处理 2表示处理中 3表示忽略 4表示疑似 5表示确认
@@ -208,6 +227,7 @@ type VulnResult struct {
 	Request    string
 	Response   string
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	RootDomain string   `yaml:"rootDomain"`
 	Tags       []string `bson:"tags"`
 	Status     int      `bson:"status"` // 1表示未处理 2表示处理中 3表示忽略 4表示疑似 5表示确认
@@ -302,6 +322,7 @@ type PageMonit struct {
 	Project    string   `bson:"project"`
 	Time       string   `bson:"time"`
 	TaskName   string   `bson:"taskName"`
+	TaskId     string   `bson:"taskId"`
 	RootDomain string   `bson:"rootDomain"`
 	Tags       []string `bson:"tags"`
 }
@@ -312,6 +333,7 @@ type PageMonitBody struct {
 }
 
 type BulkUpdateOperation struct {
-	Selector bson.M // 条件选择器数组
-	Update   bson.M // 更新内容数组
+	Selector bson.M      // 条件选择器数组
+	Update   interface{} // 更新内容，可以为更新文档或更新管道
+	TaskId   string      // 产生更新的任务 id，JSONL 后端按任务写入文件
 }
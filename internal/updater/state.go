@@ -0,0 +1,205 @@
+// updater-------------------------------------
+// @file      : state.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/10 15:02
+// -------------------------------------------
+
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/shutdown"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 更新状态，start.sh 按 "status":"pending" 判断新版本是否还未确认
+const (
+	StatusRejected   = "rejected"    // 签名、摘要或版本检查未通过，没有替换程序
+	StatusPending    = "pending"     // 已替换程序，等待新版本注册
+	StatusSuccess    = "success"     // 新版本在超时时间内注册成功
+	StatusRolledBack = "rolled_back" // 新版本没有在超时时间内注册，已恢复旧版本
+)
+
+// State 最近一次更新的状态，保存在 update/state.json，每次状态变化追加到 update/history.log
+type State struct {
+	Time     string `json:"time"`
+	Version  string `json:"version"`
+	Previous string `json:"previous"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason,omitempty"`
+	Deadline string `json:"deadline,omitempty"`
+	Reported bool   `json:"reported,omitempty"`
+}
+
+var (
+	mu        sync.Mutex
+	confirmed = make(chan struct{})
+	confirm   sync.Once
+)
+
+// Timeout 新版本需要在该时间内注册成功，否则回滚
+func Timeout() time.Duration {
+	timeout, err := time.ParseDuration(global.AppConfig.Update.Timeout)
+	if err != nil || timeout <= 0 {
+		return 5 * time.Minute
+	}
+	return timeout
+}
+
+// Resume 启动时检查未确认的更新，超过截止时间时回滚，否则在截止时间前等待注册成功
+// 在连接数据库和初始化日志之前调用，新版本无法连接时也能回滚，所以只输出到标准输出
+func Resume() {
+	mu.Lock()
+	defer mu.Unlock()
+	state, err := loadState()
+	if err != nil {
+		fmt.Printf("load update state error: %v\n", err)
+		return
+	}
+	if state == nil || state.Status != StatusPending {
+		return
+	}
+	if global.VERSION != state.Version {
+		// 程序已被替换回其他版本
+		state.Status = StatusRolledBack
+		state.Reason = fmt.Sprintf("version %v started instead", global.VERSION)
+		saveState(*state)
+		record(*state)
+		return
+	}
+	// 截止时间从新版本第一次启动开始计算，不包括旧版本停止时等待目标完成的时间
+	if state.Deadline == "" {
+		state.Deadline = time.Now().Add(Timeout()).Format(time.RFC3339)
+		saveState(*state)
+	}
+	deadline, err := time.Parse(time.RFC3339, state.Deadline)
+	if err != nil || time.Now().After(deadline) {
+		rollback(state, "not registered before deadline")
+		// 还没有开始运行任务，直接退出
+		os.Exit(1)
+	}
+	fmt.Printf("update to %v pending, waiting for registration until %v\n", state.Version, state.Deadline)
+	go func() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-confirmed:
+		case <-timer.C:
+			mu.Lock()
+			defer mu.Unlock()
+			current, err := loadState()
+			if err == nil && current != nil && current.Status == StatusPending {
+				rollback(current, "not registered before deadline")
+				shutdown.Request("system update rollback")
+			}
+		}
+	}()
+}
+
+// Confirm 节点注册成功后确认未确认的更新，回滚后的旧版本注册时上报回滚的结果
+func Confirm() {
+	mu.Lock()
+	defer mu.Unlock()
+	state, err := loadState()
+	if err != nil || state == nil {
+		return
+	}
+	switch {
+	case state.Status == StatusPending && state.Version == global.VERSION:
+		state.Status = StatusSuccess
+		state.Reported = true
+		saveState(*state)
+		record(*state)
+		confirm.Do(func() { close(confirmed) })
+		logger.SlogInfo(fmt.Sprintf("system update %v -> %v succeeded", state.Previous, state.Version))
+	case state.Status == StatusRolledBack && !state.Reported:
+		state.Reported = true
+		saveState(*state)
+		reason := state.Reason
+		if reason == "" {
+			reason = "new version failed to start"
+		}
+		logger.SlogWarn(fmt.Sprintf("system update %v -> %v rolled back: %v", state.Previous, state.Version, reason))
+	}
+}
+
+// rollback 恢复 .bak，调用方退出后由容器或 start.sh 重启为旧版本
+func rollback(state *State, reason string) {
+	state.Status = StatusRolledBack
+	state.Reason = reason
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err == nil {
+		err = os.Rename(executable+".bak", executable)
+	}
+	if err != nil {
+		state.Reason = fmt.Sprintf("%v, restore backup error: %v", reason, err)
+	}
+	saveState(*state)
+	record(*state)
+	fmt.Printf("update to %v rolled back to %v: %v\n", state.Version, state.Previous, state.Reason)
+}
+
+func statePath() string {
+	return filepath.Join(Dir(), "state.json")
+}
+
+func loadState() (*State, error) {
+	data, err := os.ReadFile(statePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func saveState(state State) error {
+	state.Time = time.Now().Format(time.RFC3339)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Dir(), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(), data, 0644)
+}
+
+func removeState() {
+	os.Remove(statePath())
+}
+
+// record 追加一条更新记录到 update/history.log
+func record(state State) {
+	state.Time = time.Now().Format(time.RFC3339)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(Dir(), os.ModePerm); err != nil {
+		fmt.Printf("create update dir error: %v\n", err)
+		return
+	}
+	file, err := os.OpenFile(filepath.Join(Dir(), "history.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("open update history error: %v\n", err)
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
@@ -0,0 +1,148 @@
+// updater-------------------------------------
+// @file      : state_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/12 22:05
+// -------------------------------------------
+
+package updater
+
+import (
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"strings"
+	"testing"
+	"time"
+)
+
+// putState 保存更新状态，测试结束后删除
+func putState(t *testing.T, state *State) {
+	if state != nil {
+		if err := saveState(*state); err != nil {
+			t.Fatalf("saveState() error: %v", err)
+		}
+	}
+	t.Cleanup(removeState)
+}
+
+func TestResume(t *testing.T) {
+	deadline := time.Now().Add(time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		state    *State
+		status   string // 为空表示没有更新状态
+		reason   string
+		deadline bool // 是否有截止时间
+	}{
+		{name: "no state"},
+		{
+			name:   "not pending",
+			state:  &State{Version: "1.5.4", Previous: "1.5.3", Status: StatusSuccess},
+			status: StatusSuccess,
+		},
+		{
+			name:   "other version started",
+			state:  &State{Version: "1.5.5", Previous: "1.5.4", Status: StatusPending},
+			status: StatusRolledBack,
+			reason: "version 1.5.4 started instead",
+		},
+		{
+			name:     "first start sets deadline",
+			state:    &State{Version: "1.5.4", Previous: "1.5.3", Status: StatusPending},
+			status:   StatusPending,
+			deadline: true,
+		},
+		{
+			name:     "waits until deadline",
+			state:    &State{Version: "1.5.4", Previous: "1.5.3", Status: StatusPending, Deadline: deadline},
+			status:   StatusPending,
+			deadline: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			putState(t, tt.state)
+			Resume()
+			state, err := loadState()
+			if err != nil {
+				t.Fatalf("loadState() error: %v", err)
+			}
+			if tt.status == "" {
+				if state != nil {
+					t.Fatalf("loadState() = %+v, want nil", state)
+				}
+				return
+			}
+			if state.Status != tt.status || state.Reason != tt.reason {
+				t.Fatalf("state = %v %q, want %v %q", state.Status, state.Reason, tt.status, tt.reason)
+			}
+			if (state.Deadline != "") != tt.deadline {
+				t.Fatalf("state deadline = %q, want deadline %v", state.Deadline, tt.deadline)
+			}
+			if tt.state.Deadline != "" && state.Deadline != tt.state.Deadline {
+				t.Fatalf("state deadline = %q, want unchanged %q", state.Deadline, tt.state.Deadline)
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    State
+		status   string
+		reported bool
+	}{
+		{
+			name:     "pending update succeeds",
+			state:    State{Version: "1.5.4", Previous: "1.5.3", Status: StatusPending},
+			status:   StatusSuccess,
+			reported: true,
+		},
+		{
+			name:   "pending update of other version",
+			state:  State{Version: "1.5.5", Previous: "1.5.4", Status: StatusPending},
+			status: StatusPending,
+		},
+		{
+			name:     "rollback reported",
+			state:    State{Version: "1.5.5", Previous: "1.5.4", Status: StatusRolledBack},
+			status:   StatusRolledBack,
+			reported: true,
+		},
+		{
+			name:   "rejected not reported",
+			state:  State{Version: "1.5.5", Status: StatusRejected},
+			status: StatusRejected,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			putState(t, &tt.state)
+			Confirm()
+			state, err := loadState()
+			if err != nil || state == nil {
+				t.Fatalf("loadState() = %v, %v", state, err)
+			}
+			if state.Status != tt.status || state.Reported != tt.reported {
+				t.Fatalf("state = %v reported %v, want %v reported %v", state.Status, state.Reported, tt.status, tt.reported)
+			}
+		})
+	}
+}
+
+func TestRollbackWithoutBackup(t *testing.T) {
+	// 测试程序没有 .bak，只记录恢复失败的原因
+	putState(t, nil)
+	state := &State{Version: "1.5.5", Previous: global.VERSION, Status: StatusPending}
+	rollback(state, "not registered before deadline")
+	saved, err := loadState()
+	if err != nil || saved == nil {
+		t.Fatalf("loadState() = %v, %v", saved, err)
+	}
+	if saved.Status != StatusRolledBack {
+		t.Fatalf("state status = %v, want %v", saved.Status, StatusRolledBack)
+	}
+	if !strings.HasPrefix(saved.Reason, "not registered before deadline, restore backup error") {
+		t.Fatalf("state reason = %q, want restore backup error", saved.Reason)
+	}
+}
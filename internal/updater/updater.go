@@ -0,0 +1,341 @@
+// updater-------------------------------------
+// @file      : updater.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/10 14:25
+// -------------------------------------------
+
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PublicKey 编译时写入的更新包签名公钥，base64 编码的 ed25519 公钥，配置文件中设置了公钥时优先使用配置
+// go build -ldflags "-X github.com/Autumn-27/ScopeSentry-Scan/internal/updater.PublicKey=<key>"
+var PublicKey string
+
+// Message UpdateSystem 消息的内容，signature 为 manifest 原始内容的 ed25519 签名
+type Message struct {
+	Manifest  string `json:"manifest"`
+	Signature string `json:"signature"`
+}
+
+// Manifest 更新包清单，url 可以是 zip 包或者可执行文件，file 为 zip 包中可执行文件的名称，默认与当前程序同名
+// expires 为清单的过期时间（RFC3339），过期的清单不能再使用，防止重放
+type Manifest struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	File    string `json:"file"`
+	Expires string `json:"expires"`
+}
+
+const (
+	// healthTimeout 运行新版本 version 命令的超时时间
+	healthTimeout = 30 * time.Second
+	// downloadTimeout 下载更新包的超时时间
+	downloadTimeout = 10 * time.Minute
+	// MaxPackageSize 更新包和其中可执行文件的最大大小
+	MaxPackageSize = 512 << 20
+)
+
+// Dir 更新包的暂存目录，也保存更新状态和更新记录
+func Dir() string {
+	return filepath.Join(global.AbsolutePath, "update")
+}
+
+// Apply 校验更新消息的签名和更新包的摘要，暂存并检查新版本后替换当前程序，当前程序保留为 .bak
+// 返回 nil 后调用方停止节点，由容器或 start.sh 重启为新版本
+func Apply(content string) error {
+	manifest, err := parse(content, time.Now())
+	if err != nil {
+		record(State{Status: StatusRejected, Reason: err.Error()})
+		return err
+	}
+	logger.SlogInfo(fmt.Sprintf("system update %v -> %v received", global.VERSION, manifest.Version))
+	if err := stage(manifest); err != nil {
+		record(State{Version: manifest.Version, Previous: global.VERSION, Status: StatusRejected, Reason: err.Error()})
+		return err
+	}
+	return nil
+}
+
+// parse 使用公钥校验签名并解析清单，清单需要未过期并且版本高于当前版本
+func parse(content string, now time.Time) (Manifest, error) {
+	var manifest Manifest
+	key, err := publicKey()
+	if err != nil {
+		return manifest, err
+	}
+	var message Message
+	if err := json.Unmarshal([]byte(content), &message); err != nil {
+		return manifest, fmt.Errorf("invalid update message: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid update signature: %w", err)
+	}
+	if !ed25519.Verify(key, []byte(message.Manifest), signature) {
+		return manifest, fmt.Errorf("update signature verification failed")
+	}
+	if err := json.Unmarshal([]byte(message.Manifest), &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid update manifest: %w", err)
+	}
+	if manifest.Version == "" || manifest.URL == "" || manifest.SHA256 == "" || manifest.Expires == "" {
+		return manifest, fmt.Errorf("update manifest requires version, url, sha256 and expires")
+	}
+	expires, err := time.Parse(time.RFC3339, manifest.Expires)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid update manifest expires: %w", err)
+	}
+	if now.After(expires) {
+		return manifest, fmt.Errorf("update manifest expired at %v", manifest.Expires)
+	}
+	newer, err := newerVersion(manifest.Version, global.VERSION)
+	if err != nil {
+		return manifest, err
+	}
+	if !newer {
+		return manifest, fmt.Errorf("version %v is not newer than running version %v", manifest.Version, global.VERSION)
+	}
+	return manifest, nil
+}
+
+// newerVersion 版本 a 是否高于版本 b，版本为点分隔的数字，可以带 v 前缀，例如 1.5.4
+func newerVersion(a string, b string) (bool, error) {
+	left, err := versionParts(a)
+	if err != nil {
+		return false, err
+	}
+	right, err := versionParts(b)
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < len(left) || i < len(right); i++ {
+		var l, r int
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		if l != r {
+			return l > r, nil
+		}
+	}
+	return false, nil
+}
+
+func versionParts(version string) ([]int, error) {
+	var parts []int
+	for _, part := range strings.Split(strings.TrimPrefix(version, "v"), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %v", version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+func publicKey() (ed25519.PublicKey, error) {
+	encoded := global.AppConfig.Update.PublicKey
+	if encoded == "" {
+		encoded = PublicKey
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("no update public key configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid update public key")
+	}
+	return key, nil
+}
+
+// stage 下载更新包到暂存目录，校验摘要，运行新版本的 version 命令检查版本后替换当前程序
+func stage(manifest Manifest) error {
+	if current, err := loadState(); err == nil && current != nil && current.Status == StatusPending {
+		return fmt.Errorf("update to %v is still pending", current.Version)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(Dir(), manifest.Version)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	packagePath := filepath.Join(dir, "package")
+	actual, err := download(manifest.URL, packagePath)
+	if err != nil {
+		return fmt.Errorf("download update package: %w", err)
+	}
+	if !strings.EqualFold(actual, manifest.SHA256) {
+		return fmt.Errorf("update package digest mismatch: expected sha256 %v, got %v", manifest.SHA256, actual)
+	}
+	file := manifest.File
+	if file == "" {
+		file = filepath.Base(executable)
+	}
+	staged := filepath.Join(dir, filepath.Base(executable))
+	if err := extract(packagePath, file, staged); err != nil {
+		return err
+	}
+	if err := healthCheck(staged, manifest.Version); err != nil {
+		return err
+	}
+	// 先写入状态再替换程序，替换后进程被意外结束时重启也能按状态回滚，截止时间在新版本启动时计算
+	state := State{
+		Version:  manifest.Version,
+		Previous: global.VERSION,
+		Status:   StatusPending,
+	}
+	if err := saveState(state); err != nil {
+		return err
+	}
+	backup := executable + ".bak"
+	if err := os.Rename(executable, backup); err != nil {
+		removeState()
+		return fmt.Errorf("backup current executable: %w", err)
+	}
+	if err := os.Rename(staged, executable); err != nil {
+		os.Rename(backup, executable)
+		removeState()
+		return fmt.Errorf("replace executable: %w", err)
+	}
+	record(state)
+	logger.SlogInfo(fmt.Sprintf("system update %v staged, restarting, rollback if not registered within %v", manifest.Version, Timeout()))
+	return nil
+}
+
+// download 把更新包写入文件并计算 sha256，超过 MaxPackageSize 时失败
+func download(url string, path string) (string, error) {
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("request failed with status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > MaxPackageSize {
+		return "", fmt.Errorf("update package is %v bytes, limit %v", resp.ContentLength, MaxPackageSize)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(resp.Body, MaxPackageSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if written > MaxPackageSize {
+		return "", fmt.Errorf("update package exceeds %v bytes", MaxPackageSize)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// extract 更新包为 zip 时取出其中的可执行文件，否则更新包本身就是可执行文件
+func extract(packagePath string, file string, dest string) error {
+	header := make([]byte, 4)
+	src, err := os.Open(packagePath)
+	if err != nil {
+		return err
+	}
+	n, _ := io.ReadFull(src, header)
+	src.Close()
+	if !bytes.Equal(header[:n], []byte("PK\x03\x04")) {
+		return copyLimited(packagePath, dest)
+	}
+	reader, err := zip.OpenReader(packagePath)
+	if err != nil {
+		return fmt.Errorf("open update package: %w", err)
+	}
+	defer reader.Close()
+	for _, f := range reader.File {
+		if f.Name != file {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return writeLimited(rc, dest)
+	}
+	return fmt.Errorf("update package does not contain %v", file)
+}
+
+func copyLimited(src string, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeLimited(file, dest)
+}
+
+// writeLimited 写入可执行文件，超过 MaxPackageSize 时失败
+func writeLimited(r io.Reader, dest string) error {
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, io.LimitReader(r, MaxPackageSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if written > MaxPackageSize {
+		return fmt.Errorf("update executable exceeds %v bytes", MaxPackageSize)
+	}
+	return nil
+}
+
+// healthCheck 新版本能在本节点运行，并且 version 命令输出的版本与清单一致
+func healthCheck(path string, version string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return fmt.Errorf("staged version check failed: %w", err)
+	}
+	if actual := strings.TrimSpace(string(output)); actual != version {
+		return fmt.Errorf("staged executable reports version %v, manifest %v", actual, version)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// updater-------------------------------------
+// @file      : updater_test.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/12 21:40
+// -------------------------------------------
+
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// 日志不输出也不发送到 redis
+	logger.ZapLog = zap.NewNop()
+	global.Standalone = true
+	global.VERSION = "1.5.4"
+	dir, err := os.MkdirTemp("", "updater-test")
+	if err != nil {
+		panic(err)
+	}
+	global.AbsolutePath = dir
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// signedMessage 使用私钥对清单签名，返回 UpdateSystem 消息的内容
+func signedMessage(t *testing.T, key ed25519.PrivateKey, manifest string) string {
+	data, err := json.Marshal(Message{
+		Manifest:  manifest,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, []byte(manifest))),
+	})
+	if err != nil {
+		t.Fatalf("marshal message error: %v", err)
+	}
+	return string(data)
+}
+
+func TestParse(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	PublicKey = base64.StdEncoding.EncodeToString(public)
+	defer func() { PublicKey = "" }()
+
+	now := time.Date(2025, 2, 12, 12, 0, 0, 0, time.UTC)
+	valid := `{"version":"1.5.5","url":"https://example.com/scan.zip","sha256":"abc","expires":"2025-02-13T00:00:00Z"}`
+	tests := []struct {
+		name    string
+		content string
+		err     string // 错误信息包含的内容，为空表示校验通过
+	}{
+		{name: "valid", content: signedMessage(t, private, valid)},
+		{name: "invalid message", content: "{", err: "invalid update message"},
+		{name: "invalid signature encoding", content: `{"manifest":"{}","signature":"***"}`, err: "invalid update signature"},
+		{name: "signed by other key", content: signedMessage(t, other, valid), err: "verification failed"},
+		{
+			name: "tampered manifest",
+			content: func() string {
+				var message Message
+				_ = json.Unmarshal([]byte(signedMessage(t, private, valid)), &message)
+				message.Manifest = strings.Replace(message.Manifest, "scan.zip", "evil.zip", 1)
+				data, _ := json.Marshal(message)
+				return string(data)
+			}(),
+			err: "verification failed",
+		},
+		{name: "invalid manifest", content: signedMessage(t, private, "[]"), err: "invalid update manifest"},
+		{
+			name:    "missing expires",
+			content: signedMessage(t, private, `{"version":"1.5.5","url":"https://example.com/scan.zip","sha256":"abc"}`),
+			err:     "requires version",
+		},
+		{
+			name:    "invalid expires",
+			content: signedMessage(t, private, `{"version":"1.5.5","url":"u","sha256":"abc","expires":"tomorrow"}`),
+			err:     "invalid update manifest expires",
+		},
+		{
+			name:    "expired",
+			content: signedMessage(t, private, `{"version":"1.5.5","url":"u","sha256":"abc","expires":"2025-02-12T11:59:59Z"}`),
+			err:     "expired",
+		},
+		{
+			name:    "same version",
+			content: signedMessage(t, private, `{"version":"1.5.4","url":"u","sha256":"abc","expires":"2025-02-13T00:00:00Z"}`),
+			err:     "not newer",
+		},
+		{
+			name:    "older version",
+			content: signedMessage(t, private, `{"version":"v1.4.9","url":"u","sha256":"abc","expires":"2025-02-13T00:00:00Z"}`),
+			err:     "not newer",
+		},
+		{
+			name:    "invalid version",
+			content: signedMessage(t, private, `{"version":"1.6-beta","url":"u","sha256":"abc","expires":"2025-02-13T00:00:00Z"}`),
+			err:     "invalid version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := parse(tt.content, now)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("parse() error: %v", err)
+				}
+				if manifest.Version != "1.5.5" || manifest.URL != "https://example.com/scan.zip" {
+					t.Fatalf("parse() = %+v, want version 1.5.5", manifest)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("parse() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	content := signedMessage(t, private, `{"version":"1.5.5","url":"u","sha256":"abc","expires":"2025-02-13T00:00:00Z"}`)
+	now := time.Date(2025, 2, 12, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		build  string
+		config string
+		err    bool
+	}{
+		{name: "no key", err: true},
+		{name: "invalid key", build: "abc", err: true},
+		{name: "build key", build: base64.StdEncoding.EncodeToString(public)},
+		// 配置中的公钥优先
+		{name: "config key", build: "abc", config: base64.StdEncoding.EncodeToString(public)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PublicKey = tt.build
+			global.AppConfig.Update.PublicKey = tt.config
+			defer func() {
+				PublicKey = ""
+				global.AppConfig.Update.PublicKey = ""
+			}()
+			if _, err := parse(content, now); (err != nil) != tt.err {
+				t.Fatalf("parse() error = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a     string
+		b     string
+		newer bool
+		err   bool
+	}{
+		{a: "1.5.5", b: "1.5.4", newer: true},
+		{a: "1.5.4", b: "1.5.4"},
+		{a: "1.5.4", b: "1.5.10"},
+		{a: "1.10", b: "1.9.9", newer: true},
+		{a: "v2", b: "1.9", newer: true},
+		{a: "1.5.4.1", b: "1.5.4", newer: true},
+		{a: "1.5", b: "1.5.0"},
+		{a: "1.5-rc1", b: "1.5", err: true},
+		{a: "1.5", b: "", err: true},
+		{a: "1.-1", b: "1.0", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			newer, err := newerVersion(tt.a, tt.b)
+			if newer != tt.newer || (err != nil) != tt.err {
+				t.Fatalf("newerVersion(%q, %q) = %v, %v, want %v, error %v", tt.a, tt.b, newer, err, tt.newer, tt.err)
+			}
+		})
+	}
+}
@@ -9,17 +9,18 @@ package assethandle
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
-	"go.mongodb.org/mongo-driver/bson"
 	"sync"
 	"time"
 )
@@ -27,13 +28,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -41,13 +44,15 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -61,18 +66,20 @@ func (r *Runner) ModuleRun() error {
 					// 如果 resultChan 关闭了，退出循环
 					// 此模块运行完毕，关闭下个模块的输入
 					if len(assetOtherArray) > 0 {
-						r.NextModule.GetInput() <- assetOtherArray
+						next.Send(assetOtherArray, "")
 					}
 
 					if len(assetHttpArray) > 0 {
-						r.NextModule.GetInput() <- assetHttpArray
+						next.Send(assetHttpArray, "")
 					}
 
 					r.NextModule.CloseInput()
 					return
 				}
 				r.NextModule.GetInput() <- result
-				if assetResult, ok := result.(types.AssetOther); ok {
+				switch result.Kind {
+				case types.KindAssetOther:
+					assetResult := result.Payload.(types.AssetOther)
 					if assetResult.Type == "http" {
 						continue
 					}
@@ -83,75 +90,24 @@ func (r *Runner) ModuleRun() error {
 						}
 					}
 					assetResult.TaskName = []string{r.Option.TaskName}
-					flag, id, bsonData := results.Duplicate.AssetInMongodb(assetResult.Host, assetResult.Port)
-					if flag {
-						// 数据库中存在该资产，对该资产信息进行diff
-						var oldAsset types.AssetOther
-						data, _ := bson.Marshal(bsonData)
-						_ = bson.Unmarshal(data, &oldAsset)
-						changeData := utils.Results.CompareAssetOther(oldAsset, assetResult)
-						if changeData.Timestamp != "" {
-							// 说明资产存在变化，将结果发送到changelog中
-							changeData.AssetId = id
-							go results.Handler.AssetChangeLog(&changeData)
-							// 对资产进行更新,设置最新的扫描时间
-						}
-						assetResult.LastScanTime = assetResult.Time
-						assetResult.Time = oldAsset.Time
-						assetResult.Project = oldAsset.Project
-						assetResult.RootDomain = oldAsset.RootDomain
-						assetResult.TaskName = append(assetResult.TaskName, oldAsset.TaskName...)
-						assetResult.TaskName = utils.Tools.RemoveStringDuplicates(assetResult.TaskName)
-						assetResult.Tags = append(assetResult.Tags, oldAsset.Tags...)
-						assetResult.Tags = utils.Tools.RemoveStringDuplicates(assetResult.Tags)
-						go results.Handler.AssetUpdate(id, assetResult)
-						// 资产没有变化，不进行操作
-					} else {
-						// 数据库中不存在该资产，直接插入。
-						assetResult.LastScanTime = assetResult.Time
-						go results.Handler.AssetOtherInsert(&assetResult)
-					}
+					assetResult.TaskId = r.Option.ID
+					// 以 host+port 原子更新或插入资产，根据更新前的资产记录变更，并合并历史资产信息
+					results.Handler.AssetOtherUpsert(&assetResult)
 					assetOtherArray = append(assetOtherArray, assetResult)
 					if len(assetOtherArray) > 10 {
-						r.NextModule.GetInput() <- assetOtherArray
+						next.Send(assetOtherArray, "")
 						assetOtherArray = nil
 					}
-				} else {
-					assetHttpResult, okh := result.(types.AssetHttp)
-					if okh {
-						assetHttpResult.TaskName = []string{r.Option.TaskName}
-						flag, id, bsonData := results.Duplicate.AssetInMongodb(assetHttpResult.Host, assetHttpResult.Port)
-						if flag {
-							var oldAssetHttp types.AssetHttp
-							data, _ := bson.Marshal(bsonData)
-							_ = bson.Unmarshal(data, &oldAssetHttp)
-							changeData := utils.Results.CompareAssetHttp(oldAssetHttp, assetHttpResult)
-							if changeData.Timestamp != "" {
-								// 说明资产存在变化，将结果发送到changelog中
-								changeData.AssetId = id
-								go results.Handler.AssetChangeLog(&changeData)
-							}
-							// 对资产进行更新,设置最新的扫描时间
-							assetHttpResult.LastScanTime = assetHttpResult.Time
-							assetHttpResult.Time = oldAssetHttp.Time
-							assetHttpResult.Project = oldAssetHttp.Project
-							assetHttpResult.RootDomain = oldAssetHttp.RootDomain
-							assetHttpResult.TaskName = append(assetHttpResult.TaskName, oldAssetHttp.TaskName...)
-							assetHttpResult.TaskName = utils.Tools.RemoveStringDuplicates(assetHttpResult.TaskName)
-							assetHttpResult.Tags = append(assetHttpResult.Tags, oldAssetHttp.Tags...)
-							assetHttpResult.Tags = utils.Tools.RemoveStringDuplicates(assetHttpResult.Tags)
-							go results.Handler.AssetUpdate(id, assetHttpResult)
-							// 资产没有变化，不进行操作
-						} else {
-							// 数据库中不存在该资产，直接插入。
-							go results.Handler.AssetHttpInsert(&assetHttpResult)
-						}
+				case types.KindAssetHttp:
+					assetHttpResult := result.Payload.(types.AssetHttp)
+					assetHttpResult.TaskName = []string{r.Option.TaskName}
+					assetHttpResult.TaskId = r.Option.ID
+					results.Handler.AssetHttpUpsert(&assetHttpResult)
 
-						assetHttpArray = append(assetHttpArray, assetHttpResult)
-						if len(assetHttpArray) > 10 {
-							r.NextModule.GetInput() <- assetHttpArray
-							assetHttpArray = nil
-						}
+					assetHttpArray = append(assetHttpArray, assetHttpResult)
+					if len(assetHttpArray) > 10 {
+						next.Send(assetHttpArray, "")
+						assetHttpArray = nil
 					}
 				}
 			}
@@ -166,7 +122,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		//
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -177,12 +135,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.AssetHandle), duration)
 				}
 				if !doneCalled {
@@ -199,25 +157,28 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				var ty string
 				var assetOther types.AssetOther
 				var assetHttp types.AssetHttp
-				switch a := data.(type) {
-				case types.AssetOther:
+				switch data.Kind {
+				case types.KindAssetOther:
 					ty = "other"
-					assetOther = a
-				case types.AssetHttp:
+					assetOther = data.Payload.(types.AssetOther)
+				case types.KindAssetHttp:
 					ty = "htttp"
-					assetHttp = a
+					assetHttp = data.Payload.(types.AssetHttp)
 				default:
-					r.NextModule.GetInput() <- data
+					pipeline.Unexpected(r.GetName(), data)
 					return
 				}
 				if len(r.Option.AssetHandle) != 0 {
 					// 调用插件
-					for _, pluginId := range r.Option.AssetHandle {
+					// 插件依次处理并修改同一个资产，只能依次运行
+					cfg := config.ModulesConfig.GetPluginRun(r.GetName())
+					cfg.PluginMode = config.PluginSequential
+					pipeline.RunPlugins(r.GetName(), r.Option.AssetHandle, cfg, func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
@@ -230,64 +191,58 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
+							// 每次执行使用资产的副本，超时后不再等待的插件修改的是副本
+							currentOther, currentHttp := assetOther, assetHttp
 							var pluginFunc func()
 							if ty == "other" {
 								pluginFunc = func(data interface{}) func() {
 									return func() {
 										defer plgWg.Done()
-										select {
-										case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-											return
-										default:
-											_, err := plg.Execute(data)
-											if err != nil {
-											}
-										}
+										pipeline.Execute(plg, data, pluginResult)
 									}
-								}(&assetOther)
+								}(&currentOther)
 							} else {
 								pluginFunc = func(data interface{}) func() {
 									return func() {
 										defer plgWg.Done()
-										select {
-										case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-											return
-										default:
-											_, err := plg.Execute(data)
-											if err != nil {
-											}
-										}
+										pipeline.Execute(plg, data, pluginResult)
 									}
-								}(&assetHttp)
+								}(&currentHttp)
 							}
 
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
 							plgWg.Wait()
+							if !pluginResult.Abandoned() {
+								assetOther, assetHttp = currentOther, currentHttp
+							}
 							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute", plg.GetName()))
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 				}
 				// 如果没有开启此模块，或者开启此模块并且插件运行结束，将data发送到结果处理处
 				if ty == "other" {
-					resultChan <- assetOther
+					output.Send(assetOther, data.Plugin)
 				} else {
-					resultChan <- assetHttp
+					output.Send(assetHttp, data.Plugin)
 				}
 			}(data)
 		}
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -295,10 +250,18 @@ func (r *Runner) GetName() string {
 	return "AssetHandle"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp, types.KindAssetOtherBatch, types.KindAssetHttpBatch}
+}
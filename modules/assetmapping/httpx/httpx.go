@@ -8,7 +8,6 @@
 package httpx
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
@@ -119,7 +118,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.([]interface{})
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not types.AssetOther\n", p.Name, input))
-		return nil, errors.New("input is not types.AssetOther")
+		return nil, fmt.Errorf("%w: input is not types.AssetOther", interfaces.ErrInputType)
 	}
 	var targetList []string
 	for _, assetinterface := range data {
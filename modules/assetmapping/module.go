@@ -9,10 +9,12 @@ package assetmapping
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -25,13 +27,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -39,20 +43,22 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
 		defer resultWg.Done()
 		for {
 			select {
-			case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+			case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
 				r.NextModule.CloseInput()
 				return
 			case result, ok := <-resultChan:
@@ -62,11 +68,13 @@ func (r *Runner) ModuleRun() error {
 					r.NextModule.CloseInput()
 					return
 				}
-				if assetResult, ok := result.(types.AssetOther); ok {
+				switch result.Kind {
+				case types.KindAssetOther:
+					assetResult := result.Payload.(types.AssetOther)
 					if assetResult.Type == "http" {
 						// 这里可能是上个模块直接发送过来的
 						httpxResultsHandler := func(ra types.AssetHttp) {
-							r.NextModule.GetInput() <- ra
+							next.Send(ra, result.Plugin)
 						}
 						var url string
 						if assetResult.Port != "" {
@@ -74,14 +82,16 @@ func (r *Runner) ModuleRun() error {
 						} else {
 							url = assetResult.Host + assetResult.UrlPath
 						}
-						utils.Requests.Httpx([]string{url}, httpxResultsHandler, "false", false, 10, false, true, contextmanager.GlobalContextManagers.GetContext(r.Option.ID), 10, false)
+						utils.Requests.Httpx([]string{url}, httpxResultsHandler, "false", false, 10, false, true, contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target), 10, false)
 					} else {
 						// 如果是other类型的资产，直接发送到下个模块
 						r.NextModule.GetInput() <- result
 					}
-				} else {
-					// 如果不是types.AssetOther，就是types.AssetHttp，直接发送到下个模块
+				case types.KindAssetHttp:
+					// types.AssetHttp，直接发送到下个模块
 					r.NextModule.GetInput() <- result
+				default:
+					pipeline.Unexpected(r.GetName(), result)
 				}
 			}
 		}
@@ -95,7 +105,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		//
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -106,12 +118,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.AssetMapping), duration)
 				}
 				if !doneCalled {
@@ -122,11 +134,15 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			assets, ok := data.([]interface{})
-			if !ok {
-				r.NextModule.GetInput() <- data
+			if !data.Is(types.KindMappingBatch) {
+				pipeline.Unexpected(r.GetName(), data)
 				continue
 			}
+			// 插件的输入为 []interface{}
+			var assets []interface{}
+			for _, asset := range data.Payload.(types.MappingBatch) {
+				assets = append(assets, asset)
+			}
 			logger.SlogInfoLocal(fmt.Sprintf("target run httpx number %v", len(assets)))
 			if !firstData {
 				start = time.Now()
@@ -139,7 +155,7 @@ func (r *Runner) ModuleRun() error {
 				//发送来的数据 只能是types.Asset
 				if len(r.Option.AssetMapping) != 0 {
 					// 调用插件
-					for _, pluginId := range r.Option.AssetMapping {
+					pipeline.RunPlugins(r.GetName(), r.Option.AssetMapping, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
@@ -152,25 +168,20 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							// 这里和其他模块不同 传递的是数组
 							pluginFunc := func(assets []interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(assets)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, assets, pluginResult)
 								}
 							}(assets)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
@@ -179,11 +190,12 @@ func (r *Runner) ModuleRun() error {
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 				} else {
 					// 如果没有开启资产测绘，将types.Asset 发送到结果处，在结果处进行转换
 					for _, asset := range assets {
-						resultChan <- asset
+						output.Send(asset, "")
 					}
 				}
 			}(assets)
@@ -193,7 +205,7 @@ func (r *Runner) ModuleRun() error {
 	return nil
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -201,10 +213,18 @@ func (r *Runner) GetName() string {
 	return "AssetMapping"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp}
+}
@@ -0,0 +1,92 @@
+// modules-------------------------------------
+// @file      : capability.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/3 20:17
+// -------------------------------------------
+
+package modules
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"strings"
+)
+
+// Rejection 节点无法运行任务的原因，写入 TaskInfo:reject:<任务ID> 中节点名称对应的字段
+type Rejection struct {
+	TaskId  string           `json:"taskId"`
+	Node    string           `json:"node"`
+	Time    string           `json:"time"`
+	Plugins []RejectedPlugin `json:"plugins"` // 节点无法运行的插件
+	Labels  []string         `json:"labels"`  // 节点缺少的能力标签
+}
+
+// RejectedPlugin 任务使用的无法运行的插件
+type RejectedPlugin struct {
+	Stage  string `json:"stage"`
+	Module string `json:"module"`
+	Plugin string `json:"plugin"`
+	Reason string `json:"reason"` // not found、install failed 或 check failed
+}
+
+func (r *Rejection) Error() string {
+	var reasons []string
+	for _, plg := range r.Plugins {
+		reasons = append(reasons, fmt.Sprintf("stage %v plugin %v %v", plg.Stage, plg.Plugin, plg.Reason))
+	}
+	if len(r.Labels) != 0 {
+		reasons = append(reasons, fmt.Sprintf("missing labels %v", strings.Join(r.Labels, ",")))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// CheckCapability 检查节点能否运行任务使用的所有插件以及是否具有任务要求的能力标签，可以运行时返回 nil
+func CheckCapability(op options.TaskOptions) *Rejection {
+	r := &Rejection{
+		TaskId: op.ID,
+		Node:   global.AppConfig.NodeName,
+		Time:   utils.Tools.GetTimeNow(),
+	}
+	labels := make(map[string]bool)
+	for _, label := range config.NodeLabels() {
+		labels[label] = true
+	}
+	for _, label := range op.Requires {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label != "" && !labels[label] {
+			r.Labels = append(r.Labels, label)
+		}
+	}
+	if op.Type != "page_monitoring" {
+		g := op.Pipeline
+		if g == nil {
+			g = pipeline.Default()
+		}
+		// 被裁剪的阶段不会运行，不检查
+		for _, stage := range pruneGraph(g, &op).Stages {
+			for _, pluginId := range stagePlugins(&op, stage) {
+				if ok, reason := pluginReady(stage.Module, pluginId); !ok {
+					r.Plugins = append(r.Plugins, RejectedPlugin{Stage: stage.Name, Module: stage.Module, Plugin: pluginId, Reason: reason})
+				}
+			}
+		}
+	}
+	if len(r.Plugins) == 0 && len(r.Labels) == 0 {
+		return nil
+	}
+	return r
+}
+
+// pluginReady 插件已注册并且安装和检查成功
+func pluginReady(module string, pluginId string) (bool, string) {
+	if !plugins.GlobalPluginManager.HasPlugin(module, pluginId) {
+		return false, "not found"
+	}
+	return plugins.GlobalPluginManager.Ready(pluginId)
+}
@@ -0,0 +1,181 @@
+// customstage-------------------------------------
+// @file      : module.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/1/12 21:40
+// -------------------------------------------
+
+package customstage
+
+import (
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"sync"
+	"time"
+)
+
+// Runner 流程图中的自定义阶段，运行 plugin/Custom 下的 yaegi 插件
+// 输入原样发送到下个阶段，插件通过 Result 返回的结果也发送到下个阶段
+type Runner struct {
+	Option     *options.TaskOptions
+	NextModule interfaces.ModuleRunner
+	Input      chan types.Message
+	Name       string
+	Plugins    []string
+}
+
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, name string, plugins []string) *Runner {
+	return &Runner{
+		Option:     op,
+		NextModule: nextModule,
+		Name:       name,
+		Plugins:    plugins,
+	}
+}
+
+func (r *Runner) ModuleRun() error {
+	var allPluginWg sync.WaitGroup
+	var resultWg sync.WaitGroup
+	// 创建一个共享的 result 通道
+	resultChan := make(chan types.Message, 100)
+	output := pipeline.NewOutput(r.GetName(), r.GetName(), r.Option.Target, r.Option.ID, resultChan)
+	go func() {
+		err := r.NextModule.ModuleRun()
+		if err != nil {
+			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
+		}
+	}()
+	// 结果处理 goroutine，插件结果直接发送到下个阶段
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range resultChan {
+			r.NextModule.GetInput() <- result
+		}
+		// 此阶段运行完毕，关闭下个阶段的输入
+		r.NextModule.CloseInput()
+	}()
+
+	var firstData bool
+	firstData = false
+	var start time.Time
+	var end time.Time
+	doneCalled := false
+	for {
+		select {
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
+			allPluginWg.Wait()
+			if !doneCalled {
+				close(resultChan)
+				resultWg.Wait()
+				r.Option.ModuleRunWg.Done()
+				doneCalled = true // 标记已调用 Done
+			}
+			return nil
+		case data, ok := <-r.Input:
+			if !ok {
+				allPluginWg.Wait()
+				// 通道已关闭，结束处理
+				if firstData {
+					end = time.Now()
+					duration := end.Sub(start)
+					output.Finish()
+					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Plugins), duration)
+				}
+				if !doneCalled {
+					close(resultChan)
+					resultWg.Wait()
+					r.Option.ModuleRunWg.Done()
+					doneCalled = true // 标记已调用 Done
+				}
+				return nil
+			}
+			if !firstData {
+				start = time.Now()
+				handler.TaskHandle.ProgressStart(r.GetName(), r.Option.Target, r.Option.ID, len(r.Plugins))
+				firstData = true
+			}
+
+			// 原始数据发送到下个阶段
+			r.NextModule.GetInput() <- data
+
+			allPluginWg.Add(1)
+			go func(data types.Message) {
+				defer allPluginWg.Done()
+				pipeline.RunPlugins(r.GetName(), r.Plugins, config.PluginRunConfig{}, func(pluginId string) bool {
+					var plgWg sync.WaitGroup
+					plg, flag := plugins.GlobalPluginManager.GetPlugin(pipeline.CustomModule, pluginId)
+					if flag {
+						logger.SlogDebugLocal(fmt.Sprintf("%v stage %v plugin start execute", r.GetName(), plg.GetName()))
+						plgWg.Add(1)
+						args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, pipeline.CustomModule, plg.GetPluginId())
+						if argsFlag {
+							plg.SetParameter(args)
+						} else {
+							plg.SetParameter("")
+						}
+						pluginResult := output.Plugin(plg.GetName())
+						plg.SetResult(pluginResult.Ch)
+						plg.SetTaskId(r.Option.ID)
+						plg.SetTaskName(r.Option.TaskName)
+						pluginFunc := func(data interface{}) func() {
+							return func() {
+								defer plgWg.Done()
+								pipeline.Execute(plg, data, pluginResult)
+							}
+						}(data.Payload)
+						err := pool.PoolManage.CustomSubmitTask(pipeline.CustomModule, config.ModulesConfig.MaxGoroutineCount, pluginFunc)
+						if err != nil {
+							pluginResult.Close()
+							plgWg.Done()
+							logger.SlogError(fmt.Sprintf("task pool error: %v", err))
+						}
+						plgWg.Wait()
+						logger.SlogDebugLocal(fmt.Sprintf("%v stage %v plugin end execute", r.GetName(), plg.GetName()))
+					} else {
+						logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
+					}
+					return true
+				})
+			}(data)
+		}
+	}
+}
+
+func (r *Runner) SetInput(ch chan types.Message) {
+	r.Input = ch
+}
+
+func (r *Runner) GetName() string {
+	return r.Name
+}
+
+func (r *Runner) GetInput() chan types.Message {
+	return r.Input
+}
+
+func (r *Runner) CloseInput() {
+	close(r.Input)
+}
+
+// Consumes 自定义阶段接收所有类型的消息，由插件自行判断
+func (r *Runner) Consumes() []types.Kind {
+	return nil
+}
+
+// Produces 自定义插件的输出类型无法预先确定
+func (r *Runner) Produces() []types.Kind {
+	return nil
+}
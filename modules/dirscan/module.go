@@ -9,10 +9,12 @@ package dirscan
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -26,13 +28,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner { // 同样改为值类型
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner { // 同样改为值类型
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -40,13 +44,14 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -60,9 +65,11 @@ func (r *Runner) ModuleRun() error {
 					r.NextModule.CloseInput()
 					return
 				}
-				if dirResult, ok := result.(types.DirResult); ok {
+				if result.Is(types.KindDir) {
+					dirResult := result.Payload.(types.DirResult)
 					dirResult.TaskName = r.Option.TaskName
-					go results.Handler.Dir(&dirResult)
+					dirResult.TaskId = r.Option.ID
+					results.Handler.Dir(&dirResult)
 				}
 			}
 		}
@@ -75,7 +82,9 @@ func (r *Runner) ModuleRun() error {
 	doneCalled := false
 	for {
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -86,12 +95,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.DirScan), duration)
 				}
 				if !doneCalled {
@@ -108,15 +117,19 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
 			// 这里接收的是发送到下个模块
 			r.NextModule.GetInput() <- data
 
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				if len(r.Option.DirScan) != 0 {
 					// 调用插件
-					for _, pluginId := range r.Option.DirScan {
+					pipeline.RunPlugins(r.GetName(), r.Option.DirScan, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
@@ -129,24 +142,19 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(data)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, data, pluginResult)
 								}
-							}(data)
+							}(data.Payload)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
@@ -155,14 +163,15 @@ func (r *Runner) ModuleRun() error {
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 				}
 			}(data)
 		}
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -170,10 +179,18 @@ func (r *Runner) GetName() string {
 	return "DirScan"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp, types.KindAssetOtherBatch, types.KindAssetHttpBatch, types.KindUrl, types.KindCrawler, types.KindCrawlerBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp, types.KindAssetOtherBatch, types.KindAssetHttpBatch, types.KindUrl, types.KindCrawler, types.KindCrawlerBatch}
+}
@@ -8,7 +8,6 @@
 package sentrydir
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
@@ -124,7 +123,7 @@ func (p *Plugin) GetParameter() string {
 func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.(types.AssetHttp)
 	if !ok {
-		return nil, errors.New("input is not types.AssetHttp")
+		return nil, fmt.Errorf("%w: input is not types.AssetHttp", interfaces.ErrInputType)
 	}
 	start := time.Now()
 	p.Log(fmt.Sprintf("scan terget begin: %v", data.URL))
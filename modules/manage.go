@@ -8,10 +8,15 @@
 package modules
 
 import (
+	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/assethandle"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/assetmapping"
+	"github.com/Autumn-27/ScopeSentry-Scan/modules/customstage"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/dirscan"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/portfingerprint"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/portscan"
@@ -23,98 +28,336 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/urlsecurity"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/vulnerabilityscan"
 	"github.com/Autumn-27/ScopeSentry-Scan/modules/webcrawler"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 )
 
+// moduleFactory 流程图中内置模块的构造信息
+type moduleFactory struct {
+	New         func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner
+	Plugins     func(op *options.TaskOptions) *[]string // 任务中该模块使用的插件
+	Sink        bool                                    // 模块没有输出，不能有下游
+	Prunable    bool                                    // 没有插件时不产生结果，作为末端阶段时可以直接跳过
+	PassThrough bool                                    // 没有插件时只把接收的数据原样发送到下游，作为中间阶段时可以直接连接上下游
+}
+
+var moduleFactories = map[string]moduleFactory{
+	"TargetHandler": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return targethandler.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.TargetHandler },
+	},
+	"SubdomainScan": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return subdomainscan.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.SubdomainScan },
+	},
+	"SubdomainSecurity": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return subdomainsecurity.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.SubdomainSecurity },
+	},
+	"PortScanPreparation": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return portscanpreparation.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.PortScanPreparation },
+	},
+	"PortScan": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return portscan.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.PortScan },
+	},
+	"PortFingerprint": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return portfingerprint.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.PortFingerprint },
+	},
+	"AssetMapping": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return assetmapping.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.AssetMapping },
+	},
+	"AssetHandle": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return assethandle.NewRunner(op, next, stage)
+		},
+		Plugins: func(op *options.TaskOptions) *[]string { return &op.AssetHandle },
+	},
+	"URLScan": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return urlscan.NewRunner(op, next, stage)
+		},
+		Plugins:  func(op *options.TaskOptions) *[]string { return &op.URLScan },
+		Prunable: true,
+	},
+	"WebCrawler": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return webcrawler.NewRunner(op, next, stage)
+		},
+		Plugins:     func(op *options.TaskOptions) *[]string { return &op.WebCrawler },
+		Prunable:    true,
+		PassThrough: true,
+	},
+	"URLSecurity": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return urlsecurity.NewRunner(op, next, stage)
+		},
+		Plugins:     func(op *options.TaskOptions) *[]string { return &op.URLSecurity },
+		Prunable:    true,
+		PassThrough: true,
+	},
+	"DirScan": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return dirscan.NewRunner(op, next, stage)
+		},
+		Plugins:     func(op *options.TaskOptions) *[]string { return &op.DirScan },
+		Prunable:    true,
+		PassThrough: true,
+	},
+	"VulnerabilityScan": {
+		New: func(op *options.TaskOptions, next interfaces.ModuleRunner, stage string) interfaces.ModuleRunner {
+			return vulnerabilityscan.NewRunner(op, nil, stage)
+		},
+		Plugins:  func(op *options.TaskOptions) *[]string { return &op.VulnerabilityScan },
+		Sink:     true,
+		Prunable: true,
+	},
+}
+
+// ValidateGraph 检查任务的流程图，在任务到达时调用
+func ValidateGraph(g *pipeline.Graph) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	for _, stage := range g.Stages {
+		if stage.Module == pipeline.CustomModule {
+			continue
+		}
+		factory, ok := moduleFactories[stage.Module]
+		if !ok {
+			return fmt.Errorf("pipeline stage %v module %v not found", stage.Name, stage.Module)
+		}
+		if factory.Sink && len(stage.Next) != 0 {
+			return fmt.Errorf("pipeline stage %v module %v has no output, next is not allowed", stage.Name, stage.Module)
+		}
+	}
+	// 检查每条边上下游的消息类型，自定义阶段不限制类型
+	entry, _ := g.Stage(g.Entry)
+	if !pipeline.Accepts(stageConsumes(entry), types.KindTarget) {
+		return fmt.Errorf("pipeline entry stage %v does not accept %v", entry.Name, types.KindTarget)
+	}
+	for _, stage := range g.Stages {
+		produces := stageProduces(stage)
+		for _, name := range stage.Next {
+			next, _ := g.Stage(name)
+			if !kindsOverlap(produces, stageConsumes(next)) {
+				return fmt.Errorf("pipeline stage %v output %v is not accepted by next stage %v", stage.Name, produces, next.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// stageRunner 创建一个只用于查询消息类型的模块，自定义阶段返回 nil
+func stageRunner(stage pipeline.Stage) interfaces.ModuleRunner {
+	if stage.Module == pipeline.CustomModule {
+		return nil
+	}
+	return moduleFactories[stage.Module].New(&options.TaskOptions{}, nil, stage.Name)
+}
+
+func stageConsumes(stage pipeline.Stage) []types.Kind {
+	runner := stageRunner(stage)
+	if runner == nil {
+		return nil
+	}
+	return runner.Consumes()
+}
+
+func stageProduces(stage pipeline.Stage) []types.Kind {
+	runner := stageRunner(stage)
+	if runner == nil {
+		return nil
+	}
+	return runner.Produces()
+}
+
+// kindsOverlap 判断上游输出和下游接收是否有相同的类型，任意一方为空表示不限制
+func kindsOverlap(produces []types.Kind, consumes []types.Kind) bool {
+	if len(produces) == 0 || len(consumes) == 0 {
+		return true
+	}
+	for _, kind := range produces {
+		if pipeline.Accepts(consumes, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// stagePlugins 阶段实际使用的插件
+func stagePlugins(op *options.TaskOptions, stage pipeline.Stage) []string {
+	if len(stage.Plugins) != 0 || stage.Module == pipeline.CustomModule {
+		return stage.Plugins
+	}
+	return *moduleFactories[stage.Module].Plugins(op)
+}
+
+// pruneGraph 去掉没有插件的末端阶段和只转发数据的中间阶段
+// 末端阶段不会产生任何结果，直接删除；中间阶段删除后上游直接连接到它的下游
+func pruneGraph(g *pipeline.Graph, op *options.TaskOptions) *pipeline.Graph {
+	stages := make([]pipeline.Stage, len(g.Stages))
+	copy(stages, g.Stages)
+	for {
+		// 被删除的阶段 -> 上游改为连接的阶段，末端阶段为空
+		removed := make(map[string][]string)
+		var kept []pipeline.Stage
+		for _, stage := range stages {
+			factory, ok := moduleFactories[stage.Module]
+			if ok && stage.Name != g.Entry && len(stagePlugins(op, stage)) == 0 {
+				if factory.Prunable && len(stage.Next) == 0 || factory.PassThrough {
+					removed[stage.Name] = stage.Next
+					continue
+				}
+			}
+			kept = append(kept, stage)
+		}
+		if len(removed) == 0 {
+			return &pipeline.Graph{Entry: g.Entry, Stages: stages}
+		}
+		for i, stage := range kept {
+			kept[i].Next = spliceNext(stage.Next, removed)
+		}
+		stages = kept
+	}
+}
+
+// spliceNext 把下游中被删除的阶段替换为它的下游，去掉重复的阶段
+func spliceNext(next []string, removed map[string][]string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	var add func(names []string)
+	add = func(names []string) {
+		for _, name := range names {
+			if children, ok := removed[name]; ok {
+				add(children)
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, name)
+			}
+		}
+	}
+	add(next)
+	return result
+}
+
+// newStageRunner 创建阶段的模块
+func newStageRunner(op *options.TaskOptions, stage pipeline.Stage, factory moduleFactory, next interfaces.ModuleRunner) interfaces.ModuleRunner {
+	// 每个阶段使用单独的任务配置，模块通过阶段名称记录进度
+	stageOp := *op
+	if stage.Module == pipeline.CustomModule {
+		return customstage.NewRunner(&stageOp, next, stage.Name, stage.Plugins)
+	}
+	if len(stage.Plugins) != 0 {
+		// 阶段指定了插件
+		*factory.Plugins(&stageOp) = stage.Plugins
+	}
+	return factory.New(&stageOp, next, stage.Name)
+}
+
+// CreateScanProcess 根据任务的流程图创建模块，返回入口阶段
 func CreateScanProcess(op *options.TaskOptions) interfaces.ModuleRunner {
 	// 初始化 InputChan
-	op.InputChan = make(map[string]chan interface{})
-
-	// 漏洞扫描模块
-	op.ModuleRunWg.Add(1)
-	vulnerabilityModule := vulnerabilityscan.NewRunner(op, nil)
-	vulnerabilityInputChan := make(chan interface{}, 100)
-	vulnerabilityModule.SetInput(vulnerabilityInputChan)
-	op.InputChan["Vulnerability"] = vulnerabilityInputChan
-
-	// 目录扫描模块
-	op.ModuleRunWg.Add(1)
-	dirScanModule := dirscan.NewRunner(op, vulnerabilityModule)
-	dirScanInputChan := make(chan interface{}, 100)
-	dirScanModule.SetInput(dirScanInputChan)
-	op.InputChan["DirScan"] = dirScanInputChan
-
-	// url安全模块
-	op.ModuleRunWg.Add(1)
-	urlSecurityModule := urlsecurity.NewRunner(op, dirScanModule)
-	urlSecurityInputChan := make(chan interface{}, 100)
-	urlSecurityModule.SetInput(urlSecurityInputChan)
-	op.InputChan["UrlSecurity"] = urlSecurityInputChan
-
-	// 爬虫模块
-	op.ModuleRunWg.Add(1)
-	webCrawlerModule := webcrawler.NewRunner(op, urlSecurityModule)
-	WebCrawlerInputChan := make(chan interface{}, 100)
-	webCrawlerModule.SetInput(WebCrawlerInputChan)
-	op.InputChan["WebCrawler"] = WebCrawlerInputChan
-
-	// url扫描模块
-	op.ModuleRunWg.Add(1)
-	urlScanModule := urlscan.NewRunner(op, webCrawlerModule)
-	urlScanInputChan := make(chan interface{}, 100)
-	urlScanModule.SetInput(urlScanInputChan)
-	op.InputChan["UrlScan"] = urlScanInputChan
-
-	// 资产处理模块
-	op.ModuleRunWg.Add(1)
-	assetHandleModule := assethandle.NewRunner(op, urlScanModule)
-	assetHandleInputChan := make(chan interface{}, 100)
-	assetHandleModule.SetInput(assetHandleInputChan)
-	op.InputChan["AssetHandle"] = assetHandleInputChan
-
-	// 资产测绘模块
-	op.ModuleRunWg.Add(1)
-	assetMappingModule := assetmapping.NewRunner(op, assetHandleModule)
-	assetMappingInputChan := make(chan interface{}, 100)
-	assetMappingModule.SetInput(assetMappingInputChan)
-	op.InputChan["AssetMapping"] = assetMappingInputChan
-
-	// 端口指纹识别模块
-	op.ModuleRunWg.Add(1)
-	portFingerprintModule := portfingerprint.NewRunner(op, assetMappingModule)
-	portFingerprintInputChan := make(chan interface{}, 100)
-	portFingerprintModule.SetInput(portFingerprintInputChan)
-	op.InputChan["PortFingerprint"] = portFingerprintInputChan
-
-	// 端口扫描模块
-	op.ModuleRunWg.Add(1)
-	portScanModule := portscan.NewRunner(op, portFingerprintModule)
-	portScanInputChan := make(chan interface{}, 100)
-	portScanModule.SetInput(portScanInputChan)
-	op.InputChan["PortScan"] = portScanInputChan
-
-	// 端口扫描预处理模块
-	op.ModuleRunWg.Add(1)
-	portScanPreparationModule := portscanpreparation.NewRunner(op, portScanModule)
-	portScanPreparationInputChan := make(chan interface{}, 100)
-	portScanPreparationModule.SetInput(portScanPreparationInputChan)
-	op.InputChan["PortScanPreparation"] = portScanPreparationInputChan
-
-	// 子域名安全模块
-	op.ModuleRunWg.Add(1)
-	subdomainSecurityModule := subdomainsecurity.NewRunner(op, portScanPreparationModule)
-	subdomainSecurityInputChan := make(chan interface{}, 100)
-	subdomainSecurityModule.SetInput(subdomainSecurityInputChan)
-	op.InputChan["SubdomainSecurity"] = subdomainSecurityInputChan
-
-	// 子域名扫描模块
-	op.ModuleRunWg.Add(1)
-	subdomainScanModule := subdomainscan.NewRunner(op, subdomainSecurityModule)
-	subdomainScanInputChan := make(chan interface{}, 100)
-	subdomainScanModule.SetInput(subdomainScanInputChan)
-	op.InputChan["SubdomainScan"] = subdomainScanInputChan
-
-	// 目标处理模块
-	op.ModuleRunWg.Add(1)
-	targetHandlerModule := targethandler.NewRunner(op, subdomainScanModule)
-	return targetHandlerModule
+	op.InputChan = make(map[string]chan types.Message)
+	g := op.Pipeline
+	if g == nil {
+		g = pipeline.Default()
+	}
+	g = pruneGraph(g, op)
+	upstreams := g.Upstreams()
+	// 重启后已完成的阶段使用检查点代替，只运行未完成的阶段
+	cp := pipeline.NewCheckpoints(op.ID, op.Target)
+	// 每个阶段的输出经过扫描范围检查后才发送到下游
+	engine, err := scope.NewEngine(op.ID, op.Scope)
+	if err != nil {
+		// 任务接收时已经检查过规则，这里只检查项目的扫描范围
+		logger.SlogError(fmt.Sprintf("task %v scope invalid: %v", op.ID, err))
+		engine, _ = scope.NewEngine(op.ID, nil)
+	}
+	// 各阶段的实时进度，由 runner 在目标开始扫描时创建
+	progress := pipeline.Progresses.Get(op.ID, op.Target)
+	built := make(map[string]interfaces.ModuleRunner)
+
+	var build func(name string) interfaces.ModuleRunner
+	build = func(name string) interfaces.ModuleRunner {
+		if runner, ok := built[name]; ok {
+			return runner
+		}
+		stage, _ := g.Stage(name)
+		factory := moduleFactories[stage.Module]
+
+		// 先创建下游
+		var children []interfaces.ModuleRunner
+		for _, childName := range stage.Next {
+			children = append(children, build(childName))
+		}
+		done := cp != nil && cp.Done(stage.Name)
+		var next interfaces.ModuleRunner
+		if !factory.Sink {
+			// 阶段的输出经过 Relay 记录检查点、统计数量、检查扫描范围后发送到下游，没有下游时丢弃输出
+			// 已完成的阶段重新发送记录的输出，不再记录
+			relay := pipeline.NewRelay(stage.Name, stage.Next, children, op.ModuleRunWg)
+			if cp != nil && !done {
+				relay.Recorder = pipeline.NewRecorder(cp, stage.Name)
+			}
+			relay.Meter = pipeline.NewMeter(progress, stage.Name)
+			relay.Filter = pipeline.NewScopeFilter(engine, stage.Name)
+			next = relay
+			next.SetInput(make(chan types.Message, 100))
+		}
+
+		inputChan := make(chan types.Message, 100)
+		op.InputChan[stage.Name] = inputChan
+		var runner interfaces.ModuleRunner
+		if done {
+			emit := false
+			for _, childName := range stage.Next {
+				if !cp.Done(childName) {
+					emit = true
+				}
+			}
+			logger.SlogInfoLocal(fmt.Sprintf("task %v target %v stage %v completed, resume from checkpoint", op.ID, op.Target, stage.Name))
+			runner = pipeline.NewReplay(cp, stage.Name, next, emit)
+		} else {
+			if cp != nil {
+				cp.Reset(stage.Name)
+			}
+			op.ModuleRunWg.Add(1)
+			runner = newStageRunner(op, stage, factory, next)
+			if factory.Sink && cp != nil {
+				// 没有输出的阶段在模块运行结束后标记完成
+				runner = pipeline.NewSink(runner, stage.Name, cp, op.ModuleRunWg)
+			}
+			progress.AddStage(stage.Name, stage.Module, len(stagePlugins(op, stage)), inputChan)
+		}
+		runner.SetInput(inputChan)
+		if upstreams[name] > 1 {
+			runner = pipeline.NewJoin(runner, upstreams[name])
+		}
+		built[name] = runner
+		return runner
+	}
+	// 任务目标也需要在扫描范围内，入口阶段接收的数据也在这里统计
+	input := pipeline.NewRelay("input", []string{g.Entry}, []interfaces.ModuleRunner{build(g.Entry)}, op.ModuleRunWg)
+	input.Meter = pipeline.NewMeter(progress, "input")
+	input.Filter = pipeline.NewScopeFilter(engine, "input")
+	return input
 }
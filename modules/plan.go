@@ -0,0 +1,384 @@
+// modules-------------------------------------
+// @file      : plan.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/2 19:40
+// -------------------------------------------
+
+package modules
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/scope"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
+	"github.com/Autumn-27/ScopeSentry-Scan/modules/targethandler/targetparser"
+	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	planExpandLimit = 65536 // IP 段超过该数量时只计数不展开
+	planSampleSize  = 100   // 计划中列出的主机数量
+)
+
+// TaskPlan 任务试运行的计划，只解析任务配置和节点上的文件，不向目标发送任何请求
+type TaskPlan struct {
+	TaskId   string       `json:"taskId"`
+	TaskName string       `json:"taskName"`
+	Time     string       `json:"time"`
+	Targets  PlanTargets  `json:"targets"`
+	Stages   []PlanStage  `json:"stages"`
+	Estimate PlanEstimate `json:"estimate"`
+	Problems []string     `json:"problems"` // 任务运行时会出错的配置，例如字典或 PoC 不存在
+}
+
+// PlanTargets 解析后的目标
+type PlanTargets struct {
+	Input    int            `json:"input"`    // 原始目标数量
+	Hosts    int            `json:"hosts"`    // 展开 IP 段并解析后在扫描范围内的主机数量
+	Domains  int            `json:"domains"`  // 其中需要子域名扫描的域名数量
+	Samples  []string       `json:"samples"`  // 部分主机
+	Excluded []PlanExcluded `json:"excluded"` // 不在扫描范围内的目标
+	Invalid  []string       `json:"invalid"`  // 无法解析的目标
+}
+
+// PlanExcluded 不在扫描范围内的目标
+type PlanExcluded struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// PlanStage 流程图中的阶段
+type PlanStage struct {
+	Name    string       `json:"name"`
+	Module  string       `json:"module"`
+	Next    []string     `json:"next"`
+	Pruned  bool         `json:"pruned"` // 没有插件且没有下游，运行时跳过
+	Plugins []PlanPlugin `json:"plugins"`
+}
+
+// PlanPlugin 阶段使用的插件和参数
+type PlanPlugin struct {
+	Id        string     `json:"id"`
+	Name      string     `json:"name"`
+	Parameter string     `json:"parameter"`
+	Files     []PlanFile `json:"files"` // 参数引用的字典和 PoC
+}
+
+// PlanFile 插件参数引用的文件
+type PlanFile struct {
+	Type   string `json:"type"` // dict 或 poc
+	Name   string `json:"name"`
+	Exists bool   `json:"exists"`
+	Lines  int    `json:"lines"`
+}
+
+// PlanEstimate 请求量估算，资产数量按目标主机数量计算，扫描中发现的子域名和端口会增加实际请求量
+type PlanEstimate struct {
+	Ports            int   `json:"ports"`            // 每个主机扫描的端口数量
+	PortProbes       int64 `json:"portProbes"`       // 主机数量 × 端口数量
+	SubdomainQueries int64 `json:"subdomainQueries"` // 域名数量 × 子域名字典大小
+	DirRequests      int64 `json:"dirRequests"`      // 资产数量 × 目录字典大小
+	Templates        int   `json:"templates"`        // 使用的 PoC 数量
+	VulnRequests     int64 `json:"vulnRequests"`     // 资产数量 × PoC 数量
+}
+
+// planDictionaries 模块中引用字典的参数和字典所在目录
+var planDictionaries = map[string]struct {
+	arg string
+	dir string
+}{
+	"SubdomainScan": {arg: "subfile", dir: "subdomain"},
+	"DirScan":       {arg: "d", dir: ""},
+}
+
+// PlanTask 生成任务计划
+func PlanTask(op options.TaskOptions, targets []string) *TaskPlan {
+	plan := &TaskPlan{
+		TaskId:   op.ID,
+		TaskName: op.TaskName,
+		Time:     utils.Tools.GetTimeNow(),
+	}
+	engine, err := scope.NewEngine(op.ID, op.Scope)
+	if err != nil {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("task scope invalid: %v", err))
+		engine, _ = scope.NewEngine(op.ID, nil)
+	}
+	domains := plan.planTargets(engine, targets)
+	if r := CheckCapability(op); r != nil && len(r.Labels) != 0 {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("node missing labels %v", strings.Join(r.Labels, ",")))
+	}
+
+	g := op.Pipeline
+	if g == nil {
+		g = pipeline.Default()
+	} else if err := ValidateGraph(g); err != nil {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("pipeline invalid: %v", err))
+		return plan
+	}
+	kept := make(map[string]bool)
+	for _, stage := range pruneGraph(g, &op).Stages {
+		kept[stage.Name] = true
+	}
+	hosts := int64(plan.Targets.Hosts)
+	for _, stage := range g.Stages {
+		planStage := PlanStage{
+			Name:   stage.Name,
+			Module: stage.Module,
+			Next:   stage.Next,
+			Pruned: !kept[stage.Name],
+		}
+		for _, pluginId := range stagePlugins(&op, stage) {
+			planStage.Plugins = append(planStage.Plugins, plan.planPlugin(&op, stage, pluginId))
+		}
+		plan.Stages = append(plan.Stages, planStage)
+		if planStage.Pruned {
+			continue
+		}
+		for _, plg := range planStage.Plugins {
+			for _, file := range plg.Files {
+				switch {
+				case stage.Module == "SubdomainScan" && file.Type == "dict":
+					plan.Estimate.SubdomainQueries += int64(domains) * int64(file.Lines)
+				case stage.Module == "DirScan" && file.Type == "dict":
+					plan.Estimate.DirRequests += hosts * int64(file.Lines)
+				case file.Type == "poc":
+					plan.Estimate.Templates += file.Lines
+				}
+			}
+		}
+		if stage.Module == "PortScan" && len(planStage.Plugins) != 0 {
+			ports, err := countPorts(op.PortRange)
+			if err != nil {
+				plan.Problems = append(plan.Problems, err.Error())
+			}
+			plan.Estimate.Ports = ports
+			plan.Estimate.PortProbes = hosts * int64(ports)
+		}
+	}
+	plan.Estimate.VulnRequests = hosts * int64(plan.Estimate.Templates)
+	return plan
+}
+
+// planTargets 展开 IP 段，使用目标解析插件解析目标并检查扫描范围，返回需要子域名扫描的域名数量
+func (plan *TaskPlan) planTargets(engine *scope.Engine, targets []string) int {
+	plan.Targets.Input = len(targets)
+	hosts := make(map[string]bool)
+	domains := 0
+	parser := targetparser.NewPlugin()
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		expanded, count := expandTarget(target)
+		if expanded == nil {
+			// IP 段太大，只计数
+			plan.Targets.Hosts += count
+			plan.Problems = append(plan.Problems, fmt.Sprintf("target %v expands to %v hosts, scope is not checked per host", target, count))
+			continue
+		}
+		for _, item := range expanded {
+			if ok, reason := engine.CheckTarget(item); !ok {
+				plan.Targets.Excluded = append(plan.Targets.Excluded, PlanExcluded{Target: item, Reason: reason})
+				continue
+			}
+			result := make(chan interface{}, 10)
+			parser.SetResult(result)
+			go func(item string) {
+				_, _ = parser.Execute(item)
+				close(result)
+			}(item)
+			parsed := false
+			for r := range result {
+				var host string
+				switch value := r.(type) {
+				case string:
+					host = value
+				case types.PortAlive:
+					host = value.Host
+				default:
+					continue
+				}
+				parsed = true
+				if hosts[host] {
+					continue
+				}
+				hosts[host] = true
+				if net.ParseIP(host) == nil {
+					domains++
+				}
+				if len(plan.Targets.Samples) < planSampleSize {
+					plan.Targets.Samples = append(plan.Targets.Samples, host)
+				}
+			}
+			if !parsed {
+				plan.Targets.Invalid = append(plan.Targets.Invalid, item)
+			}
+		}
+	}
+	plan.Targets.Hosts += len(hosts)
+	plan.Targets.Domains = domains
+	return domains
+}
+
+// planPlugin 插件的参数和参数引用的文件
+func (plan *TaskPlan) planPlugin(op *options.TaskOptions, stage pipeline.Stage, pluginId string) PlanPlugin {
+	result := PlanPlugin{Id: pluginId}
+	if plg, ok := plugins.GlobalPluginManager.GetPlugin(stage.Module, pluginId); ok {
+		result.Name = plg.GetName()
+	}
+	if ok, reason := pluginReady(stage.Module, pluginId); !ok {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("stage %v plugin %v %v on node", stage.Name, pluginId, reason))
+	}
+	if args, ok := utils.Tools.GetParameter(op.Parameters, stage.Module, pluginId); ok {
+		result.Parameter = args
+	}
+	if dict, ok := planDictionaries[stage.Module]; ok {
+		if name := planArg(result.Parameter, dict.arg); name != "" {
+			file := planFile("dict", name, filepath.Join(global.DictPath, dict.dir, name))
+			if !file.Exists {
+				plan.Problems = append(plan.Problems, fmt.Sprintf("stage %v plugin %v dictionary %v not found", stage.Name, pluginId, name))
+			}
+			result.Files = append(result.Files, file)
+		}
+	}
+	if stage.Module == "VulnerabilityScan" {
+		for _, file := range planTemplates(planArg(result.Parameter, "t")) {
+			if !file.Exists {
+				plan.Problems = append(plan.Problems, fmt.Sprintf("stage %v plugin %v poc %v not found", stage.Name, pluginId, file.Name))
+			}
+			result.Files = append(result.Files, file)
+		}
+	}
+	return result
+}
+
+// planArg 获取参数中 -key 的值，ParseArgs 遇到未声明的参数会失败，这里只查找需要的参数
+func planArg(parameter string, key string) string {
+	fields := strings.Fields(parameter)
+	for i, field := range fields {
+		name := strings.TrimLeft(field, "-")
+		if name == field {
+			continue
+		}
+		if name == key && i+1 < len(fields) {
+			return fields[i+1]
+		}
+		if strings.HasPrefix(name, key+"=") {
+			return strings.TrimPrefix(name, key+"=")
+		}
+	}
+	return ""
+}
+
+// planFile 检查文件是否存在并统计行数，PoC 的行数记为 1
+func planFile(typ string, name string, path string) PlanFile {
+	file := PlanFile{Type: typ, Name: name}
+	f, err := os.Open(path)
+	if err != nil {
+		return file
+	}
+	defer f.Close()
+	file.Exists = true
+	if typ == "poc" {
+		file.Lines = 1
+		return file
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) != "" {
+			file.Lines++
+		}
+	}
+	return file
+}
+
+// planTemplates nuclei 的 -t 参数，* 表示节点上的所有 PoC，为空时同样使用所有 PoC
+func planTemplates(value string) []PlanFile {
+	if value == "" || value == "*" {
+		matches, _ := filepath.Glob(filepath.Join(global.PocDir, "*.yaml"))
+		return []PlanFile{{Type: "poc", Name: "*", Exists: len(matches) != 0, Lines: len(matches)}}
+	}
+	var files []PlanFile
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(global.PocDir, name)
+		if filepath.Ext(name) == "" {
+			path += ".yaml"
+		}
+		files = append(files, planFile("poc", name, path))
+	}
+	return files
+}
+
+// expandTarget 展开 CIDR 和 IP 范围，超过 planExpandLimit 时返回 nil 和主机数量
+func expandTarget(target string) ([]string, int) {
+	if strings.Contains(target, "://") {
+		return []string{target}, 1
+	}
+	count := 0
+	if _, ipNet, err := net.ParseCIDR(target); err == nil {
+		ones, bits := ipNet.Mask.Size()
+		if bits-ones >= 31 {
+			count = planExpandLimit + 1
+		} else {
+			count = 1 << uint(bits-ones)
+		}
+	} else if parts := strings.Split(target, "-"); len(parts) == 2 {
+		start := net.ParseIP(strings.TrimSpace(parts[0])).To4()
+		end := net.ParseIP(strings.TrimSpace(parts[1])).To4()
+		if start != nil && end != nil {
+			count = int(binary.BigEndian.Uint32(end)) - int(binary.BigEndian.Uint32(start)) + 1
+		}
+	}
+	if count > planExpandLimit {
+		return nil, count
+	}
+	expanded, err := utils.Tools.GenerateTarget(target)
+	if err != nil || len(expanded) == 0 {
+		return []string{target}, 1
+	}
+	return expanded, len(expanded)
+}
+
+// countPorts 统计端口范围中的端口数量，例如 80,443,8000-9000
+func countPorts(portRange string) (int, error) {
+	if strings.TrimSpace(portRange) == "" {
+		return 0, fmt.Errorf("port range is empty, port scan will fail")
+	}
+	ports := make(map[int]bool)
+	for _, item := range strings.Split(portRange, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		start, end := item, item
+		if i := strings.Index(item, "-"); i >= 0 {
+			start, end = item[:i], item[i+1:]
+		}
+		s, err1 := strconv.Atoi(strings.TrimSpace(start))
+		e, err2 := strconv.Atoi(strings.TrimSpace(end))
+		if err1 != nil || err2 != nil || s < 1 || e > 65535 || s > e {
+			return len(ports), fmt.Errorf("invalid port range %v", item)
+		}
+		for port := s; port <= e; port++ {
+			ports[port] = true
+		}
+	}
+	return len(ports), nil
+}
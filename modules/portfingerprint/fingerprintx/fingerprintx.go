@@ -8,7 +8,6 @@
 package fingerprintx
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -124,7 +123,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	asset, ok := input.(*types.AssetOther)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not types.AssetOther\n", p.Name, input))
-		return nil, errors.New("input is not types.AssetOther")
+		return nil, fmt.Errorf("%w: input is not types.AssetOther", interfaces.ErrInputType)
 	}
 	if asset.Service != "" {
 		// 如果service不为空，说明有其他插件检出，直接返回
@@ -10,10 +10,12 @@ package portfingerprint
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -27,13 +29,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -41,37 +45,42 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
 		defer resultWg.Done()
-		var resultArray []interface{}
+		var resultArray types.MappingBatch
 		for {
 			select {
 			case result, ok := <-resultChan:
 				if !ok {
 					if len(resultArray) > 0 {
-						r.NextModule.GetInput() <- resultArray
+						next.Send(resultArray, "")
 					}
-					time.Sleep(3 * time.Second)
 					// 如果 resultChan 关闭了，退出循环
 					// 此模块运行完毕，关闭下个模块的输入
 					r.NextModule.CloseInput()
 					return
 				}
+				if !result.Is(types.KindAssetOther) {
+					pipeline.Unexpected(r.GetName(), result)
+					continue
+				}
 				// 将 result 加入数组
-				resultArray = append(resultArray, result)
+				resultArray = append(resultArray, result.Payload.(types.AssetOther))
 
 				// 如果数组长度超过 20，发送到下个模块并清空数组
 				if len(resultArray) > 10 {
-					r.NextModule.GetInput() <- resultArray
+					next.Send(resultArray, "")
 					resultArray = nil // 清空数组
 				}
 			}
@@ -85,7 +94,9 @@ func (r *Runner) ModuleRun() error {
 	doneCalled := false
 	for {
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -96,12 +107,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.PortFingerprint), duration)
 				}
 				if !doneCalled {
@@ -112,8 +123,11 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			_, ok = data.(types.PortAlive)
-			if !ok {
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
+			if !data.Is(types.KindPortAlive) {
 				r.NextModule.GetInput() <- data
 				continue
 			}
@@ -123,10 +137,10 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				//发送来的数据 只能是types.PortAlive
-				portAlive, _ := data.(types.PortAlive)
+				portAlive := data.Payload.(types.PortAlive)
 				var asset types.AssetOther
 				asset = types.AssetOther{
 					Host:    portAlive.Host,
@@ -138,16 +152,19 @@ func (r *Runner) ModuleRun() error {
 				if asset.Port == "" {
 					// 如果端口为空，则只测试http服务
 					asset.Type = "http"
-					resultChan <- asset
+					output.Send(asset, "")
 				} else {
 					if len(r.Option.PortFingerprint) != 0 {
 						// 调用插件
-						for _, pluginId := range r.Option.PortFingerprint {
+						// 插件依次识别并修改同一个资产，只能依次运行
+						cfg := config.ModulesConfig.GetPluginRun(r.GetName())
+						cfg.PluginMode = config.PluginSequential
+						pipeline.RunPlugins(r.GetName(), r.Option.PortFingerprint, cfg, func(pluginId string) bool {
 							//var plgWg sync.WaitGroup
 							var plgWg sync.WaitGroup
 							plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 							if flag {
-								logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+								logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 								plgWg.Add(1)
 								args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 								if argsFlag {
@@ -155,37 +172,38 @@ func (r *Runner) ModuleRun() error {
 								} else {
 									plg.SetParameter("")
 								}
-								plg.SetResult(resultChan)
+								pluginResult := output.Plugin(plg.GetName())
+								plg.SetResult(pluginResult.Ch)
 								plg.SetTaskId(r.Option.ID)
 								plg.SetTaskName(r.Option.TaskName)
+								// 每次执行使用资产的副本，超时后不再等待的插件修改的是副本
+								current := asset
 								pluginFunc := func(data interface{}) func() {
 									return func() {
 										defer plgWg.Done()
-										select {
-										case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-											return
-										default:
-											_, err := plg.Execute(data)
-											if err != nil {
-											}
-										}
+										pipeline.Execute(plg, data, pluginResult)
 									}
-								}(&asset)
+								}(&current)
 								err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 								if err != nil {
+									pluginResult.Close()
 									plgWg.Done()
 									logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 								}
 								plgWg.Wait()
+								if !pluginResult.Abandoned() {
+									asset = current
+								}
 								if asset.Service != "" {
 									// 如果已经识别到端口的服务，则退出循环不执行之后的插件
-									break
+									return false
 								}
-								logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+								logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 							} else {
 								logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 							}
-						}
+							return true
+						})
 						// 如果没有检测到端口服务，则获取原始响应
 						if asset.Service == "" {
 							asset.Type = "other"
@@ -208,15 +226,15 @@ func (r *Runner) ModuleRun() error {
 									asset.Raw = json.RawMessage("")
 								}
 							}
-							resultChan <- asset
+							output.Send(asset, "")
 						} else {
 							// 识别成功
-							resultChan <- asset
+							output.Send(asset, "")
 						}
 					} else {
 						// 如果没有开启端口指纹识别扫描，则只进行http测绘
 						asset.Type = "http"
-						resultChan <- asset
+						output.Send(asset, "")
 					}
 				}
 
@@ -226,7 +244,7 @@ func (r *Runner) ModuleRun() error {
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -234,10 +252,18 @@ func (r *Runner) GetName() string {
 	return "PortFingerprint"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindPortAlive, types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindMappingBatch}
+}
@@ -9,10 +9,12 @@ package portscan
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -26,13 +28,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -40,13 +44,14 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -60,7 +65,8 @@ func (r *Runner) ModuleRun() error {
 					r.NextModule.CloseInput()
 					return
 				}
-				if portaliveResult, ok := result.(types.PortAlive); ok {
+				if result.Is(types.KindPortAlive) {
+					portaliveResult := result.Payload.(types.PortAlive)
 					port := portaliveResult.Port
 					if port == "" {
 						port = "null"
@@ -70,6 +76,8 @@ func (r *Runner) ModuleRun() error {
 						// 本地缓存中不存在
 						r.NextModule.GetInput() <- result
 					}
+				} else {
+					pipeline.Unexpected(r.GetName(), result)
 				}
 			}
 		}
@@ -83,7 +91,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		//
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -94,12 +104,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.PortScan), duration)
 				}
 				if !doneCalled {
@@ -110,8 +120,11 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			_, ok = data.(types.DomainSkip)
-			if !ok {
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
+			if !data.Is(types.KindDomainSkip) {
 				r.NextModule.GetInput() <- data
 				continue
 			}
@@ -121,25 +134,25 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				// 无论有没有选择端口扫描 将原始数据发送到结果处
-				domainSkip, _ := data.(types.DomainSkip)
+				domainSkip := data.Payload.(types.DomainSkip)
 				result := types.PortAlive{
 					Host: domainSkip.Domain,
 					IP:   "",
 					Port: "",
 				}
-				resultChan <- result
+				output.Send(result, "")
 				//发送来的数据 只能是types.DomainSkip
 				if len(r.Option.PortScan) != 0 {
 					// 调用插件
-					for _, pluginId := range r.Option.PortScan {
+					pipeline.RunPlugins(r.GetName(), r.Option.PortScan, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 						if flag {
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 							plgWg.Add(1)
 							args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 							if argsFlag {
@@ -150,33 +163,29 @@ func (r *Runner) ModuleRun() error {
 							newParameter := plg.GetParameter() + " -port " + r.Option.PortRange
 							plg.SetParameter(newParameter)
 
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(data)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, data, pluginResult)
 								}
-							}(data)
+							}(data.Payload)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
 							plgWg.Wait()
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 				}
 			}(data)
 
@@ -184,7 +193,7 @@ func (r *Runner) ModuleRun() error {
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -192,10 +201,18 @@ func (r *Runner) GetName() string {
 	return "PortScan"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindDomainSkip, types.KindPortAlive, types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindPortAlive, types.KindMappingBatch}
+}
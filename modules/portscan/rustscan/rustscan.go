@@ -10,11 +10,11 @@ package rustscan
 import (
 	"bufio"
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/toolchain"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
@@ -147,27 +147,15 @@ func (p *Plugin) Install() error {
 
 	RustscanPath := filepath.Join(global.ExtDir, "rustscan")
 	RustscanExecPath := filepath.Join(RustscanPath, p.RustFileName)
-	if _, err := os.Stat(RustscanExecPath); os.IsNotExist(err) {
-		_, err := utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://raw.githubusercontent.com/Autumn-27/ScopeSentry-Scan/raw/refs/heads/1.5-restructure/tools", p.RustDir, p.RustFileName), RustscanExecPath)
-		if err != nil {
-			_, err = utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://gitee.com/constL/ScopeSentry-Scan/raw/1.5-restructure/tools", p.RustDir, p.RustFileName), RustscanExecPath)
-			if err != nil {
-				return err
-			}
-		}
-		if p.OsType == "linux" {
-			err = os.Chmod(RustscanExecPath, 0755)
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("Chmod rustscan Tool Fail: %s", err))
-				return err
-			}
-		}
+	if err := toolchain.Ensure("rustscan", RustscanExecPath); err != nil {
+		logger.SlogError(fmt.Sprintf("Install rustscan Tool Fail: %s", err))
+		return err
 	}
 	return nil
 }
 
 func (p *Plugin) Check() error {
-	return nil
+	return toolchain.Verify("rustscan", filepath.Join(global.ExtDir, "rustscan", p.RustFileName))
 }
 
 func (p *Plugin) SetParameter(args string) {
@@ -184,7 +172,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	domainSkip, ok := input.(types.DomainSkip)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not types.DomainSkip\n", p.Name, input))
-		return nil, errors.New("input is not types.DomainSkip")
+		return nil, fmt.Errorf("%w: input is not types.DomainSkip", interfaces.ErrInputType)
 	}
 	parameter := p.GetParameter()
 	PortBatchSize := "600"
@@ -247,6 +235,8 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 		logger.SlogWarnLocal(fmt.Sprintf("RustScan cmd.Start error： %v", err))
 		return nil, err
 	}
+	utils.Processes.Track(cmd)
+	defer utils.Processes.Untrack(cmd)
 	scanner := bufio.NewScanner(stdout)
 	for scanner.Scan() {
 		r := scanner.Text()
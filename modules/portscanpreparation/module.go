@@ -9,10 +9,12 @@ package portscanpreparation
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -25,13 +27,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -39,13 +43,14 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -72,7 +77,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		//
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -83,12 +90,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.PortScanPreparation), duration)
 				}
 				if !doneCalled {
@@ -99,8 +106,11 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			_, ok = data.(types.DomainResolve)
-			if !ok {
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
+			if !data.Is(types.KindDomainResolve) {
 				r.NextModule.GetInput() <- data
 				continue
 			}
@@ -110,10 +120,10 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				//发送来的数据 只能是types.DomainResolve
-				domainResolveResult, _ := data.(types.DomainResolve)
+				domainResolveResult := data.Payload.(types.DomainResolve)
 				var domainSkip types.DomainSkip
 				domainSkip = types.DomainSkip{
 					Domain: domainResolveResult.Domain,
@@ -123,12 +133,15 @@ func (r *Runner) ModuleRun() error {
 
 				if len(r.Option.PortScanPreparation) != 0 {
 					// 调用插件
-					for _, pluginId := range r.Option.PortScanPreparation {
+					// 插件依次处理并修改同一个 domainSkip，只能依次运行
+					cfg := config.ModulesConfig.GetPluginRun(r.GetName())
+					cfg.PluginMode = config.PluginSequential
+					pipeline.RunPlugins(r.GetName(), r.Option.PortScanPreparation, cfg, func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 						if flag {
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 							plgWg.Add(1)
 							args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 							if argsFlag {
@@ -136,45 +149,46 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
+							// 每次执行使用副本，超时后不再等待的插件修改的是副本
+							current := domainSkip
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(data)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, data, pluginResult)
 								}
-							}(&domainSkip)
+							}(&current)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
 							plgWg.Wait()
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+							if !pluginResult.Abandoned() {
+								domainSkip = current
+							}
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 					// 插件运行结束，此模块比较特殊，每个插件都是对domainSkip进行处理
-					resultChan <- domainSkip
+					output.Send(domainSkip, "")
 				} else {
 					// 没有开启跳过端口扫描检测，直接将输入发送到下个模块domainSkip进行更改，最后的结果发送到result
-					resultChan <- domainSkip
+					output.Send(domainSkip, "")
 				}
 			}(data)
 		}
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -182,10 +196,18 @@ func (r *Runner) GetName() string {
 	return "PortScanPreparation"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindDomainResolve, types.KindPortAlive, types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindDomainSkip, types.KindPortAlive, types.KindMappingBatch}
+}
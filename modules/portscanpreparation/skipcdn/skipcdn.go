@@ -8,7 +8,6 @@
 package skipcdn
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -116,7 +115,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	domainSkip, ok := input.(*types.DomainSkip)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not types.DomainSkip\n", p.Name, input))
-		return nil, errors.New("input is not types.DomainSkip")
+		return nil, fmt.Errorf("%w: input is not types.DomainSkip", interfaces.ErrInputType)
 	}
 	if domainSkip.Skip {
 		return nil, nil
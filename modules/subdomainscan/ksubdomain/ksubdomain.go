@@ -9,11 +9,11 @@ package ksubdomain
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/toolchain"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"os"
@@ -120,42 +120,27 @@ func (p *Plugin) Install() error {
 		logger.SlogError(fmt.Sprintf("Failed to create resultPath folder:", err))
 		return err
 	}
-	osType := runtime.GOOS
+	if err := toolchain.Ensure("ksubdomain", execPath()); err != nil {
+		logger.SlogError(fmt.Sprintf("Install ksubdomain Tool Fail: %s", err))
+		return err
+	}
+	return nil
+}
+
+// execPath ksubdomain 可执行文件的路径
+func execPath() string {
+	path := "ksubdomain"
 	// 判断操作系统类型
-	var path string
-	var dir string
-	switch osType {
-	case "windows":
+	if runtime.GOOS == "windows" {
 		path = "ksubdomain.exe"
-		dir = "win"
-	case "linux":
-		path = "ksubdomain"
-		dir = "linux"
-	default:
-		dir = "darwin"
-		path = "ksubdomain"
-	}
-	KsubdomainExecPath := filepath.Join(ksubdomainPath, path)
-	if _, err := os.Stat(KsubdomainExecPath); os.IsNotExist(err) {
-		_, err := utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://raw.githubusercontent.com/Autumn-27/ScopeSentry-Scan/main/tools", dir, path), KsubdomainExecPath)
-		if err != nil {
-			_, err = utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://gitee.com/constL/ScopeSentry-Scan/raw/main/tools", dir, path), KsubdomainExecPath)
-			if err != nil {
-				return err
-			}
-		}
-		if osType == "linux" {
-			err = os.Chmod(KsubdomainExecPath, 0755)
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("Chmod ksubdomain Tool Fail: %s", err))
-				return err
-			}
-		}
 	}
-	return nil
+	return filepath.Join(global.ExtDir, "ksubdomain", path)
 }
 
 func (p *Plugin) Check() error {
+	if err := toolchain.Verify("ksubdomain", execPath()); err != nil {
+		return err
+	}
 	rawSubdomain := []string{"scope-sentry.top"}
 	subdomainVerificationResult := make(chan string, 1)
 	verificationCount := 0
@@ -189,7 +174,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	target, ok := input.(string)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not a string\n", p.Name, input))
-		return nil, errors.New("input is not a string")
+		return nil, fmt.Errorf("%w: input is not a string", interfaces.ErrInputType)
 	}
 	wildcardSubdomainResults := wildcardDNSRecords(target)
 	wildcardDNSRecordsLen := len(wildcardSubdomainResults)
@@ -9,10 +9,12 @@ package subdomainscan
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -21,19 +23,22 @@ import (
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -41,13 +46,15 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -61,8 +68,12 @@ func (r *Runner) ModuleRun() error {
 					r.NextModule.CloseInput()
 					return
 				}
-				if subdomainResult, ok := result.(types.SubdomainResult); ok {
+				switch result.Kind {
+				case types.KindSubdomain:
+					subdomainResult := result.Payload.(types.SubdomainResult)
 					subdomainResult.TaskName = r.Option.TaskName
+					subdomainResult.TaskId = r.Option.ID
+					result.Payload = subdomainResult
 					flag := results.Duplicate.SubdomainInTask(r.Option.ID, subdomainResult.Host, r.Option.IsRestart)
 					if flag {
 						if r.Option.Duplicates == "subdomain" && !r.Option.IsRestart {
@@ -70,46 +81,42 @@ func (r *Runner) ModuleRun() error {
 							flag = results.Duplicate.SubdomainInMongoDb(&subdomainResult)
 							if flag {
 								// 没有在mongodb中查询到该子域名，存入数据库中并且开始扫描
-								go results.Handler.Subdomain(&subdomainResult)
+								results.Handler.Subdomain(&subdomainResult)
 								// 将子域名解析结果发送到下个模块
-								r.NextModule.GetInput() <- subdomainResult
+								r.NextModule.GetInput() <- result
 							}
 						} else {
 							// 存入数据库中，并且开始扫描
-							go results.Handler.Subdomain(&subdomainResult)
+							results.Handler.Subdomain(&subdomainResult)
 							// 将子域名解析结果发送到下个模块
-							r.NextModule.GetInput() <- subdomainResult
+							r.NextModule.GetInput() <- result
 						}
-					} else {
-						// 跳过当前任务中已扫描的子域名
-						continue
 					}
-				} else {
-					// 如果发来的不是types.SubdomainResult，说明是上个模块的输出直接过来的，或者是没有开启此模块的扫描，直接发送到下个模块
-					target, ok := result.(string)
-					if !ok {
-						r.NextModule.GetInput() <- result
-					} else {
-						// 判断该目标是否在当前任务此节点或者其他节点已经扫描过了
-						flag := results.Duplicate.SubdomainInTask(r.Option.ID, target, r.Option.IsRestart)
-						if flag {
-							if net.ParseIP(target) != nil {
-								tmp := types.SubdomainResult{
-									Host: target,
-									IP:   []string{target},
-								}
-								r.NextModule.GetInput() <- tmp
-							} else {
-								resultDns := utils.DNS.QueryOne(result.(string))
-								tmp := utils.DNS.DNSdataToSubdomainResult(resultDns)
-								// 无论是否有解析ip都发送到后边
-								tmp.TaskName = r.Option.TaskName
-								go results.Handler.Subdomain(&tmp)
-								r.NextModule.GetInput() <- tmp
+					// 跳过当前任务中已扫描的子域名
+				case types.KindTarget:
+					// 原始目标或者插件输出的域名，判断该目标是否在当前任务此节点或者其他节点已经扫描过了
+					target := result.Payload.(string)
+					flag := results.Duplicate.SubdomainInTask(r.Option.ID, target, r.Option.IsRestart)
+					if flag {
+						if net.ParseIP(target) != nil {
+							tmp := types.SubdomainResult{
+								Host: target,
+								IP:   []string{target},
 							}
+							next.Send(tmp, result.Plugin)
+						} else {
+							resultDns := utils.DNS.QueryOne(target)
+							tmp := utils.DNS.DNSdataToSubdomainResult(resultDns)
+							// 无论是否有解析ip都发送到后边
+							tmp.TaskName = r.Option.TaskName
+							tmp.TaskId = r.Option.ID
+							results.Handler.Subdomain(&tmp)
+							next.Send(tmp, result.Plugin)
 						}
 					}
-
+				default:
+					// 上个模块的输出直接发送到下个模块
+					r.NextModule.GetInput() <- result
 				}
 			}
 		}
@@ -123,7 +130,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		// 输入有两种可能，一种域名，一种ip
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -134,13 +143,13 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				logger.SlogDebugLocal(fmt.Sprintf("%v关闭: input开始关闭", r.GetName()))
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.SubdomainScan), duration)
 				}
 				logger.SlogDebugLocal(fmt.Sprintf("%v关闭: 结果处理完毕", r.GetName()))
@@ -152,36 +161,35 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			//_, ok = data.(string)
-			//if !ok {
-			//	r.NextModule.GetInput() <- data
-			//	continue
-			//}
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
 			if !firstData {
 				start = time.Now()
 				handler.TaskHandle.ProgressStart(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.SubdomainScan))
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				// 将原始数据发送给下一个模块，防止漏掉原始目标的测绘
 				resultChan <- data
-				t, _ := data.(string)
-				if net.ParseIP(t) != nil {
+				// 只对域名进行子域名扫描
+				if !data.Is(types.KindTarget) || net.ParseIP(data.Payload.(string)) != nil {
 					return
 				}
 				// 如果开启了子域名扫描
 				if len(r.Option.SubdomainScan) != 0 {
-					// 跳过插件
-					skipPluginFlag := true
+					// 插件没有找到时已经发送过原始数据，并行运行插件时会同时访问
+					var skipped atomic.Bool
 					// 调用插件
-					for _, pluginId := range r.Option.SubdomainScan {
+					pipeline.RunPlugins(r.GetName(), r.Option.SubdomainScan, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 						if flag {
-							logger.SlogInfoLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+							logger.SlogInfoLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 							plgWg.Add(1)
 							args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 							if argsFlag {
@@ -194,39 +202,34 @@ func (r *Runner) ModuleRun() error {
 							//	newParameter := plg.GetParameter() + " -subfile " + r.Option.SubdomainFilename
 							//	plg.SetParameter(newParameter)
 							//}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(data)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, data, pluginResult)
 								}
-							}(data)
+							}(data.Payload)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
 							plgWg.Wait()
-							logger.SlogInfoLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+							logger.SlogInfoLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 						} else {
 							// 插件没有找到跳过此插件
 							logger.SlogError(fmt.Sprintf("plugin %v not found, Skip this plugin", pluginId))
 							// 在多个插件都没有找到的情况下只发送一次
-							if skipPluginFlag {
+							if skipped.CompareAndSwap(false, true) {
 								resultChan <- data
-								skipPluginFlag = false
 							}
 						}
-					}
+						return true
+					})
 				}
 
 			}(data)
@@ -235,7 +238,7 @@ func (r *Runner) ModuleRun() error {
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -243,10 +246,18 @@ func (r *Runner) GetName() string {
 	return "SubdomainScan"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindTarget, types.KindPortAlive, types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindSubdomain, types.KindPortAlive, types.KindMappingBatch}
+}
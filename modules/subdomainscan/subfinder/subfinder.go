@@ -9,7 +9,6 @@ package subfinder
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
@@ -123,7 +122,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	target, ok := input.(string)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not a string\n", p.Name, input))
-		return nil, errors.New("input is not a string")
+		return nil, fmt.Errorf("%w: input is not a string", interfaces.ErrInputType)
 	}
 	parameter := p.GetParameter()
 	threads := 10
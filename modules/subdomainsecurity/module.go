@@ -9,10 +9,12 @@ package subdomainsecurity
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -26,13 +28,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -41,13 +45,15 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -62,10 +68,12 @@ func (r *Runner) ModuleRun() error {
 					r.NextModule.CloseInput()
 					return
 				}
-				if subdomainTakeoverResult, ok := result.(types.SubTakeResult); ok {
+				if result.Is(types.KindSubdomainTakeover) {
+					subdomainTakeoverResult := result.Payload.(types.SubTakeResult)
 					// 子域名接管检测结果，无需发送到下个模块
 					subdomainTakeoverResult.TaskName = r.Option.TaskName
-					go results.Handler.SubdomainTakeover(&subdomainTakeoverResult)
+					subdomainTakeoverResult.TaskId = r.Option.ID
+					results.Handler.SubdomainTakeover(&subdomainTakeoverResult)
 					logger.SlogInfoLocal(fmt.Sprintf("Find subdomain takeover: %v - %v", subdomainTakeoverResult.Input, subdomainTakeoverResult.Value))
 				} else {
 					// DomainResolve直接发送到下个模块
@@ -83,7 +91,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		// 输入为DNS信息
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -94,13 +104,13 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				logger.SlogDebugLocal(fmt.Sprintf("%v关闭: input开始关闭", r.GetName()))
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.SubdomainSecurity), duration)
 				}
 				if !doneCalled {
@@ -111,17 +121,21 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			subdomain, ok := data.(types.SubdomainResult)
-			if !ok {
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
+			if !data.Is(types.KindSubdomain) {
 				r.NextModule.GetInput() <- data
 				continue
 			}
+			subdomain := data.Payload.(types.SubdomainResult)
 			// 转换为DomainResolve发送到下个模块
 			tmp := types.DomainResolve{
 				Domain: subdomain.Host,
 				IP:     subdomain.IP,
 			}
-			r.NextModule.GetInput() <- tmp
+			next.Send(tmp, data.Plugin)
 
 			if !firstData {
 				start = time.Now()
@@ -129,18 +143,17 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				// 如果开启了子域名安全检查扫描
 				if len(r.Option.SubdomainSecurity) != 0 {
-					skipPluginFlag := true
 					// 调用插件
-					for _, pluginId := range r.Option.SubdomainSecurity {
+					pipeline.RunPlugins(r.GetName(), r.Option.SubdomainSecurity, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 						if flag {
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 							plgWg.Add(1)
 							args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 							if argsFlag {
@@ -148,39 +161,30 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										_, err := plg.Execute(data)
-										if err != nil {
-										}
-									}
+									pipeline.Execute(plg, data, pluginResult)
 								}
-							}(data)
+							}(data.Payload)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
 							plgWg.Wait()
-							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+							logger.SlogDebugLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 						} else {
-							// 插件没有找到跳过此插件
+							// 插件没有找到跳过此插件，DomainResolve 已经发送到下个模块
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
-							// 在多个插件都没有找到的情况下只发送一次
-							if skipPluginFlag {
-								resultChan <- data
-								skipPluginFlag = false
-							}
 						}
-					}
+						return true
+					})
 				} else {
 					// 没有开启子域名安全检查扫描，将数据转换一下发送到结果
 					// 前边已经发送了
@@ -199,7 +203,7 @@ func (r *Runner) ModuleRun() error {
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -207,10 +211,18 @@ func (r *Runner) GetName() string {
 	return "SubdomainSecurity"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindSubdomain, types.KindPortAlive, types.KindMappingBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindDomainResolve, types.KindPortAlive, types.KindMappingBatch}
+}
@@ -8,7 +8,6 @@
 package subdomaintakeover
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
@@ -119,7 +118,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	subdomain, ok := input.(types.SubdomainResult)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not a SubdomainResult\n", p.Name, input))
-		return nil, errors.New("input is not a SubdomainResult")
+		return nil, fmt.Errorf("%w: input is not a SubdomainResult", interfaces.ErrInputType)
 	}
 	if subdomain.Type == "CNAME" {
 		// 如果是CNAME类型的子域名，开始检查子域名接管
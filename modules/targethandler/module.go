@@ -9,13 +9,16 @@ package targethandler
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
 	"sync"
@@ -25,18 +28,20 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 	Name       string
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -48,13 +53,14 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{})
+	resultChan := make(chan types.Message)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -63,25 +69,24 @@ func (r *Runner) ModuleRun() error {
 			select {
 			case result, ok := <-resultChan:
 				if !ok {
-					time.Sleep(10 * time.Second)
+					// 此模块运行完毕，关闭下个模块的输入
 					r.NextModule.CloseInput()
 					return
 				}
 				// 处理每个插件的结果
 				// 对目标的输出进行去重，防止多个插件返回相同的结果
-				target, ok := result.(string)
-				if !ok {
+				if !result.Is(types.KindTarget) {
 					r.NextModule.GetInput() <- result
 				} else {
 					if r.Option.IsRestart {
 						// 如果是重启的不进行去重
 						r.NextModule.GetInput() <- result
 					} else {
-						key := "duplicates:" + r.Option.ID + ":target:" + target
+						key := "duplicates:" + r.Option.ID + ":target:" + result.Payload.(string)
 						flag := results.Duplicate.DuplicateLocalCache(key)
 						if flag {
 							// 本地缓存中不存在，则没有重复，发到下个模块
-							logger.SlogInfoLocal(fmt.Sprintf("%v module target %v result: %v", r.GetName(), r.Option.Target, result))
+							logger.SlogInfoLocal(fmt.Sprintf("%v module target %v result: %v", r.GetName(), r.Option.Target, result.Payload))
 							r.NextModule.GetInput() <- result
 						}
 					}
@@ -96,7 +101,9 @@ func (r *Runner) ModuleRun() error {
 	doneCalled := false
 	for {
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -107,12 +114,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				// 等待所有插件运行完毕
 				allPluginWg.Wait()
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.TargetHandler), duration)
 				}
 				if !doneCalled {
@@ -123,9 +130,8 @@ func (r *Runner) ModuleRun() error {
 				}
 				return nil
 			}
-			_, ok = data.(string)
-			if !ok {
-				r.NextModule.GetInput() <- data
+			if !data.Is(types.KindTarget) {
+				pipeline.Unexpected(r.GetName(), data)
 				continue
 			}
 			if !firstData {
@@ -134,14 +140,14 @@ func (r *Runner) ModuleRun() error {
 				firstData = true
 			}
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 				// 处理输入数据
-				for _, pluginId := range r.Option.TargetHandler {
+				pipeline.RunPlugins(r.GetName(), r.Option.TargetHandler, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 					var plgWg sync.WaitGroup
 					plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
 					if flag {
-						logger.SlogInfoLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data))
+						logger.SlogInfoLocal(fmt.Sprintf("%v plugin start execute: %v", plg.GetName(), data.Payload))
 						plgWg.Add(1)
 						args, argsFlag := utils.Tools.GetParameter(r.Option.Parameters, r.GetName(), plg.GetPluginId())
 						if argsFlag {
@@ -149,43 +155,47 @@ func (r *Runner) ModuleRun() error {
 						} else {
 							plg.SetParameter("")
 						}
-						plg.SetResult(resultChan)
+						pluginResult := output.Plugin(plg.GetName())
+						plg.SetResult(pluginResult.Ch)
 						plg.SetTaskId(r.Option.ID)
 						plg.SetTaskName(r.Option.TaskName)
 						pluginFunc := func(data interface{}) func() {
 							return func() {
 								defer plgWg.Done()
-								select {
-								case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-									return
-								default:
-									_, err := plg.Execute(data)
-									if err != nil {
-									}
-								}
+								pipeline.Execute(plg, data, pluginResult)
 							}
-						}(data)
+						}(data.Payload)
 						err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 						if err != nil {
+							pluginResult.Close()
 							plgWg.Done()
 							logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 						}
 						plgWg.Wait()
-						logger.SlogInfoLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data))
+						logger.SlogInfoLocal(fmt.Sprintf("%v plugin end execute: %v", plg.GetName(), data.Payload))
 					} else {
 						logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 					}
-				}
+					return true
+				})
 			}(data)
 
 		}
 	}
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindTarget}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindTarget, types.KindPortAlive, types.KindMappingBatch}
+}
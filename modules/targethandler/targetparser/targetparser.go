@@ -8,7 +8,6 @@
 package targetparser
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
@@ -169,7 +168,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	target, ok := input.(string)
 	if !ok {
 		logger.SlogError(fmt.Sprintf("%v error: %v input is not a string\n", p.Name, input))
-		return nil, errors.New("input is not a string")
+		return nil, fmt.Errorf("%w: input is not a string", interfaces.ErrInputType)
 	}
 	// 检查是否是 IP 地址
 	if net.ParseIP(target) != nil {
@@ -9,12 +9,12 @@ package katana
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/toolchain"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
@@ -146,27 +146,15 @@ func (p *Plugin) Install() error {
 		return err
 	}
 	KatanaExecPath := filepath.Join(katanaPath, p.KatanaFileName)
-	if _, err := os.Stat(KatanaExecPath); os.IsNotExist(err) {
-		_, err := utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://raw.githubusercontent.com/Autumn-27/ScopeSentry-Scan/refs/heads/1.5-restructure/tools", p.KatanaDir, p.KatanaFileName), KatanaExecPath)
-		if err != nil {
-			_, err = utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://gitee.com/constL/ScopeSentry-Scan/raw/main/tools", p.KatanaDir, p.KatanaFileName), KatanaExecPath)
-			if err != nil {
-				return err
-			}
-		}
-		if p.OsType == "linux" {
-			err = os.Chmod(KatanaExecPath, 0755)
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("Chmod katana Tool Fail: %s", err))
-				return err
-			}
-		}
+	if err := toolchain.Ensure("katana", KatanaExecPath); err != nil {
+		logger.SlogError(fmt.Sprintf("Install katana Tool Fail: %s", err))
+		return err
 	}
 	return nil
 }
 
 func (p *Plugin) Check() error {
-	return nil
+	return toolchain.Verify("katana", filepath.Join(global.ExtDir, "katana", p.KatanaFileName))
 }
 
 func (p *Plugin) SetParameter(args string) {
@@ -181,7 +169,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.(types.AssetHttp)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not AssetHttp\n", p.Name, input))
-		return nil, errors.New("input is not AssetHttp")
+		return nil, fmt.Errorf("%w: input is not AssetHttp", interfaces.ErrInputType)
 	}
 	p.Log(fmt.Sprintf("target %v running", data.URL))
 	parameter := p.GetParameter()
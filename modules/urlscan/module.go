@@ -9,10 +9,12 @@ package urlscan
 
 import (
 	"fmt"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/config"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/handler"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/options"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/pipeline"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/plugins"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/pool"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -26,13 +28,15 @@ import (
 type Runner struct {
 	Option     *options.TaskOptions
 	NextModule interfaces.ModuleRunner
-	Input      chan interface{}
+	Input      chan types.Message
+	Stage      string // 模块所在的流程阶段名称
 }
 
-func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner) *Runner {
+func NewRunner(op *options.TaskOptions, nextModule interfaces.ModuleRunner, stage string) *Runner {
 	return &Runner{
 		Option:     op,
 		NextModule: nextModule,
+		Stage:      stage,
 	}
 }
 
@@ -40,13 +44,15 @@ func (r *Runner) ModuleRun() error {
 	var allPluginWg sync.WaitGroup
 	var resultWg sync.WaitGroup
 	// 创建一个共享的 result 通道
-	resultChan := make(chan interface{}, 100)
+	resultChan := make(chan types.Message, 100)
 	go func() {
 		err := r.NextModule.ModuleRun()
 		if err != nil {
 			logger.SlogError(fmt.Sprintf("Next module run error: %v", err))
 		}
 	}()
+	output := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, resultChan)
+	next := pipeline.NewOutput(r.GetName(), r.Stage, r.Option.Target, r.Option.ID, r.NextModule.GetInput())
 	// 结果处理 goroutine，异步读取插件的结果
 	resultWg.Add(1)
 	go func() {
@@ -63,14 +69,15 @@ func (r *Runner) ModuleRun() error {
 				// 这里的输入为types.UrlResult，将types.UrlResult处理一下存入数据库并发送到下个模块
 				// 原始的types.AssetOther 、 types.AssetHttp 在读取input的时候已经发送到下个模块了
 				// 该结果已经在插件中进行去重
-				if urlResult, ok := result.(types.UrlResult); ok {
+				if result.Is(types.KindUrl) {
+					urlResult := result.Payload.(types.UrlResult)
 					urlResult.TaskName = r.Option.TaskName
+					urlResult.TaskId = r.Option.ID
 					hash := utils.Tools.GenerateHash()
 					urlResult.ResultId = hash
-					go results.Handler.URL(&urlResult)
-					r.NextModule.GetInput() <- urlResult
-				} else if urlList, ok := result.([]string); ok {
-					r.NextModule.GetInput() <- urlList
+					results.Handler.URL(&urlResult)
+					result.Payload = urlResult
+					r.NextModule.GetInput() <- result
 				} else {
 					r.NextModule.GetInput() <- result
 				}
@@ -86,7 +93,9 @@ func (r *Runner) ModuleRun() error {
 	for {
 		//
 		select {
-		case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
+		case <-contextmanager.GlobalContextManagers.GetTargetContext(r.Option.ID, r.Option.Target).Done():
+			// 任务取消或目标超过截止时间后继续读取输入直到上游关闭，防止上游阻塞
+			go pipeline.Drain(r.Input)
 			allPluginWg.Wait()
 			if !doneCalled {
 				close(resultChan)
@@ -97,12 +106,12 @@ func (r *Runner) ModuleRun() error {
 			return nil
 		case data, ok := <-r.Input:
 			if !ok {
-				time.Sleep(3 * time.Second)
 				allPluginWg.Wait()
 				// 通道已关闭，结束处理
 				if firstData {
 					end = time.Now()
 					duration := end.Sub(start)
+					output.Finish()
 					handler.TaskHandle.ProgressEnd(r.GetName(), r.Option.Target, r.Option.ID, len(r.Option.URLScan), duration)
 				}
 				logger.SlogDebugLocal(fmt.Sprintf("module %v target %v close resultChan", r.GetName(), r.Option.Target))
@@ -115,9 +124,13 @@ func (r *Runner) ModuleRun() error {
 				return nil
 			}
 			// 将原始数据发送到下个模块，这里的输入为 types.AssetOther 、 types.AssetHttp
+			if !pipeline.Accepts(r.Consumes(), data.Kind) {
+				pipeline.Unexpected(r.GetName(), data)
+				continue
+			}
 			r.NextModule.GetInput() <- data
-			// 如果是AssetOther，不运行该模块，只运行http资产
-			if _, ok := data.(types.AssetOther); ok {
+			// 只运行http资产，AssetOther 以及资产数组直接发送到下个模块
+			if !data.Is(types.KindAssetHttp) {
 				continue
 			}
 			if !firstData {
@@ -127,13 +140,15 @@ func (r *Runner) ModuleRun() error {
 			}
 
 			allPluginWg.Add(1)
-			go func(data interface{}) {
+			go func(data types.Message) {
 				defer allPluginWg.Done()
 
 				if len(r.Option.URLScan) != 0 {
 					var urlList []string
+					// 插件并行运行时同时写入 urlList
+					var urlListMu sync.Mutex
 					// 调用插件
-					for _, pluginId := range r.Option.URLScan {
+					pipeline.RunPlugins(r.GetName(), r.Option.URLScan, config.ModulesConfig.GetPluginRun(r.GetName()), func(pluginId string) bool {
 						//var plgWg sync.WaitGroup
 						var plgWg sync.WaitGroup
 						plg, flag := plugins.GlobalPluginManager.GetPlugin(r.GetName(), pluginId)
@@ -146,30 +161,29 @@ func (r *Runner) ModuleRun() error {
 							} else {
 								plg.SetParameter("")
 							}
-							plg.SetResult(resultChan)
+							pluginResult := output.Plugin(plg.GetName())
+							plg.SetResult(pluginResult.Ch)
 							plg.SetTaskId(r.Option.ID)
 							plg.SetTaskName(r.Option.TaskName)
 							pluginFunc := func(data interface{}) func() {
 								return func() {
 									defer plgWg.Done()
-									select {
-									case <-contextmanager.GlobalContextManagers.GetContext(r.Option.ID).Done():
-										return
-									default:
-										urlS, err := plg.Execute(data)
-										if err == nil {
-											urls, ok := urlS.([]string)
-											if ok {
-												if len(urls) > 0 {
-													urlList = append(urlList, urls...)
-												}
+									urlS, err := pipeline.Execute(plg, data, pluginResult)
+									if err == nil {
+										urls, ok := urlS.([]string)
+										if ok {
+											if len(urls) > 0 {
+												urlListMu.Lock()
+												urlList = append(urlList, urls...)
+												urlListMu.Unlock()
 											}
 										}
 									}
 								}
-							}(data)
+							}(data.Payload)
 							err := pool.PoolManage.SubmitTask(r.GetName(), pluginFunc)
 							if err != nil {
+								pluginResult.Close()
 								plgWg.Done()
 								logger.SlogError(fmt.Sprintf("task pool error: %v", err))
 							}
@@ -178,29 +192,28 @@ func (r *Runner) ModuleRun() error {
 						} else {
 							logger.SlogError(fmt.Sprintf("plugin %v not found", pluginId))
 						}
-					}
+						return true
+					})
 					if len(urlList) > 0 {
 						// 如果urlList不为空，则发送到爬虫模块，将这些url作为输入进行爬虫
-						r.NextModule.GetInput() <- urlList
+						next.Send(urlList, "")
 					} else {
 						// 如果为空，则将http资产的url作为数组传递到爬虫模块进行爬虫
-						if httpData, ok := data.(types.AssetHttp); ok {
-							r.NextModule.GetInput() <- []string{httpData.URL}
-						}
+						httpData := data.Payload.(types.AssetHttp)
+						next.Send([]string{httpData.URL}, "")
 					}
 				} else {
 					// 如果没有开启url扫描，则将爬虫的目标发到下个模块
-					if httpData, ok := data.(types.AssetHttp); ok {
-						// 如果没有开启 把http转一个urlresult发往下个模块 用于检测首页的敏感信息泄露
-						r.NextModule.GetInput() <- types.UrlResult{
-							Input:      httpData.URL,
-							Output:     httpData.URL,
-							OutputType: "httpx",
-							ResultId:   utils.Tools.GenerateHash(),
-							Body:       httpData.ResponseBody,
-						}
-						r.NextModule.GetInput() <- []string{httpData.URL}
-					}
+					httpData := data.Payload.(types.AssetHttp)
+					// 如果没有开启 把http转一个urlresult发往下个模块 用于检测首页的敏感信息泄露
+					next.Send(types.UrlResult{
+						Input:      httpData.URL,
+						Output:     httpData.URL,
+						OutputType: "httpx",
+						ResultId:   utils.Tools.GenerateHash(),
+						Body:       httpData.ResponseBody,
+					}, "")
+					next.Send([]string{httpData.URL}, "")
 				}
 
 			}(data)
@@ -208,7 +221,7 @@ func (r *Runner) ModuleRun() error {
 	}
 }
 
-func (r *Runner) SetInput(ch chan interface{}) {
+func (r *Runner) SetInput(ch chan types.Message) {
 	r.Input = ch
 }
 
@@ -216,10 +229,18 @@ func (r *Runner) GetName() string {
 	return "URLScan"
 }
 
-func (r *Runner) GetInput() chan interface{} {
+func (r *Runner) GetInput() chan types.Message {
 	return r.Input
 }
 
 func (r *Runner) CloseInput() {
 	close(r.Input)
 }
+
+func (r *Runner) Consumes() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp, types.KindAssetOtherBatch, types.KindAssetHttpBatch}
+}
+
+func (r *Runner) Produces() []types.Kind {
+	return []types.Kind{types.KindAssetOther, types.KindAssetHttp, types.KindAssetOtherBatch, types.KindAssetHttpBatch, types.KindUrl, types.KindUrlList}
+}
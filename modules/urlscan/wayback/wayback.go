@@ -8,7 +8,6 @@
 package wayback
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
@@ -123,7 +122,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.(types.AssetHttp)
 	if !ok {
 		//logger.SlogError(fmt.Sprintf("%v error: %v input is not AssetHttp\n", p.Name, input))
-		return nil, errors.New("input is not AssetHttp")
+		return nil, fmt.Errorf("%w: input is not AssetHttp", interfaces.ErrInputType)
 	}
 	p.Log(fmt.Sprintf("target %v running", data.URL))
 	waybackResults := make(chan source.Result, 100)
@@ -8,7 +8,6 @@
 package pagemonitoring
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
@@ -119,7 +118,7 @@ func (p *Plugin) GetParameter() string {
 func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.(types.UrlResult)
 	if !ok {
-		return nil, errors.New("input is not types.UrlResult")
+		return nil, fmt.Errorf("%w: input is not types.UrlResult", interfaces.ErrInputType)
 	}
 
 	parameter := p.GetParameter()
@@ -167,15 +166,16 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 		Hash:       []string{bodyHash},
 		Md5:        urlMd5,
 		TaskName:   p.TaskName,
+		TaskId:     p.TaskId,
 		Time:       utils.Tools.GetTimeNow(),
 		State:      1,
 	}
-	go results.Handler.PageMonitoringInsert(&pageMonit)
+	results.Handler.PageMonitoringInsert(&pageMonit)
 	pageMonitBody := types.PageMonitBody{
 		Md5:     urlMd5,
 		Content: []string{data.Body},
 	}
-	go results.Handler.PageMonitoringInsertBody(&pageMonitBody)
+	results.Handler.PageMonitoringInsertBody(&pageMonitBody)
 	return nil, nil
 }
 
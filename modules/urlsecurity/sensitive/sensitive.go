@@ -121,7 +121,7 @@ func (p *Plugin) GetParameter() string {
 func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.(types.UrlResult)
 	if !ok {
-		return nil, errors.New("input is not types.UrlResult")
+		return nil, fmt.Errorf("%w: input is not types.UrlResult", interfaces.ErrInputType)
 	}
 	if data.Status != 200 || data.Body == "" {
 		return nil, nil
@@ -167,16 +167,17 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 							Color:    rule.Color,
 							Md5:      respMd5,
 							TaskName: p.TaskName,
+							TaskId:   p.TaskId,
 							Status:   1,
 						}
-						go results.Handler.Sensitive(&tmpResult)
+						results.Handler.Sensitive(&tmpResult)
 						findFlag = true
 					}
 				}
 			}
 		}
 		if findFlag {
-			results.Handler.SensitiveBody(&data.Body, respMd5)
+			results.Handler.SensitiveBody(&data.Body, respMd5, p.TaskId)
 		}
 	}
 	//end = time.Now()
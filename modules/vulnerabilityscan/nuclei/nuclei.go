@@ -9,7 +9,6 @@ package nuclei
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
@@ -144,7 +143,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 		// 如果是http则限制为http的poc
 		tmplateFilters.ProtocolTypes = "http"
 	default:
-		return nil, errors.New("input is not AssetHttp, AssetOther")
+		return nil, fmt.Errorf("%w: input is not AssetHttp, AssetOther", interfaces.ErrInputType)
 	}
 	targets = utils.Tools.RemoveStringDuplicates(targets)
 	p.Log(fmt.Sprintf("target %v start", targets))
@@ -256,8 +255,9 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 			Response: event.Response,
 		}
 		tmpResult.TaskName = p.TaskName
+		tmpResult.TaskId = p.TaskId
 		tmpResult.Status = 1
-		go results.Handler.Vulnerability(&tmpResult)
+		results.Handler.Vulnerability(&tmpResult)
 	}
 
 	config.DefaultConfig.TemplatesDirectory = filepath.Join(global.PocDir)
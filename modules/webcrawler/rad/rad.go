@@ -10,12 +10,12 @@ package rad
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/contextmanager"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/global"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/interfaces"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/results"
+	"github.com/Autumn-27/ScopeSentry-Scan/internal/toolchain"
 	"github.com/Autumn-27/ScopeSentry-Scan/internal/types"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/logger"
 	"github.com/Autumn-27/ScopeSentry-Scan/pkg/utils"
@@ -150,27 +150,15 @@ func (p *Plugin) Install() error {
 		return err
 	}
 	RadExecPath := filepath.Join(radPath, p.RadFileName)
-	if _, err := os.Stat(RadExecPath); os.IsNotExist(err) {
-		_, err := utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://raw.githubusercontent.com/Autumn-27/ScopeSentry-Scan/main/tools", p.RadDir, p.RadFileName), RadExecPath)
-		if err != nil {
-			_, err = utils.Tools.HttpGetDownloadFile(fmt.Sprintf("%v/%v/%v", "https://gitee.com/constL/ScopeSentry-Scan/raw/main/tools", p.RadDir, p.RadFileName), RadExecPath)
-			if err != nil {
-				return err
-			}
-		}
-		if p.OsType == "linux" {
-			err = os.Chmod(RadExecPath, 0755)
-			if err != nil {
-				logger.SlogError(fmt.Sprintf("Chmod rad Tool Fail: %s", err))
-				return err
-			}
-		}
+	if err := toolchain.Ensure("rad", RadExecPath); err != nil {
+		logger.SlogError(fmt.Sprintf("Install rad Tool Fail: %s", err))
+		return err
 	}
 	return nil
 }
 
 func (p *Plugin) Check() error {
-	return nil
+	return toolchain.Verify("rad", filepath.Join(global.ExtDir, "rad", p.RadFileName))
 }
 
 func (p *Plugin) SetParameter(args string) {
@@ -185,7 +173,7 @@ func (p *Plugin) Execute(input interface{}) (interface{}, error) {
 	data, ok := input.([]string)
 	if !ok {
 		logger.SlogError(fmt.Sprintf("%v error: %v input is not []string\n", p.Name, input))
-		return nil, errors.New("input is not []string")
+		return nil, fmt.Errorf("%w: input is not []string", interfaces.ErrInputType)
 	}
 	start := time.Now()
 	var resultNumber int
@@ -110,6 +110,9 @@ func SlogDebugLocal(msg string) {
 }
 
 func SendLogToRedis(msg string) error {
+	if global.Standalone {
+		return nil
+	}
 	ctx := context.Background()
 	logMsg := logMessage{
 		Name: global.AppConfig.NodeName,
@@ -148,10 +151,15 @@ func PluginsLog(msg string, tp string, module string, id string) {
 
 	}
 	key := fmt.Sprintf("logs:plugins:%v:%v", module, id)
-	SendPluginLogToRedis(key, fmt.Sprintf("[%v] [%v] %v", global.AppConfig.NodeName, GetTimeNow(), msg))
+	line := fmt.Sprintf("[%v] [%v] %v", global.AppConfig.NodeName, GetTimeNow(), msg)
+	recordPluginLog(module, id, line)
+	SendPluginLogToRedis(key, line)
 }
 
 func SendPluginLogToRedis(key string, msg string) {
+	if global.Standalone {
+		return
+	}
 	ctx := context.Background()
 	_, err := redis.RedisClient.SAdd(ctx, key, msg)
 	if err != nil {
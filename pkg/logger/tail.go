@@ -0,0 +1,54 @@
+// logger-------------------------------------
+// @file      : tail.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/8 20:05
+// -------------------------------------------
+
+package logger
+
+import (
+	"sync"
+)
+
+// pluginTailSize 节点保留的最近插件日志行数
+const pluginTailSize = 1000
+
+type pluginLine struct {
+	module string
+	id     string
+	line   string
+}
+
+// pluginTail 最近的插件日志，redis 无法连接时可以通过节点的管理接口查看
+var pluginTail = struct {
+	mu    sync.Mutex
+	lines []pluginLine
+}{}
+
+func recordPluginLog(module string, id string, line string) {
+	pluginTail.mu.Lock()
+	defer pluginTail.mu.Unlock()
+	pluginTail.lines = append(pluginTail.lines, pluginLine{module: module, id: id, line: line})
+	if len(pluginTail.lines) > pluginTailSize*2 {
+		pluginTail.lines = append([]pluginLine(nil), pluginTail.lines[len(pluginTail.lines)-pluginTailSize:]...)
+	}
+}
+
+// PluginLogTail 最近的 n 行插件日志，module 和 id 为空时不过滤
+func PluginLogTail(module string, id string, n int) []string {
+	pluginTail.mu.Lock()
+	defer pluginTail.mu.Unlock()
+	lines := []string{}
+	for i := len(pluginTail.lines) - 1; i >= 0 && len(lines) < n; i-- {
+		l := pluginTail.lines[i]
+		if (module == "" || l.module == module) && (id == "" || l.id == id) {
+			lines = append(lines, l.line)
+		}
+	}
+	// 按时间顺序返回
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
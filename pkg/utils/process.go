@@ -0,0 +1,63 @@
+// utils-------------------------------------
+// @file      : process.go
+// @author    : Autumn
+// @contact   : rainy-autumn@outlook.com
+// @time      : 2025/2/4 19:26
+// -------------------------------------------
+
+package utils
+
+import (
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+type processRegistry struct {
+	mu    sync.Mutex
+	items map[*exec.Cmd]bool
+}
+
+// Processes 正在运行的外部程序（rustscan、katana、rad 等），节点退出时结束这些程序，防止成为孤儿进程
+var Processes = &processRegistry{
+	items: make(map[*exec.Cmd]bool),
+}
+
+// Track 外部程序启动后记录
+func (r *processRegistry) Track(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[cmd] = true
+}
+
+// Untrack 外部程序结束后删除记录
+func (r *processRegistry) Untrack(cmd *exec.Cmd) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, cmd)
+}
+
+// Counts 每个外部程序正在运行的进程数量
+func (r *processRegistry) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int)
+	for cmd := range r.items {
+		counts[filepath.Base(cmd.Path)] += 1
+	}
+	return counts
+}
+
+// KillAll 结束所有正在运行的外部程序，返回结束的数量
+func (r *processRegistry) KillAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for cmd := range r.items {
+		if cmd.Process != nil && cmd.Process.Kill() == nil {
+			count++
+		}
+		delete(r.items, cmd)
+	}
+	return count
+}
@@ -437,7 +437,12 @@ func (t *UtilTools) ExecuteCommandWithTimeout(command string, args []string, tim
 	cmd := exec.CommandContext(mergedCtx, command, args...)
 
 	// 执行命令，不获取输出
-	err := cmd.Run()
+	err := cmd.Start()
+	if err == nil {
+		Processes.Track(cmd)
+		err = cmd.Wait()
+		Processes.Untrack(cmd)
+	}
 	if err != nil {
 		// 如果是上下文取消的错误
 		if errors.Is(mergedCtx.Err(), context.Canceled) {
@@ -486,6 +491,8 @@ func (t *UtilTools) ExecuteCommandToChanWithTimeout(cmdName string, args []strin
 		logger.SlogWarnLocal(fmt.Sprintf("Error getting starting command: %v", err))
 		return
 	}
+	Processes.Track(cmd)
+	defer Processes.Untrack(cmd)
 	wg.Add(1)
 	// 使用 goroutine 读取命令的标准输出
 	go func() {
@@ -552,6 +559,8 @@ func (t *UtilTools) ExecuteCommandToChan(cmdName string, args []string, result c
 		close(result)
 		return
 	}
+	Processes.Track(cmd)
+	defer Processes.Untrack(cmd)
 
 	// 使用 bufio 读取命令的标准输出
 	scanner := bufio.NewScanner(stdout)
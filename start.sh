@@ -3,55 +3,29 @@
 # 进入工作目录
 cd /apps
 
-# 判断 UPDATE 文件是否存在
-if [ -f "/apps/UPDATE" ]; then
-    echo "UPDATE 文件存在，开始处理更新..."
-
-    # 备份现有的 ScopeSentry 可执行文件
-    if [ -f "/apps/ScopeSentry" ]; then
-        echo "备份现有的 ScopeSentry 文件..."
-        mv /apps/ScopeSentry /apps/ScopeSentry.bak || { echo "备份失败"; exit 1; }
-    fi
-
-    # 从 UPDATE 文件中读取 ZIP 文件的 URL
-    zip_url=$(cat /apps/UPDATE)
-
-    if [ -z "$zip_url" ]; then
-        echo "ERROR: UPDATE 文件中没有 URL 地址"
-        exit 1
-    fi
-
-    # 下载 ZIP 文件到 /tmp/main.zip
-    echo "从 $zip_url 下载 ZIP 文件..."
-    curl -o /tmp/main.zip "$zip_url" || { echo "ERROR: ZIP 文件下载失败"; mv /apps/ScopeSentry.bak /apps/ScopeSentry || exit 1; exit 1; }
-
-    # 解压 ZIP 文件到 /apps 目录
-    echo "解压 ZIP 文件到 /apps..."
-    unzip -o /tmp/main.zip -d /apps || { echo "ERROR: 解压失败"; mv /apps/ScopeSentry.bak /apps/ScopeSentry || exit 1; exit 1; }
-
-    # 清理临时文件
-    rm -f /tmp/main.zip
-
-    # 删除 UPDATE 文件
-    rm -f /apps/UPDATE
-else
-    echo "UPDATE 文件不存在，跳过更新，直接启动应用..."
+# 更新由 ScopeSentry 完成：校验更新包的签名和摘要，替换 /apps/ScopeSentry 并保留 /apps/ScopeSentry.bak，
+# 新版本在超时时间内注册成功后确认更新，否则自行回滚，更新状态保存在 /apps/update/state.json
+if [ ! -f "/apps/ScopeSentry" ] && [ -f "/apps/ScopeSentry.bak" ]; then
+    echo "ERROR: ScopeSentry 文件不存在，恢复备份..."
+    mv /apps/ScopeSentry.bak /apps/ScopeSentry
+fi
+if [ ! -f "/apps/ScopeSentry" ]; then
+    echo "ERROR: ScopeSentry 文件不存在，无法启动应用"
+    exit 1
 fi
 
-# 确保新的 ScopeSentry 文件存在并有执行权限
-if [ -f "/apps/ScopeSentry" ]; then
+chmod +x /apps/ScopeSentry
+echo "运行 ScopeSentry..."
+/apps/ScopeSentry
+code=$?
+
+# 新版本无法启动时不会运行到程序中的回滚逻辑，在这里恢复备份
+if [ $code -ne 0 ] && [ -f "/apps/ScopeSentry.bak" ] && grep -q '"status":"pending"' /apps/update/state.json 2>/dev/null; then
+    echo "ERROR: 新版本启动失败，恢复备份..."
+    mv /apps/ScopeSentry.bak /apps/ScopeSentry
+    sed -i 's/"status":"pending"/"status":"rolled_back"/' /apps/update/state.json
+    echo "{\"time\":\"$(date +%Y-%m-%dT%H:%M:%S%:z)\",\"status\":\"rolled_back\",\"reason\":\"new version exited with code $code\"}" >> /apps/update/history.log
     chmod +x /apps/ScopeSentry
-    # 运行新的 ScopeSentry 可执行文件
-    echo "运行新的 ScopeSentry..."
-    /apps/ScopeSentry
-else
-    echo "ERROR: ScopeSentry 文件不存在，恢复备份并启动..."
-    if [ -f "/apps/ScopeSentry.bak" ]; then
-        mv /apps/ScopeSentry.bak /apps/ScopeSentry
-        chmod +x /apps/ScopeSentry
-        /apps/ScopeSentry
-    else
-        echo "ERROR: 没有备份文件，无法启动应用"
-        exit 1
-    fi
+    exec /apps/ScopeSentry
 fi
+exit $code